@@ -0,0 +1,72 @@
+// Command arrstub serves a stub of the radarr and sonarr API, to run telarr offline.
+//
+//	go run ./cmd/arrstub -apikey stub
+//
+// Then set the radarr endpoint to http://localhost:7878, the sonarr one to http://localhost:8989
+// and both api keys to "stub" in the configuration of telarr.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"telarr/internal/arrstub"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	radarrAddr := flag.String("radarr", ":7878", "listen address of the radarr stub")
+	sonarrAddr := flag.String("sonarr", ":8989", "listen address of the sonarr stub")
+	apiKey := flag.String("apikey", "stub", "api key expected by the stubs")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "15:04:05"})
+
+	radarrStub, err := arrstub.NewRadarr(*apiKey)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error when loading the radarr fixtures")
+	}
+	sonarrStub, err := arrstub.NewSonarr(*apiKey)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error when loading the sonarr fixtures")
+	}
+
+	servers := []*http.Server{
+		{Addr: *radarrAddr, Handler: logRequests("radarr", radarrStub)},
+		{Addr: *sonarrAddr, Handler: logRequests("sonarr", sonarrStub)},
+	}
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Info().Str("addr", srv.Addr).Msg("stub listening")
+			err := srv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal().Err(err).Str("addr", srv.Addr).Msg("error when serving the stub")
+			}
+		}(srv)
+	}
+
+	// wait for the signal interrupt
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	<-c
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		srv.Shutdown(ctx)
+	}
+}
+
+// logRequests logs the requests received by the stub.
+func logRequests(app string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Info().Str("app", app).Str("method", r.Method).Str("path", r.URL.Path).Str("query", r.URL.RawQuery).Msg("request")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"telarr/configuration"
+	"telarr/internal/authentication"
+	"telarr/internal/invite"
+	"telarr/internal/radarr"
+	"telarr/internal/sonarr"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+const usage = `usage:
+  telarr                        run the bot
+  telarr config check [-probe]  check the configuration and print all its problems
+  telarr hash-password          print the hash of the password read from the terminal or stdin
+  telarr invite create [-role role] [-uses n] [-ttl duration]
+                                create an invite code and print it
+  telarr invite list            print the invite codes and the users who redeemed them
+`
+
+// runCommand runs the command given in the arguments and returns the exit code.
+// The logs are disabled, the commands print their results.
+func runCommand(args []string) int {
+	log.Logger = zerolog.Nop()
+
+	switch {
+	case len(args) >= 2 && args[0] == "config" && args[1] == "check":
+		return configCheck(args[2:])
+	case len(args) == 1 && args[0] == "hash-password":
+		return hashPassword()
+	case len(args) >= 2 && args[0] == "invite" && args[1] == "create":
+		return inviteCreate(args[2:])
+	case len(args) == 2 && args[0] == "invite" && args[1] == "list":
+		return inviteList()
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n%s", strings.Join(args, " "), usage)
+	return 2
+}
+
+// configCheck checks every field of the configuration, and probes the endpoints with -probe.
+// All the problems and the warnings are printed with their yaml path, the exit code is 1 if there is any problem.
+func configCheck(args []string) int {
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	probe := flags.Bool("probe", false, "contact each radarr and sonarr instance to check its endpoint and api key")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	fmt.Printf("checking %s\n", configuration.FilePath())
+	config, err := configuration.ReadConfiguration()
+	if err != nil {
+		fmt.Printf("the configuration can't be read: %v\n", err)
+		return 1
+	}
+
+	problems := config.Check()
+	if *probe {
+		problems = append(problems, probeInstances(config)...)
+	}
+
+	for _, warning := range config.Warnings() {
+		fmt.Printf("  warning: %s\n", warning)
+	}
+	if len(problems) == 0 {
+		fmt.Println("the configuration is valid")
+		return 0
+	}
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+	fmt.Printf("%d problem(s) found\n", len(problems))
+	return 1
+}
+
+// probeInstances requests the system status of every radarr and sonarr instance, at the same time.
+// The instances without endpoint or api key are skipped, Check already reports them.
+func probeInstances(config configuration.Configuration) configuration.Problems {
+	type pinger interface {
+		Ping() error
+	}
+
+	var paths []string
+	var services []pinger
+	for i, instance := range config.Radarr {
+		if instance.Endpoint != "" && instance.ApiKey != "" {
+			paths = append(paths, configuration.InstancePath("radarr", i, len(config.Radarr))+".endpoint")
+			services = append(services, radarr.New(instance))
+		}
+	}
+	for i, instance := range config.Sonarr {
+		if instance.Endpoint != "" && instance.ApiKey != "" {
+			paths = append(paths, configuration.InstancePath("sonarr", i, len(config.Sonarr))+".endpoint")
+			services = append(services, sonarr.New(instance))
+		}
+	}
+
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i := range services {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = services[i].Ping()
+		}(i)
+	}
+	wg.Wait()
+
+	var problems configuration.Problems
+	for i, err := range errs {
+		if err != nil {
+			problems = append(problems, configuration.Problem{Path: paths[i], Message: fmt.Sprintf("can't get the system status: %v", err)})
+		}
+	}
+	return problems
+}
+
+// hashPassword reads the password, twice from a terminal, and prints its bcrypt hash to put in telegram.passwd.
+func hashPassword() int {
+	var password string
+	stdin := int(os.Stdin.Fd())
+	if term.IsTerminal(stdin) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		bytes, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error when reading the password: %v\n", err)
+			return 1
+		}
+		fmt.Fprint(os.Stderr, "Confirm: ")
+		confirm, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error when reading the password: %v\n", err)
+			return 1
+		}
+		if string(bytes) != string(confirm) {
+			fmt.Fprintln(os.Stderr, "the passwords don't match")
+			return 1
+		}
+		password = string(bytes)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Fprintf(os.Stderr, "error when reading the password: %v\n", err)
+			return 1
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "the password is empty")
+		return 1
+	}
+	hash, err := authentication.HashPassword(password)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error when hashing the password: %v\n", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
+
+// inviteCreate creates an invite code with the role, the number of uses and the time to live of the flags, and prints it.
+func inviteCreate(args []string) int {
+	flags := flag.NewFlagSet("invite create", flag.ContinueOnError)
+	role := flags.String("role", "", "role of the users redeeming the code, the default role if empty")
+	uses := flags.Int("uses", 1, "number of times the code can be redeemed, unlimited until it expires if 0")
+	ttl := flags.Duration("ttl", invite.DefaultTtl, "time the code can be redeemed, never expires if 0")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	i := invite.Invite{MaxUses: *uses, CreatedBy: "command line"}
+	if *role != "" {
+		i.Role, err = authentication.ParseRole(*role)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+	}
+	if *uses < 0 || *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "the uses and the ttl must not be negative")
+		return 2
+	}
+	if *uses == 0 && *ttl == 0 {
+		fmt.Fprintln(os.Stderr, "the code must be single use or expire")
+		return 2
+	}
+	if *ttl > 0 {
+		i.ExpiresAt = time.Now().Add(*ttl)
+	}
+
+	store, _, err := openInvites()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error when opening the invite codes: %v\n", err)
+		return 1
+	}
+	i, err = store.Create(i)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error when creating the invite code: %v\n", err)
+		return 1
+	}
+	fmt.Println(i.Code)
+	fmt.Fprintf(os.Stderr, "send /start %s to the bot, or share https://t.me/<bot username>?start=%s\n", i.Code, i.Code)
+	return 0
+}
+
+// inviteList prints all the invite codes, with their status and the users who redeemed them.
+func inviteList() int {
+	store, config, err := openInvites()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error when opening the invite codes: %v\n", err)
+		return 1
+	}
+	list, err := store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error when reading the invite codes: %v\n", err)
+		return 1
+	}
+
+	for _, i := range list {
+		status := "usable"
+		if err := i.Check(); err != nil {
+			status = err.Error()
+		}
+		role := i.Role
+		if role == "" {
+			role = authentication.ConfiguredDefaultRole(config.Auth)
+		}
+		uses := strconv.Itoa(len(i.Redemptions)) + "/" + strconv.Itoa(i.MaxUses)
+		if i.MaxUses == 0 {
+			uses = strconv.Itoa(len(i.Redemptions)) + "/unlimited"
+		}
+		expires := "never"
+		if !i.ExpiresAt.IsZero() {
+			expires = i.ExpiresAt.Format(time.DateTime)
+		}
+		fmt.Printf("%s  role: %s  uses: %s  expires: %s  created by %s on %s  (%s)\n",
+			i.Code, role, uses, expires, i.CreatedBy, i.CreatedAt.Format(time.DateTime), status)
+		for _, r := range i.Redemptions {
+			fmt.Printf("    redeemed by %d @%s on %s\n", r.UserId, r.Username, r.RedeemedAt.Format(time.DateTime))
+		}
+	}
+	if len(list) == 0 {
+		fmt.Println("no invite code")
+	}
+	return 0
+}
+
+// openInvites opens the store of the invite codes of the configuration, and returns the configuration with it.
+func openInvites() (*invite.Store, configuration.Configuration, error) {
+	config, err := configuration.ReadConfiguration()
+	if err != nil {
+		return nil, config, err
+	}
+	store, err := invite.NewStore(invite.ConfiguredPath(config))
+	return store, config, err
+}
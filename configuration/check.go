@@ -0,0 +1,256 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Problem is an invalid field of the configuration.
+type Problem struct {
+	// Path is the yaml path of the field (e.g. "radarr[1].apiKey").
+	Path string
+	// Message describes what is wrong with the field.
+	Message string
+}
+
+func (p Problem) Error() string {
+	return p.Path + ": " + p.Message
+}
+
+// Problems is the list of the problems of a configuration.
+type Problems []Problem
+
+// Err returns the problems joined in a single error, nil if there is none.
+func (p Problems) Err() error {
+	errs := make([]error, len(p))
+	for i := range p {
+		errs[i] = p[i]
+	}
+	return errors.Join(errs...)
+}
+
+// Check validates every field of the configuration and returns all the problems found.
+// It does not contact the services, see the config check command to probe the endpoints.
+func (c Configuration) Check() Problems {
+	var problems Problems
+	add := func(path string, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// telegram
+	if isBlank(c.Telegram.Token) {
+		add("telegram.token", "is empty")
+	}
+	if strings.HasPrefix(c.Telegram.Passwd, "$2") {
+		if _, err := bcrypt.Cost([]byte(c.Telegram.Passwd)); err != nil {
+			add("telegram.passwd", "is not a valid bcrypt hash: %v", err)
+		}
+	}
+	if c.Telegram.Webhook.Enabled() {
+		webhook := c.Telegram.Webhook
+		if !strings.HasPrefix(webhook.Url, "https://") {
+			add("telegram.webhook.url", "must start with https://")
+		}
+		if isBlank(webhook.Listen) {
+			add("telegram.webhook.listen", "is empty")
+		}
+		if (webhook.CertFile == "") != (webhook.KeyFile == "") {
+			add("telegram.webhook", "certFile and keyFile must be set together")
+		}
+		if webhook.CertFile != "" {
+			if _, err := os.Stat(webhook.CertFile); err != nil {
+				add("telegram.webhook.certFile", "can't be read: %v", err)
+			}
+		}
+		if webhook.KeyFile != "" {
+			if _, err := os.Stat(webhook.KeyFile); err != nil {
+				add("telegram.webhook.keyFile", "can't be read: %v", err)
+			}
+		}
+	}
+
+	// instances
+	radarrNames := make([]string, len(c.Radarr))
+	for i, instance := range c.Radarr {
+		radarrNames[i] = instance.Name
+		problems = append(problems, checkInstance(InstancePath("radarr", i, len(c.Radarr)), instance.ApiKey, instance.Endpoint, instance.PublicUrl)...)
+	}
+	problems = append(problems, checkInstancesNames("radarr", radarrNames)...)
+	sonarrNames := make([]string, len(c.Sonarr))
+	for i, instance := range c.Sonarr {
+		sonarrNames[i] = instance.Name
+		problems = append(problems, checkInstance(InstancePath("sonarr", i, len(c.Sonarr)), instance.ApiKey, instance.Endpoint, instance.PublicUrl)...)
+	}
+	problems = append(problems, checkInstancesNames("sonarr", sonarrNames)...)
+
+	// wake on lan, disabled if the mac address and the ip are empty
+	if c.WakeOnLan.MacAddress != "" || c.WakeOnLan.IP != "" {
+		if c.WakeOnLan.MacAddress == "" {
+			add("wakeOnLan.mac", "is empty")
+		} else if _, err := net.ParseMAC(c.WakeOnLan.MacAddress); err != nil {
+			add("wakeOnLan.mac", "is not a valid mac address: %v", err)
+		}
+		if c.WakeOnLan.IP == "" {
+			add("wakeOnLan.ip", "is empty")
+		} else if _, _, err := net.SplitHostPort(c.WakeOnLan.IP); err != nil {
+			add("wakeOnLan.ip", "must be an address with a port (e.g. 192.168.1.255:9): %v", err)
+		}
+		if l := len(c.WakeOnLan.Password); l != 0 && l != 4 && l != 6 {
+			add("wakeOnLan.password", "must be 4 or 6 bytes long, got %d", l)
+		}
+	}
+
+	// session
+	if c.Session.Ttl < 0 {
+		add("session.ttl", "must not be negative")
+	}
+
+	// auth
+	if c.Auth.Backend != "" && c.Auth.Backend != AuthBackendJson && c.Auth.Backend != AuthBackendBolt {
+		add("auth.backend", "unknown backend %q, must be %q or %q", c.Auth.Backend, AuthBackendJson, AuthBackendBolt)
+	}
+	switch c.Auth.DefaultRole {
+	case "", "viewer", "requester", "manager":
+	default:
+		add("auth.defaultRole", "unknown role %q, must be \"viewer\", \"requester\" or \"manager\"", c.Auth.DefaultRole)
+	}
+
+	// invites
+	if c.Invites.Ttl < 0 {
+		add("invites.ttl", "must not be negative")
+	}
+
+	// lockout
+	if c.Lockout.MaxAttempts < 0 {
+		add("lockout.maxAttempts", "must not be negative")
+	}
+	if c.Lockout.Duration < 0 {
+		add("lockout.duration", "must not be negative")
+	}
+	if c.Lockout.MaxDuration < 0 {
+		add("lockout.maxDuration", "must not be negative")
+	}
+	if c.Lockout.BlacklistAfter < 0 {
+		add("lockout.blacklistAfter", "must not be negative")
+	}
+
+	if c.Quotas.Estimates.Movie < 0 {
+		add("quotas.estimates.movie", "must not be negative")
+	}
+	if c.Quotas.Estimates.Serie < 0 {
+		add("quotas.estimates.serie", "must not be negative")
+	}
+
+	// quotas, sorted to always report the problems in the same order
+	roles := make([]string, 0, len(c.Quotas.Roles))
+	for role := range c.Quotas.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		problems = append(problems, checkQuota("quotas.roles."+role, c.Quotas.Roles[role])...)
+	}
+	users := make([]int, 0, len(c.Quotas.Users))
+	for user := range c.Quotas.Users {
+		users = append(users, user)
+	}
+	sort.Ints(users)
+	for _, user := range users {
+		problems = append(problems, checkQuota(fmt.Sprintf("quotas.users.%d", user), c.Quotas.Users[user])...)
+	}
+
+	return problems
+}
+
+// Warnings returns the problems that don't stop the bot, as they can be solved while it runs (e.g. a disk mounted later).
+func (c Configuration) Warnings() Problems {
+	var warnings Problems
+
+	// disk usage, unavailable in the status until the path exists
+	if c.PathForDiskUsage != "" {
+		if _, err := os.Stat(c.PathForDiskUsage); err != nil {
+			warnings = append(warnings, Problem{Path: "pathForDiskUsage", Message: fmt.Sprintf("does not exist: %v", err)})
+		}
+	}
+
+	return warnings
+}
+
+// InstancePath returns the yaml path of an instance: "radarr" if it is the only one, "radarr[1]" otherwise.
+func InstancePath(service string, index int, count int) string {
+	if count == 1 {
+		return service
+	}
+	return fmt.Sprintf("%s[%d]", service, index)
+}
+
+// checkInstance checks the fields of a radarr or sonarr instance.
+func checkInstance(path string, apiKey string, endpoint string, publicUrl string) Problems {
+	var problems Problems
+	if isBlank(apiKey) {
+		problems = append(problems, Problem{Path: path + ".apiKey", Message: "is empty"})
+	}
+	if isBlank(endpoint) {
+		problems = append(problems, Problem{Path: path + ".endpoint", Message: "is empty"})
+	} else if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+		problems = append(problems, Problem{Path: path + ".endpoint", Message: fmt.Sprintf("%q is not a valid url", endpoint)})
+	}
+	if publicUrl != "" {
+		if u, err := url.Parse(publicUrl); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, Problem{Path: path + ".publicUrl", Message: fmt.Sprintf("%q is not a valid http(s) url", publicUrl)})
+		}
+	}
+	return problems
+}
+
+// checkInstancesNames checks that all the instances of the service have a name, and that the names are unique.
+func checkInstancesNames(service string, names []string) Problems {
+	var problems Problems
+	seen := make(map[string]bool)
+	for i, name := range names {
+		path := InstancePath(service, i, len(names)) + ".name"
+		if isBlank(name) {
+			problems = append(problems, Problem{Path: path, Message: fmt.Sprintf("is empty, %s instances must have a name", service)})
+			continue
+		}
+		if seen[name] {
+			problems = append(problems, Problem{Path: path, Message: fmt.Sprintf("%q is used twice", name)})
+		}
+		seen[name] = true
+	}
+	return problems
+}
+
+// checkQuota checks the limits of a quota.
+func checkQuota(path string, quota Quota) Problems {
+	var problems Problems
+	limits := []struct {
+		name  string
+		limit Limit
+	}{
+		{name: "movies", limit: quota.Movies},
+		{name: "series", limit: quota.Series},
+		{name: "size", limit: quota.Size},
+	}
+	for _, l := range limits {
+		if l.limit.Max < 0 {
+			problems = append(problems, Problem{Path: path + "." + l.name + ".max", Message: "must not be negative"})
+		}
+		if l.limit.Enabled() && l.limit.Period <= 0 {
+			problems = append(problems, Problem{Path: path + "." + l.name + ".period", Message: "must be set with max (e.g. \"168h\" for a week)"})
+		}
+	}
+	return problems
+}
+
+// isBlank returns true if the string is empty or only contains spaces.
+func isBlank(s string) bool {
+	return len(strings.Trim(s, string(' '))) == 0
+}
@@ -1,18 +1,79 @@
 telegram:
   token: "token" // token to interact with the telegram bot api
-  passwd: "password" // used to auth a new user of your bot
+  passwd: "$2a$10$..." // used to auth a new user of your bot, bcrypt hash given by `telarr hash-password` (or in clear)
+  webhook: // optional, receive the updates with a webhook instead of long polling
+    listen: ":8443" // local address of the webhook server
+    url: "https://telarr.example.com/telegram" // public url called by telegram (must be https)
+    secretToken: "" // token sent by telegram in each request (optional)
+    certFile: "" // tls certificate, if telarr serves https itself (optional)
+    keyFile: "" // tls private key (optional)
 
-radarr:
-  apiKey: ""
-  endpoint: "x.x.x.x:7878" // with or without http(s)://
+radarr: // a single instance, or a list of named instances
+  - name: "1080p" // name shown to the users (optional with a single instance)
+    apiKey: ""
+    endpoint: "x.x.x.x:7878" // with or without http(s)://
+    rootFolder: "/movies" // root folder to add the movies to (optional, selected by the user if there are several)
+    publicUrl: "https://radarr.example.com" // url of the web UI used in the links sent to the users (optional)
+  - name: "4K"
+    apiKey: ""
+    endpoint: "x.x.x.x:7879"
 
 sonarr:
   apiKey: ""
   endpoint: "x.x.x.x:8989"  // with or without http(s)://
+  rootFolder: "" // root folder to add the series to (optional, selected by the user if there are several)
+  publicUrl: "" // url of the web UI used in the links sent to the users (optional)
 
 pathForDiskUsage: "." // path to check disk usage
 
+session:
+  ttl: "1h" // time an unfinished conversation (search, add, remove) is kept
+  path: "/opt/telarr/session/sessions.json" // file to keep the conversations across restarts (optional, in memory if empty)
+
+auth:
+  backend: "json" // "json" for the authorizations files editable by hand, "bolt" for an embedded database (default "json")
+  path: "/opt/telarr/auth" // directory of the authorizations files or of the database (default "/opt/telarr/auth")
+  defaultRole: "requester" // role of the users and the groups authorized without a role: "viewer", "requester" or "manager" (default "requester")
+
+requests:
+  path: "/opt/telarr/requests/requests.json" // file to keep the requests waiting for the approval of an admin (optional)
+
+quotas:
+  path: "/opt/telarr/requests/quotas.json" // file to count the additions of the users (optional)
+  roles: // quotas of the users of each role, the roles without quota are unlimited (optional)
+    requester:
+      movies:
+        max: 5 // movies added in the period
+        period: "168h" // sliding period, up to a year
+      series:
+        max: 2
+        period: "720h"
+      size:
+        max: 200 // GB of the releases of the movies and series added
+        period: "720h"
+  users: // quotas of some users by id, replacing the one of their role (optional)
+    123456789:
+      movies:
+        max: 20
+        period: "168h"
+  estimates: // GB counted for a movie or a serie until it is downloaded and its size known (optional)
+    movie: 10 // default
+    serie: 50 // default
+
+invites:
+  path: "/opt/telarr/auth/invites.json" // file to keep the invite codes and who redeemed them (optional, default invites.json in auth.path)
+  ttl: "168h" // time the codes created from the bot can be redeemed (default "168h")
+
+audit:
+  path: "/opt/telarr/audit/audit.jsonl" // file the actions of the users are appended to (optional)
+
+lockout: // what happens to the users entering wrong passwords (optional)
+  maxAttempts: 3 // wrong passwords before a lockout (default 3)
+  duration: "15m" // first lockout, doubled at each new lockout of the user (default "15m")
+  maxDuration: "24h" // longest lockout (default "24h")
+  blacklistAfter: 0 // lockouts before the user is blacklisted for good, never if 0 (default 0)
+
 wakeOnLan:
   mac: "xx:xx:xx:xx:xx:xx" // mac address of the machine to wake up
-  ip: "x.x.x.x" // ip address of the machine to wake up
-  password: "password" // password to auth the wol request (optional)
+  ip: "x.x.x.255:9" // broadcast address and port the magic packet is sent to
+  password: "passwd" // password to auth the wol request (optional, 4 or 6 bytes)
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -20,10 +21,17 @@ const (
 )
 
 type Configuration struct {
-	Telegram  Telegram  `yaml:"telegram"`
-	Radarr    Radarr    `yaml:"radarr"`
-	Sonarr    Sonarr    `yaml:"sonarr"`
-	WakeOnLan WakeOnLan `yaml:"wakeOnLan"`
+	Telegram  Telegram          `yaml:"telegram"`
+	Radarr    Instances[Radarr] `yaml:"radarr"`
+	Sonarr    Instances[Sonarr] `yaml:"sonarr"`
+	WakeOnLan WakeOnLan         `yaml:"wakeOnLan"`
+	Session   Session           `yaml:"session"`
+	Auth      Auth              `yaml:"auth"`
+	Requests  Requests          `yaml:"requests"`
+	Quotas    Quotas            `yaml:"quotas"`
+	Lockout   Lockout           `yaml:"lockout"`
+	Invites   Invites           `yaml:"invites"`
+	Audit     Audit             `yaml:"audit"`
 
 	PathForDiskUsage string `yaml:"pathForDiskUsage"`
 }
@@ -32,16 +40,74 @@ type Telegram struct {
 	// Token token to use with the telegram API
 	Token  string `yaml:"token"`
 	Passwd string `yaml:"passwd"`
+
+	// Webhook is used to receive the updates with a webhook instead of long polling.
+	Webhook Webhook `yaml:"webhook"`
+}
+
+type Webhook struct {
+	// Listen is the local address the webhook server listens on (e.g. ":8443").
+	Listen string `yaml:"listen"`
+	// Url is the public url (https) telegram sends the updates to.
+	Url string `yaml:"url"`
+	// SecretToken is the token telegram sends in each request to authenticate itself (optional).
+	SecretToken string `yaml:"secretToken"`
+
+	// CertFile is the path to the TLS certificate, when telarr serves the webhook in https itself (optional).
+	CertFile string `yaml:"certFile"`
+	// KeyFile is the path to the TLS private key (optional).
+	KeyFile string `yaml:"keyFile"`
+}
+
+// Enabled returns true if the updates must be received with a webhook.
+func (w Webhook) Enabled() bool {
+	return w.Url != ""
 }
 
 type Radarr struct {
+	// Name is the name of the instance shown to the users (e.g. "4K"), required with several instances.
+	Name     string `yaml:"name"`
 	ApiKey   string `yaml:"apiKey"`
 	Endpoint string `yaml:"endpoint"`
+	// RootFolder is the root folder the movies are added to. If empty, the user selects it when the instance has several.
+	RootFolder string `yaml:"rootFolder"`
+	// PublicUrl is the url of the web UI reachable by the users, used to link the movies (optional).
+	PublicUrl string `yaml:"publicUrl"`
 }
 
 type Sonarr struct {
+	// Name is the name of the instance shown to the users (e.g. "Anime"), required with several instances.
+	Name     string `yaml:"name"`
 	ApiKey   string `yaml:"apiKey"`
 	Endpoint string `yaml:"endpoint"`
+	// RootFolder is the root folder the series are added to. If empty, the user selects it when the instance has several.
+	RootFolder string `yaml:"rootFolder"`
+	// PublicUrl is the url of the web UI reachable by the users, used to link the series (optional).
+	PublicUrl string `yaml:"publicUrl"`
+}
+
+// Instances is the list of the instances of a service.
+// A single instance can be written as a mapping instead of a list.
+type Instances[T any] []T
+
+func (i *Instances[T]) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var instance T
+		err := value.Decode(&instance)
+		if err != nil {
+			return err
+		}
+		*i = Instances[T]{instance}
+		return nil
+	}
+
+	var instances []T
+	err := value.Decode(&instances)
+	if err != nil {
+		return err
+	}
+	*i = instances
+	return nil
 }
 
 type WakeOnLan struct {
@@ -50,9 +116,122 @@ type WakeOnLan struct {
 	Password   string `yaml:"password"`
 }
 
-// GetConfiguration returns the configuration
+type Session struct {
+	// Ttl is the time a conversation is kept without activity (e.g. "30m").
+	Ttl time.Duration `yaml:"ttl"`
+	// Path is the file where the conversations are saved to survive a restart, kept in memory only if empty.
+	Path string `yaml:"path"`
+}
+
+const (
+	// AuthBackendJson keeps the users lists in the authorizations files, editable by hand.
+	AuthBackendJson = "json"
+	// AuthBackendBolt keeps the users lists in an embedded database.
+	AuthBackendBolt = "bolt"
+)
+
+// Auth is where the users lists and the wrong passwords attempts are saved.
+type Auth struct {
+	// Backend is AuthBackendJson (default) or AuthBackendBolt.
+	Backend string `yaml:"backend"`
+	// Path is the directory of the authorizations files, or of the database (default "/opt/telarr/auth").
+	Path string `yaml:"path"`
+	// DefaultRole is the role of the users and the group chats autorized without a role: "viewer", "requester" (default) or "manager".
+	DefaultRole string `yaml:"defaultRole"`
+}
+
+type Requests struct {
+	// Path is the file where the requests waiting for the approval of an admin are saved (default "/opt/telarr/requests/requests.json").
+	Path string `yaml:"path"`
+}
+
+type Quotas struct {
+	// Path is the file where the additions of the users are counted (default "/opt/telarr/requests/quotas.json").
+	Path string `yaml:"path"`
+	// Roles are the quotas of the users of each role (e.g. "requester"), the roles without quota are unlimited.
+	Roles map[string]Quota `yaml:"roles"`
+	// Users are the quotas of some users by id, replacing the one of their role.
+	Users map[int]Quota `yaml:"users"`
+	// Estimates are the sizes counted in the size quotas for the medias not downloaded yet.
+	Estimates Estimates `yaml:"estimates"`
+}
+
+// Quota is the maximum a user can add in a period, the admins have no quota.
+type Quota struct {
+	Movies Limit `yaml:"movies"`
+	Series Limit `yaml:"series"`
+	// Size is the budget in GB of the movies and series added, from the size of their releases on disk,
+	// or from their estimated size until they are downloaded.
+	Size Limit `yaml:"size"`
+}
+
+// Estimates are the sizes in GB counted for a movie or a serie added, until its size on disk is known.
+type Estimates struct {
+	// Movie is the estimated size of a movie (default 10).
+	Movie float64 `yaml:"movie"`
+	// Serie is the estimated size of a serie (default 50).
+	Serie float64 `yaml:"serie"`
+}
+
+// Limit is a maximum in a sliding period (e.g. 5 movies in "168h"), unlimited if Max is 0.
+type Limit struct {
+	Max    float64       `yaml:"max"`
+	Period time.Duration `yaml:"period"`
+}
+
+// Enabled returns true if the limit applies.
+func (l Limit) Enabled() bool {
+	return l.Max > 0
+}
+
+// Invites are the settings of the invite codes.
+type Invites struct {
+	// Path is the file where the invite codes are saved (default "invites.json" in the directory of Auth).
+	Path string `yaml:"path"`
+	// Ttl is the time the codes created from the bot can be redeemed (default "168h").
+	Ttl time.Duration `yaml:"ttl"`
+}
+
+// Audit is where the actions of the users are recorded.
+type Audit struct {
+	// Path is the json lines file the actions are appended to (default "/opt/telarr/audit/audit.jsonl").
+	Path string `yaml:"path"`
+}
+
+// Lockout is the policy applied to the users entering wrong passwords.
+type Lockout struct {
+	// MaxAttempts is the number of wrong passwords before the user is locked out (default 3).
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Duration is the time of the first lockout, doubled at each new lockout of the user (default "15m").
+	Duration time.Duration `yaml:"duration"`
+	// MaxDuration is the longest time a user is locked out (default "24h").
+	MaxDuration time.Duration `yaml:"maxDuration"`
+	// BlacklistAfter is the number of lockouts after which the user is blacklisted for good, never if 0.
+	BlacklistAfter int `yaml:"blacklistAfter"`
+}
+
+// GetConfiguration returns the configuration, or all its problems as a single error.
+// The warnings are logged, they don't stop the bot.
 func GetConfiguration() (Configuration, error) {
-	filePath := path.Join(getConfigPath(), configFileName)
+	config, err := ReadConfiguration()
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	problems := config.Check()
+	if len(problems) > 0 {
+		return Configuration{}, problems.Err()
+	}
+	for _, warning := range config.Warnings() {
+		log.Warn().Str("path", warning.Path).Msg(warning.Message)
+	}
+
+	return config, nil
+}
+
+// ReadConfiguration reads and parses the configuration file, overridden by the environment variables, without checking it.
+func ReadConfiguration() (Configuration, error) {
+	filePath := FilePath()
 
 	// open the configuration file
 	log.Trace().Str("filePath", filePath).Msg("oppening configuration file")
@@ -73,22 +252,42 @@ func GetConfiguration() (Configuration, error) {
 		return Configuration{}, err
 	}
 
-	// TelegramToken must not be empty
-	if len(strings.Trim(config.Telegram.Token, string(' '))) == 0 {
-		return Configuration{}, fmt.Errorf("TelegramToken is empty")
+	// override the fields with the environment variables
+	err = applyEnv(&config)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	// a single instance does not need a name
+	if len(config.Radarr) == 1 && config.Radarr[0].Name == "" {
+		config.Radarr[0].Name = "Radarr"
+	}
+	if len(config.Sonarr) == 1 && config.Sonarr[0].Name == "" {
+		config.Sonarr[0].Name = "Sonarr"
 	}
 
 	// check if the endpoints contain http or https
-	if !strings.HasPrefix(config.Radarr.Endpoint, "http") {
-		config.Radarr.Endpoint = "http://" + config.Radarr.Endpoint
+	for i := range config.Radarr {
+		if config.Radarr[i].Endpoint != "" && !strings.HasPrefix(config.Radarr[i].Endpoint, "http") {
+			config.Radarr[i].Endpoint = "http://" + config.Radarr[i].Endpoint
+		}
+		config.Radarr[i].PublicUrl = strings.TrimSuffix(config.Radarr[i].PublicUrl, "/")
 	}
-	if !strings.HasPrefix(config.Sonarr.Endpoint, "http") {
-		config.Sonarr.Endpoint = "http://" + config.Sonarr.Endpoint
+	for i := range config.Sonarr {
+		if config.Sonarr[i].Endpoint != "" && !strings.HasPrefix(config.Sonarr[i].Endpoint, "http") {
+			config.Sonarr[i].Endpoint = "http://" + config.Sonarr[i].Endpoint
+		}
+		config.Sonarr[i].PublicUrl = strings.TrimSuffix(config.Sonarr[i].PublicUrl, "/")
 	}
 
 	return config, nil
 }
 
+// FilePath returns the path to the configuration file
+func FilePath() string {
+	return path.Join(getConfigPath(), configFileName)
+}
+
 // getConfigPath returns the path to the configuration file
 func getConfigPath() string {
 	configPath := os.Getenv(configEnv)
@@ -5,6 +5,7 @@ import (
 	"path"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGetConfiguration(t *testing.T) {
@@ -51,14 +52,16 @@ sonarr:
 					Token:  "token",
 					Passwd: "passwd",
 				},
-				Radarr: Radarr{
+				Radarr: Instances[Radarr]{{
+					Name:     "Radarr",
 					ApiKey:   "apiKeyR",
 					Endpoint: "http://endpointR",
-				},
-				Sonarr: Sonarr{
+				}},
+				Sonarr: Instances[Sonarr]{{
+					Name:     "Sonarr",
 					ApiKey:  "apiKeyS",
 					Endpoint: "http://endpointS",
-				},
+				}},
 			},
 			wantErr: false,
 		},
@@ -75,25 +78,158 @@ sonarr:
     apiKey: "apiKeyS"
     endpoint: "https://endpointS"
 
-pathForDiskUsage: "/mnt"
+pathForDiskUsage: "."
 `,
 			want: Configuration{
 				Telegram: Telegram{
 					Token:  "token",
 					Passwd: "passwd",
 				},
-				Radarr: Radarr{
+				Radarr: Instances[Radarr]{{
+					Name:     "Radarr",
 					ApiKey:   "apiKeyR",
 					Endpoint: "https://endpointR",
-				},
-				Sonarr: Sonarr{
+				}},
+				Sonarr: Instances[Sonarr]{{
+					Name:     "Sonarr",
 					ApiKey:  "apiKeyS",
 					Endpoint: "https://endpointS",
+				}},
+				PathForDiskUsage: ".",
+			},
+			wantErr: false,
+		},
+		{
+			name: "webhook without https",
+			fileContent: `
+telegram:
+    token: "token"
+    webhook:
+        listen: ":8443"
+        url: "http://telarr.example.com/telegram"
+`,
+			want:    Configuration{},
+			wantErr: true,
+		},
+		{
+			name: "webhook without listen address",
+			fileContent: `
+telegram:
+    token: "token"
+    webhook:
+        url: "https://telarr.example.com/telegram"
+`,
+			want:    Configuration{},
+			wantErr: true,
+		},
+		{
+			name: "ok with webhook",
+			fileContent: `
+telegram:
+    token: "token"
+    passwd: "passwd"
+    webhook:
+        listen: ":8443"
+        url: "https://telarr.example.com/telegram"
+        secretToken: "secret"
+radarr:
+    apiKey: "apiKeyR"
+    endpoint: "endpointR"
+sonarr:
+    apiKey: "apiKeyS"
+    endpoint: "endpointS"
+`,
+			want: Configuration{
+				Telegram: Telegram{
+					Token:  "token",
+					Passwd: "passwd",
+					Webhook: Webhook{
+					Listen:      ":8443",
+					Url:         "https://telarr.example.com/telegram",
+					SecretToken: "secret",
+					},
+				},
+				Radarr: Instances[Radarr]{{
+					Name:     "Radarr",
+					ApiKey:   "apiKeyR",
+					Endpoint: "http://endpointR",
+				}},
+				Sonarr: Instances[Sonarr]{{
+					Name:     "Sonarr",
+					ApiKey:   "apiKeyS",
+					Endpoint: "http://endpointS",
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "ok with several instances",
+			fileContent: `
+telegram:
+    token: "token"
+radarr:
+    - name: "1080p"
+      apiKey: "apiKeyR"
+      endpoint: "endpointR"
+    - name: "4K"
+      apiKey: "apiKeyR4K"
+      endpoint: "https://endpointR4K"
+sonarr:
+    - name: "Anime"
+      apiKey: "apiKeyS"
+      endpoint: "endpointS"
+`,
+			want: Configuration{
+				Telegram: Telegram{
+					Token: "token",
+				},
+				Radarr: Instances[Radarr]{
+					{
+						Name:     "1080p",
+						ApiKey:   "apiKeyR",
+						Endpoint: "http://endpointR",
+					},
+					{
+						Name:     "4K",
+						ApiKey:   "apiKeyR4K",
+						Endpoint: "https://endpointR4K",
+					},
 				},
-				PathForDiskUsage: "/mnt",
+				Sonarr: Instances[Sonarr]{{
+					Name:     "Anime",
+					ApiKey:   "apiKeyS",
+					Endpoint: "http://endpointS",
+				}},
 			},
 			wantErr: false,
 		},
+		{
+			name: "instance without name",
+			fileContent: `
+telegram:
+    token: "token"
+radarr:
+    - name: "1080p"
+      endpoint: "endpointR"
+    - endpoint: "endpointR4K"
+`,
+			want:    Configuration{},
+			wantErr: true,
+		},
+		{
+			name: "instance name used twice",
+			fileContent: `
+telegram:
+    token: "token"
+sonarr:
+    - name: "Sonarr"
+      endpoint: "endpointS"
+    - name: "Sonarr"
+      endpoint: "endpointS2"
+`,
+			want:    Configuration{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -115,3 +251,279 @@ pathForDiskUsage: "/mnt"
 		})
 	}
 }
+
+func TestConfiguration_Check(t *testing.T) {
+	valid := Configuration{
+		Telegram: Telegram{Token: "token"},
+		Radarr:   Instances[Radarr]{{Name: "Radarr", ApiKey: "apiKeyR", Endpoint: "http://endpointR"}},
+		Sonarr:   Instances[Sonarr]{{Name: "Sonarr", ApiKey: "apiKeyS", Endpoint: "http://endpointS"}},
+		WakeOnLan: WakeOnLan{
+			MacAddress: "01:23:45:67:89:ab",
+			IP:         "192.168.1.255:9",
+		},
+		PathForDiskUsage: ".",
+	}
+
+	tests := []struct {
+		name      string
+		edit      func(c *Configuration)
+		wantPaths []string
+	}{
+		{
+			name:      "ok",
+			edit:      func(c *Configuration) {},
+			wantPaths: nil,
+		},
+		{
+			name: "ok without wake on lan",
+			edit: func(c *Configuration) {
+				c.WakeOnLan = WakeOnLan{}
+			},
+			wantPaths: nil,
+		},
+		{
+			name: "bad mac address",
+			edit: func(c *Configuration) {
+				c.WakeOnLan.MacAddress = "01:23:45"
+			},
+			wantPaths: []string{"wakeOnLan.mac"},
+		},
+		{
+			name: "wake on lan ip without port",
+			edit: func(c *Configuration) {
+				c.WakeOnLan.IP = "192.168.1.255"
+			},
+			wantPaths: []string{"wakeOnLan.ip"},
+		},
+		{
+			name: "invalid password hash",
+			edit: func(c *Configuration) {
+				c.Telegram.Passwd = "$2a$10$tooShort"
+			},
+			wantPaths: []string{"telegram.passwd"},
+		},
+		{
+			name: "quotas",
+			edit: func(c *Configuration) {
+				c.Quotas = Quotas{
+					Roles: map[string]Quota{
+						"requester": {Movies: Limit{Max: 5, Period: 168 * time.Hour}, Size: Limit{Max: 100}},
+						"manager":   {Series: Limit{Max: -1}},
+					},
+					Users: map[int]Quota{42: {Movies: Limit{Max: 10, Period: 24 * time.Hour}}},
+				}
+			},
+			wantPaths: []string{"quotas.roles.manager.series.max", "quotas.roles.requester.size.period"},
+		},
+		{
+			name: "negative lockout and invites ttl",
+			edit: func(c *Configuration) {
+				c.Lockout = Lockout{MaxAttempts: 5, Duration: -time.Minute, BlacklistAfter: -1}
+				c.Invites.Ttl = -time.Hour
+			},
+			wantPaths: []string{"invites.ttl", "lockout.duration", "lockout.blacklistAfter"},
+		},
+		{
+			name: "unknown auth backend",
+			edit: func(c *Configuration) {
+				c.Auth.Backend = "sqlite"
+			},
+			wantPaths: []string{"auth.backend"},
+		},
+		{
+			name: "admin default role",
+			edit: func(c *Configuration) {
+				c.Auth.DefaultRole = "admin"
+			},
+			wantPaths: []string{"auth.defaultRole"},
+		},
+		{
+			name: "all the problems at once",
+			edit: func(c *Configuration) {
+				c.Telegram.Token = ""
+				c.Radarr = append(c.Radarr, Radarr{Name: "Radarr", Endpoint: "http://endpointR4K", PublicUrl: "endpointR4K"})
+				c.Sonarr[0].Endpoint = ""
+				c.Session.Ttl = -1
+			},
+			wantPaths: []string{"telegram.token", "radarr[1].apiKey", "radarr[1].publicUrl", "radarr[1].name", "sonarr.endpoint", "session.ttl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			config.Radarr = append(Instances[Radarr]{}, valid.Radarr...)
+			config.Sonarr = append(Instances[Sonarr]{}, valid.Sonarr...)
+			tt.edit(&config)
+
+			var gotPaths []string
+			for _, problem := range config.Check() {
+				gotPaths = append(gotPaths, problem.Path)
+			}
+			if !reflect.DeepEqual(gotPaths, tt.wantPaths) {
+				t.Errorf("Configuration.Check() paths = %v, want %v", gotPaths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestConfiguration_Warnings(t *testing.T) {
+	// a missing path for the disk usage is a warning, not a problem stopping the bot
+	config := Configuration{PathForDiskUsage: path.Join(t.TempDir(), "missing")}
+
+	var gotPaths []string
+	for _, warning := range config.Warnings() {
+		gotPaths = append(gotPaths, warning.Path)
+	}
+	if want := []string{"pathForDiskUsage"}; !reflect.DeepEqual(gotPaths, want) {
+		t.Errorf("Configuration.Warnings() paths = %v, want %v", gotPaths, want)
+	}
+	for _, problem := range config.Check() {
+		if problem.Path == "pathForDiskUsage" {
+			t.Errorf("Configuration.Check() reports %v", problem)
+		}
+	}
+
+	config.PathForDiskUsage = "."
+	if warnings := config.Warnings(); len(warnings) != 0 {
+		t.Errorf("Configuration.Warnings() = %v, want none", warnings)
+	}
+}
+
+func TestGetConfiguration_Env(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv(configEnv, tmpDir)
+
+	// docker secret style files
+	secretPath := path.Join(tmpDir, "secret")
+	err := os.WriteFile(secretPath, []byte("apiKeyFromFile\n"), 0600)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	fileContent := `
+telegram:
+    token: "token"
+radarr:
+    apiKey: "apiKeyR"
+    endpoint: "endpointR"
+`
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Configuration
+		wantErr bool
+	}{
+		{
+			name: "no variable",
+			env:  map[string]string{},
+			want: Configuration{
+				Telegram: Telegram{Token: "token"},
+				Radarr:   Instances[Radarr]{{Name: "Radarr", ApiKey: "apiKeyR", Endpoint: "http://endpointR"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "variables override the file",
+			env: map[string]string{
+				"TELARR_TELEGRAM_TOKEN": "tokenFromEnv",
+				"TELARR_RADARR_APIKEY":  "apiKeyFromEnv",
+				"TELARR_SESSION_TTL":    "30m",
+				"TELARR_WAKEONLAN_MAC":  "01:23:45:67:89:ab",
+			},
+			want: Configuration{
+				Telegram:  Telegram{Token: "tokenFromEnv"},
+				Radarr:    Instances[Radarr]{{Name: "Radarr", ApiKey: "apiKeyFromEnv", Endpoint: "http://endpointR"}},
+				Session:   Session{Ttl: 30 * time.Minute},
+				WakeOnLan: WakeOnLan{MacAddress: "01:23:45:67:89:ab", IP: "192.168.1.255:9"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "file variable",
+			env: map[string]string{
+				"TELARR_RADARR_APIKEY_FILE": secretPath,
+			},
+			want: Configuration{
+				Telegram: Telegram{Token: "token"},
+				Radarr:   Instances[Radarr]{{Name: "Radarr", ApiKey: "apiKeyFromFile", Endpoint: "http://endpointR"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "variable before file variable",
+			env: map[string]string{
+				"TELARR_RADARR_APIKEY":      "apiKeyFromEnv",
+				"TELARR_RADARR_APIKEY_FILE": secretPath,
+			},
+			want: Configuration{
+				Telegram: Telegram{Token: "token"},
+				Radarr:   Instances[Radarr]{{Name: "Radarr", ApiKey: "apiKeyFromEnv", Endpoint: "http://endpointR"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "indexed variables add an instance",
+			env: map[string]string{
+				"TELARR_RADARR_0_NAME":      "1080p",
+				"TELARR_RADARR_1_NAME":      "4K",
+				"TELARR_RADARR_1_APIKEY":    "apiKeyR4K",
+				"TELARR_RADARR_1_ENDPOINT":  "endpointR4K",
+				"TELARR_SONARR_APIKEY_FILE": secretPath,
+				"TELARR_SONARR_ENDPOINT":    "endpointS",
+			},
+			want: Configuration{
+				Telegram: Telegram{Token: "token"},
+				Radarr: Instances[Radarr]{
+					{Name: "1080p", ApiKey: "apiKeyR", Endpoint: "http://endpointR"},
+					{Name: "4K", ApiKey: "apiKeyR4K", Endpoint: "http://endpointR4K"},
+				},
+				Sonarr: Instances[Sonarr]{{Name: "Sonarr", ApiKey: "apiKeyFromFile", Endpoint: "http://endpointS"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid duration",
+			env: map[string]string{
+				"TELARR_SESSION_TTL": "one hour",
+			},
+			want:    Configuration{},
+			wantErr: true,
+		},
+		{
+			name: "missing file",
+			env: map[string]string{
+				"TELARR_TELEGRAM_TOKEN_FILE": path.Join(tmpDir, "missing"),
+			},
+			want:    Configuration{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// write the file
+			filePath := path.Join(getConfigPath(), configFileName)
+			content := fileContent
+			if _, found := tt.env["TELARR_WAKEONLAN_MAC"]; found {
+				content += "wakeOnLan:\n    ip: \"192.168.1.255:9\"\n"
+			}
+			err := os.WriteFile(filePath, []byte(content), 0644)
+			if err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			got, err := GetConfiguration()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetConfiguration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
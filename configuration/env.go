@@ -0,0 +1,140 @@
+package configuration
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables overriding the configuration
+	envPrefix = "TELARR"
+	// envFileSuffix is the suffix of the variables holding the path to a file containing the value (e.g. a docker secret)
+	envFileSuffix = "_FILE"
+)
+
+// applyEnv overrides the fields of the configuration with the environment variables.
+//
+// The name of a variable is TELARR followed by the yaml path of the field, in upper case and separated by "_"
+// (e.g. TELARR_TELEGRAM_TOKEN, TELARR_WAKEONLAN_MAC). The instances are selected with their index
+// (TELARR_RADARR_1_APIKEY), TELARR_RADARR_APIKEY being the same as TELARR_RADARR_0_APIKEY.
+// Setting a variable of an instance that is not in the file adds it.
+//
+// Each variable can be replaced by the same name suffixed with _FILE, holding the path to a file containing the value.
+// The precedence is: the variable, then the _FILE variable, then the yaml file.
+func applyEnv(config *Configuration) error {
+	return applyEnvStruct(reflect.ValueOf(config).Elem(), envPrefix)
+}
+
+// applyEnvStruct overrides the fields of the struct v, prefix is the name of the variable of v.
+func applyEnvStruct(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		envName := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+
+		var err error
+		switch {
+		case field.Kind() == reflect.Struct:
+			err = applyEnvStruct(field, envName)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			err = applyEnvInstances(field, envName)
+		default:
+			err = applyEnvValue(field, envName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnvInstances overrides the instances of the slice v, adding the ones only set in the environment.
+func applyEnvInstances(v reflect.Value, prefix string) error {
+	// find the highest index set in the environment
+	count := v.Len()
+	indexRegexp := regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + `_(\d+)_`)
+	for _, env := range os.Environ() {
+		match := indexRegexp.FindStringSubmatch(env)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[1])
+		if err != nil {
+			return fmt.Errorf("%s: invalid instance index: %w", strings.TrimSuffix(match[0], "_"), err)
+		}
+		count = max(count, index+1)
+	}
+
+	// the variables without index are the ones of the first instance
+	first := reflect.New(v.Type().Elem()).Elem()
+	if v.Len() > 0 {
+		first.Set(v.Index(0))
+	}
+	err := applyEnvStruct(first, prefix)
+	if err != nil {
+		return err
+	}
+	if v.Len() == 0 && !first.IsZero() {
+		count = max(count, 1)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	instances := reflect.MakeSlice(v.Type(), count, count)
+	reflect.Copy(instances, v)
+	instances.Index(0).Set(first)
+	for i := 0; i < count; i++ {
+		err := applyEnvStruct(instances.Index(i), prefix+"_"+strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+	}
+	v.Set(instances)
+	return nil
+}
+
+// applyEnvValue sets v from the variable, or from the file of the _FILE variable.
+// The strings are taken as is, the other types are parsed as yaml (e.g. "30m" for a duration).
+func applyEnvValue(v reflect.Value, envName string) error {
+	value, found, err := lookupEnv(envName)
+	if err != nil || !found {
+		return err
+	}
+
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	err = yaml.Unmarshal([]byte(value), v.Addr().Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %w", envName, err)
+	}
+	return nil
+}
+
+// lookupEnv returns the value of the variable, or the content of the file of the _FILE variable without the trailing new line.
+func lookupEnv(envName string) (string, bool, error) {
+	if value, found := os.LookupEnv(envName); found {
+		return value, true, nil
+	}
+
+	filePath, found := os.LookupEnv(envName + envFileSuffix)
+	if !found {
+		return "", false, nil
+	}
+	bytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", envName+envFileSuffix, err)
+	}
+	return strings.TrimRight(string(bytes), "\r\n"), true, nil
+}
@@ -2,7 +2,12 @@ module telarr
 
 go 1.21.6
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	go.etcd.io/bbolt v1.3.8
+	golang.org/x/crypto v0.18.0
+	golang.org/x/term v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
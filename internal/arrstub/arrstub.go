@@ -0,0 +1,94 @@
+// Package arrstub is a stub of the subset of the radarr and sonarr v3 API used by telarr.
+// It serves a fixed library of movies and series, so the bot can be run and tested offline.
+package arrstub
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// apiPrefix is the prefix of all the v3 API paths.
+	apiPrefix = "/api/v3/"
+	// apiKeyHeader is the header holding the api key.
+	apiKeyHeader = "X-Api-Key"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// loadFixture decodes the fixture file of the app into v.
+func loadFixture(app string, name string, v any) error {
+	data, err := fixtures.ReadFile(path.Join("fixtures", app, name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// route returns the API path of the request, lower case and without the "/api/v3/" prefix.
+// Return false if the api key is wrong or the path is not an API path, the error is already written.
+func route(w http.ResponseWriter, r *http.Request, apiKey string) (string, bool) {
+	if r.Header.Get(apiKeyHeader) != apiKey && r.URL.Query().Get("apikey") != apiKey {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return "", false
+	}
+
+	p, found := strings.CutPrefix(strings.ToLower(r.URL.Path), apiPrefix)
+	if !found {
+		writeError(w, http.StatusNotFound, "NotFound")
+		return "", false
+	}
+	return strings.TrimSuffix(p, "/"), true
+}
+
+// idFromPath returns the id at the end of the path ("movie/12" returns 12).
+// Return false if the path is not the resource followed by an id.
+func idFromPath(p string, resource string) (int64, bool) {
+	idStr, found := strings.CutPrefix(p, resource+"/")
+	if !found {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON writes v as the json body of the response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error the way the *arr apps do.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+// writeValidationError writes a validation error of a property the way the *arr apps do.
+func writeValidationError(w http.ResponseWriter, property string, message string) {
+	writeJSON(w, http.StatusBadRequest, []map[string]string{{
+		"propertyName": property,
+		"errorMessage": message,
+	}})
+}
+
+// getPage returns the page number and the page size requested, 1 and 10 by default.
+func getPage(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
@@ -0,0 +1,440 @@
+package arrstub
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golift.io/starr"
+	"golift.io/starr/radarr"
+)
+
+// Radarr is a stub of the radarr v3 API.
+// The library starts with the fixtures, the added movies are downloading until they are imported with ImportMovie.
+type Radarr struct {
+	apiKey string
+
+	status   *radarr.SystemStatus
+	profiles []*radarr.QualityProfile
+	folders  []*radarr.RootFolder
+	lookup   []*radarr.Movie
+	releases []*release
+
+	// movies is the library.
+	movies []*radarr.Movie
+	// queue is the list of the downloading movies.
+	queue []*radarr.QueueRecord
+	// lastId is the last id given to a movie, a queue record or a command.
+	lastId int64
+	mu     sync.Mutex
+}
+
+func NewRadarr(apiKey string) (*Radarr, error) {
+	s := &Radarr{apiKey: apiKey}
+
+	err := loadFixture("radarr", "status.json", &s.status)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("radarr", "qualityprofiles.json", &s.profiles)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("radarr", "rootfolders.json", &s.folders)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("radarr", "lookup.json", &s.lookup)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("radarr", "movies.json", &s.movies)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("radarr", "releases.json", &s.releases)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, movie := range s.movies {
+		s.lastId = max(s.lastId, movie.ID)
+	}
+
+	return s, nil
+}
+
+// ImportMovie ends the download of the movie: it leaves the queue and gets a file.
+// Return false if the movie is not downloading.
+func (s *Radarr) ImportMovie(movieId int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rec := range s.queue {
+		if rec.MovieID != movieId {
+			continue
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+
+		if movie := s.findMovie(movieId); movie != nil {
+			s.lastId++
+			movie.HasFile = true
+			movie.SizeOnDisk = int64(rec.Size)
+			movie.MovieFile = &radarr.MovieFile{
+				ID:      s.lastId,
+				MovieID: movie.ID,
+				Size:    int64(rec.Size),
+				Quality: &starr.Quality{Quality: &starr.BaseQuality{ID: 7, Name: "Bluray-1080p", Source: "bluray", Resolution: 1080}},
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (s *Radarr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := route(w, r, s.apiKey)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case p == "system/status" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.status)
+	case p == "qualityprofile" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.profiles)
+	case p == "rootfolder" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.folders)
+	case p == "movie" && r.Method == http.MethodGet:
+		s.getMovies(w, r)
+	case p == "movie" && r.Method == http.MethodPost:
+		s.addMovie(w, r)
+	case p == "movie/lookup" && r.Method == http.MethodGet:
+		s.lookupMovie(w, r)
+	case strings.HasPrefix(p, "movie/"):
+		id, ok := idFromPath(p, "movie")
+		if !ok {
+			writeError(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		s.movieById(w, r, id)
+	case p == "release" && r.Method == http.MethodGet:
+		s.searchReleases(w, r)
+	case p == "release" && r.Method == http.MethodPost:
+		s.grabRelease(w, r)
+	case p == "queue" && r.Method == http.MethodGet:
+		s.getQueue(w, r)
+	case p == "command" && r.Method == http.MethodPost:
+		s.command(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+/* Handlers */
+
+func (s *Radarr) getMovies(w http.ResponseWriter, r *http.Request) {
+	tmdbId, _ := strconv.ParseInt(r.URL.Query().Get("tmdbId"), 10, 64)
+
+	movies := []*radarr.Movie{}
+	for _, movie := range s.movies {
+		if tmdbId == 0 || movie.TmdbID == tmdbId {
+			movies = append(movies, movie)
+		}
+	}
+	writeJSON(w, http.StatusOK, movies)
+}
+
+func (s *Radarr) addMovie(w http.ResponseWriter, r *http.Request) {
+	var input radarr.AddMovieInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, movie := range s.movies {
+		if movie.TmdbID == input.TmdbID {
+			writeValidationError(w, "TmdbId", "This movie has already been added")
+			return
+		}
+	}
+
+	if !s.hasRootFolder(input.RootFolderPath) {
+		writeValidationError(w, "RootFolderPath", "Root folder '"+input.RootFolderPath+"' does not exist")
+		return
+	}
+
+	var found *radarr.Movie
+	for _, movie := range s.lookup {
+		if movie.TmdbID == input.TmdbID {
+			found = movie
+			break
+		}
+	}
+	if found == nil {
+		writeValidationError(w, "TmdbId", "Movie not found")
+		return
+	}
+
+	s.lastId++
+	movie := *found
+	movie.ID = s.lastId
+	movie.Path = strings.TrimSuffix(input.RootFolderPath, "/") + "/" + movie.Title + " (" + strconv.Itoa(movie.Year) + ")"
+	movie.QualityProfileID = input.QualityProfileID
+	movie.Monitored = input.Monitored
+	movie.Added = time.Now()
+	s.movies = append(s.movies, &movie)
+
+	if input.AddOptions != nil && input.AddOptions.SearchForMovie {
+		s.searchMovie(&movie)
+	}
+
+	writeJSON(w, http.StatusCreated, movie)
+}
+
+func (s *Radarr) lookupMovie(w http.ResponseWriter, r *http.Request) {
+	term := strings.ToLower(r.URL.Query().Get("term"))
+
+	movies := []*radarr.Movie{}
+	for _, movie := range s.lookup {
+		if !strings.Contains(strings.ToLower(movie.Title), term) {
+			continue
+		}
+
+		// the movies of the library are returned with their id
+		for _, libMovie := range s.movies {
+			if libMovie.TmdbID == movie.TmdbID {
+				movie = libMovie
+				break
+			}
+		}
+		movies = append(movies, movie)
+	}
+	writeJSON(w, http.StatusOK, movies)
+}
+
+func (s *Radarr) movieById(w http.ResponseWriter, r *http.Request, id int64) {
+	movie := s.findMovie(id)
+	if movie == nil {
+		writeError(w, http.StatusNotFound, "Movie with ID "+strconv.FormatInt(id, 10)+" does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, movie)
+	case http.MethodPut:
+		var input radarr.Movie
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// only the settings changed by telarr are saved
+		movie.Monitored = input.Monitored
+		movie.QualityProfileID = input.QualityProfileID
+		writeJSON(w, http.StatusAccepted, movie)
+	case http.MethodDelete:
+		for i, m := range s.movies {
+			if m.ID == id {
+				s.movies = append(s.movies[:i], s.movies[i+1:]...)
+				break
+			}
+		}
+		for i, rec := range s.queue {
+			if rec.MovieID == id {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *Radarr) searchReleases(w http.ResponseWriter, r *http.Request) {
+	movieId, _ := strconv.ParseInt(r.URL.Query().Get("movieId"), 10, 64)
+	movie := s.findMovie(movieId)
+	if movie == nil {
+		writeError(w, http.StatusNotFound, "Movie with ID "+strconv.FormatInt(movieId, 10)+" does not exist")
+		return
+	}
+
+	// every movie has the releases of the fixture, named after it
+	releases := []*release{}
+	for _, rel := range s.releases {
+		found := *rel
+		found.Title = releaseTitle(movie, rel)
+		found.MovieId = movie.ID
+		releases = append(releases, &found)
+	}
+	writeJSON(w, http.StatusOK, releases)
+}
+
+func (s *Radarr) grabRelease(w http.ResponseWriter, r *http.Request) {
+	var input release
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var found *release
+	for _, rel := range s.releases {
+		if rel.Guid == input.Guid && rel.IndexerId == input.IndexerId {
+			found = rel
+			break
+		}
+	}
+	movie := s.findMovie(input.MovieId)
+	if found == nil || movie == nil {
+		writeError(w, http.StatusNotFound, "Couldn't find requested release in cache, cache timeout probably expired.")
+		return
+	}
+
+	s.lastId++
+	s.queue = append(s.queue, &radarr.QueueRecord{
+		ID:                      s.lastId,
+		MovieID:                 movie.ID,
+		Title:                   releaseTitle(movie, found),
+		Size:                    float64(found.Size),
+		Sizeleft:                float64(found.Size),
+		Timeleft:                "00:30:00",
+		EstimatedCompletionTime: time.Now().Add(30 * time.Minute),
+		Status:                  "queued",
+		TrackedDownloadStatus:   "ok",
+		TrackedDownloadState:    "downloading",
+		Protocol:                found.Protocol,
+		DownloadClient:          "qBittorrent",
+		Indexer:                 found.Indexer,
+	})
+
+	grabbed := *found
+	grabbed.Title = releaseTitle(movie, found)
+	grabbed.MovieId = movie.ID
+	writeJSON(w, http.StatusOK, grabbed)
+}
+
+func (s *Radarr) getQueue(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := getPage(r)
+
+	records := []*radarr.QueueRecord{}
+	if start := (page - 1) * pageSize; start < len(s.queue) {
+		records = s.queue[start:min(start+pageSize, len(s.queue))]
+	}
+	writeJSON(w, http.StatusOK, radarr.Queue{
+		Page:          page,
+		PageSize:      pageSize,
+		SortKey:       "timeleft",
+		SortDirection: "ascending",
+		TotalRecords:  len(s.queue),
+		Records:       records,
+	})
+}
+
+func (s *Radarr) command(w http.ResponseWriter, r *http.Request) {
+	var cmd radarr.CommandRequest
+	err := json.NewDecoder(r.Body).Decode(&cmd)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if cmd.Name == "MoviesSearch" {
+		for _, id := range cmd.MovieIDs {
+			if movie := s.findMovie(id); movie != nil {
+				s.searchMovie(movie)
+			}
+		}
+	}
+
+	s.lastId++
+	writeJSON(w, http.StatusCreated, radarr.CommandResponse{
+		ID:          s.lastId,
+		Name:        cmd.Name,
+		CommandName: cmd.Name,
+		Priority:    "normal",
+		Status:      "queued",
+		Queued:      time.Now(),
+	})
+}
+
+/* Tools */
+
+// release is a release of the /api/v3/release endpoint, which the starr library doesn't have.
+type release struct {
+	Guid       string         `json:"guid"`
+	IndexerId  int64          `json:"indexerId"`
+	Indexer    string         `json:"indexer"`
+	MovieId    int64          `json:"movieId,omitempty"`
+	Title      string         `json:"title"`
+	Quality    *starr.Quality `json:"quality"`
+	Size       int64          `json:"size"`
+	Protocol   string         `json:"protocol"`
+	Seeders    *int           `json:"seeders,omitempty"`
+	AgeHours   float64        `json:"ageHours"`
+	Rejected   bool           `json:"rejected"`
+	Rejections []string       `json:"rejections"`
+}
+
+// releaseTitle returns the title of the release of the movie, the title of the fixture being only its end.
+func releaseTitle(movie *radarr.Movie, rel *release) string {
+	return strings.ReplaceAll(movie.Title, " ", ".") + "." + strconv.Itoa(movie.Year) + "." + rel.Title
+}
+
+// searchMovie puts a release of the movie in the queue, as the search always finds one.
+// Nothing is done if the movie is already downloading.
+// s.mu must be held.
+func (s *Radarr) searchMovie(movie *radarr.Movie) {
+	for _, rec := range s.queue {
+		if rec.MovieID == movie.ID {
+			return
+		}
+	}
+
+	s.lastId++
+	s.queue = append(s.queue, &radarr.QueueRecord{
+		ID:                      s.lastId,
+		MovieID:                 movie.ID,
+		Title:                   movie.Title + " " + strconv.Itoa(movie.Year) + " 1080p BluRay x264",
+		Size:                    8 * 1024 * 1024 * 1024,
+		Sizeleft:                6 * 1024 * 1024 * 1024,
+		Timeleft:                "00:20:00",
+		EstimatedCompletionTime: time.Now().Add(20 * time.Minute),
+		Status:                  "downloading",
+		TrackedDownloadStatus:   "ok",
+		TrackedDownloadState:    "downloading",
+		Protocol:                "torrent",
+		DownloadClient:          "qBittorrent",
+		Indexer:                 "Stub",
+	})
+}
+
+// hasRootFolder returns true if the path is one of the root folders.
+func (s *Radarr) hasRootFolder(path string) bool {
+	for _, folder := range s.folders {
+		if folder.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// findMovie returns the movie of the library with the id, nil if not found.
+// s.mu must be held.
+func (s *Radarr) findMovie(id int64) *radarr.Movie {
+	for _, movie := range s.movies {
+		if movie.ID == id {
+			return movie
+		}
+	}
+	return nil
+}
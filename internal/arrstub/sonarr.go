@@ -0,0 +1,230 @@
+package arrstub
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golift.io/starr/sonarr"
+)
+
+// Sonarr is a stub of the sonarr v3 API.
+// The library starts with the fixtures.
+type Sonarr struct {
+	apiKey string
+
+	status   *sonarr.SystemStatus
+	profiles []*sonarr.QualityProfile
+	folders  []*sonarr.RootFolder
+	lookup   []*sonarr.Series
+
+	// series is the library.
+	series []*sonarr.Series
+	// lastId is the last id given to a serie or a command.
+	lastId int64
+	mu     sync.Mutex
+}
+
+func NewSonarr(apiKey string) (*Sonarr, error) {
+	s := &Sonarr{apiKey: apiKey}
+
+	err := loadFixture("sonarr", "status.json", &s.status)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("sonarr", "qualityprofiles.json", &s.profiles)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("sonarr", "rootfolders.json", &s.folders)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("sonarr", "lookup.json", &s.lookup)
+	if err != nil {
+		return nil, err
+	}
+	err = loadFixture("sonarr", "series.json", &s.series)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, serie := range s.series {
+		s.lastId = max(s.lastId, serie.ID)
+	}
+
+	return s, nil
+}
+
+func (s *Sonarr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := route(w, r, s.apiKey)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case p == "system/status" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.status)
+	case p == "qualityprofile" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.profiles)
+	case p == "rootfolder" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.folders)
+	case p == "series" && r.Method == http.MethodGet:
+		s.getSeries(w, r)
+	case p == "series" && r.Method == http.MethodPost:
+		s.addSerie(w, r)
+	case p == "series/lookup" && r.Method == http.MethodGet:
+		s.lookupSerie(w, r)
+	case strings.HasPrefix(p, "series/"):
+		id, ok := idFromPath(p, "series")
+		if !ok {
+			writeError(w, http.StatusNotFound, "NotFound")
+			return
+		}
+		s.serieById(w, r, id)
+	case p == "command" && r.Method == http.MethodPost:
+		s.command(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+/* Handlers */
+
+func (s *Sonarr) getSeries(w http.ResponseWriter, r *http.Request) {
+	tvdbId, _ := strconv.ParseInt(r.URL.Query().Get("tvdbId"), 10, 64)
+
+	series := []*sonarr.Series{}
+	for _, serie := range s.series {
+		if tvdbId == 0 || serie.TvdbID == tvdbId {
+			series = append(series, serie)
+		}
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+func (s *Sonarr) addSerie(w http.ResponseWriter, r *http.Request) {
+	var input sonarr.AddSeriesInput
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, serie := range s.series {
+		if serie.TvdbID == input.TvdbID {
+			writeValidationError(w, "TvdbId", "This series has already been added")
+			return
+		}
+	}
+
+	if !s.hasRootFolder(input.RootFolderPath) {
+		writeValidationError(w, "RootFolderPath", "Root folder '"+input.RootFolderPath+"' does not exist")
+		return
+	}
+
+	var found *sonarr.Series
+	for _, serie := range s.lookup {
+		if serie.TvdbID == input.TvdbID {
+			found = serie
+			break
+		}
+	}
+	if found == nil {
+		writeValidationError(w, "TvdbId", "Series not found")
+		return
+	}
+
+	s.lastId++
+	serie := *found
+	serie.ID = s.lastId
+	serie.Path = strings.TrimSuffix(input.RootFolderPath, "/") + "/" + serie.Title
+	serie.QualityProfileID = input.QualityProfileID
+	serie.Monitored = input.Monitored
+	serie.Added = time.Now()
+	s.series = append(s.series, &serie)
+
+	writeJSON(w, http.StatusCreated, serie)
+}
+
+func (s *Sonarr) lookupSerie(w http.ResponseWriter, r *http.Request) {
+	term := strings.ToLower(r.URL.Query().Get("term"))
+
+	series := []*sonarr.Series{}
+	for _, serie := range s.lookup {
+		if !strings.Contains(strings.ToLower(serie.Title), term) {
+			continue
+		}
+
+		// the series of the library are returned with their id
+		for _, libSerie := range s.series {
+			if libSerie.TvdbID == serie.TvdbID {
+				serie = libSerie
+				break
+			}
+		}
+		series = append(series, serie)
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+func (s *Sonarr) serieById(w http.ResponseWriter, r *http.Request, id int64) {
+	index := -1
+	for i, serie := range s.series {
+		if serie.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "Series with ID "+strconv.FormatInt(id, 10)+" does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.series[index])
+	case http.MethodDelete:
+		s.series = append(s.series[:index], s.series[index+1:]...)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *Sonarr) command(w http.ResponseWriter, r *http.Request) {
+	var cmd sonarr.CommandRequest
+	err := json.NewDecoder(r.Body).Decode(&cmd)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.lastId++
+	writeJSON(w, http.StatusCreated, sonarr.CommandResponse{
+		ID:          s.lastId,
+		Name:        cmd.Name,
+		CommandName: cmd.Name,
+		Priority:    "normal",
+		Status:      "queued",
+		Queued:      time.Now(),
+	})
+}
+
+/* Tools */
+
+// hasRootFolder returns true if the path is one of the root folders.
+func (s *Sonarr) hasRootFolder(path string) bool {
+	for _, folder := range s.folders {
+		if folder.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes the content to the file at path through a temporary file of the same directory renamed once complete,
+// so a crash never leaves the file half written.
+// The temporary file and the directory are synced, so the new content survives a power loss once WriteFile returns.
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	// a unique temporary file, two processes writing the same file don't write the same temporary file
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = f.Write(content)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory, to persist the rename of the file.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file.json")
+
+	tests := []struct {
+		name    string
+		content string
+		perm    os.FileMode
+	}{
+		{
+			name:    "new file",
+			content: `{"a":1}`,
+			perm:    0600,
+		},
+		{
+			name:    "replaced file",
+			content: `{"b":2}`,
+			perm:    0644,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteFile(p, []byte(tt.content), tt.perm)
+			if err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			got, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("content = %q, want %q", got, tt.content)
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				t.Fatalf("error stating file: %v", err)
+			}
+			if info.Mode().Perm() != tt.perm {
+				t.Errorf("perm = %v, want %v", info.Mode().Perm(), tt.perm)
+			}
+
+			// the temporary file is renamed
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("error reading dir: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%v files in the directory, want 1", len(entries))
+			}
+		})
+	}
+
+	// the temporary file is removed when the file can't be replaced
+	err := os.Mkdir(filepath.Join(dir, "dir"), 0755)
+	if err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "dir", "other"), nil, 0600)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	err = WriteFile(filepath.Join(dir, "dir"), []byte("content"), 0600)
+	if err == nil {
+		t.Fatalf("WriteFile() over a directory error = nil")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%v files in the directory, want 2", len(entries))
+	}
+}
@@ -0,0 +1,313 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPath is the file where the entries are appended when no path is configured.
+	DefaultPath = "/opt/telarr/audit/audit.jsonl"
+
+	// maxLineLength is the longest entry read from the file.
+	maxLineLength = 1024 * 1024
+)
+
+// Action is what the user did.
+type Action string
+
+const (
+	// ActionAddMovie and ActionAddSerie are the additions of a media, directly or when an admin approves a request.
+	ActionAddMovie Action = "addMovie"
+	ActionAddSerie Action = "addSerie"
+	// ActionRemoveMovie and ActionRemoveSerie are the removals of a media with its files.
+	ActionRemoveMovie Action = "removeMovie"
+	ActionRemoveSerie Action = "removeSerie"
+	// ActionRequest is a request sent to the admins by a requester.
+	ActionRequest Action = "request"
+	// ActionApproveRequest and ActionRejectRequest are the decisions of an admin on a request.
+	ActionApproveRequest Action = "approveRequest"
+	ActionRejectRequest  Action = "rejectRequest"
+	// ActionSearchMovie is a search of a movie of the library asked to radarr.
+	ActionSearchMovie Action = "searchMovie"
+	// ActionRefreshMovie is a refresh and rescan of a movie of the library asked to radarr.
+	ActionRefreshMovie Action = "refreshMovie"
+	// ActionEditMovie is a change of the monitoring or the quality profile of a movie of the library.
+	ActionEditMovie Action = "editMovie"
+	// ActionGrabRelease is a release of a movie grabbed from the release search.
+	ActionGrabRelease Action = "grabRelease"
+	// ActionWakeOnLan is the Wake-on-LAN sent by an admin.
+	ActionWakeOnLan Action = "wakeOnLan"
+
+	// ActionAuthorize is a new user entering the right password.
+	ActionAuthorize Action = "authorize"
+	// ActionWrongPassword is a new user entering a wrong password.
+	ActionWrongPassword Action = "wrongPassword"
+	// ActionLockout is a user locked out after too many wrong passwords.
+	ActionLockout Action = "lockout"
+	// ActionBlacklist is a user blacklisted after too many lockouts.
+	ActionBlacklist Action = "blacklist"
+	// ActionRedeemInvite is a new user redeeming an invite code.
+	ActionRedeemInvite Action = "redeemInvite"
+	// ActionClaimAdmin is the first admin claiming the bot with the code printed in the log.
+	ActionClaimAdmin Action = "claimAdmin"
+
+	// ActionRevokeUser, ActionUnblacklistUser, ActionSetRole and ActionResetQuota are the changes of a user by an admin.
+	ActionRevokeUser      Action = "revokeUser"
+	ActionUnblacklistUser Action = "unblacklistUser"
+	ActionSetRole         Action = "setRole"
+	ActionResetQuota      Action = "resetQuota"
+	// ActionCreateInvite and ActionRevokeInvite are the changes of the invite codes by an admin.
+	ActionCreateInvite Action = "createInvite"
+	ActionRevokeInvite Action = "revokeInvite"
+	// ActionAllowChat and ActionRevokeChat are the changes of the autorized group chats by an admin.
+	ActionAllowChat  Action = "allowChat"
+	ActionRevokeChat Action = "revokeChat"
+)
+
+var (
+	// Actions are all the actions recorded, to filter the entries.
+	Actions = []Action{
+		ActionAddMovie, ActionAddSerie, ActionRemoveMovie, ActionRemoveSerie,
+		ActionSearchMovie, ActionRefreshMovie, ActionEditMovie, ActionGrabRelease, ActionRequest, ActionApproveRequest, ActionRejectRequest, ActionWakeOnLan,
+		ActionAuthorize, ActionWrongPassword, ActionLockout, ActionBlacklist, ActionRedeemInvite, ActionClaimAdmin,
+		ActionRevokeUser, ActionUnblacklistUser, ActionSetRole, ActionResetQuota, ActionCreateInvite, ActionRevokeInvite,
+		ActionAllowChat, ActionRevokeChat,
+	}
+)
+
+func (a Action) String() string {
+	return string(a)
+}
+
+// Result is the outcome of the action.
+type Result string
+
+const (
+	// ResultOk is an action done.
+	ResultOk Result = "ok"
+	// ResultDenied is an action refused to the user (e.g. a wrong password).
+	ResultDenied Result = "denied"
+	// ResultError is an action that failed, the error is in the entry.
+	ResultError Result = "error"
+)
+
+// Entry is an action recorded in the log.
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	// UserId and Username are the user who did the action.
+	UserId   int    `json:"userId"`
+	Username string `json:"username"`
+
+	Action Action `json:"action"`
+	// MediaIds are the ids of the medias of the action, in their instance.
+	MediaIds []int64 `json:"mediaIds,omitempty"`
+	// Media is the title of the media, or what the action is about (e.g. the user changed by an admin).
+	Media string `json:"media,omitempty"`
+	// Instance is the name of the radarr or sonarr instance.
+	Instance string `json:"instance,omitempty"`
+	// ChatId is the id of the group chat of the action (e.g. the group autorized by an admin).
+	ChatId int64 `json:"chatId,omitempty"`
+
+	Result Result `json:"result"`
+	// Error is the error of the action when it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Filter selects the entries, the zero value selects all of them.
+type Filter struct {
+	// UserId selects the entries of the user, all the users if 0.
+	UserId int `json:"userId,omitempty"`
+	// Username selects the entries of the user by its username, without "@" and case insensitive.
+	Username string `json:"username,omitempty"`
+	// Action selects the entries of the action, all the actions if empty.
+	Action Action `json:"action,omitempty"`
+	// Since and Until select the entries in the time range, unbounded if zero.
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+}
+
+// Match returns true if the entry is selected by the filter.
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.UserId != 0 && e.UserId != f.UserId:
+		return false
+	case f.Username != "" && !strings.EqualFold(e.Username, f.Username):
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// ParseFilter returns the filter of the arguments of the audit command, separated by spaces:
+// a username ("@name") or a user id, an action name, and a period ("24h", "7d") or one or two dates ("2006-01-02").
+func ParseFilter(args string, now time.Time) (Filter, error) {
+	var f Filter
+	var dates []time.Time
+	for _, arg := range strings.Fields(args) {
+		if username, found := strings.CutPrefix(arg, "@"); found {
+			f.Username = username
+			continue
+		}
+		if id, err := strconv.Atoi(arg); err == nil {
+			f.UserId = id
+			continue
+		}
+		if action, found := parseAction(arg); found {
+			f.Action = action
+			continue
+		}
+		if d, found := parsePeriod(arg); found {
+			f.Since = now.Add(-d)
+			continue
+		}
+		if date, err := time.ParseInLocation(time.DateOnly, arg, now.Location()); err == nil {
+			dates = append(dates, date)
+			continue
+		}
+		return Filter{}, fmt.Errorf("unknown argument %q", arg)
+	}
+
+	switch len(dates) {
+	case 0:
+	case 1:
+		f.Since = dates[0]
+	case 2:
+		if dates[1].Before(dates[0]) {
+			dates[0], dates[1] = dates[1], dates[0]
+		}
+		f.Since = dates[0]
+		// the last day is included
+		f.Until = dates[1].AddDate(0, 0, 1)
+	default:
+		return Filter{}, errors.New("at most two dates can be given")
+	}
+	return f, nil
+}
+
+// parseAction returns the action of the name, case insensitive.
+func parseAction(name string) (Action, bool) {
+	for _, action := range Actions {
+		if strings.EqualFold(action.String(), name) {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// parsePeriod returns the duration of a period, a go duration ("24h") or a number of days ("7d").
+func parsePeriod(s string) (time.Duration, bool) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// Log appends the entries to a json lines file, one entry per line. The entries are never modified.
+type Log struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewLog creates a log appending the entries to the file at path, and creates the file if it does not exist.
+func NewLog(path string) (*Log, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{path: path}, nil
+}
+
+// Record appends the entry, at the current time if its time is not set.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// the line is written at once, so a crash can only leave the last line incomplete
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Query returns the entries selected by the filter, from the newest, skipping offset entries and returning at most limit entries.
+// The total number of entries selected is returned too. The lines that can't be parsed are skipped.
+func (l *Log) Query(filter Filter, offset int, limit int) ([]Entry, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var selected []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineLength)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if filter.Match(e) {
+			selected = append(selected, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(selected)
+	var page []Entry
+	for i := total - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, selected[i])
+	}
+	return page, total, nil
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	p := path.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := NewLog(p)
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	entries := []Entry{
+		{Time: now.Add(-48 * time.Hour), UserId: 1, Username: "user", Action: ActionAddMovie, MediaIds: []int64{1}, Result: ResultOk},
+		{Time: now.Add(-2 * time.Hour), UserId: 1, Username: "user", Action: ActionRemoveMovie, MediaIds: []int64{1}, Result: ResultError, Error: "not found"},
+		{Time: now.Add(-time.Hour), UserId: 2, Username: "Admin", Action: ActionWakeOnLan, Result: ResultOk},
+		{UserId: 3, Action: ActionWrongPassword, Result: ResultDenied},
+	}
+	for _, e := range entries {
+		err = l.Record(e)
+		if err != nil {
+			t.Fatalf("Log.Record() error = %v", err)
+		}
+	}
+
+	// a line left incomplete by a crash is skipped
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	f.WriteString(`{"userId": 4, "act`)
+	f.Close()
+
+	// the entries survive a restart
+	l, err = NewLog(p)
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		offset    int
+		limit     int
+		wantUsers []int
+		wantTotal int
+	}{
+		{name: "all from the newest", limit: 10, wantUsers: []int{3, 2, 1, 1}, wantTotal: 4},
+		{name: "pages", offset: 1, limit: 2, wantUsers: []int{2, 1}, wantTotal: 4},
+		{name: "after the last page", offset: 4, limit: 2, wantUsers: nil, wantTotal: 4},
+		{name: "user id", filter: Filter{UserId: 1}, limit: 10, wantUsers: []int{1, 1}, wantTotal: 2},
+		{name: "username case insensitive", filter: Filter{Username: "admin"}, limit: 10, wantUsers: []int{2}, wantTotal: 1},
+		{name: "action", filter: Filter{Action: ActionAddMovie}, limit: 10, wantUsers: []int{1}, wantTotal: 1},
+		{name: "time range", filter: Filter{Since: now.Add(-3 * time.Hour), Until: now.Add(-time.Hour)}, limit: 10, wantUsers: []int{1}, wantTotal: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := l.Query(tt.filter, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("Log.Query() error = %v", err)
+			}
+			var users []int
+			for _, e := range got {
+				users = append(users, e.UserId)
+			}
+			if !reflect.DeepEqual(users, tt.wantUsers) || total != tt.wantTotal {
+				t.Errorf("Log.Query() = %v, %d, want users %v, %d", got, total, tt.wantUsers, tt.wantTotal)
+			}
+		})
+	}
+
+	// the time is set when recording
+	got, _, _ := l.Query(Filter{UserId: 3}, 0, 1)
+	if len(got) != 1 || got[0].Time.IsZero() {
+		t.Errorf("Log.Query() = %v, want the entry with its time", got)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		args    string
+		want    Filter
+		wantErr bool
+	}{
+		{name: "no argument", args: "", want: Filter{}},
+		{name: "username and action", args: "@user removeMovie", want: Filter{Username: "user", Action: ActionRemoveMovie}},
+		{name: "user id and period in days", args: "123 7d", want: Filter{UserId: 123, Since: now.Add(-7 * 24 * time.Hour)}},
+		{name: "action case insensitive and duration", args: "WAKEONLAN 24h", want: Filter{Action: ActionWakeOnLan, Since: now.Add(-24 * time.Hour)}},
+		{name: "one date", args: "2024-03-01", want: Filter{Since: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "two dates with the last day included", args: "2024-03-05 2024-03-01", want: Filter{Since: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)}},
+		{name: "three dates", args: "2024-03-01 2024-03-02 2024-03-03", wantErr: true},
+		{name: "unknown argument", args: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.args, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,38 +1,35 @@
 package authentication
 
 import (
-	"context"
-	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
 	"strconv"
+	"sync"
 	"telarr/configuration"
+	"telarr/internal/tgclient"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"gitlab.com/toby3d/telegram"
 )
 
-const (
-	// maxAttempts is the maximum number of attempts to use the bot.
-	maxAttempts = 3
-
-	// blacklistFile is the name of the file that contains the blacklist.
-	blacklistFile = "blacklist.json"
-	// autorizedFile is the name of the file that contains the autorized.
-	autorizedFile = "autorized.json"
-	// adminFile is the name of the file that contains the admins.
-	adminFile = "admin.json"
-)
-
-var (
-	// authPath is the path to the auth files.
-	authPath = "/opt/telarr/auth"
-)
-
 type User struct {
 	// Id is the id of the user.
 	Id int `json:"id"`
 	// Username is the username of the user.
 	Username string `json:"username"`
+	// Role is the role of an autorized user, the configured default role if empty. The admins are in the admin file.
+	Role Role `json:"role,omitempty"`
+}
+
+// Chat is a group chat whose members are allowed to use the bot.
+type Chat struct {
+	// Id is the id of the chat, negative for the groups.
+	Id int64 `json:"id"`
+	// Title is the title of the group.
+	Title string `json:"title"`
+	// Role is the role of the members of the chat, the configured default role if empty.
+	Role Role `json:"role,omitempty"`
 }
 
 type Auth struct {
@@ -42,13 +39,30 @@ type Auth struct {
 	Autorized []User
 	// Admins is a list of users that are allowed to use the admin commands.
 	Admins []User
+	// Chats is a list of group chats whose members are allowed to use the bot.
+	Chats []Chat
 
-	// Attempts is a map of users and the number of attempts to use the bot.
-	Attempts map[int]int
+	// Attempts is a map of users and their wrong passwords, saved in the store.
+	Attempts map[int]Attempt
+
+	// claimCode is the one-time code making the first user sending it an admin, empty once there is an admin.
+	claimCode string
 
 	conf configuration.Configuration
+	// store saves the lists and the attempts.
+	store UserStore
+
+	// mu protects the lists and the attempts, as the updates of different users are handled concurrently.
+	mu sync.RWMutex
 }
 
+var (
+	// ErrUserNotFound is returned when the user is not in the list to change.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrChatNotFound is returned when the group chat is not autorized.
+	ErrChatNotFound = errors.New("chat not found")
+)
+
 type AuthStatus int
 
 const (
@@ -62,192 +76,588 @@ const (
 
 	// AuthStatusWrongPassword is returned when the user has entered the wrong password.
 	AuthStatusWrongPassword
-	// AuthStatusMaxAttempts is returned when the user has reached the maximum number of attempts.
+	// AuthStatusMaxAttempts is returned when the user has been blacklisted after too many lockouts.
 	AuthStatusMaxAttempts
+	// AuthStatusLockedOut is returned when the user has to wait before entering the password again.
+	AuthStatusLockedOut
 
 	// AuthStatusError is returned when there is an error when autorizing the user.
 	AuthStatusError
 )
 
+// New opens the store of the configuration and reads the users lists and the attempts from it.
+// If there is no admin, a claim code is printed in the log, see Claim.
 func New(conf configuration.Configuration) (*Auth, error) {
-	// create the auth directory if it does not exist
-	err := os.MkdirAll(authPath, 0755)
+	store, err := NewStore(conf.Auth)
 	if err != nil {
 		return nil, err
 	}
-	// create the blacklist file if it does not exist
-	_, err = os.Stat(authPath + "/" + blacklistFile)
-	if os.IsNotExist(err) {
-		_, err = os.Create(authPath + "/" + blacklistFile)
-		if err != nil {
-			return nil, err
-		}
+
+	auth, err := NewWithStore(conf, store)
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
-	// create the autorized file if it does not exist
-	_, err = os.Stat(authPath + "/" + autorizedFile)
-	if os.IsNotExist(err) {
-		_, err = os.Create(authPath + "/" + autorizedFile)
-		if err != nil {
-			return nil, err
-		}
+
+	// a fresh install has no admin, the first one claims the bot with the code printed in the log
+	code, err := auth.NewClaimCode()
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
-	// create the admin file if it does not exist
-	_, err = os.Stat(authPath + "/" + adminFile)
-	if os.IsNotExist(err) {
-		_, err = os.Create(authPath + "/" + adminFile)
-		if err != nil {
-			return nil, err
-		}
+	if code != "" {
+		log.Warn().Str("code", code).Msg("no admin yet, send /claim " + code + " to the bot in a private chat to become admin")
+	}
+	return auth, nil
+}
+
+// NewWithStore reads the users lists and the attempts from the store.
+func NewWithStore(conf configuration.Configuration, store UserStore) (*Auth, error) {
+	// read the attempts, kept across restarts
+	attempts, err := store.Attempts()
+	if err != nil {
+		return nil, err
 	}
 
-	// create the auth struct
 	auth := &Auth{
-		Attempts: make(map[int]int),
+		Attempts: attempts,
 		conf:     conf,
+		store:    store,
 	}
-
-	// read the blacklist from the database
-	bytes, err := os.ReadFile(authPath + "/" + blacklistFile)
+	err = auth.Reload()
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(bytes, &auth.Blacklist)
+	return auth, nil
+}
 
-	// read the autorized from the database
-	bytes, err = os.ReadFile(authPath + "/" + autorizedFile)
+// Reload reads the users lists from the store again, to apply the changes made by hand.
+// The attempts are kept. If a list is invalid, the lists are not changed.
+// The lists are read and swapped under the lock, so a list saved meanwhile by the bot is never replaced by an older read,
+// and the reload triggered by a save of the bot reads the saved lists back.
+func (a *Auth) Reload() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	blacklist, err := a.readUsers(ListBlacklist)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	autorized, err := a.readUsers(ListAutorized)
+	if err != nil {
+		return err
+	}
+	admins, err := a.readUsers(ListAdmins)
+	if err != nil {
+		return err
+	}
+	chats, err := a.readChats()
+	if err != nil {
+		return err
+	}
+
+	a.Blacklist = blacklist
+	a.Autorized = autorized
+	a.Admins = admins
+	a.Chats = chats
+
+	return nil
+}
+
+// SetConfiguration replaces the configuration, to apply a new password.
+func (a *Auth) SetConfiguration(conf configuration.Configuration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conf = conf
+}
+
+// FilesPaths returns the paths of the files of the store that can be edited by hand.
+func (a *Auth) FilesPaths() []string {
+	return a.store.Paths()
+}
+
+// Close closes the store.
+func (a *Auth) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.store.Close()
+}
+
+/* Users management */
+
+// GetAutorized returns a copy of the autorized users list.
+func (a *Auth) GetAutorized() []User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]User(nil), a.Autorized...)
+}
+
+// GetBlacklist returns a copy of the blacklist.
+func (a *Auth) GetBlacklist() []User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]User(nil), a.Blacklist...)
+}
+
+// GetAdmins returns a copy of the admins list.
+func (a *Auth) GetAdmins() []User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]User(nil), a.Admins...)
+}
+
+// GetChats returns a copy of the autorized group chats list.
+func (a *Auth) GetChats() []Chat {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Chat(nil), a.Chats...)
+}
+
+// GetDefaultRole returns the role of the users and the chats without role.
+func (a *Auth) GetDefaultRole() Role {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return ConfiguredDefaultRole(a.conf.Auth)
+}
+
+// GetUser returns the user from the autorized list or the blacklist.
+func (a *Auth) GetUser(userId int) (User, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if i := indexUser(a.Autorized, userId); i >= 0 {
+		return a.Autorized[i], true
+	}
+	if i := indexUser(a.Blacklist, userId); i >= 0 {
+		return a.Blacklist[i], true
+	}
+	return User{}, false
+}
+
+// GetRole returns the role of the user, false if the user is not autorized.
+func (a *Auth) GetRole(userId int) (Role, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	i := indexUser(a.Autorized, userId)
+	if i < 0 {
+		return "", false
 	}
-	json.Unmarshal(bytes, &auth.Autorized)
+	return a.roleOf(a.Autorized[i]), true
+}
+
+// Revoke removes the user from the autorized list, and from the admins.
+// The user has to enter the password again to use the bot.
+func (a *Auth) Revoke(userId int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	// read the admin from the database
-	bytes, err = os.ReadFile(authPath + "/" + adminFile)
+	var found bool
+	a.Autorized, found = removeUser(a.Autorized, userId)
+	if !found {
+		return ErrUserNotFound
+	}
+	err := a.saveAutorized()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	json.Unmarshal(bytes, &auth.Admins)
 
-	return auth, nil
+	var admin bool
+	a.Admins, admin = removeUser(a.Admins, userId)
+	if admin {
+		return a.saveAdmins()
+	}
+	return nil
+}
+
+// Unblacklist removes the user from the blacklist and resets the attempts.
+// The user can enter the password again.
+func (a *Auth) Unblacklist(userId int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var found bool
+	a.Blacklist, found = removeUser(a.Blacklist, userId)
+	if !found {
+		return ErrUserNotFound
+	}
+	err := a.saveBlacklist()
+	if err != nil {
+		return err
+	}
+	if _, found = a.Attempts[userId]; found {
+		delete(a.Attempts, userId)
+		return a.saveAttempts()
+	}
+	return nil
+}
+
+// SetRole changes the role of the autorized user.
+// The admin role adds the user to the admins, the other roles remove it.
+func (a *Auth) SetRole(userId int, role Role) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := indexUser(a.Autorized, userId)
+	if i < 0 {
+		return ErrUserNotFound
+	}
+
+	if role == RoleAdmin {
+		if a.isAdmin(userId) {
+			return nil
+		}
+		a.Admins = append(a.Admins, User{Id: a.Autorized[i].Id, Username: a.Autorized[i].Username})
+		return a.saveAdmins()
+	}
+
+	var wasAdmin bool
+	a.Admins, wasAdmin = removeUser(a.Admins, userId)
+	if wasAdmin {
+		err := a.saveAdmins()
+		if err != nil {
+			return err
+		}
+	}
+	a.Autorized[i].Role = role
+	return a.saveAutorized()
+}
+
+// AutorizeChat autorizes the members of the group chat with the role of the chat (the default role if empty), or changes their role.
+// The admin role can't be given to a chat.
+func (a *Auth) AutorizeChat(chat Chat) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if chat.Role == RoleAdmin {
+		chat.Role = ConfiguredDefaultRole(a.conf.Auth)
+	}
+	if i := indexChat(a.Chats, chat.Id); i >= 0 {
+		a.Chats[i] = chat
+	} else {
+		a.Chats = append(a.Chats, chat)
+	}
+	return a.saveChats()
+}
+
+// RevokeChat removes the group chat from the autorized chats.
+// Its members who are not autorized themselves can't use the bot anymore.
+func (a *Auth) RevokeChat(chatId int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var found bool
+	a.Chats, found = removeChat(a.Chats, chatId)
+	if !found {
+		return ErrChatNotFound
+	}
+	return a.saveChats()
+}
+
+// CheckAutorized checks if the user is autorized, and returns its role.
+func (a *Auth) CheckAutorized(userId int) (AuthStatus, Role) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.checkAutorized(userId)
+}
+
+// CheckAutorizedInChat checks if the user is autorized, by itself or as a member of the autorized group chat, and returns its role.
+// The role of an autorized user comes before the role of the chat, and a blacklisted user stays blacklisted.
+func (a *Auth) CheckAutorizedInChat(userId int, chatId int64) (AuthStatus, Role) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	status, role := a.checkAutorized(userId)
+	if status != AuthStatusNewUser {
+		return status, role
+	}
+	if i := indexChat(a.Chats, chatId); i >= 0 {
+		return AuthStatusAutorized, a.chatRole(a.Chats[i])
+	}
+	return status, role
 }
 
-// CheckAutorized checks if the user is autorized.
-func (a *Auth) CheckAutorized(userId int) (AuthStatus, bool) {
+// checkAutorized checks if the user is autorized and returns its role, a.mu must be held.
+func (a *Auth) checkAutorized(userId int) (AuthStatus, Role) {
 	// check blacklist
 	for _, u := range a.Blacklist {
 		if u.Id == userId {
-			return AuthStatusBlackListed, false
+			return AuthStatusBlackListed, ""
 		}
 	}
 
 	// check autorized
 	for _, u := range a.Autorized {
 		if u.Id == userId {
-			return AuthStatusAutorized, a.isAdmin(userId)
+			return AuthStatusAutorized, a.roleOf(u)
 		}
 	}
 
-	return AuthStatusNewUser, false
+	// check lockout
+	if _, locked := a.lockedUntil(userId); locked {
+		return AuthStatusLockedOut, ""
+	}
+
+	return AuthStatusNewUser, ""
 }
 
 // AutorizeNewUser autorizes the user if the password is correct.
-// Add the user to the blacklist if the maximum number of attempts has been reached.
+// The user is locked out when the maximum number of attempts has been reached, and blacklisted after too many lockouts if the policy says so.
+// The int returned is the number of attempts left, 0 when this attempt locked the user out or blacklisted it, -1 otherwise.
 func (a *Auth) AutorizeNewUser(user User, password string) (AuthStatus, int) {
-	// check if the user is autorized
-	status, _ := a.CheckAutorized(user.Id)
-	if status == AuthStatusAutorized {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// check if the user is autorized or locked out
+	status, _ := a.checkAutorized(user.Id)
+	switch status {
+	case AuthStatusAutorized:
 		return AuthStatusAutorized, -1
+	case AuthStatusLockedOut:
+		return AuthStatusLockedOut, -1
 	}
 
 	// check if the password is correct
-	if password != a.conf.Telegram.Passwd {
-		a.Attempts[user.Id]++
+	if !comparePassword(a.conf.Telegram.Passwd, password) {
+		policy := a.lockoutPolicy()
+		attempt := a.Attempts[user.Id]
+		attempt.Failures++
 
 		// check if the user has reached the maximum number of attempts
-		if a.Attempts[user.Id] >= maxAttempts {
-			// add user to the blacklist
-			err := a.saveBlacklist(user)
+		if attempt.Failures < policy.MaxAttempts {
+			a.Attempts[user.Id] = attempt
+			err := a.saveAttempts()
 			if err != nil {
 				return AuthStatusError, -1
 			}
+			return AuthStatusWrongPassword, policy.MaxAttempts - attempt.Failures
+		}
+		attempt.Failures = 0
+		attempt.Lockouts++
 
+		// blacklist the user after too many lockouts
+		if policy.BlacklistAfter > 0 && attempt.Lockouts >= policy.BlacklistAfter {
+			err := a.addToBlacklist(user)
+			if err != nil {
+				return AuthStatusError, -1
+			}
+			delete(a.Attempts, user.Id)
+			err = a.saveAttempts()
+			if err != nil {
+				return AuthStatusError, -1
+			}
 			return AuthStatusMaxAttempts, 0
 		}
-		return AuthStatusWrongPassword, maxAttempts - a.Attempts[user.Id]
+
+		// lock the user out, a bit longer at each lockout
+		attempt.LockedUntil = time.Now().Add(lockoutDuration(policy, attempt.Lockouts))
+		a.Attempts[user.Id] = attempt
+		err := a.saveAttempts()
+		if err != nil {
+			return AuthStatusError, -1
+		}
+		return AuthStatusLockedOut, 0
+	}
+
+	// reset the attempts before the autorization, so the wrong passwords of an autorized user are never kept
+	if _, found := a.Attempts[user.Id]; found {
+		delete(a.Attempts, user.Id)
+		err := a.saveAttempts()
+		if err != nil {
+			return AuthStatusError, -1
+		}
 	}
 
 	// add the user to the autorized list
 	log.Debug().Str("username", user.Username).Msg("saving autorized user")
-	err := a.saveAutorized(user)
+	err := a.addToAutorized(user)
 	if err != nil {
 		return AuthStatusError, -1
 	}
-	delete(a.Attempts, user.Id)
 
 	return AuthStatusAutorized, -1
 }
 
-func (a *Auth) WaitForAutorization(ctx context.Context, user User, bot *telegram.Bot, textChan chan string, chatId int64) {
-	// wait for the user to be autorized
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case text := <-textChan:
-			status, attemps := a.AutorizeNewUser(user, text)
-			switch status {
-			case AuthStatusAutorized:
-				log.Info().Str("username", user.Username).Msg("user is now authorized")
-
-				_, err := bot.SendMessage(telegram.SendMessage{
-					ChatID: chatId,
-					Text:   "You are now authorized! 🎉",
-				})
-				if err != nil {
-					log.Err(err).Msg("error when sending message")
-				}
-
-				return
-			case AuthStatusWrongPassword:
-				log.Debug().Str("username", user.Username).Msg("wrong password")
-
-				_, err := bot.SendMessage(telegram.SendMessage{
-					ChatID: chatId,
-					Text:   "Wrong password ❌\nYou have " + strconv.Itoa(attemps) + " attempts left.",
-				})
-				if err != nil {
-					log.Err(err).Msg("error when sending message")
-				}
-			case AuthStatusMaxAttempts:
-				log.Debug().Str("username", user.Username).Msg("maximum number of attempts reached")
-
-				_, err := bot.SendMessage(telegram.SendMessage{
-					ChatID: chatId,
-					Text:   "You have reached the maximum number of attempts.\nYou are now blacklisted!",
-				})
-				if err != nil {
-					log.Err(err).Msg("error when sending message")
-				}
-
-				return
-			case AuthStatusError:
-				log.Debug().Str("username", user.Username).Msg("error when autorizing user")
-
-				_, err := bot.SendMessage(telegram.SendMessage{
-					ChatID: chatId,
-					Text:   "An error occurred while checking your authorization.\nPlease contact the administrator.",
-				})
-				if err != nil {
-					log.Err(err).Msg("error when sending message")
-				}
-
-				return
-			}
+// AutorizeInvitedUser autorizes the user who redeemed an invite code, with the role of the code (the default role if empty).
+// The admin role adds the user to the admins.
+func (a *Auth) AutorizeInvitedUser(user User, role Role) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if role != RoleAdmin {
+		user.Role = role
+	}
+	err := a.addToAutorized(user)
+	if err != nil {
+		return err
+	}
+	if _, found := a.Attempts[user.Id]; found {
+		delete(a.Attempts, user.Id)
+		err = a.saveAttempts()
+		if err != nil {
+			return err
+		}
+	}
+
+	if role == RoleAdmin && !a.isAdmin(user.Id) {
+		a.Admins = append(a.Admins, User{Id: user.Id, Username: user.Username})
+		return a.saveAdmins()
+	}
+	return nil
+}
+
+// CheckPassword autorizes the user if the password is correct and tells the user the result.
+// The admins are notified when the user is locked out or blacklisted.
+// Return true if the user doesn't have to enter the password anymore (autorized, locked out, blacklisted or error).
+func (a *Auth) CheckPassword(user User, bot tgclient.Client, password string, chatId int64) bool {
+	status, attemps := a.AutorizeNewUser(user, password)
+	switch status {
+	case AuthStatusAutorized:
+		log.Info().Str("username", user.Username).Msg("user is now authorized")
+
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: chatId,
+			Text:   "You are now authorized! 🎉",
+		}})
+		if err != nil {
+			log.Err(err).Msg("error when sending message")
+		}
+
+		return true
+	case AuthStatusWrongPassword:
+		log.Debug().Str("username", user.Username).Msg("wrong password")
+
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: chatId,
+			Text:   "Wrong password ❌\nYou have " + strconv.Itoa(attemps) + " attempts left.",
+		}})
+		if err != nil {
+			log.Err(err).Msg("error when sending message")
+		}
+
+		return false
+	case AuthStatusLockedOut:
+		until, _ := a.LockedUntil(user.Id)
+		retryIn := PrintDuration(time.Until(until))
+
+		text := "You are locked out 🔒\nYou can try again in " + retryIn + "."
+		if attemps == 0 {
+			log.Warn().Int("userId", user.Id).Str("username", user.Username).Time("until", until).Msg("user locked out")
+			text = "You have reached the maximum number of attempts.\n" + text
+			a.notifyAdmins(bot, "🔒 "+printUser(user)+" entered too many wrong passwords and is locked out for "+retryIn+".")
+		}
+
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: chatId,
+			Text:   text,
+		}})
+		if err != nil {
+			log.Err(err).Msg("error when sending message")
+		}
+
+		return true
+	case AuthStatusMaxAttempts:
+		log.Warn().Int("userId", user.Id).Str("username", user.Username).Msg("user blacklisted after too many lockouts")
+
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: chatId,
+			Text:   "You have reached the maximum number of attempts.\nYou are now blacklisted!",
+		}})
+		if err != nil {
+			log.Err(err).Msg("error when sending message")
+		}
+		a.notifyAdmins(bot, "⛔ "+printUser(user)+" entered too many wrong passwords and is now blacklisted.\nYou can remove it from the blacklist in the /admin menu.")
+
+		return true
+	default:
+		log.Debug().Str("username", user.Username).Msg("error when autorizing user")
+
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: chatId,
+			Text:   "An error occurred while checking your authorization.\nPlease contact the administrator.",
+		}})
+		if err != nil {
+			log.Err(err).Msg("error when sending message")
 		}
+
+		return true
 	}
 }
 
 /* Internal */
 
+// readUsers reads a users list from the store and checks the roles of its users, a.mu must be held.
+func (a *Auth) readUsers(list List) ([]User, error) {
+	users, err := a.store.Users(list)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Role == "" {
+			continue
+		}
+		_, err = ParseRole(user.Role.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %d: %w", list, user.Id, err)
+		}
+	}
+	return users, nil
+}
+
+// readChats reads the autorized group chats from the store and checks their roles, a.mu must be held.
+func (a *Auth) readChats() ([]Chat, error) {
+	chats, err := a.store.Chats()
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		if chat.Role == "" {
+			continue
+		}
+		_, err = ParseRole(chat.Role.String())
+		if err != nil {
+			return nil, fmt.Errorf("chats: chat %d: %w", chat.Id, err)
+		}
+	}
+	return chats, nil
+}
+
+// roleOf returns the role of the autorized user, a.mu must be held.
+func (a *Auth) roleOf(user User) Role {
+	if a.isAdmin(user.Id) {
+		return RoleAdmin
+	}
+	switch {
+	case user.Role == "" || user.Role == RoleAdmin:
+		return ConfiguredDefaultRole(a.conf.Auth)
+	case user.Role.level() < 0:
+		// a role mistyped in the file gives the lowest access
+		return RoleViewer
+	}
+	return user.Role
+}
+
+// ChatRole returns the role of the members of the autorized group chat, never admin.
+func (a *Auth) ChatRole(chat Chat) Role {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.chatRole(chat)
+}
+
+// chatRole returns the role of the members of the autorized group chat, a.mu must be held.
+func (a *Auth) chatRole(chat Chat) Role {
+	switch {
+	case chat.Role == "" || chat.Role == RoleAdmin:
+		return ConfiguredDefaultRole(a.conf.Auth)
+	case chat.Role.level() < 0:
+		// a role mistyped in the file gives the lowest access
+		return RoleViewer
+	}
+	return chat.Role
+}
+
+// isAdmin checks if the user is an admin, a.mu must be held.
 func (a *Auth) isAdmin(userId int) bool {
 	for _, u := range a.Admins {
 		if userId == u.Id {
@@ -257,54 +667,106 @@ func (a *Auth) isAdmin(userId int) bool {
 	return false
 }
 
-func (a *Auth) saveBlacklist(user User) error {
+// addToBlacklist adds the user to the blacklist and saves it, a.mu must be held.
+func (a *Auth) addToBlacklist(user User) error {
 	// check if the user is already in the blacklist
-	for _, u := range a.Blacklist {
-		if u.Id == user.Id {
-			return nil
-		}
+	if containsUser(a.Blacklist, user.Id) {
+		return nil
 	}
 
 	// add the user to the blacklist
 	a.Blacklist = append(a.Blacklist, user)
+	return a.saveBlacklist()
+}
+
+// addToAutorized adds the user to the autorized list and saves it, a.mu must be held.
+func (a *Auth) addToAutorized(user User) error {
+	// check if the user is already in the autorized list
+	if containsUser(a.Autorized, user.Id) {
+		return nil
+	}
+
+	// add the user to the autorized list
+	a.Autorized = append(a.Autorized, user)
+	return a.saveAutorized()
+}
 
-	// save the blacklist to the database
-	bytes, err := json.MarshalIndent(a.Blacklist, "", "  ")
+// saveBlacklist saves the blacklist to the store, a.mu must be held.
+func (a *Auth) saveBlacklist() error {
+	return a.saveUsers(ListBlacklist, a.Blacklist)
+}
+
+// saveAutorized saves the autorized list to the store, a.mu must be held.
+func (a *Auth) saveAutorized() error {
+	return a.saveUsers(ListAutorized, a.Autorized)
+}
+
+// saveAdmins saves the admins list to the store, a.mu must be held.
+func (a *Auth) saveAdmins() error {
+	return a.saveUsers(ListAdmins, a.Admins)
+}
+
+// saveChats saves the autorized group chats list to the store, a.mu must be held.
+func (a *Auth) saveChats() error {
+	err := a.store.SaveChats(a.Chats)
 	if err != nil {
-		log.Err(err).Msg("error when marshaling the blacklist")
+		log.Err(err).Msg("error when saving the chats")
 		return err
 	}
-	err = os.WriteFile(authPath+"/"+blacklistFile, bytes, 0644)
+
+	return nil
+}
+
+// saveUsers saves a users list to the store, a.mu must be held.
+func (a *Auth) saveUsers(list List, users []User) error {
+	err := a.store.SaveUsers(list, users)
 	if err != nil {
-		log.Err(err).Msg("error when saving the blacklist to the database")
+		log.Err(err).Str("list", string(list)).Msg("error when saving the users list")
 		return err
 	}
 
 	return nil
 }
 
-func (a *Auth) saveAutorized(user User) error {
-	// check if the user is already in the autorized list
-	for _, u := range a.Autorized {
-		if u.Id == user.Id {
-			return nil
+// containsUser returns true if the user is in the list.
+func containsUser(users []User, userId int) bool {
+	return indexUser(users, userId) >= 0
+}
+
+// indexUser returns the index of the user in the list, -1 if not found.
+func indexUser(users []User, userId int) int {
+	for i, u := range users {
+		if u.Id == userId {
+			return i
 		}
 	}
+	return -1
+}
 
-	// add the user to the autorized list
-	a.Autorized = append(a.Autorized, user)
-
-	// save the autorized list to the database
-	bytes, err := json.MarshalIndent(a.Autorized, "", "  ")
-	if err != nil {
-		log.Err(err).Msg("error when marshaling the autorized list")
-		return err
+// removeUser returns the list without the user, and true if the user was in it.
+func removeUser(users []User, userId int) ([]User, bool) {
+	i := indexUser(users, userId)
+	if i < 0 {
+		return users, false
 	}
-	err = os.WriteFile(authPath+"/"+autorizedFile, bytes, 0644)
-	if err != nil {
-		log.Err(err).Msg("error when saving the autorized list to the database")
-		return err
+	return append(users[:i:i], users[i+1:]...), true
+}
+
+// indexChat returns the index of the group chat in the list, -1 if not found.
+func indexChat(chats []Chat, chatId int64) int {
+	for i, c := range chats {
+		if c.Id == chatId {
+			return i
+		}
 	}
+	return -1
+}
 
-	return nil
+// removeChat returns the list without the group chat, and true if the chat was in it.
+func removeChat(chats []Chat, chatId int64) ([]Chat, bool) {
+	i := indexChat(chats, chatId)
+	if i < 0 {
+		return chats, false
+	}
+	return append(chats[:i:i], chats[i+1:]...), true
 }
@@ -1,17 +1,39 @@
 package authentication
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"telarr/configuration"
+	"telarr/internal/tgclient"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// newTestStore returns a json store in a temporary directory.
+func newTestStore(t *testing.T) *JSONStore {
+	t.Helper()
+
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewJSONStore() error = %v", err)
+	}
+	return store
+}
+
 func TestNew(t *testing.T) {
-	authPath = t.TempDir()
+	dir := t.TempDir()
 	conf := configuration.Configuration{
 		Telegram: configuration.Telegram{
 			Passwd: "password",
 		},
+		Auth: configuration.Auth{Path: dir},
 	}
 
 	tests := []struct {
@@ -22,8 +44,9 @@ func TestNew(t *testing.T) {
 		{
 			name: "success",
 			want: &Auth{
-				Attempts: make(map[int]int),
+				Attempts: make(map[int]Attempt),
 				conf:     conf,
+				store:    &JSONStore{dir: dir},
 			},
 			wantErr: false,
 		},
@@ -35,6 +58,12 @@ func TestNew(t *testing.T) {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+
+			// without admin, the bot can be claimed with a random code
+			if !got.ClaimPending() {
+				t.Errorf("New() without claim code")
+			}
+			got.claimCode = ""
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
@@ -52,7 +81,7 @@ func TestAuth_CheckAutorized(t *testing.T) {
 	type fields struct {
 		Blacklist []User
 		Autorized []User
-		Attempts  map[int]int
+		Attempts  map[int]Attempt
 	}
 	type args struct {
 		userId int
@@ -68,7 +97,7 @@ func TestAuth_CheckAutorized(t *testing.T) {
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  make(map[int]int),
+				Attempts:  make(map[int]Attempt),
 			},
 			args: args{
 				userId: 1,
@@ -80,7 +109,7 @@ func TestAuth_CheckAutorized(t *testing.T) {
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  make(map[int]int),
+				Attempts:  make(map[int]Attempt),
 			},
 			args: args{
 				userId: 3,
@@ -92,7 +121,7 @@ func TestAuth_CheckAutorized(t *testing.T) {
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  make(map[int]int),
+				Attempts:  make(map[int]Attempt),
 			},
 			args: args{
 				userId: 5,
@@ -116,7 +145,6 @@ func TestAuth_CheckAutorized(t *testing.T) {
 }
 
 func TestAuth_Autorize(t *testing.T) {
-	authPath = t.TempDir()
 	conf := configuration.Configuration{
 		Telegram: configuration.Telegram{
 			Passwd: "password",
@@ -126,7 +154,8 @@ func TestAuth_Autorize(t *testing.T) {
 	type fields struct {
 		Blacklist []User
 		Autorized []User
-		Attempts  map[int]int
+		Attempts  map[int]Attempt
+		Lockout   configuration.Lockout
 	}
 	type args struct {
 		user     User
@@ -143,7 +172,7 @@ func TestAuth_Autorize(t *testing.T) {
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  make(map[int]int),
+				Attempts:  make(map[int]Attempt),
 			},
 			args: args{
 				user:     User{Id: 1},
@@ -156,7 +185,7 @@ func TestAuth_Autorize(t *testing.T) {
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  make(map[int]int),
+				Attempts:  make(map[int]Attempt),
 			},
 			args: args{
 				user:     User{Id: 3},
@@ -165,26 +194,68 @@ func TestAuth_Autorize(t *testing.T) {
 			want: AuthStatusAutorized,
 		},
 		{
-			name: "max attempts",
+			name: "locked out",
+			fields: fields{
+				Blacklist: []User{{Id: 1}, {Id: 2}},
+				Autorized: []User{{Id: 3}, {Id: 4}},
+				Attempts:  map[int]Attempt{5: {Lockouts: 1, LockedUntil: time.Now().Add(time.Hour)}},
+			},
+			args: args{
+				user:     User{Id: 5},
+				password: "password",
+			},
+			want: AuthStatusLockedOut,
+		},
+		{
+			name: "lockout expired",
 			fields: fields{
 				Blacklist: []User{{Id: 1}, {Id: 2}},
 				Autorized: []User{{Id: 3}, {Id: 4}},
-				Attempts:  map[int]int{5: maxAttempts},
+				Attempts:  map[int]Attempt{5: {Lockouts: 1, LockedUntil: time.Now().Add(-time.Minute)}},
 			},
 			args: args{
 				user:     User{Id: 5},
 				password: "password",
 			},
+			want: AuthStatusAutorized,
+		},
+		{
+			name: "max attempts",
+			fields: fields{
+				Blacklist: []User{{Id: 1}, {Id: 2}},
+				Autorized: []User{{Id: 3}, {Id: 4}},
+				Attempts:  map[int]Attempt{5: {Failures: defaultMaxAttempts - 1}},
+			},
+			args: args{
+				user:     User{Id: 5},
+				password: "wrongPassword",
+			},
+			want: AuthStatusLockedOut,
+		},
+		{
+			name: "blacklisted after lockouts",
+			fields: fields{
+				Blacklist: []User{{Id: 1}, {Id: 2}},
+				Autorized: []User{{Id: 3}, {Id: 4}},
+				Attempts:  map[int]Attempt{5: {Failures: 1, Lockouts: 1}},
+				Lockout:   configuration.Lockout{MaxAttempts: 2, BlacklistAfter: 2},
+			},
+			args: args{
+				user:     User{Id: 5},
+				password: "wrongPassword",
+			},
 			want: AuthStatusMaxAttempts,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			conf.Lockout = tt.fields.Lockout
 			a := &Auth{
 				Blacklist: tt.fields.Blacklist,
 				Autorized: tt.fields.Autorized,
 				Attempts:  tt.fields.Attempts,
 				conf:      conf,
+				store:     newTestStore(t),
 			}
 			if got, _ := a.AutorizeNewUser(tt.args.user, tt.args.password); got != tt.want {
 				t.Errorf("Auth.Autorize() = %v, want %v", got, tt.want)
@@ -192,3 +263,622 @@ func TestAuth_Autorize(t *testing.T) {
 		})
 	}
 }
+
+func TestAuth_Lockout(t *testing.T) {
+	dir := t.TempDir()
+	conf := configuration.Configuration{
+		Telegram: configuration.Telegram{
+			Passwd: "password",
+		},
+		Auth: configuration.Auth{Path: dir},
+		Lockout: configuration.Lockout{
+			MaxAttempts: 2,
+			Duration:    time.Minute,
+			MaxDuration: 3 * time.Minute,
+		},
+	}
+	a := &Auth{
+		Admins:   []User{{Id: 1, Username: "admin"}},
+		Attempts: make(map[int]Attempt),
+		conf:     conf,
+		store:    &JSONStore{dir: dir},
+	}
+	user := User{Id: 2, Username: "user"}
+	fake := tgclient.NewFake()
+
+	// the first wrong password only costs an attempt
+	if done := a.CheckPassword(user, fake, "wrongPassword", 2); done {
+		t.Fatalf("Auth.CheckPassword() = true after the first wrong password")
+	}
+	if _, ok := fake.WaitForText(2, time.Second, "1 attempts left"); !ok {
+		t.Fatalf("no attempts left message, messages = %+v", fake.Messages(2))
+	}
+
+	// the second one locks the user out and notifies the admins
+	if done := a.CheckPassword(user, fake, "wrongPassword", 2); !done {
+		t.Fatalf("Auth.CheckPassword() = false after the lockout")
+	}
+	if _, ok := fake.WaitForText(2, time.Second, "You can try again in 1m."); !ok {
+		t.Fatalf("no lockout message, messages = %+v", fake.Messages(2))
+	}
+	if _, ok := fake.WaitForText(1, time.Second, "@user entered too many wrong passwords and is locked out for 1m."); !ok {
+		t.Fatalf("admin not notified, messages = %+v", fake.Messages(1))
+	}
+	if status, _ := a.CheckAutorized(user.Id); status != AuthStatusLockedOut {
+		t.Errorf("Auth.CheckAutorized() = %v, want %v", status, AuthStatusLockedOut)
+	}
+	if status, _ := a.AutorizeNewUser(user, "password"); status != AuthStatusLockedOut {
+		t.Errorf("Auth.AutorizeNewUser() while locked out = %v, want %v", status, AuthStatusLockedOut)
+	}
+
+	// the attempts survive a restart
+	restarted, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, locked := restarted.LockedUntil(user.Id); !locked {
+		t.Errorf("Auth.LockedUntil() after restart = false, want true")
+	}
+	want := Attempt{Lockouts: 1, LockedUntil: a.Attempts[user.Id].LockedUntil}
+	if got := restarted.Attempts[user.Id]; got.Lockouts != want.Lockouts || !got.LockedUntil.Equal(want.LockedUntil) {
+		t.Errorf("attempts after restart = %+v, want %+v", got, want)
+	}
+
+	// once the lockout is over, the right password autorizes the user and forgets its attempts
+	attempt := restarted.Attempts[user.Id]
+	attempt.LockedUntil = time.Now().Add(-time.Second)
+	restarted.Attempts[user.Id] = attempt
+	if status, _ := restarted.AutorizeNewUser(user, "password"); status != AuthStatusAutorized {
+		t.Errorf("Auth.AutorizeNewUser() after the lockout = %v, want %v", status, AuthStatusAutorized)
+	}
+	if _, found := restarted.Attempts[user.Id]; found {
+		t.Errorf("attempts of the autorized user kept")
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	policy := configuration.Lockout{Duration: 15 * time.Minute, MaxDuration: 2 * time.Hour}
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{lockouts: 1, want: 15 * time.Minute},
+		{lockouts: 2, want: 30 * time.Minute},
+		{lockouts: 3, want: time.Hour},
+		{lockouts: 4, want: 2 * time.Hour},
+		{lockouts: 100, want: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.lockouts), func(t *testing.T) {
+			if got := lockoutDuration(policy, tt.lockouts); got != tt.want {
+				t.Errorf("lockoutDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 10 * time.Second, want: "1m"},
+		{d: 15*time.Minute - time.Second, want: "15m"},
+		{d: 90 * time.Minute, want: "1h30m"},
+		{d: 24 * time.Hour, want: "24h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := PrintDuration(tt.d); got != tt.want {
+				t.Errorf("PrintDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth_AutorizeNewUser_Concurrent(t *testing.T) {
+	conf := configuration.Configuration{
+		Telegram: configuration.Telegram{
+			Passwd: "password",
+		},
+	}
+	a := &Auth{
+		Attempts: make(map[int]Attempt),
+		conf:     conf,
+		store:    newTestStore(t),
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(2)
+		go func(userId int) {
+			defer wg.Done()
+			a.AutorizeNewUser(User{Id: userId}, "password")
+		}(i)
+		go func(userId int) {
+			defer wg.Done()
+			a.CheckAutorized(userId)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(a.Autorized) != 10 {
+		t.Errorf("%v users autorized, want 10", len(a.Autorized))
+	}
+}
+
+func TestAuth_Reload(t *testing.T) {
+	store := newTestStore(t)
+	running := []User{{Id: 1, Username: "user"}}
+
+	tests := []struct {
+		name          string
+		autorizedFile string
+		wantAutorized []User
+		wantErr       bool
+	}{
+		{
+			name:          "user added by hand",
+			autorizedFile: `{"version": 2, "users": [{"id": 1, "username": "user"}, {"id": 2, "username": "other"}]}`,
+			wantAutorized: []User{{Id: 1, Username: "user"}, {Id: 2, Username: "other"}},
+			wantErr:       false,
+		},
+		{
+			name:          "empty file",
+			autorizedFile: "",
+			wantAutorized: nil,
+			wantErr:       false,
+		},
+		{
+			name:          "invalid file",
+			autorizedFile: `[{"id": 1, "username": "user"},]`,
+			wantAutorized: running,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, file := range []string{blacklistFile, adminFile} {
+				err := os.WriteFile(filepath.Join(store.dir, file), nil, 0644)
+				if err != nil {
+					t.Fatalf("error writing file: %v", err)
+				}
+			}
+			err := os.WriteFile(filepath.Join(store.dir, autorizedFile), []byte(tt.autorizedFile), 0644)
+			if err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+
+			a := &Auth{
+				Autorized: running,
+				Attempts:  make(map[int]Attempt),
+				store:     store,
+			}
+			err = a.Reload()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Auth.Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(a.Autorized, tt.wantAutorized) {
+				t.Errorf("Auth.Reload() autorized = %v, want %v", a.Autorized, tt.wantAutorized)
+			}
+		})
+	}
+}
+
+func TestComparePassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		password string
+		want     bool
+	}{
+		{
+			name:     "clear password",
+			expected: "password",
+			password: "password",
+			want:     true,
+		},
+		{
+			name:     "wrong clear password",
+			expected: "password",
+			password: "passwor",
+			want:     false,
+		},
+		{
+			name:     "hashed password",
+			expected: string(hash),
+			password: "password",
+			want:     true,
+		},
+		{
+			name:     "wrong hashed password",
+			expected: string(hash),
+			password: "wrongPassword",
+			want:     false,
+		},
+		{
+			name:     "hash sent as password",
+			expected: string(hash),
+			password: string(hash),
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := comparePassword(tt.expected, tt.password); got != tt.want {
+				t.Errorf("comparePassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth_ManageUsers(t *testing.T) {
+	tests := []struct {
+		name          string
+		change        func(a *Auth) error
+		wantAutorized []User
+		wantBlacklist []User
+		wantAdmins    []User
+		wantErr       error
+	}{
+		{
+			name:          "revoke",
+			change:        func(a *Auth) error { return a.Revoke(3) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}},
+		},
+		{
+			name:          "revoke admin",
+			change:        func(a *Auth) error { return a.Revoke(2) },
+			wantAutorized: []User{{Id: 3, Username: "user"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    nil,
+		},
+		{
+			name:          "unblacklist",
+			change:        func(a *Auth) error { return a.Unblacklist(1) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}},
+			wantBlacklist: nil,
+			wantAdmins:    []User{{Id: 2, Username: "admin"}},
+		},
+		{
+			name:          "set admin role",
+			change:        func(a *Auth) error { return a.SetRole(3, RoleAdmin) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}},
+		},
+		{
+			name:          "set viewer role",
+			change:        func(a *Auth) error { return a.SetRole(3, RoleViewer) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user", Role: RoleViewer}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}},
+		},
+		{
+			name:          "demote admin",
+			change:        func(a *Auth) error { return a.SetRole(2, RoleManager) },
+			wantAutorized: []User{{Id: 2, Username: "admin", Role: RoleManager}, {Id: 3, Username: "user"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    nil,
+		},
+		{
+			name:          "invited viewer",
+			change:        func(a *Auth) error { return a.AutorizeInvitedUser(User{Id: 4, Username: "new"}, RoleViewer) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}, {Id: 4, Username: "new", Role: RoleViewer}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}},
+		},
+		{
+			name:          "invited admin",
+			change:        func(a *Auth) error { return a.AutorizeInvitedUser(User{Id: 4, Username: "new"}, RoleAdmin) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}, {Id: 4, Username: "new"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}, {Id: 4, Username: "new"}},
+		},
+		{
+			name:          "set role of blacklisted",
+			change:        func(a *Auth) error { return a.SetRole(1, RoleAdmin) },
+			wantAutorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}},
+			wantBlacklist: []User{{Id: 1, Username: "blacklisted"}},
+			wantAdmins:    []User{{Id: 2, Username: "admin"}},
+			wantErr:       ErrUserNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Auth{
+				Blacklist: []User{{Id: 1, Username: "blacklisted"}},
+				Autorized: []User{{Id: 2, Username: "admin"}, {Id: 3, Username: "user"}},
+				Admins:    []User{{Id: 2, Username: "admin"}},
+				Attempts:  map[int]Attempt{1: {Lockouts: 1}},
+				store:     newTestStore(t),
+			}
+			for _, save := range []func() error{a.saveBlacklist, a.saveAutorized, a.saveAdmins} {
+				if err := save(); err != nil {
+					t.Fatalf("error saving the lists: %v", err)
+				}
+			}
+
+			err := tt.change(a)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("change error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// the lists are saved
+			err = a.Reload()
+			if err != nil {
+				t.Fatalf("Auth.Reload() error = %v", err)
+			}
+			if !reflect.DeepEqual(a.Autorized, tt.wantAutorized) {
+				t.Errorf("autorized = %v, want %v", a.Autorized, tt.wantAutorized)
+			}
+			if !reflect.DeepEqual(a.Blacklist, tt.wantBlacklist) {
+				t.Errorf("blacklist = %v, want %v", a.Blacklist, tt.wantBlacklist)
+			}
+			if !reflect.DeepEqual(a.Admins, tt.wantAdmins) {
+				t.Errorf("admins = %v, want %v", a.Admins, tt.wantAdmins)
+			}
+		})
+	}
+}
+
+func TestAuth_CheckAutorizedRole(t *testing.T) {
+	a := &Auth{
+		Blacklist: []User{{Id: 1}},
+		Autorized: []User{{Id: 2}, {Id: 3, Role: RoleViewer}, {Id: 4, Role: RoleManager}, {Id: 5, Role: RoleAdmin}},
+		Admins:    []User{{Id: 2}},
+	}
+	tests := []struct {
+		name       string
+		userId     int
+		wantStatus AuthStatus
+		wantRole   Role
+	}{
+		{name: "blacklisted", userId: 1, wantStatus: AuthStatusBlackListed},
+		{name: "admin file", userId: 2, wantStatus: AuthStatusAutorized, wantRole: RoleAdmin},
+		{name: "viewer", userId: 3, wantStatus: AuthStatusAutorized, wantRole: RoleViewer},
+		{name: "manager", userId: 4, wantStatus: AuthStatusAutorized, wantRole: RoleManager},
+		{name: "admin role without admin file", userId: 5, wantStatus: AuthStatusAutorized, wantRole: DefaultRole},
+		{name: "new user", userId: 6, wantStatus: AuthStatusNewUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, role := a.CheckAutorized(tt.userId)
+			if status != tt.wantStatus || role != tt.wantRole {
+				t.Errorf("Auth.CheckAutorized() = %v, %v, want %v, %v", status, role, tt.wantStatus, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuth_CheckAutorizedInChat(t *testing.T) {
+	a := &Auth{
+		Blacklist: []User{{Id: 1}},
+		Autorized: []User{{Id: 2, Role: RoleManager}},
+		Chats:     []Chat{{Id: -1001234567890, Title: "Family", Role: RoleRequester}, {Id: -200, Title: "Friends"}},
+		Attempts:  map[int]Attempt{4: {LockedUntil: time.Now().Add(time.Hour)}},
+		store:     newTestStore(t),
+	}
+	tests := []struct {
+		name       string
+		userId     int
+		chatId     int64
+		wantStatus AuthStatus
+		wantRole   Role
+	}{
+		{name: "blacklisted in an autorized chat", userId: 1, chatId: -1001234567890, wantStatus: AuthStatusBlackListed},
+		{name: "own role before the chat role", userId: 2, chatId: -1001234567890, wantStatus: AuthStatusAutorized, wantRole: RoleManager},
+		{name: "new user in an autorized chat", userId: 3, chatId: -1001234567890, wantStatus: AuthStatusAutorized, wantRole: RoleRequester},
+		{name: "chat without role", userId: 3, chatId: -200, wantStatus: AuthStatusAutorized, wantRole: DefaultRole},
+		{name: "new user in another chat", userId: 3, chatId: -300, wantStatus: AuthStatusNewUser},
+		{name: "locked out in an autorized chat", userId: 4, chatId: -1001234567890, wantStatus: AuthStatusLockedOut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, role := a.CheckAutorizedInChat(tt.userId, tt.chatId)
+			if status != tt.wantStatus || role != tt.wantRole {
+				t.Errorf("Auth.CheckAutorizedInChat() = %v, %v, want %v, %v", status, role, tt.wantStatus, tt.wantRole)
+			}
+		})
+	}
+
+	// the admin role is not given to a chat, and the chats are saved
+	err := a.AutorizeChat(Chat{Id: -300, Title: "Others", Role: RoleAdmin})
+	if err != nil {
+		t.Fatalf("Auth.AutorizeChat() error = %v", err)
+	}
+	err = a.RevokeChat(-200)
+	if err != nil {
+		t.Fatalf("Auth.RevokeChat() error = %v", err)
+	}
+	err = a.RevokeChat(-200)
+	if !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("Auth.RevokeChat() error = %v, want %v", err, ErrChatNotFound)
+	}
+	err = a.Reload()
+	if err != nil {
+		t.Fatalf("Auth.Reload() error = %v", err)
+	}
+	wantChats := []Chat{{Id: -1001234567890, Title: "Family", Role: RoleRequester}, {Id: -300, Title: "Others", Role: DefaultRole}}
+	if !reflect.DeepEqual(a.GetChats(), wantChats) {
+		t.Errorf("Auth.GetChats() = %v, want %v", a.GetChats(), wantChats)
+	}
+}
+
+func TestAuth_Claim(t *testing.T) {
+	a := &Auth{
+		Blacklist: []User{{Id: 1, Username: "owner"}},
+		Attempts:  map[int]Attempt{1: {Lockouts: 2}},
+		store:     newTestStore(t),
+	}
+	code, err := a.NewClaimCode()
+	if err != nil || code == "" {
+		t.Fatalf("Auth.NewClaimCode() = %q, %v, want a code", code, err)
+	}
+
+	err = a.Claim(User{Id: 1, Username: "owner"}, "wrong")
+	if !errors.Is(err, ErrWrongClaimCode) {
+		t.Fatalf("Auth.Claim() error = %v, want %v", err, ErrWrongClaimCode)
+	}
+
+	// the code is case insensitive, the user leaves the blacklist
+	err = a.Claim(User{Id: 1, Username: "owner"}, " "+strings.ToLower(code)+" ")
+	if err != nil {
+		t.Fatalf("Auth.Claim() error = %v", err)
+	}
+	if status, role := a.CheckAutorized(1); status != AuthStatusAutorized || role != RoleAdmin {
+		t.Errorf("Auth.CheckAutorized() = %v, %v, want %v, %v", status, role, AuthStatusAutorized, RoleAdmin)
+	}
+	if _, found := a.Attempts[1]; found {
+		t.Errorf("attempts of the user not removed: %v", a.Attempts)
+	}
+
+	// the code is used once
+	err = a.Claim(User{Id: 2, Username: "other"}, code)
+	if !errors.Is(err, ErrNoClaimCode) {
+		t.Errorf("Auth.Claim() error = %v, want %v", err, ErrNoClaimCode)
+	}
+	if a.ClaimPending() {
+		t.Errorf("Auth.ClaimPending() = true after the claim")
+	}
+
+	// the admins are saved, no code is created once there is an admin
+	err = a.Reload()
+	if err != nil {
+		t.Fatalf("Auth.Reload() error = %v", err)
+	}
+	if !reflect.DeepEqual(a.Admins, []User{{Id: 1, Username: "owner"}}) {
+		t.Errorf("admins = %v, want the owner", a.Admins)
+	}
+	code, err = a.NewClaimCode()
+	if err != nil || code != "" || a.ClaimPending() {
+		t.Errorf("Auth.NewClaimCode() = %q, %v, want no code", code, err)
+	}
+}
+
+// attemptsErrorStore is a store that can't save the attempts.
+type attemptsErrorStore struct {
+	UserStore
+}
+
+// errSaveAttempts is the error of attemptsErrorStore.SaveAttempts.
+var errSaveAttempts = errors.New("attempts not saved")
+
+func (s attemptsErrorStore) SaveAttempts(map[int]Attempt) error {
+	return errSaveAttempts
+}
+
+func TestAuth_SaveAttemptsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(a *Auth) error
+	}{
+		{
+			name:   "unblacklist",
+			change: func(a *Auth) error { return a.Unblacklist(1) },
+		},
+		{
+			name:   "invited user",
+			change: func(a *Auth) error { return a.AutorizeInvitedUser(User{Id: 1, Username: "blacklisted"}, RoleViewer) },
+		},
+		{
+			name: "claim",
+			change: func(a *Auth) error {
+				code, err := a.NewClaimCode()
+				if err != nil {
+					return err
+				}
+				return a.Claim(User{Id: 1, Username: "blacklisted"}, code)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Auth{
+				Blacklist: []User{{Id: 1, Username: "blacklisted"}},
+				Attempts:  map[int]Attempt{1: {Lockouts: 1}},
+				store:     attemptsErrorStore{UserStore: newTestStore(t)},
+			}
+			if err := tt.change(a); !errors.Is(err, errSaveAttempts) {
+				t.Errorf("change error = %v, want %v", err, errSaveAttempts)
+			}
+		})
+	}
+
+	// a wrong password that can't be counted is an error
+	a := &Auth{
+		Attempts: make(map[int]Attempt),
+		conf:     configuration.Configuration{Telegram: configuration.Telegram{Passwd: "password"}},
+		store:    attemptsErrorStore{UserStore: newTestStore(t)},
+	}
+	if status, _ := a.AutorizeNewUser(User{Id: 2, Username: "new"}, "wrong"); status != AuthStatusError {
+		t.Errorf("Auth.AutorizeNewUser() status = %v, want %v", status, AuthStatusError)
+	}
+}
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{role: RoleViewer, required: RoleViewer, want: true},
+		{role: RoleViewer, required: RoleRequester, want: false},
+		{role: RoleManager, required: RoleRequester, want: true},
+		{role: RoleManager, required: RoleAdmin, want: false},
+		{role: RoleAdmin, required: RoleManager, want: true},
+		{role: Role("unknown"), required: RoleViewer, want: false},
+		{role: "", required: RoleViewer, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role.String()+"/"+tt.required.String(), func(t *testing.T) {
+			if got := tt.role.Allows(tt.required); got != tt.want {
+				t.Errorf("Role.Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfiguredDefaultRole(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultRole string
+		want        Role
+	}{
+		{name: "not set", defaultRole: "", want: DefaultRole},
+		{name: "viewer", defaultRole: "viewer", want: RoleViewer},
+		{name: "manager", defaultRole: "manager", want: RoleManager},
+		{name: "admin", defaultRole: "admin", want: DefaultRole},
+		{name: "unknown", defaultRole: "owner", want: DefaultRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConfiguredDefaultRole(configuration.Auth{DefaultRole: tt.defaultRole}); got != tt.want {
+				t.Errorf("ConfiguredDefaultRole() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the users and the chats without role have the configured role
+	a := &Auth{
+		Autorized: []User{{Id: 1}},
+		Chats:     []Chat{{Id: -100}},
+		conf:      configuration.Configuration{Auth: configuration.Auth{DefaultRole: "viewer"}},
+	}
+	if status, role := a.CheckAutorizedInChat(1, 0); status != AuthStatusAutorized || role != RoleViewer {
+		t.Errorf("Auth.CheckAutorized() = %v, %v, want %v, %v", status, role, AuthStatusAutorized, RoleViewer)
+	}
+	if status, role := a.CheckAutorizedInChat(2, -100); status != AuthStatusAutorized || role != RoleViewer {
+		t.Errorf("Auth.CheckAutorizedInChat() = %v, %v, want %v, %v", status, role, AuthStatusAutorized, RoleViewer)
+	}
+}
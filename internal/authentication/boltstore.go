@@ -0,0 +1,347 @@
+package authentication
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// databaseFile is the name of the database of the BoltStore.
+	databaseFile = "auth.db"
+	// openTimeout is the time to wait for the lock of the database, held by a running bot.
+	openTimeout = time.Second
+)
+
+var (
+	// attemptsBucket holds the attempts by user id.
+	attemptsBucket = []byte("attempts")
+	// chatsBucket holds the autorized group chats by chat id.
+	chatsBucket = []byte("chats")
+	// metaBucket holds the version of the schema of the database.
+	metaBucket = []byte("meta")
+	// versionKey is the key of the schema version in the meta bucket.
+	versionKey = []byte("version")
+)
+
+// BoltStore saves the users lists, the chats and the attempts in an embedded database, a bucket per list with the users by id.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens the database in the directory, and creates it if it does not exist.
+// A new database imports the authorizations files of the directory, to switch from the JSONStore without losing the users.
+func NewBoltStore(dir string) (*BoltStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, databaseFile), 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", databaseFile, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta != nil {
+			version := int(decodeId(meta.Get(versionKey)))
+			if version > schemaVersion {
+				return fmt.Errorf("%s: version %d is newer than the supported version %d", databaseFile, version, schemaVersion)
+			}
+			if version == schemaVersion {
+				return nil
+			}
+
+			log.Info().Str("file", databaseFile).Int("from", version).Int("to", schemaVersion).Msg("migrating the database")
+			err := migrateBolt(tx, version)
+			if err != nil {
+				return err
+			}
+			return meta.Put(versionKey, encodeId(schemaVersion))
+		}
+
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		err = importJSON(tx, dir)
+		if err != nil {
+			return err
+		}
+		return meta.Put(versionKey, encodeId(schemaVersion))
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Users(list List) ([]User, error) {
+	var users []User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		users, err = getUsers(tx, list)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *BoltStore) SaveUsers(list List, users []User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putUsers(tx, list, users)
+	})
+}
+
+func (s *BoltStore) Chats() ([]Chat, error) {
+	var chats []Chat
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		chats, err = getChats(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (s *BoltStore) SaveChats(chats []Chat) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putChats(tx, chats)
+	})
+}
+
+func (s *BoltStore) Attempts() (map[int]Attempt, error) {
+	attempts := make(map[int]Attempt)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(attemptsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var attempt Attempt
+			err := json.Unmarshal(v, &attempt)
+			if err != nil {
+				return fmt.Errorf("attempts: user %d: %w", decodeId(k), err)
+			}
+			attempts[int(decodeId(k))] = attempt
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (s *BoltStore) SaveAttempts(attempts map[int]Attempt) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putAttempts(tx, attempts)
+	})
+}
+
+// Paths returns nothing, the database is not edited by hand.
+func (s *BoltStore) Paths() []string {
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// getUsers returns the users of the bucket of the list, nil if it doesn't exist.
+func getUsers(tx *bolt.Tx, list List) ([]User, error) {
+	bucket := tx.Bucket([]byte(list))
+	if bucket == nil {
+		return nil, nil
+	}
+	var users []User
+	err := bucket.ForEach(func(k, v []byte) error {
+		var user User
+		err := json.Unmarshal(v, &user)
+		if err != nil {
+			return fmt.Errorf("%s: user %d: %w", list, decodeId(k), err)
+		}
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// getChats returns the chats of the chats bucket, nil if it doesn't exist.
+func getChats(tx *bolt.Tx) ([]Chat, error) {
+	bucket := tx.Bucket(chatsBucket)
+	if bucket == nil {
+		return nil, nil
+	}
+	var chats []Chat
+	err := bucket.ForEach(func(k, v []byte) error {
+		var chat fileChat
+		err := json.Unmarshal(v, &chat)
+		if err != nil {
+			return fmt.Errorf("chats: chat %d: %w", decodeId(k), err)
+		}
+		chats = append(chats, chat.chat())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+// migrateBolt migrates the users lists and the chats of the database from the version to schemaVersion.
+// The chats are always rewritten, to save them with their title.
+func migrateBolt(tx *bolt.Tx, version int) error {
+	chats, err := getChats(tx)
+	if err != nil {
+		return err
+	}
+	if version < rolesVersion {
+		for _, list := range lists {
+			users, err := getUsers(tx, list)
+			if err != nil {
+				return err
+			}
+			err = putUsers(tx, list, migrateRoles(list, users))
+			if err != nil {
+				return err
+			}
+		}
+		chats = migrateChatRoles(chats)
+	}
+	return putChats(tx, chats)
+}
+
+// putUsers replaces the bucket of the list with the users.
+func putUsers(tx *bolt.Tx, list List, users []User) error {
+	bucket, err := recreateBucket(tx, []byte(list))
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		value, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(encodeId(int64(user.Id)), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putChats replaces the chats bucket with the chats.
+func putChats(tx *bolt.Tx, chats []Chat) error {
+	bucket, err := recreateBucket(tx, chatsBucket)
+	if err != nil {
+		return err
+	}
+	for _, chat := range chats {
+		value, err := json.Marshal(chat)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(encodeId(chat.Id), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putAttempts replaces the bucket of the attempts.
+func putAttempts(tx *bolt.Tx, attempts map[int]Attempt) error {
+	bucket, err := recreateBucket(tx, attemptsBucket)
+	if err != nil {
+		return err
+	}
+	for userId, attempt := range attempts {
+		value, err := json.Marshal(attempt)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(encodeId(int64(userId)), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recreateBucket deletes the bucket if it exists and creates it empty.
+func recreateBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	err := tx.DeleteBucket(name)
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return nil, err
+	}
+	return tx.CreateBucket(name)
+}
+
+// importJSON copies the authorizations files, the chats and the attempts of the directory in the new database, the missing files are skipped.
+func importJSON(tx *bolt.Tx, dir string) error {
+	files := &JSONStore{dir: dir}
+	for _, list := range lists {
+		if _, err := os.Stat(files.path(list)); os.IsNotExist(err) {
+			continue
+		}
+		users, err := files.Users(list)
+		if err != nil {
+			return err
+		}
+		err = putUsers(tx, list, users)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("file", listsFiles[list]).Int("users", len(users)).Msg("users file imported in the database")
+	}
+
+	if _, err := os.Stat(files.chatsPath()); err == nil {
+		chats, err := files.Chats()
+		if err != nil {
+			return err
+		}
+		err = putChats(tx, chats)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("file", chatsFile).Int("chats", len(chats)).Msg("chats file imported in the database")
+	}
+
+	attempts, err := files.Attempts()
+	if err != nil {
+		return err
+	}
+	return putAttempts(tx, attempts)
+}
+
+// encodeId returns the key of the id, in big endian so the users are sorted by id.
+func encodeId(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+// decodeId returns the id of the key.
+func decodeId(key []byte) int64 {
+	if len(key) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(key))
+}
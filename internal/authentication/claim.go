@@ -0,0 +1,96 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// claimCodeBytes is the number of random bytes of the claim code, 16 characters once encoded.
+	claimCodeBytes = 10
+)
+
+var (
+	// ErrNoClaimCode is returned when claiming the bot while there is no claim code, an admin already exists.
+	ErrNoClaimCode = errors.New("no claim code")
+	// ErrWrongClaimCode is returned when claiming the bot with another code than the claim code.
+	ErrWrongClaimCode = errors.New("wrong claim code")
+)
+
+// NewClaimCode creates the one-time code making the first user sending it an admin, and returns it.
+// It returns an empty code if there is an admin. The code is only kept in memory, a new one is created on restart.
+func (a *Auth) NewClaimCode() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.Admins) > 0 {
+		return "", nil
+	}
+
+	bytes := make([]byte, claimCodeBytes)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	a.claimCode = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(bytes)
+	return a.claimCode, nil
+}
+
+// ClaimPending returns true if the bot has no admin and waits for the claim code.
+func (a *Auth) ClaimPending() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.claimCode != "" && len(a.Admins) == 0
+}
+
+// Claim makes the user an admin if the code is the claim code, and invalidates the code.
+// The user is autorized, and removed from the blacklist and the attempts if needed.
+func (a *Auth) Claim(user User, code string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// an admin may have been added in the file since the code was created
+	if a.claimCode == "" || len(a.Admins) > 0 {
+		a.claimCode = ""
+		return ErrNoClaimCode
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.ToUpper(strings.TrimSpace(code))), []byte(a.claimCode)) != 1 {
+		return ErrWrongClaimCode
+	}
+
+	var blacklisted bool
+	a.Blacklist, blacklisted = removeUser(a.Blacklist, user.Id)
+	if blacklisted {
+		err := a.saveBlacklist()
+		if err != nil {
+			return err
+		}
+	}
+	if _, found := a.Attempts[user.Id]; found {
+		delete(a.Attempts, user.Id)
+		err := a.saveAttempts()
+		if err != nil {
+			return err
+		}
+	}
+	err := a.addToAutorized(User{Id: user.Id, Username: user.Username})
+	if err != nil {
+		return err
+	}
+	a.Admins = append(a.Admins, User{Id: user.Id, Username: user.Username})
+	err = a.saveAdmins()
+	if err != nil {
+		a.Admins = nil
+		return err
+	}
+
+	a.claimCode = ""
+	log.Info().Int("userId", user.Id).Str("username", user.Username).Msg("bot claimed, the user is now admin")
+	return nil
+}
@@ -0,0 +1,295 @@
+package authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"telarr/internal/atomicfile"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// blacklistFile is the name of the file that contains the blacklist.
+	blacklistFile = "blacklist.json"
+	// autorizedFile is the name of the file that contains the autorized.
+	autorizedFile = "autorized.json"
+	// adminFile is the name of the file that contains the admins.
+	adminFile = "admin.json"
+	// chatsFile is the name of the file that contains the autorized group chats.
+	chatsFile = "chats.json"
+	// attemptsFile is the name of the file that contains the failed attempts.
+	attemptsFile = "attempts.json"
+
+	// schemaVersion is the version of the format of the users files written by the store.
+	// Version 0 is a bare array of users, with "name" instead of "username" in the first files.
+	// Version 1 wraps the users in an object holding the version.
+	// Version 2 gives the manager role to the autorized users and the chats without a role, see migrateRoles.
+	// Version 3 saves the chats in "chats" with their title, instead of in "users" with the title in "username".
+	schemaVersion = 3
+)
+
+var (
+	// listsFiles are the files of the users lists.
+	listsFiles = map[List]string{
+		ListBlacklist: blacklistFile,
+		ListAutorized: autorizedFile,
+		ListAdmins:    adminFile,
+	}
+)
+
+// JSONStore saves the users lists in the authorizations files, which can be edited by hand.
+// The files are written atomically, so a crash never leaves them half written.
+type JSONStore struct {
+	dir string
+}
+
+// usersFile is the content of a users file.
+type usersFile struct {
+	Version int        `json:"version"`
+	Users   []fileUser `json:"users"`
+}
+
+// chatsList is the content of the chats file, Users holds the chats of the files older than chatsVersion.
+type chatsList struct {
+	Version int        `json:"version"`
+	Chats   []fileChat `json:"chats"`
+	Users   []fileChat `json:"users,omitempty"`
+}
+
+// fileUser is a user read from a file, Name is the username in the files of version 0.
+type fileUser struct {
+	User
+	Name string `json:"name,omitempty"`
+}
+
+// NewJSONStore creates a store saving the files in the directory, and creates the missing files.
+// The files in an older format are migrated, a file that can't be parsed is an error.
+func NewJSONStore(dir string) (*JSONStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &JSONStore{dir: dir}
+	for _, list := range lists {
+		_, err = os.Stat(s.path(list))
+		if os.IsNotExist(err) {
+			err = s.SaveUsers(list, nil)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		users, version, err := s.read(list)
+		if err != nil {
+			return nil, err
+		}
+		if version < schemaVersion {
+			log.Info().Str("file", listsFiles[list]).Int("from", version).Int("to", schemaVersion).Msg("migrating the users file")
+			err = s.SaveUsers(list, users)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = os.Stat(s.chatsPath())
+	if os.IsNotExist(err) {
+		err = s.SaveChats(nil)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	chats, version, err := s.readChats()
+	if err != nil {
+		return nil, err
+	}
+	if version < schemaVersion {
+		log.Info().Str("file", chatsFile).Int("from", version).Int("to", schemaVersion).Msg("migrating the chats file")
+		err = s.SaveChats(chats)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *JSONStore) Users(list List) ([]User, error) {
+	users, _, err := s.read(list)
+	return users, err
+}
+
+func (s *JSONStore) SaveUsers(list List, users []User) error {
+	file := usersFile{
+		Version: schemaVersion,
+		Users:   make([]fileUser, len(users)),
+	}
+	for i, user := range users {
+		file.Users[i] = fileUser{User: user}
+	}
+
+	bytes, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.path(list), bytes, 0644)
+}
+
+func (s *JSONStore) Chats() ([]Chat, error) {
+	chats, _, err := s.readChats()
+	return chats, err
+}
+
+func (s *JSONStore) SaveChats(chats []Chat) error {
+	file := chatsList{
+		Version: schemaVersion,
+		Chats:   make([]fileChat, len(chats)),
+	}
+	for i, chat := range chats {
+		file.Chats[i] = fileChat{Chat: chat}
+	}
+
+	bytes, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.chatsPath(), bytes, 0644)
+}
+
+func (s *JSONStore) Attempts() (map[int]Attempt, error) {
+	attempts := make(map[int]Attempt)
+
+	bytes, err := os.ReadFile(filepath.Join(s.dir, attemptsFile))
+	if os.IsNotExist(err) {
+		return attempts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) == 0 {
+		return attempts, nil
+	}
+
+	err = json.Unmarshal(bytes, &attempts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", attemptsFile, err)
+	}
+	return attempts, nil
+}
+
+func (s *JSONStore) SaveAttempts(attempts map[int]Attempt) error {
+	bytes, err := json.MarshalIndent(attempts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(s.dir, attemptsFile), bytes, 0644)
+}
+
+func (s *JSONStore) Paths() []string {
+	paths := make([]string, len(lists), len(lists)+1)
+	for i, list := range lists {
+		paths[i] = s.path(list)
+	}
+	return append(paths, s.chatsPath())
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// path returns the path of the file of the list.
+func (s *JSONStore) path(list List) string {
+	return filepath.Join(s.dir, listsFiles[list])
+}
+
+// chatsPath returns the path of the chats file.
+func (s *JSONStore) chatsPath() string {
+	return filepath.Join(s.dir, chatsFile)
+}
+
+// read reads the file of the list and returns its users and the version of its format, an empty file is an empty list.
+func (s *JSONStore) read(list List) ([]User, int, error) {
+	fileName := listsFiles[list]
+	content, err := os.ReadFile(s.path(list))
+	if err != nil {
+		return nil, 0, err
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, schemaVersion, nil
+	}
+
+	// the files of version 0 are a bare array
+	var file usersFile
+	if content[0] == '[' {
+		err = json.Unmarshal(content, &file.Users)
+	} else {
+		err = json.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if file.Version > schemaVersion {
+		return nil, 0, fmt.Errorf("%s: version %d is newer than the supported version %d", fileName, file.Version, schemaVersion)
+	}
+	withoutRoles := file.Version < rolesVersion
+
+	var users []User
+	for _, u := range file.Users {
+		if u.Username == "" && u.Name != "" {
+			u.Username = u.Name
+			// the file must be rewritten with "username"
+			file.Version = 0
+		}
+		users = append(users, u.User)
+	}
+	if withoutRoles {
+		users = migrateRoles(list, users)
+	}
+	return users, file.Version, nil
+}
+
+// readChats reads the chats file and returns its chats and the version of its format, an empty file is an empty list.
+func (s *JSONStore) readChats() ([]Chat, int, error) {
+	content, err := os.ReadFile(s.chatsPath())
+	if err != nil {
+		return nil, 0, err
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, schemaVersion, nil
+	}
+
+	// the files of version 0 are a bare array of users
+	var file chatsList
+	if content[0] == '[' {
+		err = json.Unmarshal(content, &file.Users)
+	} else {
+		err = json.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", chatsFile, err)
+	}
+	if file.Version > schemaVersion {
+		return nil, 0, fmt.Errorf("%s: version %d is newer than the supported version %d", chatsFile, file.Version, schemaVersion)
+	}
+	withoutRoles := file.Version < rolesVersion
+	if len(file.Users) > 0 {
+		// the file must be rewritten with "chats"
+		file.Version = 0
+	}
+
+	var chats []Chat
+	for _, c := range append(file.Chats, file.Users...) {
+		chats = append(chats, c.chat())
+	}
+	if withoutRoles {
+		chats = migrateChatRoles(chats)
+	}
+	return chats, file.Version, nil
+}
@@ -0,0 +1,117 @@
+package authentication
+
+import (
+	"strconv"
+	"strings"
+	"telarr/configuration"
+	"telarr/internal/tgclient"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// defaultMaxAttempts is the number of wrong passwords before a lockout when none is configured.
+	defaultMaxAttempts = 3
+	// defaultLockoutDuration is the time of the first lockout when none is configured.
+	defaultLockoutDuration = 15 * time.Minute
+	// defaultMaxLockoutDuration is the longest lockout when none is configured.
+	defaultMaxLockoutDuration = 24 * time.Hour
+)
+
+// Attempt is the record of the wrong passwords entered by a user.
+type Attempt struct {
+	// Failures is the number of wrong passwords since the last lockout.
+	Failures int `json:"failures"`
+	// Lockouts is the number of times the user was locked out, each lockout lasts twice the previous one.
+	Lockouts int `json:"lockouts"`
+	// LockedUntil is the time the user can enter the password again.
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// LockedUntil returns the time the user can enter the password again, false if the user is not locked out.
+func (a *Auth) LockedUntil(userId int) (time.Time, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.lockedUntil(userId)
+}
+
+// lockedUntil returns the end of the lockout of the user, false if the user is not locked out, a.mu must be held.
+func (a *Auth) lockedUntil(userId int) (time.Time, bool) {
+	until := a.Attempts[userId].LockedUntil
+	return until, time.Now().Before(until)
+}
+
+// lockoutPolicy returns the lockout policy of the configuration, with the defaults for the fields not set, a.mu must be held.
+func (a *Auth) lockoutPolicy() configuration.Lockout {
+	policy := a.conf.Lockout
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.Duration == 0 {
+		policy.Duration = defaultLockoutDuration
+	}
+	if policy.MaxDuration == 0 {
+		policy.MaxDuration = defaultMaxLockoutDuration
+	}
+	return policy
+}
+
+// lockoutDuration returns the duration of the nth lockout of a user: the duration of the policy doubled at each lockout, up to its max duration.
+func lockoutDuration(policy configuration.Lockout, lockouts int) time.Duration {
+	d := policy.Duration
+	for i := 1; i < lockouts && d < policy.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > policy.MaxDuration {
+		return policy.MaxDuration
+	}
+	return d
+}
+
+// saveAttempts saves the attempts, so the counters and the lockouts survive a restart, a.mu must be held.
+func (a *Auth) saveAttempts() error {
+	err := a.store.SaveAttempts(a.Attempts)
+	if err != nil {
+		log.Err(err).Msg("error when saving the attempts")
+		return err
+	}
+
+	return nil
+}
+
+// notifyAdmins sends the text to all the admins.
+func (a *Auth) notifyAdmins(bot tgclient.Client, text string) {
+	for _, admin := range a.GetAdmins() {
+		_, err := bot.SendMessage(tgclient.SendMessage{SendMessage: telegram.SendMessage{
+			ChatID: int64(admin.Id),
+			Text:   text,
+		}})
+		if err != nil {
+			log.Err(err).Int("adminId", admin.Id).Msg("error when notifying admin")
+		}
+	}
+}
+
+// PrintDuration returns the duration rounded to the minute, e.g. "1h30m", at least one minute.
+func PrintDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		d = time.Minute
+	}
+	str := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+// printUser returns the username of the user, or its id if it has none.
+func printUser(user User) string {
+	if user.Username == "" {
+		return strconv.Itoa(user.Id)
+	}
+	return "@" + user.Username
+}
@@ -0,0 +1,31 @@
+package authentication
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword returns the bcrypt hash of the password, to put in the configuration instead of the password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// comparePassword returns true if the password matches the one of the configuration,
+// which is either a bcrypt hash or the password in clear. Both are compared in constant time.
+func comparePassword(expected string, password string) bool {
+	if IsPasswordHash(expected) {
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// IsPasswordHash returns true if the password of the configuration is a bcrypt hash.
+func IsPasswordHash(passwd string) bool {
+	_, err := bcrypt.Cost([]byte(passwd))
+	return err == nil
+}
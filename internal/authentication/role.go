@@ -0,0 +1,71 @@
+package authentication
+
+import (
+	"fmt"
+	"telarr/configuration"
+)
+
+// Role is the role of an autorized user, giving access to the commands and callbacks.
+// Each role can do everything the previous ones can.
+type Role string
+
+const (
+	// RoleViewer can browse the libraries and follow the downloads.
+	RoleViewer Role = "viewer"
+	// RoleRequester can also add movies and series.
+	RoleRequester Role = "requester"
+	// RoleManager can also remove movies and series with their files.
+	RoleManager Role = "manager"
+	// RoleAdmin can also use the admin commands. The admins are the users of the admin file.
+	RoleAdmin Role = "admin"
+
+	// DefaultRole is the role of the users and the chats without role, when auth.defaultRole is not set.
+	// The users autorized before the roles keep the manager role, given to them by the migration of the store.
+	DefaultRole = RoleRequester
+)
+
+var (
+	// Roles are the roles from the lowest to the highest.
+	Roles = []Role{RoleViewer, RoleRequester, RoleManager, RoleAdmin}
+)
+
+func (r Role) String() string {
+	return string(r)
+}
+
+// level returns the position of the role in Roles, -1 if the role is unknown.
+func (r Role) level() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Allows returns true if the role can do what the required role can.
+func (r Role) Allows(required Role) bool {
+	return r.level() >= 0 && r.level() >= required.level()
+}
+
+// ConfiguredDefaultRole returns the role of the users and the chats without role, DefaultRole if auth.defaultRole is not set or invalid.
+// The admin role is never a default role.
+func ConfiguredDefaultRole(config configuration.Auth) Role {
+	role, err := ParseRole(config.DefaultRole)
+	if err != nil || role == RoleAdmin {
+		return DefaultRole
+	}
+	return role
+}
+
+// ParseRole returns the role from its name, the default role if empty.
+func ParseRole(name string) (Role, error) {
+	if name == "" {
+		return DefaultRole, nil
+	}
+	role := Role(name)
+	if role.level() < 0 {
+		return "", fmt.Errorf("unknown role %q, must be one of %v", name, Roles)
+	}
+	return role, nil
+}
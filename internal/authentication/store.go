@@ -0,0 +1,111 @@
+package authentication
+
+import (
+	"fmt"
+	"telarr/configuration"
+)
+
+const (
+	// DefaultPath is the directory of the authorizations files or of the database when no path is configured.
+	DefaultPath = "/opt/telarr/auth"
+
+	// rolesVersion is the schema version from which a user without role has the configured default role.
+	rolesVersion = 2
+	// chatsVersion is the schema version from which the chats are saved with their title, instead of as users with the title in the username.
+	chatsVersion = 3
+)
+
+// List is a users list kept by a UserStore.
+type List string
+
+const (
+	// ListBlacklist are the users not allowed to use the bot.
+	ListBlacklist List = "blacklist"
+	// ListAutorized are the users allowed to use the bot.
+	ListAutorized List = "autorized"
+	// ListAdmins are the users allowed to use the admin commands.
+	ListAdmins List = "admins"
+)
+
+var (
+	// lists are all the users lists.
+	lists = []List{ListBlacklist, ListAutorized, ListAdmins}
+)
+
+// UserStore saves the users lists, the autorized group chats and the wrong passwords attempts.
+// The calls are serialized by Auth, a store doesn't have to be safe for concurrent use.
+type UserStore interface {
+	// Users returns the users of the list, nil if it is empty.
+	Users(list List) ([]User, error)
+	// SaveUsers replaces the users of the list.
+	SaveUsers(list List, users []User) error
+
+	// Chats returns the autorized group chats, nil if there is none.
+	Chats() ([]Chat, error)
+	// SaveChats replaces the autorized group chats.
+	SaveChats(chats []Chat) error
+
+	// Attempts returns the wrong passwords attempts of the users.
+	Attempts() (map[int]Attempt, error)
+	// SaveAttempts replaces the attempts.
+	SaveAttempts(attempts map[int]Attempt) error
+
+	// Paths returns the files that can be edited by hand, watched to reload the lists.
+	Paths() []string
+	// Close releases the store.
+	Close() error
+}
+
+// fileChat is a chat read from the store, Username is the title of the chats saved before chatsVersion.
+type fileChat struct {
+	Chat
+	Username string `json:"username,omitempty"`
+}
+
+// chat returns the chat, with the title read from the username if it has none.
+func (c fileChat) chat() Chat {
+	if c.Title == "" {
+		c.Title = c.Username
+	}
+	return c.Chat
+}
+
+// migrateRoles gives the manager role to the users without role of the autorized list, read from a schema older than rolesVersion.
+// They were managers before the default role was configurable, they keep their access whatever the default role.
+func migrateRoles(list List, users []User) []User {
+	if list != ListAutorized {
+		return users
+	}
+	for i := range users {
+		if users[i].Role == "" {
+			users[i].Role = RoleManager
+		}
+	}
+	return users
+}
+
+// migrateChatRoles gives the manager role to the chats without role, read from a schema older than rolesVersion, see migrateRoles.
+func migrateChatRoles(chats []Chat) []Chat {
+	for i := range chats {
+		if chats[i].Role == "" {
+			chats[i].Role = RoleManager
+		}
+	}
+	return chats
+}
+
+// NewStore creates the store of the configuration.
+func NewStore(conf configuration.Auth) (UserStore, error) {
+	dir := conf.Path
+	if dir == "" {
+		dir = DefaultPath
+	}
+
+	switch conf.Backend {
+	case "", configuration.AuthBackendJson:
+		return NewJSONStore(dir)
+	case configuration.AuthBackendBolt:
+		return NewBoltStore(dir)
+	}
+	return nil, fmt.Errorf("unknown auth backend %q", conf.Backend)
+}
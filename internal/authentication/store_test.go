@@ -0,0 +1,326 @@
+package authentication
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNewJSONStore_Migration(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		wantUsers []User
+		wantErr   bool
+	}{
+		{
+			name:      "bare array with name",
+			file:      `[{"id": 1, "name": "user"}]`,
+			wantUsers: []User{{Id: 1, Username: "user", Role: RoleManager}},
+		},
+		{
+			name:      "bare array with username",
+			file:      `[{"id": 1, "username": "user", "role": "viewer"}]`,
+			wantUsers: []User{{Id: 1, Username: "user", Role: RoleViewer}},
+		},
+		{
+			name:      "users without role",
+			file:      `{"version": 1, "users": [{"id": 1, "username": "user"}, {"id": 2, "username": "viewer", "role": "viewer"}]}`,
+			wantUsers: []User{{Id: 1, Username: "user", Role: RoleManager}, {Id: 2, Username: "viewer", Role: RoleViewer}},
+		},
+		{
+			name:      "current version",
+			file:      `{"version": 3, "users": [{"id": 1, "username": "user"}]}`,
+			wantUsers: []User{{Id: 1, Username: "user"}},
+		},
+		{
+			name:      "empty file",
+			file:      "",
+			wantUsers: nil,
+		},
+		{
+			name:    "newer version",
+			file:    `{"version": 4, "users": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid file",
+			file:    `[{"id": 1},]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, autorizedFile), []byte(tt.file), 0644)
+			if err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+
+			store, err := NewJSONStore(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewJSONStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			users, err := store.Users(ListAutorized)
+			if err != nil {
+				t.Fatalf("JSONStore.Users() error = %v", err)
+			}
+			if !reflect.DeepEqual(users, tt.wantUsers) {
+				t.Errorf("JSONStore.Users() = %v, want %v", users, tt.wantUsers)
+			}
+
+			// the file is rewritten in the current format, and the missing files are created
+			_, version, err := store.read(ListAutorized)
+			if err != nil || version != schemaVersion {
+				t.Errorf("version after migration = %v, %v, want %v", version, err, schemaVersion)
+			}
+			bytes, err := os.ReadFile(filepath.Join(dir, autorizedFile))
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if strings.Contains(string(bytes), `"name"`) {
+				t.Errorf("file still contains name: %s", bytes)
+			}
+			for _, file := range []string{blacklistFile, adminFile, chatsFile} {
+				if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+					t.Errorf("%s not created: %v", file, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewJSONStore_ChatsMigration(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		wantChats []Chat
+		wantErr   bool
+	}{
+		{
+			name:      "chats without role saved as users",
+			file:      `{"version": 1, "users": [{"id": -1001234567890, "username": "Family"}, {"id": -200, "username": "Friends", "role": "viewer"}]}`,
+			wantChats: []Chat{{Id: -1001234567890, Title: "Family", Role: RoleManager}, {Id: -200, Title: "Friends", Role: RoleViewer}},
+		},
+		{
+			name:      "chats saved as users",
+			file:      `{"version": 2, "users": [{"id": -1001234567890, "username": "Family"}]}`,
+			wantChats: []Chat{{Id: -1001234567890, Title: "Family"}},
+		},
+		{
+			name:      "current version",
+			file:      `{"version": 3, "chats": [{"id": -1001234567890, "title": "Family", "role": "requester"}]}`,
+			wantChats: []Chat{{Id: -1001234567890, Title: "Family", Role: RoleRequester}},
+		},
+		{
+			name:    "newer version",
+			file:    `{"version": 4, "chats": []}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, chatsFile), []byte(tt.file), 0644)
+			if err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+
+			store, err := NewJSONStore(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewJSONStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			chats, err := store.Chats()
+			if err != nil {
+				t.Fatalf("JSONStore.Chats() error = %v", err)
+			}
+			if !reflect.DeepEqual(chats, tt.wantChats) {
+				t.Errorf("JSONStore.Chats() = %v, want %v", chats, tt.wantChats)
+			}
+
+			// the file is rewritten with the titles
+			_, version, err := store.readChats()
+			if err != nil || version != schemaVersion {
+				t.Errorf("version after migration = %v, %v, want %v", version, err, schemaVersion)
+			}
+			bytes, err := os.ReadFile(filepath.Join(dir, chatsFile))
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if strings.Contains(string(bytes), `"username"`) {
+				t.Errorf("file still contains username: %s", bytes)
+			}
+		})
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	dir := t.TempDir()
+
+	// the authorizations files are imported in a new database
+	files, err := NewJSONStore(dir)
+	if err != nil {
+		t.Fatalf("NewJSONStore() error = %v", err)
+	}
+	err = files.SaveUsers(ListAutorized, []User{{Id: 2, Username: "user"}, {Id: 1, Username: "admin"}})
+	if err != nil {
+		t.Fatalf("JSONStore.SaveUsers() error = %v", err)
+	}
+	err = files.SaveChats([]Chat{{Id: -1001234567890, Title: "Family"}})
+	if err != nil {
+		t.Fatalf("JSONStore.SaveChats() error = %v", err)
+	}
+	err = files.SaveAttempts(map[int]Attempt{3: {Failures: 2}})
+	if err != nil {
+		t.Fatalf("JSONStore.SaveAttempts() error = %v", err)
+	}
+
+	store, err := NewBoltStore(dir)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	users, err := store.Users(ListAutorized)
+	if err != nil {
+		t.Fatalf("BoltStore.Users() error = %v", err)
+	}
+	if want := []User{{Id: 1, Username: "admin"}, {Id: 2, Username: "user"}}; !reflect.DeepEqual(users, want) {
+		t.Errorf("imported users = %v, want %v", users, want)
+	}
+	chats, err := store.Chats()
+	if err != nil {
+		t.Fatalf("BoltStore.Chats() error = %v", err)
+	}
+	if want := []Chat{{Id: -1001234567890, Title: "Family"}}; !reflect.DeepEqual(chats, want) {
+		t.Errorf("imported chats = %v, want %v", chats, want)
+	}
+
+	// the changes survive a restart, and the files are not imported again
+	err = store.SaveUsers(ListAdmins, []User{{Id: 1, Username: "admin", Role: RoleAdmin}})
+	if err != nil {
+		t.Fatalf("BoltStore.SaveUsers() error = %v", err)
+	}
+	err = store.SaveUsers(ListAutorized, []User{{Id: 1, Username: "admin"}})
+	if err != nil {
+		t.Fatalf("BoltStore.SaveUsers() error = %v", err)
+	}
+	lockedUntil := time.Now().Add(time.Hour).Truncate(time.Second)
+	err = store.SaveAttempts(map[int]Attempt{4: {Lockouts: 1, LockedUntil: lockedUntil}})
+	if err != nil {
+		t.Fatalf("BoltStore.SaveAttempts() error = %v", err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatalf("BoltStore.Close() error = %v", err)
+	}
+
+	store, err = NewBoltStore(dir)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	defer store.Close()
+
+	wantLists := map[List][]User{
+		ListBlacklist: nil,
+		ListAutorized: {{Id: 1, Username: "admin"}},
+		ListAdmins:    {{Id: 1, Username: "admin", Role: RoleAdmin}},
+	}
+	for list, want := range wantLists {
+		users, err := store.Users(list)
+		if err != nil {
+			t.Fatalf("BoltStore.Users(%s) error = %v", list, err)
+		}
+		if !reflect.DeepEqual(users, want) {
+			t.Errorf("BoltStore.Users(%s) = %v, want %v", list, users, want)
+		}
+	}
+	attempts, err := store.Attempts()
+	if err != nil {
+		t.Fatalf("BoltStore.Attempts() error = %v", err)
+	}
+	if len(attempts) != 1 || attempts[4].Lockouts != 1 || !attempts[4].LockedUntil.Equal(lockedUntil) {
+		t.Errorf("BoltStore.Attempts() = %v, want the attempt of user 4", attempts)
+	}
+}
+
+func TestBoltStore_Migration(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewBoltStore(dir)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	lists := map[List][]User{
+		ListBlacklist: {{Id: 1, Username: "blacklisted"}},
+		ListAutorized: {{Id: 2, Username: "user"}, {Id: 3, Username: "viewer", Role: RoleViewer}},
+	}
+	for list, users := range lists {
+		err = store.SaveUsers(list, users)
+		if err != nil {
+			t.Fatalf("BoltStore.SaveUsers() error = %v", err)
+		}
+	}
+
+	// a database of version 1, before the default role was configurable and with the chats saved as users
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		err := putUsers(tx, List(chatsBucket), []User{{Id: -100, Username: "Family"}})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(versionKey, encodeId(1))
+	})
+	if err != nil {
+		t.Fatalf("error setting the version: %v", err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatalf("BoltStore.Close() error = %v", err)
+	}
+
+	store, err = NewBoltStore(dir)
+	if err != nil {
+		t.Fatalf("NewBoltStore() error = %v", err)
+	}
+	defer store.Close()
+
+	wantLists := map[List][]User{
+		ListBlacklist: {{Id: 1, Username: "blacklisted"}},
+		ListAutorized: {{Id: 2, Username: "user", Role: RoleManager}, {Id: 3, Username: "viewer", Role: RoleViewer}},
+	}
+	for list, want := range wantLists {
+		users, err := store.Users(list)
+		if err != nil {
+			t.Fatalf("BoltStore.Users(%s) error = %v", list, err)
+		}
+		if !reflect.DeepEqual(users, want) {
+			t.Errorf("BoltStore.Users(%s) = %v, want %v", list, users, want)
+		}
+	}
+	chats, err := store.Chats()
+	if err != nil {
+		t.Fatalf("BoltStore.Chats() error = %v", err)
+	}
+	if want := []Chat{{Id: -100, Title: "Family", Role: RoleManager}}; !reflect.DeepEqual(chats, want) {
+		t.Errorf("BoltStore.Chats() = %v, want %v", chats, want)
+	}
+	err = store.db.View(func(tx *bolt.Tx) error {
+		if version := decodeId(tx.Bucket(metaBucket).Get(versionKey)); version != schemaVersion {
+			t.Errorf("version after migration = %d, want %d", version, schemaVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error reading the version: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package invite
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"telarr/configuration"
+	"telarr/internal/atomicfile"
+	"telarr/internal/authentication"
+)
+
+const (
+	// DefaultFile is the file in the directory of the authorizations where the invite codes are saved when no path is configured.
+	DefaultFile = "invites.json"
+	// DefaultTtl is the time an invite code created from the bot can be redeemed when no ttl is configured.
+	DefaultTtl = 7 * 24 * time.Hour
+
+	// codeBytes is the number of random bytes of a code, 16 characters once encoded.
+	codeBytes = 10
+)
+
+var (
+	// ErrInviteNotFound is returned when no invite has the code.
+	ErrInviteNotFound = errors.New("invite code not found")
+	// ErrInviteExpired is returned when the invite can't be redeemed anymore.
+	ErrInviteExpired = errors.New("invite code expired")
+	// ErrInviteUsed is returned when the invite was redeemed as many times as allowed.
+	ErrInviteUsed = errors.New("invite code already used")
+	// ErrInviteRevoked is returned when an admin revoked the invite.
+	ErrInviteRevoked = errors.New("invite code revoked")
+
+	// encoding is the encoding of the codes, only letters and digits so they fit in a deep link.
+	encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// Invite is a code giving access to the bot without the password.
+type Invite struct {
+	// Id is the id of the invite, given by the store.
+	Id int64 `json:"id"`
+	// Code is the code to redeem, given by the store.
+	Code string `json:"code"`
+	// Role is the role of the users redeeming the code, the configured default role if empty.
+	Role authentication.Role `json:"role,omitempty"`
+
+	// MaxUses is the number of times the code can be redeemed, unlimited until it expires if 0.
+	MaxUses int `json:"maxUses"`
+	// ExpiresAt is the time the code can't be redeemed anymore, never if zero.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Revoked is true when an admin revoked the code, it is kept to know who redeemed it.
+	Revoked bool `json:"revoked,omitempty"`
+
+	// CreatedBy is the admin who created the code, or "command line".
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Redemptions are the users who redeemed the code.
+	Redemptions []Redemption `json:"redemptions,omitempty"`
+}
+
+// Redemption is the use of an invite code by a user.
+type Redemption struct {
+	UserId     int       `json:"userId"`
+	Username   string    `json:"username"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
+
+// Check returns nil if the code can be redeemed, the reason why not otherwise.
+func (i Invite) Check() error {
+	switch {
+	case i.Revoked:
+		return ErrInviteRevoked
+	case !i.ExpiresAt.IsZero() && time.Now().After(i.ExpiresAt):
+		return ErrInviteExpired
+	case i.MaxUses > 0 && len(i.Redemptions) >= i.MaxUses:
+		return ErrInviteUsed
+	}
+	return nil
+}
+
+// ConfiguredPath returns the file of the invite codes of the configuration,
+// DefaultFile in the directory of the authorizations if no path is configured.
+func ConfiguredPath(config configuration.Configuration) string {
+	if config.Invites.Path != "" {
+		return config.Invites.Path
+	}
+	dir := config.Auth.Path
+	if dir == "" {
+		dir = authentication.DefaultPath
+	}
+	return filepath.Join(dir, DefaultFile)
+}
+
+// Store saves the invites in a json file.
+// The file is read at each operation, so the codes created with the command line are seen by the running bot,
+// and it is changed under a file lock, so the command line and the bot never overwrite the changes of each other.
+type Store struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// storeFile is the content of the file of the store.
+type storeFile struct {
+	LastId  int64    `json:"lastId"`
+	Invites []Invite `json:"invites"`
+}
+
+// NewStore creates a store saving the invites in the file at path, and checks the file if it exists.
+func NewStore(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{path: path}
+	_, err = s.read()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create saves the invite with a new id and a new random code, and returns it.
+func (s *Store) Create(i Invite) (Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return Invite{}, err
+	}
+	defer unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return Invite{}, err
+	}
+
+	bytes := make([]byte, codeBytes)
+	_, err = rand.Read(bytes)
+	if err != nil {
+		return Invite{}, err
+	}
+
+	file.LastId++
+	i.Id = file.LastId
+	i.Code = encoding.EncodeToString(bytes)
+	if i.CreatedAt.IsZero() {
+		i.CreatedAt = time.Now()
+	}
+	file.Invites = append(file.Invites, i)
+	return i, s.write(file)
+}
+
+// Redeem calls authorize with the invite of the code, then records the use of the code by the user and returns the invite.
+// The code is not case sensitive, an error is returned if it can't be redeemed.
+// The use is not recorded if authorize returns an error, which is returned.
+func (s *Store) Redeem(code string, userId int, username string, authorize func(Invite) error) (Invite, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return Invite{}, ErrInviteNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return Invite{}, err
+	}
+	defer unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return Invite{}, err
+	}
+	for n := range file.Invites {
+		i := &file.Invites[n]
+		if i.Code != code {
+			continue
+		}
+		err = i.Check()
+		if err != nil {
+			return *i, err
+		}
+		err = authorize(*i)
+		if err != nil {
+			return *i, err
+		}
+
+		i.Redemptions = append(i.Redemptions, Redemption{UserId: userId, Username: username, RedeemedAt: time.Now()})
+		return *i, s.write(file)
+	}
+	return Invite{}, ErrInviteNotFound
+}
+
+// Revoke prevents the invite from being redeemed, and returns it.
+func (s *Store) Revoke(id int64) (Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return Invite{}, err
+	}
+	defer unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return Invite{}, err
+	}
+	for n := range file.Invites {
+		if file.Invites[n].Id == id {
+			file.Invites[n].Revoked = true
+			return file.Invites[n], s.write(file)
+		}
+	}
+	return Invite{}, ErrInviteNotFound
+}
+
+// List returns all the invites, the oldest first, with the ones that can't be redeemed anymore.
+func (s *Store) List() ([]Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return file.Invites, nil
+}
+
+// lock locks the lock file next to the file of the store until the returned function is called, s.mu must be held.
+// The file is replaced at each write, so it can't be locked itself.
+func (s *Store) lock() (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// read reads the file, a missing or empty file is no invite, s.mu must be held.
+func (s *Store) read() (storeFile, error) {
+	var file storeFile
+
+	bytes, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return file, err
+	}
+	if len(bytes) > 0 {
+		err = json.Unmarshal(bytes, &file)
+		if err != nil {
+			return file, err
+		}
+	}
+	return file, nil
+}
+
+// write writes the file, s.mu must be held.
+func (s *Store) write(file storeFile) error {
+	bytes, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, bytes, 0600)
+}
@@ -0,0 +1,132 @@
+package invite
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+	"telarr/internal/authentication"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	p := path.Join(t.TempDir(), "invites.json")
+	s, err := NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	single, err := s.Create(Invite{Role: authentication.RoleViewer, MaxUses: 1, CreatedBy: "@admin"})
+	if err != nil {
+		t.Fatalf("Store.Create() error = %v", err)
+	}
+	expired, err := s.Create(Invite{ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Store.Create() error = %v", err)
+	}
+	revoked, err := s.Create(Invite{})
+	if err != nil {
+		t.Fatalf("Store.Create() error = %v", err)
+	}
+	if single.Code == "" || single.Code == expired.Code || single.Id == expired.Id {
+		t.Fatalf("invites with the same code or id: %+v, %+v", single, expired)
+	}
+	_, err = s.Revoke(revoked.Id)
+	if err != nil {
+		t.Fatalf("Store.Revoke() error = %v", err)
+	}
+
+	// the invites created by another store, as the command line, are seen
+	other, err := NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	multi, err := other.Create(Invite{ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Store.Create() error = %v", err)
+	}
+
+	errAuthorize := errors.New("authorize error")
+	tests := []struct {
+		name         string
+		code         string
+		userId       int
+		authorizeErr error
+		wantRole     authentication.Role
+		wantErr      error
+	}{
+		{name: "single use not authorized", code: single.Code, userId: 9, authorizeErr: errAuthorize, wantErr: errAuthorize},
+		{name: "single use", code: single.Code, userId: 1, wantRole: authentication.RoleViewer},
+		{name: "single use twice", code: single.Code, userId: 2, wantErr: ErrInviteUsed},
+		{name: "expired", code: expired.Code, userId: 3, wantErr: ErrInviteExpired},
+		{name: "revoked", code: revoked.Code, userId: 4, wantErr: ErrInviteRevoked},
+		{name: "multiple uses", code: multi.Code, userId: 5},
+		{name: "multiple uses lower case", code: " " + strings.ToLower(multi.Code) + " ", userId: 6},
+		{name: "unknown", code: "UNKNOWN", userId: 7, wantErr: ErrInviteNotFound},
+		{name: "empty", code: "", userId: 8, wantErr: ErrInviteNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Redeem(tt.code, tt.userId, "user", func(Invite) error { return tt.authorizeErr })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Store.Redeem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Role != tt.wantRole {
+				t.Errorf("Store.Redeem() role = %v, want %v", got.Role, tt.wantRole)
+			}
+		})
+	}
+
+	// the redemptions are kept to audit the codes
+	invites, err := s.List()
+	if err != nil {
+		t.Fatalf("Store.List() error = %v", err)
+	}
+	if len(invites) != 4 {
+		t.Fatalf("Store.List() = %v, want 4 invites", invites)
+	}
+	if r := invites[0].Redemptions; len(r) != 1 || r[0].UserId != 1 || r[0].RedeemedAt.IsZero() {
+		t.Errorf("redemptions of the single use code = %+v", r)
+	}
+	if r := invites[3].Redemptions; len(r) != 2 {
+		t.Errorf("redemptions of the multiple uses code = %+v, want 2", r)
+	}
+}
+
+func TestStore_ConcurrentStores(t *testing.T) {
+	p := path.Join(t.TempDir(), "invites.json")
+
+	// the bot and the command line change the same file
+	const nbInvites = 20
+	wg := sync.WaitGroup{}
+	for n := 0; n < 2; n++ {
+		s, err := NewStore(p)
+		if err != nil {
+			t.Fatalf("NewStore() error = %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < nbInvites; i++ {
+				_, err := s.Create(Invite{})
+				if err != nil {
+					t.Errorf("Store.Create() error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s, err := NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	invites, err := s.List()
+	if err != nil {
+		t.Fatalf("Store.List() error = %v", err)
+	}
+	if len(invites) != 2*nbInvites {
+		t.Errorf("Store.List() = %v invites, want %v", len(invites), 2*nbInvites)
+	}
+}
@@ -0,0 +1,158 @@
+package quota
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"telarr/internal/atomicfile"
+	"time"
+)
+
+const (
+	// DefaultPath is the file where the additions are saved when no path is configured.
+	DefaultPath = "/opt/telarr/requests/quotas.json"
+	// maxAge is the time the additions are kept, the periods of the quotas can't be longer.
+	maxAge = 366 * 24 * time.Hour
+)
+
+// Addition is a movie or a serie added by a user, counted in its quota.
+type Addition struct {
+	UserId int `json:"userId"`
+	// Media is the type of the media ("movie" or "serie"), or "release" for a release grabbed for a media already added.
+	Media string `json:"media"`
+	// Instance and MediaId are the instance the media was added to and its id there, to get the size of its release.
+	Instance int   `json:"instance"`
+	MediaId  int64 `json:"mediaId"`
+	// Size is the size in GB of the release of the media, 0 until it is known.
+	Size float64 `json:"size,omitempty"`
+
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Ledger keeps the additions of the users in memory and saves them in a json file, so the quotas survive a restart.
+type Ledger struct {
+	path string
+
+	additions []Addition
+
+	mu sync.Mutex
+}
+
+// NewLedger creates a ledger saving the additions in the file at path, the additions already saved are loaded.
+func NewLedger(path string) (*Ledger, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Ledger{path: path}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(bytes) > 0 {
+		err = json.Unmarshal(bytes, &l.additions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Record saves the addition, and drops the ones too old to be counted.
+func (l *Ledger) Record(a Addition) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if a.AddedAt.IsZero() {
+		a.AddedAt = time.Now()
+	}
+
+	kept := make([]Addition, 0, len(l.additions))
+	for _, old := range append(l.additions, a) {
+		if time.Since(old.AddedAt) < maxAge {
+			kept = append(kept, old)
+		}
+	}
+	return l.save(kept)
+}
+
+// Since returns the additions of the media type by the user since the time, all the types if media is empty.
+func (l *Ledger) Since(userId int, media string, since time.Time) []Addition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var additions []Addition
+	for _, a := range l.additions {
+		if a.UserId == userId && (media == "" || a.Media == media) && !a.AddedAt.Before(since) {
+			additions = append(additions, a)
+		}
+	}
+	return additions
+}
+
+// Unsized returns the additions added since the time whose size is not known yet.
+func (l *Ledger) Unsized(since time.Time) []Addition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var additions []Addition
+	for _, a := range l.additions {
+		if a.Size == 0 && !a.AddedAt.Before(since) {
+			additions = append(additions, a)
+		}
+	}
+	return additions
+}
+
+// SetSize saves the size in GB of the release of the media, for all its additions.
+func (l *Ledger) SetSize(media string, instance int, mediaId int64, size float64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changed := false
+	additions := append([]Addition(nil), l.additions...)
+	for i, a := range additions {
+		if a.Media == media && a.Instance == instance && a.MediaId == mediaId && a.Size != size {
+			additions[i].Size = size
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return l.save(additions)
+}
+
+// Reset forgets the additions of the user, giving it its whole quota again.
+func (l *Ledger) Reset(userId int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := make([]Addition, 0, len(l.additions))
+	for _, a := range l.additions {
+		if a.UserId != userId {
+			kept = append(kept, a)
+		}
+	}
+	return l.save(kept)
+}
+
+// save writes the additions to the file and keeps them once written, l.mu must be held.
+// The additions are not changed if the file can't be written.
+func (l *Ledger) save(additions []Addition) error {
+	bytes, err := json.Marshal(additions)
+	if err != nil {
+		return err
+	}
+
+	err = atomicfile.WriteFile(l.path, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	l.additions = additions
+	return nil
+}
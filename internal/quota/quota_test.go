@@ -0,0 +1,95 @@
+package quota
+
+import (
+	"path"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	p := path.Join(t.TempDir(), "quotas.json")
+	l, err := NewLedger(p)
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+
+	now := time.Now()
+	additions := []Addition{
+		{UserId: 1, Media: "movie", MediaId: 1, AddedAt: now.Add(-2 * time.Hour)},
+		{UserId: 1, Media: "movie", MediaId: 2, AddedAt: now.Add(-10 * 24 * time.Hour)},
+		{UserId: 1, Media: "serie", MediaId: 3},
+		{UserId: 2, Media: "movie", MediaId: 4},
+		// too old to be kept
+		{UserId: 1, Media: "movie", MediaId: 5, AddedAt: now.Add(-2 * maxAge)},
+	}
+	for _, a := range additions {
+		err = l.Record(a)
+		if err != nil {
+			t.Fatalf("Ledger.Record() error = %v", err)
+		}
+	}
+
+	// the additions survive a restart
+	l, err = NewLedger(p)
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		userId int
+		media  string
+		since  time.Time
+		want   int
+	}{
+		{name: "movies of the week", userId: 1, media: "movie", since: now.Add(-7 * 24 * time.Hour), want: 1},
+		{name: "movies of the month", userId: 1, media: "movie", since: now.Add(-30 * 24 * time.Hour), want: 2},
+		{name: "all the medias of the month", userId: 1, since: now.Add(-30 * 24 * time.Hour), want: 3},
+		{name: "old additions dropped", userId: 1, media: "movie", since: now.Add(-3 * maxAge), want: 2},
+		{name: "other user", userId: 2, media: "movie", since: now.Add(-time.Hour), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Since(tt.userId, tt.media, tt.since); len(got) != tt.want {
+				t.Errorf("Ledger.Since() = %v, want %d additions", got, tt.want)
+			}
+		})
+	}
+
+	// the size of a media is known once downloaded
+	if got := l.Unsized(now.Add(-30 * 24 * time.Hour)); len(got) != 4 {
+		t.Fatalf("Ledger.Unsized() = %v, want 4 additions", got)
+	}
+	err = l.SetSize("movie", 0, 1, 2.5)
+	if err != nil {
+		t.Fatalf("Ledger.SetSize() error = %v", err)
+	}
+	if got := l.Unsized(now.Add(-30 * 24 * time.Hour)); len(got) != 3 {
+		t.Errorf("Ledger.Unsized() after Ledger.SetSize() = %v, want 3 additions", got)
+	}
+	if got := l.Since(1, "movie", now.Add(-7*24*time.Hour)); len(got) != 1 || got[0].Size != 2.5 {
+		t.Errorf("Ledger.Since() after Ledger.SetSize() = %v, want the size 2.5", got)
+	}
+
+	// the additions are kept when the reset can't be saved
+	l.path = path.Join(t.TempDir(), "missing", "quotas.json")
+	err = l.Reset(1)
+	if err == nil {
+		t.Fatalf("Ledger.Reset() without directory error = nil")
+	}
+	if got := l.Since(1, "", now.Add(-maxAge)); len(got) != 3 {
+		t.Fatalf("Ledger.Reset() failed but the additions are removed, got %v", got)
+	}
+	l.path = p
+
+	err = l.Reset(1)
+	if err != nil {
+		t.Fatalf("Ledger.Reset() error = %v", err)
+	}
+	if got := l.Since(1, "", now.Add(-maxAge)); len(got) != 0 {
+		t.Errorf("Ledger.Since() after reset = %v, want none", got)
+	}
+	if got := l.Since(2, "", now.Add(-maxAge)); len(got) != 1 {
+		t.Errorf("Ledger.Since() of the other user after reset = %v, want 1 addition", got)
+	}
+}
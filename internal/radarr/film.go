@@ -1,10 +1,15 @@
 package radarr
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 type Film struct {
 	TmdbId  int64
 	MovieId int64
+	// ImdbId is the id of the film on IMDb, empty if unknown.
+	ImdbId string
 
 	// IsInLibrary is true if the film is in the library.
 	IsInLibrary bool
@@ -42,6 +47,13 @@ type Film struct {
 	Downloaded bool
 	// Size is the size of the film on disk GB.
 	Size float64
+	// Monitored is true if radarr looks for the film, or for a better release of it.
+	Monitored bool
+	// QualityProfileId is the id of the quality profile of the film in the library.
+	QualityProfileId int64
+
+	// WebUrl is the url of the film in the radarr web UI, empty if the instance has no public url or the film is not in the library.
+	WebUrl string
 }
 
 func (f Film) PrintMovieTitle() string {
@@ -78,7 +90,7 @@ func (f Film) PrintMovieDetails() string {
 	} else {
 		str += f.Overview
 	}
-	str += " [TMDb](https://www.themoviedb.org/movie/" + strconv.Itoa(int(f.TmdbId)) + ") 🔗\n\n"
+	str += "\n\n"
 
 	str += "📡 " + "*Status*: "
 	if f.Downloaded {
@@ -88,16 +100,31 @@ func (f Film) PrintMovieDetails() string {
 	} else {
 		str += "Missing ❌\n"
 	}
+	if f.Monitored {
+		str += "👁 " + "*Monitored*: Yes ✅\n"
+	} else {
+		str += "👁 " + "*Monitored*: No ❌\n"
+	}
 
-	str += "\n"
-
-	str += "[__View in Radarr__](nasalex.hole:30025/movie/" + strconv.Itoa(int(f.TmdbId)) + ")"
+	if links := f.PrintLinks(); links != "" {
+		str += "\n🔗 " + links
+	}
 
 	return str
 }
 
-// ToFolderPath returns the path where to store the film.
-// It does not return the current path of the film, but the path where to store it.
-func (f Film) ToFolderPath() string {
-	return "/movies/" + f.OriginalTitle + " (" + strconv.Itoa(f.Year) + ")"
+// PrintLinks returns the links to the film on TMDb, IMDb and in radarr, the unknown ones are skipped.
+func (f Film) PrintLinks() string {
+	var links []string
+	if f.TmdbId > 0 {
+		links = append(links, "[TMDb](https://www.themoviedb.org/movie/"+strconv.FormatInt(f.TmdbId, 10)+")")
+	}
+	if f.ImdbId != "" {
+		links = append(links, "[IMDb](https://www.imdb.com/title/"+f.ImdbId+")")
+	}
+	if f.WebUrl != "" {
+		links = append(links, "[View in Radarr]("+f.WebUrl+")")
+	}
+
+	return strings.Join(links, " | ")
 }
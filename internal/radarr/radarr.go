@@ -1,40 +1,135 @@
 package radarr
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"telarr/configuration"
 	"telarr/internal/types"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"golift.io/starr"
 	"golift.io/starr/radarr"
 )
 
-func GetStatus(config configuration.Radarr) types.ServiceStatus {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for status")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+const (
+	// bpRelease is the endpoint of the releases, not supported by the starr library.
+	bpRelease = radarr.APIver + "/release"
+	// releaseSearchTimeout is the timeout of a release search, longer than the default one as all the indexers are queried.
+	releaseSearchTimeout = 2 * time.Minute
+)
+
+// MovieService is the interface to manage the movies library.
+type MovieService interface {
+	// Name returns the name of the instance.
+	Name() string
+	// GetStatus returns the status of the service.
+	GetStatus() types.ServiceStatus
+	// GetFilmsList returns the list of films in the library.
+	GetFilmsList() ([]Film, error)
+	// GetFilmDetails returns the details of a film in the library from its name.
+	GetFilmDetails(movieName string) ([]Film, error)
+	// GetMovieName returns the name of a movie in the library from its id.
+	GetMovieName(movieId int) (string, error)
+	// GetFilm returns a film of the library from its id.
+	GetFilm(movieId int) (Film, error)
+	// RemoveFilm removes a film from the library.
+	RemoveFilm(movieId int) error
+	// LookupFilm looks for a film to add to the library.
+	LookupFilm(movieName string) ([]Film, error)
+	// AddFilm adds a film to the library, in the root folder, and returns it as added.
+	AddFilm(film Film, qualityProfileId int64, rootFolderPath string) (Film, error)
+	// GetQualityProfiles returns the list of quality profiles.
+	GetQualityProfiles() ([]types.QualityProfile, error)
+	// GetRootFolders returns the list of root folders, with their free space.
+	GetRootFolders() ([]types.RootFolder, error)
+	// DefaultRootFolder returns the root folder to add the films to, empty if the user must select it.
+	DefaultRootFolder() string
+	// GetQualityProfileId returns the id of a quality profile from its name, -1 if not found.
+	GetQualityProfileId(profileName string) (int64, error)
+	// GetDownloadingStatus returns the downloading status of a film.
+	GetDownloadingStatus(filmId int) (types.DownloadingStatus, error)
+	// SearchFilm asks radarr to search a film of the library on the indexers and to grab the best release.
+	SearchFilm(movieId int) error
+	// RefreshFilm asks radarr to refresh the information of a film of the library and to rescan its files.
+	RefreshFilm(movieId int) error
+	// SetMonitored sets whether radarr monitors a film of the library, and returns the film updated.
+	SetMonitored(movieId int, monitored bool) (Film, error)
+	// SetQualityProfile changes the quality profile of a film of the library, and returns the film updated.
+	SetQualityProfile(movieId int, qualityProfileId int64) (Film, error)
+	// SearchReleases searches the releases of a film of the library on the indexers.
+	SearchReleases(movieId int) ([]Release, error)
+	// GrabRelease sends a release found by SearchReleases to the download client.
+	GrabRelease(release Release) error
+}
+
+// Service is the MovieService using the radarr API.
+type Service struct {
+	config configuration.Radarr
+	client *radarr.Radarr
+	// searchClient is the client searching the releases, with a longer timeout.
+	searchClient *radarr.Radarr
+}
+
+func New(config configuration.Radarr) *Service {
+	return &Service{
+		config:       config,
+		client:       radarr.New(starr.New(config.ApiKey, config.Endpoint, 0)),
+		searchClient: radarr.New(starr.New(config.ApiKey, config.Endpoint, releaseSearchTimeout)),
+	}
+}
+
+// Name returns the name of the instance, "Radarr" if not set.
+func (s *Service) Name() string {
+	if s.config.Name == "" {
+		return "Radarr"
+	}
+	return s.config.Name
+}
+
+// GetStatus returns the status of the instance.
+func (s *Service) GetStatus() types.ServiceStatus {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for status")
+	r := s.client
 
 	status, err := r.GetSystemStatus()
 	if err != nil {
 		return types.ServiceStatus{
-			Name:    "Radarr",
+			Name:    statusName("Radarr", s.Name()),
 			Version: "unknown",
 			Running: false,
 		}
 	}
 
 	return types.ServiceStatus{
-		Name:    status.AppName,
+		Name:    statusName(status.AppName, s.Name()),
 		Version: status.Version,
 		Running: true,
 	}
 }
 
+// Ping checks that the endpoint is reachable, accepts the api key and is a radarr instance.
+func (s *Service) Ping() error {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for status")
+	status, err := s.client.GetSystemStatus()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(status.AppName, "Radarr") {
+		return fmt.Errorf("the endpoint is a %s instance, not a radarr one", status.AppName)
+	}
+	return nil
+}
+
 // GetFilmsList returns the list of films in the library.
-func GetFilmsList(config configuration.Radarr) ([]Film, error) {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for movie list")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) GetFilmsList() ([]Film, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for movie list")
+	r := s.client
 
 	films, err := r.GetMovie(0)
 	if err != nil {
@@ -44,17 +139,16 @@ func GetFilmsList(config configuration.Radarr) ([]Film, error) {
 	// convert the films to the Film struct
 	var filmsList []Film
 	for _, film := range films {
-		filmsList = append(filmsList, toFilmStruct(film))
+		filmsList = append(filmsList, toFilmStruct(film, s.config.PublicUrl))
 	}
 
 	return filmsList, nil
 }
 
 // GetFilmDetails returns the details of a film in the library from its name.
-func GetFilmDetails(config configuration.Radarr, movieName string) ([]Film, error) {
-	log.Trace().Str("movieName", movieName).Str("endpoint", config.Endpoint).Msg("contacting radarr for movie details")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) GetFilmDetails(movieName string) ([]Film, error) {
+	log.Trace().Str("movieName", movieName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for movie details")
+	r := s.client
 
 	films, err := r.Lookup(movieName)
 	if err != nil {
@@ -63,7 +157,7 @@ func GetFilmDetails(config configuration.Radarr, movieName string) ([]Film, erro
 
 	// convert the films to the Film struct
 	var filmsList []Film
-	libFilms, err := GetFilmsList(config)
+	libFilms, err := s.GetFilmsList()
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +165,7 @@ func GetFilmDetails(config configuration.Radarr, movieName string) ([]Film, erro
 		for _, libFilm := range libFilms {
 			// keep only films that are in the library
 			if film.TmdbID == libFilm.TmdbId {
-				f := toFilmStruct(film)
+				f := toFilmStruct(film, s.config.PublicUrl)
 				filmsList = append(filmsList, f)
 			}
 		}
@@ -81,10 +175,9 @@ func GetFilmDetails(config configuration.Radarr, movieName string) ([]Film, erro
 }
 
 // GetMovieName returns the name of a movie in the library from its id.
-func GetMovieName(config configuration.Radarr, movieId int) (string, error) {
-	log.Trace().Int("movieId", movieId).Str("endpoint", config.Endpoint).Msg("contacting radarr for movie name")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) GetMovieName(movieId int) (string, error) {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for movie name")
+	r := s.client
 
 	movie, err := r.GetMovieByID(int64(movieId))
 	if err != nil {
@@ -94,11 +187,23 @@ func GetMovieName(config configuration.Radarr, movieId int) (string, error) {
 	return movie.Title, nil
 }
 
+// GetFilm returns a film of the library from its id.
+func (s *Service) GetFilm(movieId int) (Film, error) {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for movie")
+	r := s.client
+
+	movie, err := r.GetMovieByID(int64(movieId))
+	if err != nil {
+		return Film{}, err
+	}
+
+	return toFilmStruct(movie, s.config.PublicUrl), nil
+}
+
 // RemoveFilm removes a film from the library.
-func RemoveFilm(config configuration.Radarr, movieId int) error {
-	log.Trace().Int("movieId", movieId).Str("endpoint", config.Endpoint).Msg("contacting radarr	to remove movie")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) RemoveFilm(movieId int) error {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr	to remove movie")
+	r := s.client
 
 	err := r.DeleteMovie(int64(movieId), true, false)
 	if err != nil {
@@ -109,10 +214,9 @@ func RemoveFilm(config configuration.Radarr, movieId int) error {
 }
 
 // LookupFilm looks for a film in radarr.
-func LookupFilm(config configuration.Radarr, movieName string) ([]Film, error) {
-	log.Trace().Str("movieName", movieName).Str("endpoint", config.Endpoint).Msg("contacting radarr for movie lookup")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) LookupFilm(movieName string) ([]Film, error) {
+	log.Trace().Str("movieName", movieName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for movie lookup")
+	r := s.client
 
 	films, err := r.Lookup(movieName)
 	if err != nil {
@@ -122,39 +226,37 @@ func LookupFilm(config configuration.Radarr, movieName string) ([]Film, error) {
 	// convert the films to the Film struct
 	var filmsList []Film
 	for _, film := range films {
-		filmsList = append(filmsList, toFilmStruct(film))
+		filmsList = append(filmsList, toFilmStruct(film, s.config.PublicUrl))
 	}
 
 	return filmsList, nil
 }
 
-func AddFilm(config configuration.Radarr, film Film, qualityProfileId int64) (int64, error) {
-	log.Trace().Str("movieName", film.Title).Str("endpoint", config.Endpoint).Msg("contacting radarr to add movie")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) AddFilm(film Film, qualityProfileId int64, rootFolderPath string) (Film, error) {
+	log.Trace().Str("movieName", film.Title).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to add movie")
+	r := s.client
 
 	newFilm, err := r.AddMovie(&radarr.AddMovieInput{
 		Title:            film.Title,
 		TmdbID:           film.TmdbId,
 		QualityProfileID: qualityProfileId,
 		Monitored:        true,
-		RootFolderPath:   "/movies",
+		RootFolderPath:   rootFolderPath,
 		AddOptions: &radarr.AddMovieOptions{
 			SearchForMovie: true,
 			Monitor:        "movieOnly",
 		},
 	})
 	if err != nil {
-		return -1, err
+		return Film{}, err
 	}
 
-	return newFilm.ID, nil
+	return toFilmStruct(newFilm, s.config.PublicUrl), nil
 }
 
-func GetQualityProfiles(config configuration.Radarr) ([]types.QualityProfile, error) {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for quality profiles")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) GetQualityProfiles() ([]types.QualityProfile, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for quality profiles")
+	r := s.client
 
 	profiles, err := r.GetQualityProfiles()
 	if err != nil {
@@ -174,10 +276,38 @@ func GetQualityProfiles(config configuration.Radarr) ([]types.QualityProfile, er
 	return profilesList, nil
 }
 
-func GetQualityProfileId(config configuration.Radarr, profileName string) (int64, error) {
-	log.Trace().Str("profileName", profileName).Str("endpoint", config.Endpoint).Msg("contacting radarr for quality profile id")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+// GetRootFolders returns the list of root folders, with their free space.
+func (s *Service) GetRootFolders() ([]types.RootFolder, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for root folders")
+	r := s.client
+
+	folders, err := r.GetRootFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert the folders to the RootFolder struct
+	var foldersList []types.RootFolder
+	for _, folder := range folders {
+		f := types.RootFolder{
+			ID:        folder.ID,
+			Path:      folder.Path,
+			FreeSpace: folder.FreeSpace,
+		}
+		foldersList = append(foldersList, f)
+	}
+
+	return foldersList, nil
+}
+
+// DefaultRootFolder returns the root folder configured for the instance, empty if none.
+func (s *Service) DefaultRootFolder() string {
+	return s.config.RootFolder
+}
+
+func (s *Service) GetQualityProfileId(profileName string) (int64, error) {
+	log.Trace().Str("profileName", profileName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for quality profile id")
+	r := s.client
 
 	profiles, err := r.GetQualityProfiles()
 	if err != nil {
@@ -194,10 +324,9 @@ func GetQualityProfileId(config configuration.Radarr, profileName string) (int64
 }
 
 // GetDownloadingStatus returns the downloading status of a film.
-func GetDownloadingStatus(config configuration.Radarr, filmId int) (types.DownloadingStatus, error) {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for downloading status")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := radarr.New(c)
+func (s *Service) GetDownloadingStatus(filmId int) (types.DownloadingStatus, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for downloading status")
+	r := s.client
 
 	_, err := r.SendCommand(&radarr.CommandRequest{
 		Name: "RefreshMonitoredDownloads",
@@ -227,12 +356,148 @@ func GetDownloadingStatus(config configuration.Radarr, filmId int) (types.Downlo
 	return types.DownloadingStatus{Found: false}, nil
 }
 
+// SearchFilm asks radarr to search a film of the library on the indexers and to grab the best release.
+// The search runs in the background, the command is only queued.
+func (s *Service) SearchFilm(movieId int) error {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to search movie")
+	r := s.client
+
+	_, err := r.SendCommand(&radarr.CommandRequest{
+		Name:     "MoviesSearch",
+		MovieIDs: []int64{int64(movieId)},
+	})
+	return err
+}
+
+// RefreshFilm asks radarr to refresh the information of a film of the library and to rescan its files.
+func (s *Service) RefreshFilm(movieId int) error {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to refresh movie")
+	r := s.client
+
+	_, err := r.SendCommand(&radarr.CommandRequest{
+		Name:     "RefreshMovie",
+		MovieIDs: []int64{int64(movieId)},
+	})
+	return err
+}
+
+// SetMonitored sets whether radarr monitors a film of the library, and returns the film updated.
+func (s *Service) SetMonitored(movieId int, monitored bool) (Film, error) {
+	log.Trace().Int("movieId", movieId).Bool("monitored", monitored).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to monitor movie")
+
+	return s.updateFilm(movieId, func(movie *radarr.Movie) {
+		movie.Monitored = monitored
+	})
+}
+
+// SetQualityProfile changes the quality profile of a film of the library, and returns the film updated.
+func (s *Service) SetQualityProfile(movieId int, qualityProfileId int64) (Film, error) {
+	log.Trace().Int("movieId", movieId).Int64("qualityProfileId", qualityProfileId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to change movie quality profile")
+
+	return s.updateFilm(movieId, func(movie *radarr.Movie) {
+		movie.QualityProfileID = qualityProfileId
+	})
+}
+
+// SearchReleases searches the releases of a film of the library on the indexers, the best ones first.
+func (s *Service) SearchReleases(movieId int) ([]Release, error) {
+	log.Trace().Int("movieId", movieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to search releases")
+	r := s.searchClient
+
+	var releases []*releaseResource
+	req := starr.Request{URI: bpRelease, Query: url.Values{"movieId": []string{strconv.Itoa(movieId)}}}
+	err := r.GetInto(context.Background(), req, &releases)
+	if err != nil {
+		return nil, fmt.Errorf("api.Get(%s): %w", &req, err)
+	}
+
+	// convert the releases to the Release struct
+	var releasesList []Release
+	for _, release := range releases {
+		releasesList = append(releasesList, toReleaseStruct(release, int64(movieId)))
+	}
+
+	return releasesList, nil
+}
+
+// GrabRelease sends a release found by SearchReleases to the download client.
+// Radarr keeps the releases of a search for 30 minutes, an older release can't be grabbed.
+func (s *Service) GrabRelease(release Release) error {
+	log.Trace().Str("release", release.Title).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to grab release")
+	r := s.client
+
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(grabInput{Guid: release.Guid, IndexerId: release.IndexerId, MovieId: release.MovieId})
+	if err != nil {
+		return fmt.Errorf("json.Marshal(%s): %w", bpRelease, err)
+	}
+
+	var output releaseResource
+	req := starr.Request{URI: bpRelease, Body: &body}
+	err = r.PostInto(context.Background(), req, &output)
+	if err != nil {
+		return fmt.Errorf("api.Post(%s): %w", &req, err)
+	}
+
+	return nil
+}
+
 /* Tools */
 
-func toFilmStruct(film *radarr.Movie) Film {
+// updateFilm gets the film from radarr, changes it with the update function and saves it, without moving its files.
+func (s *Service) updateFilm(movieId int, update func(movie *radarr.Movie)) (Film, error) {
+	r := s.client
+
+	movie, err := r.GetMovieByID(int64(movieId))
+	if err != nil {
+		return Film{}, err
+	}
+	update(movie)
+	updated, err := r.UpdateMovie(movie.ID, movie, false)
+	if err != nil {
+		return Film{}, err
+	}
+
+	return toFilmStruct(updated, s.config.PublicUrl), nil
+}
+
+// statusName returns the name of the app followed by the name of the instance, if different.
+func statusName(appName string, instanceName string) string {
+	if instanceName == appName {
+		return appName
+	}
+	return appName + " " + instanceName
+}
+
+func toReleaseStruct(release *releaseResource, movieId int64) Release {
+	r := Release{
+		Guid:       release.Guid,
+		IndexerId:  release.IndexerId,
+		Indexer:    release.Indexer,
+		MovieId:    movieId,
+		Title:      release.Title,
+		Size:       float64(release.Size) / 1024 / 1024 / 1024,
+		Protocol:   release.Protocol,
+		Seeders:    -1,
+		AgeHours:   release.AgeHours,
+		Rejected:   release.Rejected,
+		Rejections: release.Rejections,
+	}
+	if release.Quality != nil && release.Quality.Quality != nil {
+		r.Quality = release.Quality.Quality.Name
+	}
+	if release.Seeders != nil {
+		r.Seeders = *release.Seeders
+	}
+
+	return r
+}
+
+func toFilmStruct(film *radarr.Movie, publicUrl string) Film {
 	f := Film{
 		TmdbId:        film.TmdbID,
 		MovieId:       film.ID,
+		ImdbId:        film.ImdbID,
 		IsInLibrary:   film.ID > 0,
 		Title:         film.Title,
 		OriginalTitle: film.OriginalTitle,
@@ -242,6 +507,9 @@ func toFilmStruct(film *radarr.Movie) Film {
 		Genres:        film.Genres,
 		Studio:        film.Studio,
 		Size:          0,
+
+		Monitored:        film.Monitored,
+		QualityProfileId: film.QualityProfileID,
 	}
 
 	if film.MovieFile != nil {
@@ -276,5 +544,10 @@ func toFilmStruct(film *radarr.Movie) Film {
 		}
 	}
 
+	// the web UI has a page only for the films of the library
+	if publicUrl != "" && f.IsInLibrary {
+		f.WebUrl = publicUrl + "/movie/" + strconv.FormatInt(film.TmdbID, 10)
+	}
+
 	return f
 }
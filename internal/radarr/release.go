@@ -0,0 +1,78 @@
+package radarr
+
+import (
+	"strconv"
+
+	"golift.io/starr"
+)
+
+// Release is a release of a film found on the indexers, which can be grabbed.
+type Release struct {
+	// Guid is the id of the release on its indexer.
+	Guid string
+	// IndexerId is the id of the indexer in radarr, needed with the guid to grab the release.
+	IndexerId int64
+	// Indexer is the name of the indexer.
+	Indexer string
+	// MovieId is the id of the film of the release in the library.
+	MovieId int64
+
+	// Title is the title of the release.
+	Title string
+	// Quality is the quality of the release (e.g. "Bluray-1080p").
+	Quality string
+	// Size is the size of the release in GB.
+	Size float64
+	// Protocol is the download protocol of the release, "torrent" or "usenet".
+	Protocol string
+	// Seeders is the number of seeders of a torrent, -1 if unknown.
+	Seeders int
+	// AgeHours is the age of the release in hours.
+	AgeHours float64
+
+	// Rejected is true if radarr would not grab the release by itself, for the reasons of Rejections.
+	Rejected bool
+	// Rejections are the reasons why the release is rejected.
+	Rejections []string
+}
+
+// PrintAge returns the age of the release, in hours for the first two days and in days after.
+func (r Release) PrintAge() string {
+	if r.AgeHours < 48 {
+		return strconv.Itoa(int(r.AgeHours)) + " hours"
+	}
+	return strconv.Itoa(int(r.AgeHours/24)) + " days"
+}
+
+// PrintSeeders returns the number of seeders, "usenet" for the usenet releases.
+func (r Release) PrintSeeders() string {
+	if r.Protocol == "usenet" {
+		return "usenet"
+	}
+	if r.Seeders < 0 {
+		return "? seeders"
+	}
+	return strconv.Itoa(r.Seeders) + " seeders"
+}
+
+// releaseResource is a release of the /api/v3/release endpoint.
+type releaseResource struct {
+	Guid       string         `json:"guid"`
+	IndexerId  int64          `json:"indexerId"`
+	Indexer    string         `json:"indexer"`
+	Title      string         `json:"title"`
+	Quality    *starr.Quality `json:"quality"`
+	Size       int64          `json:"size"`
+	Protocol   string         `json:"protocol"`
+	Seeders    *int           `json:"seeders"`
+	AgeHours   float64        `json:"ageHours"`
+	Rejected   bool           `json:"rejected"`
+	Rejections []string       `json:"rejections"`
+}
+
+// grabInput is the body grabbing a release, radarr finds it in the results of the last searches.
+type grabInput struct {
+	Guid      string `json:"guid"`
+	IndexerId int64  `json:"indexerId"`
+	MovieId   int64  `json:"movieId"`
+}
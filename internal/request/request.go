@@ -0,0 +1,212 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"telarr/internal/atomicfile"
+	"time"
+
+	"telarr/internal/radarr"
+	"telarr/internal/sonarr"
+)
+
+const (
+	// DefaultPath is the file where the pending requests are saved when no path is configured.
+	DefaultPath = "/opt/telarr/requests/requests.json"
+)
+
+var (
+	// ErrRequestNotFound is returned when the request was already approved or rejected.
+	ErrRequestNotFound = errors.New("request not found")
+)
+
+// Request is the addition of a movie or a serie asked by a user, waiting for the approval of an admin.
+type Request struct {
+	// Id is the id of the request, given by the store.
+	Id int64 `json:"id"`
+
+	// UserId, Username and ChatId are the user who asked for the media and the chat to send the outcome to.
+	UserId   int    `json:"userId"`
+	Username string `json:"username"`
+	ChatId   int64  `json:"chatId"`
+	// ThreadId is the forum topic of the chat the request was sent from, 0 if none.
+	ThreadId int `json:"threadId,omitempty"`
+
+	// Instance is the index of the radarr or sonarr instance to add the media to.
+	Instance int `json:"instance"`
+	// Film is the movie to add, nil for a serie.
+	Film *radarr.Film `json:"film,omitempty"`
+	// Serie is the serie to add, nil for a movie.
+	Serie *sonarr.Serie `json:"serie,omitempty"`
+	// QualityProfileId and RootFolderPath are the ones selected by the user.
+	QualityProfileId int64  `json:"qualityProfileId"`
+	RootFolderPath   string `json:"rootFolderPath"`
+
+	// Notifications are the messages sent to the admins, edited with the outcome.
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Notification is a message sent to an admin about a request.
+type Notification struct {
+	ChatId    int64 `json:"chatId"`
+	MessageId int   `json:"messageId"`
+}
+
+// Title returns the title of the media of the request.
+func (r Request) Title() string {
+	if r.Film != nil {
+		return r.Film.PrintMovieTitle()
+	}
+	if r.Serie != nil {
+		return r.Serie.PrintSerieTitle()
+	}
+	return ""
+}
+
+// Store keeps the pending requests in memory and saves them in a json file, so they survive a restart.
+type Store struct {
+	path string
+
+	requests []Request
+	// lastId is the id of the last request added, saved so the buttons of a handled request never match a new one.
+	lastId int64
+
+	mu sync.Mutex
+}
+
+// storeFile is the content of the file of the store.
+type storeFile struct {
+	LastId   int64     `json:"lastId"`
+	Requests []Request `json:"requests"`
+}
+
+// NewStore creates a store saving the requests in the file at path, the requests already saved are loaded.
+func NewStore(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{path: path}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(bytes) > 0 {
+		var file storeFile
+		err = json.Unmarshal(bytes, &file)
+		if err != nil {
+			return nil, err
+		}
+		s.requests = file.Requests
+		s.lastId = file.LastId
+	}
+
+	return s, nil
+}
+
+// Add saves the request with a new id, and returns it.
+func (s *Store) Add(r Request) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastId++
+	r.Id = s.lastId
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	s.requests = append(s.requests, r)
+	return r, s.save()
+}
+
+// SetNotifications saves the messages sent to the admins about the request.
+func (s *Store) SetNotifications(id int64, notifications []Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return ErrRequestNotFound
+	}
+	s.requests[i].Notifications = notifications
+	return s.save()
+}
+
+// Get returns the pending request, false if it doesn't exist (anymore).
+func (s *Store) Get(id int64) (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return Request{}, false
+	}
+	return s.requests[i], true
+}
+
+// List returns the pending requests, from the oldest.
+func (s *Store) List() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Take removes the request and returns it, so two admins can't handle the same request.
+// The request is kept if the file can't be saved.
+func (s *Store) Take(id int64) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return Request{}, ErrRequestNotFound
+	}
+	r := s.requests[i]
+	requests := s.requests
+	s.requests = append(append([]Request(nil), requests[:i]...), requests[i+1:]...)
+	err := s.save()
+	if err != nil {
+		s.requests = requests
+		return Request{}, err
+	}
+	return r, nil
+}
+
+// Restore puts back a request taken but not handled, keeping its id.
+func (s *Store) Restore(r Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(r.Id) >= 0 {
+		return nil
+	}
+	s.requests = append(s.requests, r)
+	return s.save()
+}
+
+// index returns the index of the request, -1 if not found, s.mu must be held.
+func (s *Store) index(id int64) int {
+	for i, r := range s.requests {
+		if r.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the requests to the file, s.mu must be held.
+func (s *Store) save() error {
+	bytes, err := json.Marshal(storeFile{LastId: s.lastId, Requests: s.requests})
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, bytes, 0600)
+}
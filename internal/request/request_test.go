@@ -0,0 +1,84 @@
+package request
+
+import (
+	"errors"
+	"path"
+	"telarr/internal/radarr"
+	"telarr/internal/sonarr"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	p := path.Join(t.TempDir(), "requests.json")
+	s, err := NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	movie, err := s.Add(Request{UserId: 1, Film: &radarr.Film{Title: "Dune", Year: 2021}, QualityProfileId: 4})
+	if err != nil {
+		t.Fatalf("Store.Add() error = %v", err)
+	}
+	serie, err := s.Add(Request{UserId: 2, Serie: &sonarr.Serie{Title: "The Office"}})
+	if err != nil {
+		t.Fatalf("Store.Add() error = %v", err)
+	}
+	if movie.Id == serie.Id {
+		t.Fatalf("requests with the same id %d", movie.Id)
+	}
+	err = s.SetNotifications(movie.Id, []Notification{{ChatId: 3, MessageId: 10}})
+	if err != nil {
+		t.Fatalf("Store.SetNotifications() error = %v", err)
+	}
+
+	// the requests survive a restart
+	s, err = NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if got := s.List(); len(got) != 2 {
+		t.Fatalf("Store.List() = %v, want 2 requests", got)
+	}
+	got, found := s.Get(movie.Id)
+	if !found || got.Film == nil || got.Film.Title != "Dune" || got.QualityProfileId != 4 || len(got.Notifications) != 1 {
+		t.Errorf("Store.Get() = %+v, %v", got, found)
+	}
+
+	// the request is kept when it can't be taken
+	s.path = path.Join(t.TempDir(), "missing", "requests.json")
+	_, err = s.Take(movie.Id)
+	if err == nil {
+		t.Fatalf("Store.Take() without directory error = nil")
+	}
+	if _, found := s.Get(movie.Id); !found {
+		t.Fatalf("Store.Take() failed but the request is removed")
+	}
+	s.path = p
+
+	// a request is handled once
+	_, err = s.Take(movie.Id)
+	if err != nil {
+		t.Fatalf("Store.Take() error = %v", err)
+	}
+	_, err = s.Take(serie.Id)
+	if err != nil {
+		t.Fatalf("Store.Take() error = %v", err)
+	}
+	_, err = s.Take(movie.Id)
+	if !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("Store.Take() twice error = %v, want %v", err, ErrRequestNotFound)
+	}
+
+	// the ids are not reused after a restart
+	s, err = NewStore(p)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	other, err := s.Add(Request{UserId: 1})
+	if err != nil {
+		t.Fatalf("Store.Add() error = %v", err)
+	}
+	if other.Id <= serie.Id {
+		t.Errorf("new request id = %d, want more than %d", other.Id, serie.Id)
+	}
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"telarr/internal/atomicfile"
+	"time"
+)
+
+// FileStore is a store keeping the sessions in memory and saving them in a json file,
+// so the conversations survive a restart.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+}
+
+// NewFileStore creates a store saving the sessions in the file at path.
+// The sessions already saved in the file are loaded, the expired ones are dropped.
+func NewFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{
+		MemoryStore: NewMemoryStore(ttl),
+		path:        path,
+	}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(bytes) > 0 {
+		err = json.Unmarshal(bytes, &f.sessions)
+		if err != nil {
+			return nil, err
+		}
+		f.deleteExpired()
+	}
+
+	return f, nil
+}
+
+func (f *FileStore) Set(userId int, s Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s.ExpiresAt = time.Now().Add(f.ttl)
+	f.sessions[userId] = s
+	return f.save()
+}
+
+func (f *FileStore) Delete(userId int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exist := f.sessions[userId]; !exist {
+		return nil
+	}
+	delete(f.sessions, userId)
+	return f.save()
+}
+
+func (f *FileStore) DeleteExpired() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.deleteExpired() {
+		return nil
+	}
+	return f.save()
+}
+
+// save writes the sessions to the file, f.mu must be held.
+func (f *FileStore) save() error {
+	bytes, err := json.Marshal(f.sessions)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(f.path, bytes, 0600)
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a store keeping the sessions in memory.
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[int]Session
+}
+
+// NewMemoryStore creates a store keeping the sessions in memory for ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	return &MemoryStore{
+		ttl:      ttl,
+		sessions: make(map[int]Session),
+	}
+}
+
+func (m *MemoryStore) Get(userId int) (Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, exist := m.sessions[userId]
+	if !exist || time.Now().After(s.ExpiresAt) {
+		return Session{}, false
+	}
+	return s, true
+}
+
+func (m *MemoryStore) Set(userId int, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.ExpiresAt = time.Now().Add(m.ttl)
+	m.sessions[userId] = s
+	return nil
+}
+
+func (m *MemoryStore) Delete(userId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, userId)
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpired() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteExpired()
+	return nil
+}
+
+// deleteExpired removes the expired sessions, m.mu must be held.
+func (m *MemoryStore) deleteExpired() bool {
+	now := time.Now()
+	deleted := false
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
+			deleted = true
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"telarr/internal/audit"
+	"telarr/internal/radarr"
+	"telarr/internal/sonarr"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultTTL is the time a session is kept when no ttl is configured.
+	DefaultTTL = time.Hour
+	// janitorInterval is the interval between two cleanups of the expired sessions.
+	janitorInterval = time.Minute
+)
+
+// Session is the state of the conversation with a user.
+type Session struct {
+	// Action is the action the user is doing, empty if none.
+	Action types.UserAction `json:"action,omitempty"`
+	// Instance is the index of the radarr or sonarr instance the action is about.
+	Instance int `json:"instance,omitempty"`
+
+	// Films is the list of films found when looking for a movie to add.
+	Films []radarr.Film `json:"films,omitempty"`
+	// Series is the list of series found when looking for a serie to add.
+	Series []sonarr.Serie `json:"series,omitempty"`
+	// Releases is the list of releases found when searching the releases of a movie, to grab one.
+	Releases []radarr.Release `json:"releases,omitempty"`
+	// CurrPage is the current page in the list of films or series (starting at 1).
+	CurrPage int `json:"currPage,omitempty"`
+	// QualityProfileId is the quality profile selected for the film or serie to add, while the user selects the root folder.
+	QualityProfileId int64 `json:"qualityProfileId,omitempty"`
+
+	// AuditFilter is the filter of the last audit command of the admin, to show its next pages.
+	AuditFilter *audit.Filter `json:"auditFilter,omitempty"`
+
+	// ExpiresAt is the time after which the session is removed.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// HasData returns true if the session holds a list of films, series or releases.
+func (s Session) HasData() bool {
+	return len(s.Films) > 0 || len(s.Series) > 0 || len(s.Releases) > 0
+}
+
+// Store keeps the sessions of the users.
+type Store interface {
+	// Get returns the session of the user, false if there is none or if it has expired.
+	Get(userId int) (Session, bool)
+	// Set saves the session of the user and resets its expiration.
+	Set(userId int, s Session) error
+	// Delete removes the session of the user.
+	Delete(userId int) error
+	// DeleteExpired removes all the expired sessions.
+	DeleteExpired() error
+}
+
+// StartJanitor removes the expired sessions of the store periodically, until the context is done.
+func StartJanitor(ctx context.Context, store Store) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := store.DeleteExpired()
+			if err != nil {
+				log.Err(err).Msg("error when removing the expired sessions")
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"path"
+	"reflect"
+	"telarr/internal/radarr"
+	"telarr/internal/types"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		wait      time.Duration
+		wantExist bool
+	}{
+		{
+			name:      "not expired",
+			ttl:       time.Minute,
+			wait:      0,
+			wantExist: true,
+		},
+		{
+			name:      "expired",
+			ttl:       10 * time.Millisecond,
+			wait:      20 * time.Millisecond,
+			wantExist: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryStore(tt.ttl)
+			err := m.Set(1, Session{Action: types.UserActionLookMovieToAdd})
+			if err != nil {
+				t.Fatalf("MemoryStore.Set() error = %v", err)
+			}
+			time.Sleep(tt.wait)
+
+			got, exist := m.Get(1)
+			if exist != tt.wantExist {
+				t.Fatalf("MemoryStore.Get() exist = %v, want %v", exist, tt.wantExist)
+			}
+			if exist && got.Action != types.UserActionLookMovieToAdd {
+				t.Errorf("MemoryStore.Get() action = %v, want %v", got.Action, types.UserActionLookMovieToAdd)
+			}
+
+			err = m.DeleteExpired()
+			if err != nil {
+				t.Fatalf("MemoryStore.DeleteExpired() error = %v", err)
+			}
+			if _, stored := m.sessions[1]; stored != tt.wantExist {
+				t.Errorf("session stored = %v after DeleteExpired, want %v", stored, tt.wantExist)
+			}
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "session", "sessions.json")
+
+	want := Session{
+		Action:   types.UserActionAddMovie,
+		Films:    []radarr.Film{{TmdbId: 603, Title: "The Matrix", Year: 1999, Genres: []string{"Action"}}},
+		CurrPage: 1,
+	}
+
+	f, err := NewFileStore(filePath, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	err = f.Set(1, want)
+	if err != nil {
+		t.Fatalf("FileStore.Set() error = %v", err)
+	}
+	err = f.Set(2, Session{Action: types.UserActionLookSerieToAdd})
+	if err != nil {
+		t.Fatalf("FileStore.Set() error = %v", err)
+	}
+	err = f.Delete(2)
+	if err != nil {
+		t.Fatalf("FileStore.Delete() error = %v", err)
+	}
+
+	// reopen the store as after a restart
+	f, err = NewFileStore(filePath, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	got, exist := f.Get(1)
+	if !exist {
+		t.Fatalf("FileStore.Get() session not found after reopening")
+	}
+	got.ExpiresAt = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FileStore.Get() = %v, want %v", got, want)
+	}
+	if _, exist := f.Get(2); exist {
+		t.Errorf("FileStore.Get() deleted session found after reopening")
+	}
+}
@@ -1,10 +1,15 @@
 package sonarr
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 type Serie struct {
 	TvdbId  int64
 	SerieId int64
+	// ImdbId is the id of the serie on IMDb, empty if unknown.
+	ImdbId string
 
 	// IsInLibrary is true if the serie is in the library.
 	IsInLibrary bool
@@ -38,6 +43,9 @@ type Serie struct {
 	Downloaded bool
 	// Size is the size of the serie on disk GB.
 	Size float64
+
+	// WebUrl is the url of the serie in the sonarr web UI, empty if the instance has no public url or the serie is not in the library.
+	WebUrl string
 }
 
 func (s Serie) PrintSerieTitle() string {
@@ -86,9 +94,25 @@ func (s Serie) PrintSerieDetails() string {
 		str += " (" + strconv.Itoa(season.DownloadedEpisodes) + "/" + strconv.Itoa(season.TotalEpisodes) + ")_\n"
 	}
 
+	if links := s.PrintLinks(); links != "" {
+		str += "\n🔗 " + links
+	}
+
 	return str
 }
 
-func (s Serie) ToFolderPath() string {
-	return "/tv/" + s.Title + " (" + strconv.Itoa(s.Year) + ")"
+// PrintLinks returns the links to the serie on TVDb, IMDb and in sonarr, the unknown ones are skipped.
+func (s Serie) PrintLinks() string {
+	var links []string
+	if s.TvdbId > 0 {
+		links = append(links, "[TVDb](https://www.thetvdb.com/dereferrer/series/"+strconv.FormatInt(s.TvdbId, 10)+")")
+	}
+	if s.ImdbId != "" {
+		links = append(links, "[IMDb](https://www.imdb.com/title/"+s.ImdbId+")")
+	}
+	if s.WebUrl != "" {
+		links = append(links, "[View in Sonarr]("+s.WebUrl+")")
+	}
+
+	return strings.Join(links, " | ")
 }
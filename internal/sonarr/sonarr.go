@@ -1,6 +1,8 @@
 package sonarr
 
 import (
+	"fmt"
+	"strings"
 	"telarr/configuration"
 	"telarr/internal/types"
 
@@ -19,32 +21,93 @@ type Season struct {
 	TotalEpisodes int
 }
 
-func GetStatus(config configuration.Sonarr) types.ServiceStatus {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting sonarr for status")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+// SeriesService is the interface to manage the series library.
+type SeriesService interface {
+	// Name returns the name of the instance.
+	Name() string
+	// GetStatus returns the status of the service.
+	GetStatus() types.ServiceStatus
+	// GetSeriesList returns the list of series in the library.
+	GetSeriesList() ([]Serie, error)
+	// GetSerieDetails returns the details of a serie in the library from its name.
+	GetSerieDetails(serieName string) ([]Serie, error)
+	// GetSerieName returns the name of a serie in the library from its id.
+	GetSerieName(serieId int) (string, error)
+	// RemoveSerie removes a serie from the library.
+	RemoveSerie(serieId int) error
+	// LookupSerie looks for a serie to add to the library.
+	LookupSerie(serieName string) ([]Serie, error)
+	// AddSerie adds a serie to the library, in the root folder, and returns it as added.
+	AddSerie(serie Serie, qualityProfileId int64, rootFolderPath string) (Serie, error)
+	// GetQualityProfiles returns the list of quality profiles.
+	GetQualityProfiles() ([]types.QualityProfile, error)
+	// GetRootFolders returns the list of root folders, with their free space.
+	GetRootFolders() ([]types.RootFolder, error)
+	// DefaultRootFolder returns the root folder to add the series to, empty if the user must select it.
+	DefaultRootFolder() string
+	// GetQualityProfileId returns the id of a quality profile from its name, -1 if not found.
+	GetQualityProfileId(profileName string) (int64, error)
+}
+
+// Service is the SeriesService using the sonarr API.
+type Service struct {
+	config configuration.Sonarr
+	client *sonarr.Sonarr
+}
+
+func New(config configuration.Sonarr) *Service {
+	return &Service{
+		config: config,
+		client: sonarr.New(starr.New(config.ApiKey, config.Endpoint, 0)),
+	}
+}
+
+// Name returns the name of the instance, "Sonarr" if not set.
+func (s *Service) Name() string {
+	if s.config.Name == "" {
+		return "Sonarr"
+	}
+	return s.config.Name
+}
+
+// GetStatus returns the status of the instance.
+func (s *Service) GetStatus() types.ServiceStatus {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting sonarr for status")
+	r := s.client
 
 	status, err := r.GetSystemStatus()
 	if err != nil {
 		return types.ServiceStatus{
-			Name:    "Sonarr",
+			Name:    statusName("Sonarr", s.Name()),
 			Version: "unknown",
 			Running: false,
 		}
 	}
 
 	return types.ServiceStatus{
-		Name:    status.AppName,
+		Name:    statusName(status.AppName, s.Name()),
 		Version: status.Version,
 		Running: true,
 	}
 }
 
+// Ping checks that the endpoint is reachable, accepts the api key and is a sonarr instance.
+func (s *Service) Ping() error {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting sonarr for status")
+	status, err := s.client.GetSystemStatus()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(status.AppName, "Sonarr") {
+		return fmt.Errorf("the endpoint is a %s instance, not a sonarr one", status.AppName)
+	}
+	return nil
+}
+
 // GetSeriesList returns the list of series in the library.
-func GetSeriesList(config configuration.Sonarr) ([]Serie, error) {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for series list")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) GetSeriesList() ([]Serie, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for series list")
+	r := s.client
 
 	series, err := r.GetSeries(0)
 	if err != nil {
@@ -54,7 +117,7 @@ func GetSeriesList(config configuration.Sonarr) ([]Serie, error) {
 	// convert the series to the Serie struct
 	var seriesList []Serie
 	for _, serie := range series {
-		s := toSerieStruct(serie)
+		s := toSerieStruct(serie, s.config.PublicUrl)
 		seriesList = append(seriesList, s)
 	}
 
@@ -62,10 +125,9 @@ func GetSeriesList(config configuration.Sonarr) ([]Serie, error) {
 }
 
 // GetSerieDetails returns the details of a serie in the library from its name.
-func GetSerieDetails(config configuration.Sonarr, serieName string) ([]Serie, error) {
-	log.Trace().Str("serieName", serieName).Str("endpoint", config.Endpoint).Msg("contacting radarr for serie details")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) GetSerieDetails(serieName string) ([]Serie, error) {
+	log.Trace().Str("serieName", serieName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for serie details")
+	r := s.client
 
 	series, err := r.Lookup(serieName)
 	if err != nil {
@@ -74,7 +136,7 @@ func GetSerieDetails(config configuration.Sonarr, serieName string) ([]Serie, er
 
 	// convert the series to the Serie struct
 	var seriesList []Serie
-	libSeries, err := GetSeriesList(config)
+	libSeries, err := s.GetSeriesList()
 	if err != nil {
 		return nil, err
 	}
@@ -92,10 +154,9 @@ func GetSerieDetails(config configuration.Sonarr, serieName string) ([]Serie, er
 }
 
 // GetSerieName returns the name of a serie in the library from its id.
-func GetSerieName(config configuration.Sonarr, serieId int) (string, error) {
-	log.Trace().Int("serieId", serieId).Str("endpoint", config.Endpoint).Msg("contacting radarr for serie name")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) GetSerieName(serieId int) (string, error) {
+	log.Trace().Int("serieId", serieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for serie name")
+	r := s.client
 
 	serie, err := r.GetSeriesByID(int64(serieId))
 	if err != nil {
@@ -106,10 +167,9 @@ func GetSerieName(config configuration.Sonarr, serieId int) (string, error) {
 }
 
 // RemoveSerie removes a serie from the library.
-func RemoveSerie(config configuration.Sonarr, serieId int) error {
-	log.Trace().Int("serieId", serieId).Str("endpoint", config.Endpoint).Msg("contacting radarr to remove serie")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) RemoveSerie(serieId int) error {
+	log.Trace().Int("serieId", serieId).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to remove serie")
+	r := s.client
 
 	err := r.DeleteSeries(serieId, true, false)
 	if err != nil {
@@ -119,10 +179,9 @@ func RemoveSerie(config configuration.Sonarr, serieId int) error {
 	return nil
 }
 
-func LookupSerie(config configuration.Sonarr, serieName string) ([]Serie, error) {
-	log.Trace().Str("serieName", serieName).Str("endpoint", config.Endpoint).Msg("contacting radarr for serie details")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) LookupSerie(serieName string) ([]Serie, error) {
+	log.Trace().Str("serieName", serieName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for serie details")
+	r := s.client
 
 	series, err := r.Lookup(serieName)
 	if err != nil {
@@ -132,41 +191,39 @@ func LookupSerie(config configuration.Sonarr, serieName string) ([]Serie, error)
 	// convert the series to the Serie struct
 	var seriesList []Serie
 	for _, serie := range series {
-		s := toSerieStruct(serie)
+		s := toSerieStruct(serie, s.config.PublicUrl)
 		seriesList = append(seriesList, s)
 	}
 
 	return seriesList, nil
 }
 
-func AddSerie(config configuration.Sonarr, serie Serie, qualityProfileId int64) error {
-	log.Trace().Str("serieTitle", serie.Title).Str("endpoint", config.Endpoint).Msg("contacting radarr to add serie")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	r := sonarr.New(c)
+func (s *Service) AddSerie(serie Serie, qualityProfileId int64, rootFolderPath string) (Serie, error) {
+	log.Trace().Str("serieTitle", serie.Title).Str("endpoint", s.config.Endpoint).Msg("contacting radarr to add serie")
+	r := s.client
 
-	_, err := r.AddSeries(&sonarr.AddSeriesInput{
+	newSerie, err := r.AddSeries(&sonarr.AddSeriesInput{
 		Title:            serie.Title,
 		TvdbID:           serie.TvdbId,
 		QualityProfileID: qualityProfileId,
 		Monitored:        true,
-		RootFolderPath:   "/tv",
+		RootFolderPath:   rootFolderPath,
 		AddOptions: &sonarr.AddSeriesOptions{
 			SearchForMissingEpisodes: true,
 		},
 	})
 	if err != nil {
-		return err
+		return Serie{}, err
 	}
 
-	return nil
+	return toSerieStruct(newSerie, s.config.PublicUrl), nil
 }
 
-func GetQualityProfiles(config configuration.Sonarr) ([]types.QualityProfile, error) {
-	log.Trace().Str("endpoint", config.Endpoint).Msg("contacting radarr for quality profiles")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	s := sonarr.New(c)
+func (s *Service) GetQualityProfiles() ([]types.QualityProfile, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting radarr for quality profiles")
+	r := s.client
 
-	profiles, err := s.GetQualityProfiles()
+	profiles, err := r.GetQualityProfiles()
 	if err != nil {
 		return nil, err
 	}
@@ -184,12 +241,40 @@ func GetQualityProfiles(config configuration.Sonarr) ([]types.QualityProfile, er
 	return profilesList, nil
 }
 
-func GetQualityProfileId(config configuration.Sonarr, profileName string) (int64, error) {
-	log.Trace().Str("profileName", profileName).Str("endpoint", config.Endpoint).Msg("contacting radarr for quality profile id")
-	c := starr.New(config.ApiKey, config.Endpoint, 0)
-	s := sonarr.New(c)
+// GetRootFolders returns the list of root folders, with their free space.
+func (s *Service) GetRootFolders() ([]types.RootFolder, error) {
+	log.Trace().Str("endpoint", s.config.Endpoint).Msg("contacting sonarr for root folders")
+	r := s.client
 
-	profiles, err := s.GetQualityProfiles()
+	folders, err := r.GetRootFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	// convert the folders to the RootFolder struct
+	var foldersList []types.RootFolder
+	for _, folder := range folders {
+		f := types.RootFolder{
+			ID:        folder.ID,
+			Path:      folder.Path,
+			FreeSpace: folder.FreeSpace,
+		}
+		foldersList = append(foldersList, f)
+	}
+
+	return foldersList, nil
+}
+
+// DefaultRootFolder returns the root folder configured for the instance, empty if none.
+func (s *Service) DefaultRootFolder() string {
+	return s.config.RootFolder
+}
+
+func (s *Service) GetQualityProfileId(profileName string) (int64, error) {
+	log.Trace().Str("profileName", profileName).Str("endpoint", s.config.Endpoint).Msg("contacting radarr for quality profile id")
+	r := s.client
+
+	profiles, err := r.GetQualityProfiles()
 	if err != nil {
 		return -1, err
 	}
@@ -205,20 +290,35 @@ func GetQualityProfileId(config configuration.Sonarr, profileName string) (int64
 
 /* Tools */
 
-func toSerieStruct(serie *sonarr.Series) Serie {
+// statusName returns the name of the app followed by the name of the instance, if different.
+func statusName(appName string, instanceName string) string {
+	if instanceName == appName {
+		return appName
+	}
+	return appName + " " + instanceName
+}
+
+func toSerieStruct(serie *sonarr.Series, publicUrl string) Serie {
 	s := Serie{
-		TvdbId:            serie.TvdbID,
-		SerieId:           serie.ID,
-		IsInLibrary:       serie.ID > 0,
-		Title:             serie.Title,
-		Year:              serie.Year,
-		TotalSeasonsCount: serie.Statistics.SeasonCount,
-		Rating:            serie.Ratings.Value,
-		NumberOfVotes:     int(serie.Ratings.Votes),
-		Overview:          serie.Overview,
-		Genres:            serie.Genres,
-		Downloaded:        serie.Statistics.EpisodeFileCount > 0,
-		Size:              float64(serie.Statistics.SizeOnDisk) / 1024 / 1024 / 1024,
+		TvdbId:      serie.TvdbID,
+		SerieId:     serie.ID,
+		ImdbId:      serie.ImdbID,
+		IsInLibrary: serie.ID > 0,
+		Title:       serie.Title,
+		Year:        serie.Year,
+		Overview:    serie.Overview,
+		Genres:      serie.Genres,
+	}
+
+	// the statistics and the ratings are missing from some responses (e.g. when adding a serie)
+	if serie.Statistics != nil {
+		s.TotalSeasonsCount = serie.Statistics.SeasonCount
+		s.Downloaded = serie.Statistics.EpisodeFileCount > 0
+		s.Size = float64(serie.Statistics.SizeOnDisk) / 1024 / 1024 / 1024
+	}
+	if serie.Ratings != nil {
+		s.Rating = serie.Ratings.Value
+		s.NumberOfVotes = int(serie.Ratings.Votes)
 	}
 
 	// get the seasons
@@ -242,5 +342,10 @@ func toSerieStruct(serie *sonarr.Series) Serie {
 		}
 	}
 
+	// the web UI has a page only for the series of the library
+	if publicUrl != "" && s.IsInLibrary && serie.TitleSlug != "" {
+		s.WebUrl = publicUrl + "/series/" + serie.TitleSlug
+	}
+
 	return s
 }
@@ -0,0 +1,110 @@
+package tgclient
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// pollingRetryDelay is the delay before getting the updates again after an error.
+	pollingRetryDelay = 3 * time.Second
+)
+
+// Bot is the telegram bot, sending the messages to the forum topics and receiving the topics of the updates.
+type Bot struct {
+	*telegram.Bot
+}
+
+// NewBot creates the bot from its token.
+func NewBot(token string) (*Bot, error) {
+	bot, err := telegram.New(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Bot{Bot: bot}, nil
+}
+
+func (b *Bot) SendMessage(p SendMessage) (*telegram.Message, error) {
+	if p.MessageThreadID == 0 {
+		return b.Bot.SendMessage(p.SendMessage)
+	}
+	src, err := b.Do(telegram.MethodSendMessage, p)
+	if err != nil {
+		return nil, err
+	}
+	result := new(telegram.Message)
+	return result, parseResponse(src, result)
+}
+
+func (b *Bot) SendPhoto(p SendPhoto) (*telegram.Message, error) {
+	// the library only knows how to upload a file
+	if p.MessageThreadID == 0 || p.Photo == nil || !p.Photo.IsURI() {
+		return b.Bot.SendPhoto(p.SendPhoto)
+	}
+	src, err := b.Do(telegram.MethodSendPhoto, struct {
+		ChatID          int64                `json:"chat_id"`
+		MessageThreadID int                  `json:"message_thread_id"`
+		Photo           string               `json:"photo"`
+		Caption         string               `json:"caption,omitempty"`
+		ParseMode       string               `json:"parse_mode,omitempty"`
+		ReplyMarkup     telegram.ReplyMarkup `json:"reply_markup,omitempty"`
+	}{
+		ChatID:          p.ChatID,
+		MessageThreadID: p.MessageThreadID,
+		Photo:           p.Photo.URI.String(),
+		Caption:         p.Caption,
+		ParseMode:       p.ParseMode,
+		ReplyMarkup:     p.ReplyMarkup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := new(telegram.Message)
+	return result, parseResponse(src, result)
+}
+
+// NewLongPollingChannel returns the channel of the updates received by long polling, with their forum topic.
+func (b *Bot) NewLongPollingChannel(params *telegram.GetUpdates) UpdatesChannel {
+	updates := make(UpdatesChannel, params.Limit)
+
+	go func() {
+		for {
+			src, err := b.Do(telegram.MethodGetUpdates, params)
+			var result []*Update
+			if err == nil {
+				err = parseResponse(src, &result)
+			}
+			if err != nil {
+				log.Err(err).Str("retryIn", pollingRetryDelay.String()).Msg("error when getting the updates")
+				time.Sleep(pollingRetryDelay)
+				continue
+			}
+
+			for _, upd := range result {
+				if upd.UpdateID < params.Offset {
+					continue
+				}
+				params.Offset = upd.UpdateID + 1
+				updates <- upd
+			}
+		}
+	}()
+
+	return updates
+}
+
+// parseResponse reads the result of the response into the result, or returns the error of the response.
+func parseResponse(src []byte, result any) error {
+	var resp telegram.Response
+	err := json.Unmarshal(src, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return &telegram.Error{Code: resp.ErrorCode, Description: resp.Description}
+	}
+	return json.Unmarshal(resp.Result, result)
+}
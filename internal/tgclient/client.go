@@ -0,0 +1,73 @@
+package tgclient
+
+import "gitlab.com/toby3d/telegram"
+
+// Client is the part of the telegram bot API used to talk to the users.
+// It is implemented by *Bot, and by Fake in the tests.
+type Client interface {
+	// SendMessage sends a text message.
+	SendMessage(p SendMessage) (*telegram.Message, error)
+	// SendPhoto sends a photo with a caption.
+	SendPhoto(p SendPhoto) (*telegram.Message, error)
+	// EditMessageText edits the text and the inline keyboard of a message.
+	EditMessageText(p *telegram.EditMessageText) (*telegram.Message, error)
+	// EditMessageMedia edits the photo, the caption and the inline keyboard of a message.
+	EditMessageMedia(p telegram.EditMessageMedia) (*telegram.Message, error)
+	// DeleteMessage deletes a message.
+	DeleteMessage(chatID int64, messageID int) (bool, error)
+}
+
+var _ Client = (*Bot)(nil)
+
+// SendMessage is the text message to send, in a forum topic of the chat if MessageThreadID is set.
+type SendMessage struct {
+	telegram.SendMessage
+	// MessageThreadID is the id of the forum topic, 0 for the general topic or a chat without topics.
+	MessageThreadID int `json:"message_thread_id,omitempty"`
+}
+
+// SendPhoto is the photo to send, in a forum topic of the chat if MessageThreadID is set.
+type SendPhoto struct {
+	telegram.SendPhoto
+	// MessageThreadID is the id of the forum topic, 0 for the general topic or a chat without topics.
+	MessageThreadID int `json:"message_thread_id,omitempty"`
+}
+
+// threadClient is a client sending the new messages of a chat to a forum topic.
+type threadClient struct {
+	Client
+	chatID   int64
+	threadID int
+}
+
+// InThread returns the client sending the new messages of the chat to the forum topic,
+// the messages of the other chats are unchanged. It returns the client itself if there is no topic.
+func InThread(c Client, chatID int64, threadID int) Client {
+	if threadID == 0 {
+		return c
+	}
+	return &threadClient{Client: c, chatID: chatID, threadID: threadID}
+}
+
+// ThreadID returns the forum topic the client sends the new messages of the chat to, 0 if none.
+func ThreadID(c Client, chatID int64) int {
+	t, ok := c.(*threadClient)
+	if !ok || t.chatID != chatID {
+		return 0
+	}
+	return t.threadID
+}
+
+func (t *threadClient) SendMessage(p SendMessage) (*telegram.Message, error) {
+	if p.ChatID == t.chatID && p.MessageThreadID == 0 {
+		p.MessageThreadID = t.threadID
+	}
+	return t.Client.SendMessage(p)
+}
+
+func (t *threadClient) SendPhoto(p SendPhoto) (*telegram.Message, error) {
+	if p.ChatID == t.chatID && p.MessageThreadID == 0 {
+		p.MessageThreadID = t.threadID
+	}
+	return t.Client.SendPhoto(p)
+}
@@ -0,0 +1,379 @@
+package tgclient
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// fakeUpdatesChannelSize is the size of the channel of the injected updates.
+	fakeUpdatesChannelSize = 100
+	// fakeWaitInterval is the interval between two checks of the sent messages when waiting.
+	fakeWaitInterval = 10 * time.Millisecond
+
+	// FakeBotUsername is the username of the bot the injected messages reply to.
+	FakeBotUsername = "telarr_test_bot"
+)
+
+var (
+	// ErrFakeMessageNotFound is returned when editing or deleting a message that was not sent.
+	ErrFakeMessageNotFound = errors.New("message not found")
+)
+
+// FakeMessage is a message sent by the bot to the Fake.
+type FakeMessage struct {
+	// ChatID is the id of the chat the message was sent to.
+	ChatID int64
+	// ThreadID is the id of the forum topic the message was sent to, 0 if none.
+	ThreadID int
+	// MessageID is the id of the message, unique for the whole Fake.
+	MessageID int
+	// Text is the text of the message, or the caption of the photo.
+	Text string
+	// Photo is the url of the photo, empty if it's a text message.
+	Photo string
+	// ReplyMarkup is the keyboard attached to the message, nil if none.
+	ReplyMarkup telegram.ReplyMarkup
+
+	// Edited is the number of times the message was edited.
+	Edited int
+	// Deleted is true if the message was deleted.
+	Deleted bool
+}
+
+// InlineKeyboard returns the inline keyboard of the message, nil if it has none.
+func (m FakeMessage) InlineKeyboard() *telegram.InlineKeyboardMarkup {
+	switch k := m.ReplyMarkup.(type) {
+	case telegram.InlineKeyboardMarkup:
+		return &k
+	case *telegram.InlineKeyboardMarkup:
+		return k
+	}
+	return nil
+}
+
+// Button returns the first button of the inline keyboard whose text contains the given text.
+func (m FakeMessage) Button(text string) (*telegram.InlineKeyboardButton, bool) {
+	keyboard := m.InlineKeyboard()
+	if keyboard == nil {
+		return nil, false
+	}
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			if strings.Contains(button.Text, text) {
+				return button, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Fake is an in-memory telegram client.
+// It records the messages sent by the bot and allows to inject the updates of the users,
+// so the bot can be tested without network.
+type Fake struct {
+	// messages is the list of the messages sent by the bot, in the order they were sent.
+	messages []*FakeMessage
+	// userMessages are the messages injected by the users, true once deleted by the bot.
+	userMessages map[fakeMessageKey]bool
+	// lastMessageId is the last id given to a message, sent by the bot or injected.
+	lastMessageId int
+	// lastUpdateId is the last id given to an injected update.
+	lastUpdateId int
+	mu           sync.Mutex
+
+	updates UpdatesChannel
+}
+
+// fakeMessageKey identifies a message.
+type fakeMessageKey struct {
+	chatID    int64
+	messageID int
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		userMessages: make(map[fakeMessageKey]bool),
+		updates:      make(UpdatesChannel, fakeUpdatesChannelSize),
+	}
+}
+
+// Updates returns the channel of the injected updates.
+func (f *Fake) Updates() UpdatesChannel {
+	return f.updates
+}
+
+/* Client */
+
+func (f *Fake) SendMessage(p SendMessage) (*telegram.Message, error) {
+	return f.send(FakeMessage{
+		ChatID:      p.ChatID,
+		ThreadID:    p.MessageThreadID,
+		Text:        p.Text,
+		ReplyMarkup: p.ReplyMarkup,
+	}), nil
+}
+
+func (f *Fake) SendPhoto(p SendPhoto) (*telegram.Message, error) {
+	m := FakeMessage{
+		ChatID:      p.ChatID,
+		ThreadID:    p.MessageThreadID,
+		Text:        p.Caption,
+		ReplyMarkup: p.ReplyMarkup,
+	}
+	if p.Photo != nil && p.Photo.URI != nil {
+		m.Photo = p.Photo.URI.String()
+	}
+	return f.send(m), nil
+}
+
+func (f *Fake) EditMessageText(p *telegram.EditMessageText) (*telegram.Message, error) {
+	return f.edit(p.ChatID, p.MessageID, func(m *FakeMessage) {
+		m.Text = p.Text
+		m.ReplyMarkup = inlineKeyboardOrNil(p.ReplyMarkup)
+	})
+}
+
+func (f *Fake) EditMessageMedia(p telegram.EditMessageMedia) (*telegram.Message, error) {
+	// the media may be a custom type, so it's read from its json representation
+	var media struct {
+		Media   any    `json:"media"`
+		Caption string `json:"caption"`
+	}
+	raw, err := json.Marshal(p.Media)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &media)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.edit(p.ChatID, p.MessageID, func(m *FakeMessage) {
+		if url, ok := media.Media.(string); ok {
+			m.Photo = url
+		}
+		m.Text = media.Caption
+		m.ReplyMarkup = inlineKeyboardOrNil(p.ReplyMarkup)
+	})
+}
+
+func (f *Fake) DeleteMessage(chatID int64, messageID int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.find(chatID, messageID)
+	if m == nil {
+		key := fakeMessageKey{chatID: chatID, messageID: messageID}
+		if _, ok := f.userMessages[key]; ok {
+			f.userMessages[key] = true
+			return true, nil
+		}
+		return false, ErrFakeMessageNotFound
+	}
+	m.Deleted = true
+	return true, nil
+}
+
+/* Tests helpers */
+
+// Messages returns a copy of the messages sent by the bot in the chat, deleted ones included.
+func (f *Fake) Messages(chatID int64) []FakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []FakeMessage
+	for _, m := range f.messages {
+		if m.ChatID == chatID {
+			messages = append(messages, *m)
+		}
+	}
+	return messages
+}
+
+// WaitForMessage waits until a message of the chat matches, and returns it.
+// Return false if no message matched before the timeout.
+func (f *Fake) WaitForMessage(chatID int64, timeout time.Duration, match func(m FakeMessage) bool) (FakeMessage, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, m := range f.Messages(chatID) {
+			if match(m) {
+				return m, true
+			}
+		}
+		if time.Now().After(deadline) {
+			return FakeMessage{}, false
+		}
+		time.Sleep(fakeWaitInterval)
+	}
+}
+
+// WaitForText waits until a message of the chat, not deleted, contains the text, and returns it.
+func (f *Fake) WaitForText(chatID int64, timeout time.Duration, text string) (FakeMessage, bool) {
+	return f.WaitForMessage(chatID, timeout, func(m FakeMessage) bool {
+		return !m.Deleted && strings.Contains(m.Text, text)
+	})
+}
+
+// InjectMessage sends a text message from the user in the private chat to the bot.
+// The message is a command if the text starts with a "/". Return the id of the message.
+func (f *Fake) InjectMessage(from *telegram.User, chatID int64, text string) int {
+	return f.InjectChatMessage(from, fakeChat(chatID), 0, text, 0)
+}
+
+// InjectChatMessage sends a text message from the user in the chat and the forum topic to the bot,
+// as a reply to the message of the bot if replyTo isn't 0. The words starting with a "@" are mentions.
+// Return the id of the message.
+func (f *Fake) InjectChatMessage(from *telegram.User, chat *telegram.Chat, threadID int, text string, replyTo int) int {
+	f.mu.Lock()
+	f.lastMessageId++
+	f.lastUpdateId++
+	messageId, updateId := f.lastMessageId, f.lastUpdateId
+	f.userMessages[fakeMessageKey{chatID: chat.ID, messageID: messageId}] = false
+	f.mu.Unlock()
+
+	msg := &telegram.Message{
+		ID:   messageId,
+		From: from,
+		Chat: chat,
+		Date: time.Now().Unix(),
+		Text: text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		msg.Entities = []*telegram.MessageEntity{{
+			Type:   telegram.EntityBotCommand,
+			Offset: 0,
+			Length: utf8.RuneCountInString(command),
+		}}
+	}
+	// the offsets of the entities are in UTF-16 code units
+	offset := 0
+	for _, word := range strings.SplitAfter(text, " ") {
+		length := len(utf16.Encode([]rune(word)))
+		if strings.HasPrefix(word, "@") {
+			msg.Entities = append(msg.Entities, &telegram.MessageEntity{
+				Type:   telegram.EntityMention,
+				Offset: offset,
+				Length: len(utf16.Encode([]rune(strings.TrimSuffix(word, " ")))),
+			})
+		}
+		offset += length
+	}
+	if replyTo != 0 {
+		msg.ReplyToMessage = &telegram.Message{
+			ID:   replyTo,
+			From: &telegram.User{IsBot: true, Username: FakeBotUsername},
+			Chat: chat,
+		}
+	}
+
+	f.updates <- &Update{Update: &telegram.Update{UpdateID: updateId, Message: msg}, ThreadID: threadID}
+	return messageId
+}
+
+// UserMessageDeleted returns true if the bot deleted the message injected by the user.
+func (f *Fake) UserMessageDeleted(chatID int64, messageID int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.userMessages[fakeMessageKey{chatID: chatID, messageID: messageID}]
+}
+
+// InjectCallback sends the press of a button of a message sent by the bot to the bot.
+func (f *Fake) InjectCallback(from *telegram.User, m FakeMessage, data string) {
+	f.mu.Lock()
+	f.lastUpdateId++
+	updateId := f.lastUpdateId
+	f.mu.Unlock()
+
+	msg := &telegram.Message{
+		ID:   m.MessageID,
+		Chat: fakeChat(m.ChatID),
+		Date: time.Now().Unix(),
+	}
+	if m.Photo != "" {
+		msg.Caption = m.Text
+	} else {
+		msg.Text = m.Text
+	}
+
+	f.updates <- &Update{Update: &telegram.Update{UpdateID: updateId, CallbackQuery: &telegram.CallbackQuery{
+		From:    from,
+		Message: msg,
+		Data:    data,
+	}}, ThreadID: m.ThreadID}
+}
+
+/* Tools */
+
+// fakeChat returns the chat of the id, a private chat for a positive id and a supergroup otherwise, as telegram does.
+func fakeChat(chatID int64) *telegram.Chat {
+	if chatID > 0 {
+		return &telegram.Chat{ID: chatID, Type: telegram.ChatPrivate}
+	}
+	return &telegram.Chat{ID: chatID, Type: telegram.ChatSuperGroup}
+}
+
+// send records the message and returns it as telegram would.
+func (f *Fake) send(m FakeMessage) *telegram.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastMessageId++
+	m.MessageID = f.lastMessageId
+	f.messages = append(f.messages, &m)
+
+	return &telegram.Message{
+		ID:   m.MessageID,
+		Chat: &telegram.Chat{ID: m.ChatID},
+		Date: time.Now().Unix(),
+		Text: m.Text,
+	}
+}
+
+// edit applies the change to the message and returns it as telegram would.
+func (f *Fake) edit(chatID int64, messageID int, change func(m *FakeMessage)) (*telegram.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.find(chatID, messageID)
+	if m == nil || m.Deleted {
+		return nil, ErrFakeMessageNotFound
+	}
+	change(m)
+	m.Edited++
+
+	return &telegram.Message{
+		ID:   m.MessageID,
+		Chat: &telegram.Chat{ID: m.ChatID},
+		Date: time.Now().Unix(),
+		Text: m.Text,
+	}, nil
+}
+
+// find returns the message sent in the chat with the id, nil if not found.
+// f.mu must be held.
+func (f *Fake) find(chatID int64, messageID int) *FakeMessage {
+	for _, m := range f.messages {
+		if m.ChatID == chatID && m.MessageID == messageID {
+			return m
+		}
+	}
+	return nil
+}
+
+// inlineKeyboardOrNil returns the keyboard as a ReplyMarkup, nil if there is no keyboard.
+func inlineKeyboardOrNil(keyboard *telegram.InlineKeyboardMarkup) telegram.ReplyMarkup {
+	if keyboard == nil {
+		return nil
+	}
+	return keyboard
+}
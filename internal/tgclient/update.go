@@ -0,0 +1,57 @@
+package tgclient
+
+import (
+	"encoding/json"
+
+	"gitlab.com/toby3d/telegram"
+)
+
+// Update is a telegram update with the forum topic of its message, unknown to the telegram library.
+type Update struct {
+	*telegram.Update
+	// ThreadID is the id of the forum topic of the message, or of the message of the callback query.
+	// It is 0 for the general topic or a chat without topics.
+	ThreadID int
+}
+
+// UpdatesChannel is the channel of the incoming updates.
+type UpdatesChannel chan *Update
+
+// topicMessage is the part of a message telling its forum topic.
+type topicMessage struct {
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+}
+
+// threadID returns the forum topic of the message, 0 if it's not in a topic.
+// The thread of a message outside a topic is the message it replies to, so it's ignored.
+func (m *topicMessage) threadID() int {
+	if m == nil || !m.IsTopicMessage {
+		return 0
+	}
+	return m.MessageThreadID
+}
+
+func (u *Update) UnmarshalJSON(data []byte) error {
+	u.Update = new(telegram.Update)
+	err := json.Unmarshal(data, u.Update)
+	if err != nil {
+		return err
+	}
+
+	var topic struct {
+		Message       *topicMessage `json:"message"`
+		CallbackQuery *struct {
+			Message *topicMessage `json:"message"`
+		} `json:"callback_query"`
+	}
+	err = json.Unmarshal(data, &topic)
+	if err != nil {
+		return err
+	}
+	u.ThreadID = topic.Message.threadID()
+	if topic.CallbackQuery != nil {
+		u.ThreadID = topic.CallbackQuery.Message.threadID()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package tgclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUpdate_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantThreadID int
+		wantErr      bool
+	}{
+		{
+			name:         "private message",
+			data:         `{"update_id": 1, "message": {"message_id": 1, "chat": {"id": 1, "type": "private"}, "text": "/movies"}}`,
+			wantThreadID: 0,
+		},
+		{
+			name:         "message in a topic",
+			data:         `{"update_id": 1, "message": {"message_id": 1, "message_thread_id": 7, "is_topic_message": true, "chat": {"id": -100, "type": "supergroup"}, "text": "/movies"}}`,
+			wantThreadID: 7,
+		},
+		{
+			name:         "reply outside a topic",
+			data:         `{"update_id": 1, "message": {"message_id": 2, "message_thread_id": 1, "chat": {"id": -100, "type": "supergroup"}, "text": "hello"}}`,
+			wantThreadID: 0,
+		},
+		{
+			name:         "callback in a topic",
+			data:         `{"update_id": 1, "callback_query": {"id": "1", "data": "x", "message": {"message_id": 1, "message_thread_id": 7, "is_topic_message": true, "chat": {"id": -100, "type": "supergroup"}}}}`,
+			wantThreadID: 7,
+		},
+		{
+			name:    "invalid",
+			data:    `{"update_id": "1"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upd Update
+			err := json.Unmarshal([]byte(tt.data), &upd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Update.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if upd.UpdateID != 1 || upd.ThreadID != tt.wantThreadID {
+				t.Errorf("Update.UnmarshalJSON() = %d, thread %d, want 1, thread %d", upd.UpdateID, upd.ThreadID, tt.wantThreadID)
+			}
+		})
+	}
+}
@@ -68,12 +68,32 @@ const (
 	CallbackPreviousAddMovie CallbackAction = "previousAddMovie"
 	// CallbackEditRequestAddMovie is the action to edit the request of add a movie.
 	CallbackEditRequestAddMovie CallbackAction = "editRequestMovie"
+	// CallbackRootFolderAddMovie is the action to select the root folder of the movie to add, the id of the folder is the arg.
+	CallbackRootFolderAddMovie CallbackAction = "rootFolderAddMovie"
 	// CallbackFollowDownloadingStatusMovie is the action to get the downloading status of a movie.
 	CallbackFollowDownloadingStatusMovie CallbackAction = "followDownloadingStatus"
 	// CallbackRefreshDownloadingStatusMovie is the action to refresh the downloading status of a movie.
 	CallbackRefreshDownloadingStatusMovie CallbackAction = "refreshDownloadingStatus"
 	// CallbackCancelFollowDownloadingStatusMovie is the action to cancel the downloading status of a movie.
 	CallbackCancelFollowDownloadingStatusMovie CallbackAction = "cancelFollowDownloadingStatus"
+	// CallbackFilmDetails is the action to show the details of a movie of the library again, the id of the movie is the media id.
+	CallbackFilmDetails CallbackAction = "filmDetails"
+	// CallbackSearchFilm is the action to ask radarr to search a movie of the library and grab the best release.
+	CallbackSearchFilm CallbackAction = "searchFilm"
+	// CallbackRefreshFilm is the action to refresh the information of a movie of the library and rescan its files.
+	CallbackRefreshFilm CallbackAction = "refreshFilm"
+	// CallbackToggleMonitoredFilm is the action to monitor or unmonitor a movie of the library.
+	CallbackToggleMonitoredFilm CallbackAction = "toggleMonitoredFilm"
+	// CallbackQualityProfilesFilm is the action to show the quality profiles to select for a movie of the library.
+	CallbackQualityProfilesFilm CallbackAction = "qualityProfilesFilm"
+	// CallbackSetQualityProfileFilm is the action to change the quality profile of a movie of the library, the id of the profile is the arg.
+	CallbackSetQualityProfileFilm CallbackAction = "setQualityProfileFilm"
+	// CallbackSearchReleases is the action to search the releases of a movie of the library, the id of the movie is the media id.
+	CallbackSearchReleases CallbackAction = "searchReleases"
+	// CallbackReleasesPage is the action to show a page of the releases found, the number of the page is the page.
+	CallbackReleasesPage CallbackAction = "releasesPage"
+	// CallbackGrabRelease is the action to grab a release found, the number of the release (starting at 1) is the arg.
+	CallbackGrabRelease CallbackAction = "grabRelease"
 
 	// CallbackNextSerie is the action to get the next page of the series list.
 	CallbackNextSerie CallbackAction = "nextSerie"
@@ -101,10 +121,47 @@ const (
 	CallbackPreviousAddSerie CallbackAction = "previousAddSerie"
 	// CallbackEditRequestAddSerie is the action to edit the request of add a serie.
 	CallbackEditRequestAddSerie CallbackAction = "editRequestSerie"
+	// CallbackRootFolderAddSerie is the action to select the root folder of the serie to add, the id of the folder is the arg.
+	CallbackRootFolderAddSerie CallbackAction = "rootFolderAddSerie"
 
 	// CallbackCancel is the action to cancel the current action.
 	CallbackCancel CallbackAction = "cancel"
 
 	// CallbackWakeOnLan is the action to wake on lan the PC.
 	CallbackWakeOnLan CallbackAction = "wakeOnLan"
+
+	// CallbackApproveRequest is the action to approve the request of a user, the id of the request is the arg.
+	CallbackApproveRequest CallbackAction = "approveRequest"
+	// CallbackRejectRequest is the action to reject the request of a user.
+	CallbackRejectRequest CallbackAction = "rejectRequest"
+
+	// CallbackAuditPage is the action to show a page of the audit log, the number of the page is the page.
+	CallbackAuditPage CallbackAction = "auditPage"
+
+	// CallbackAdminMenu is the action to go back to the admin menu.
+	CallbackAdminMenu CallbackAction = "adminMenu"
+	// CallbackAdminAutorizedUsers is the action to list the autorized users.
+	CallbackAdminAutorizedUsers CallbackAction = "adminAutorized"
+	// CallbackAdminBlacklistedUsers is the action to list the blacklisted users.
+	CallbackAdminBlacklistedUsers CallbackAction = "adminBlacklisted"
+	// CallbackAdminUser is the action to show the actions on a user, the id of the user is the user id.
+	CallbackAdminUser CallbackAction = "adminUser"
+	// CallbackAdminRevokeUser is the action to revoke the access of a user.
+	CallbackAdminRevokeUser CallbackAction = "adminRevoke"
+	// CallbackAdminUnblacklistUser is the action to remove a user from the blacklist.
+	CallbackAdminUnblacklistUser CallbackAction = "adminUnblacklist"
+	// CallbackAdminResetQuota is the action to forget the additions of a user, giving it its whole quota again.
+	CallbackAdminResetQuota CallbackAction = "adminResetQuota"
+	// CallbackAdminSetRole is the action to change the role of a user, the index of the role is the arg.
+	CallbackAdminSetRole CallbackAction = "adminSetRole"
+	// CallbackAdminInvites is the action to list the invite codes.
+	CallbackAdminInvites CallbackAction = "adminInvites"
+	// CallbackAdminCreateInvite is the action to create an invite code, the index of its role is the arg.
+	CallbackAdminCreateInvite CallbackAction = "adminCreateInvite"
+	// CallbackAdminRevokeInvite is the action to revoke an invite code, the id of the code is the arg.
+	CallbackAdminRevokeInvite CallbackAction = "adminRevokeInvite"
+	// CallbackAdminChats is the action to list the autorized group chats.
+	CallbackAdminChats CallbackAction = "adminChats"
+	// CallbackAdminRevokeChat is the action to revoke the access of a group chat, the id of the chat is the arg.
+	CallbackAdminRevokeChat CallbackAction = "adminRevokeChat"
 )
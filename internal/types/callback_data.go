@@ -0,0 +1,156 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxCallbackDataLength is the maximum length of the callback data accepted by telegram.
+	MaxCallbackDataLength = 64
+	// CallbackDataMaxAge is the maximum age of a callback data. Telegram doesn't allow to edit messages older than 48h anyway.
+	CallbackDataMaxAge = 48 * time.Hour
+
+	// callbackDataSeparator is the separator between the fields of the callback data.
+	callbackDataSeparator = "|"
+	// callbackDataSignatureLength is the number of bytes of the HMAC kept in the callback data.
+	callbackDataSignatureLength = 6
+)
+
+var (
+	// ErrCallbackDataMalformed is returned when the callback data can't be decoded.
+	ErrCallbackDataMalformed = errors.New("malformed callback data")
+	// ErrCallbackDataTampered is returned when the signature of the callback data doesn't match its content.
+	ErrCallbackDataTampered = errors.New("callback data signature mismatch")
+	// ErrCallbackDataStale is returned when the callback data is older than CallbackDataMaxAge.
+	ErrCallbackDataStale = errors.New("callback data expired")
+	// ErrCallbackDataTooLong is returned when the encoded callback data is longer than MaxCallbackDataLength.
+	ErrCallbackDataTooLong = errors.New("callback data too long")
+)
+
+// CallbackData is the payload of an inline keyboard button.
+type CallbackData struct {
+	// Action is the action to do when the button is pressed.
+	Action CallbackAction
+	// MediaId is the id of the movie or serie the action is about (0 if none).
+	MediaId int64
+	// UserId is the id of the user the admin action is about (0 if none).
+	UserId int64
+	// Page is the page to show (0 if none).
+	Page int
+	// Instance is the index of the radarr or sonarr instance the action is about.
+	Instance int
+	// Arg is the other value the action is about (0 if none): the id of a quality profile, a root folder,
+	// a request, an invite or a chat, the number of a release or the index of a role.
+	Arg int64
+	// Nonce is the creation time of the payload (unix seconds).
+	// It makes each payload unique and allows to reject the stale ones.
+	Nonce int64
+}
+
+// CallbackCodec encodes and decodes the callback data.
+// The payloads are signed so the content of a button can't be forged.
+type CallbackCodec struct {
+	key []byte
+
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+// NewCallbackCodec creates a codec signing the payloads with a key derived from the secret.
+func NewCallbackCodec(secret string) *CallbackCodec {
+	key := sha256.Sum256([]byte("telarr-callback-data:" + secret))
+	return &CallbackCodec{
+		key: key[:],
+		now: time.Now,
+	}
+}
+
+// Encode returns the callback data to put in a button.
+// The nonce is set to the current time if it is not set.
+func (c *CallbackCodec) Encode(d CallbackData) (string, error) {
+	if d.Nonce == 0 {
+		d.Nonce = c.now().Unix()
+	}
+
+	payload := strings.Join([]string{
+		d.Action.String(),
+		strconv.FormatInt(d.MediaId, 36),
+		strconv.FormatInt(d.UserId, 36),
+		strconv.FormatInt(int64(d.Page), 36),
+		strconv.FormatInt(int64(d.Instance), 36),
+		strconv.FormatInt(d.Arg, 36),
+		strconv.FormatInt(d.Nonce, 36),
+	}, callbackDataSeparator)
+	data := payload + callbackDataSeparator + c.sign(payload)
+
+	if len(data) > MaxCallbackDataLength {
+		return "", ErrCallbackDataTooLong
+	}
+	return data, nil
+}
+
+// Decode returns the payload of the callback data, after checking its signature and its age.
+func (c *CallbackCodec) Decode(data string) (CallbackData, error) {
+	parts := strings.Split(data, callbackDataSeparator)
+	if len(parts) != 8 || parts[0] == "" {
+		return CallbackData{}, ErrCallbackDataMalformed
+	}
+
+	// check the signature before parsing the content
+	payload := data[:strings.LastIndex(data, callbackDataSeparator)]
+	if !hmac.Equal([]byte(parts[7]), []byte(c.sign(payload))) {
+		return CallbackData{}, ErrCallbackDataTampered
+	}
+
+	mediaId, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+	userId, err := strconv.ParseInt(parts[2], 36, 64)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+	page, err := strconv.ParseInt(parts[3], 36, 32)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+	instance, err := strconv.ParseInt(parts[4], 36, 32)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+	arg, err := strconv.ParseInt(parts[5], 36, 64)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+	nonce, err := strconv.ParseInt(parts[6], 36, 64)
+	if err != nil {
+		return CallbackData{}, errors.Join(ErrCallbackDataMalformed, err)
+	}
+
+	if c.now().Sub(time.Unix(nonce, 0)) > CallbackDataMaxAge {
+		return CallbackData{}, ErrCallbackDataStale
+	}
+
+	return CallbackData{
+		Action:   CallbackAction(parts[0]),
+		MediaId:  mediaId,
+		UserId:   userId,
+		Page:     int(page),
+		Instance: int(instance),
+		Arg:      arg,
+		Nonce:    nonce,
+	}, nil
+}
+
+// sign returns the truncated HMAC of the payload.
+func (c *CallbackCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackDataSignatureLength])
+}
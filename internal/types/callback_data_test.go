@@ -0,0 +1,153 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackCodec(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		data     CallbackData
+		alter    func(data string) string
+		decodeAt time.Time
+		wantErr  error
+	}{
+		{
+			name:     "ok",
+			data:     CallbackData{Action: CallbackConfirmRemoveMovie, MediaId: 1234567},
+			decodeAt: now,
+		},
+		{
+			name:     "ok with page",
+			data:     CallbackData{Action: CallbackNextMovie, Page: 42},
+			decodeAt: now.Add(time.Hour),
+		},
+		{
+			name:     "ok with instance",
+			data:     CallbackData{Action: CallbackConfirmRemoveMovie, MediaId: 12, Instance: 3},
+			decodeAt: now,
+		},
+		{
+			name:     "ok with user and arg",
+			data:     CallbackData{Action: CallbackAdminSetRole, UserId: 1<<52 - 1, Arg: 3},
+			decodeAt: now,
+		},
+		{
+			name:     "ok with media and arg",
+			data:     CallbackData{Action: CallbackSetQualityProfileFilm, MediaId: 1<<31 - 1, Instance: 35, Arg: 1<<31 - 1},
+			decodeAt: now,
+		},
+		{
+			name:     "longest action",
+			data:     CallbackData{Action: CallbackCancelFollowDownloadingStatusMovie, MediaId: 1<<31 - 1, Instance: 35},
+			decodeAt: now,
+		},
+		{
+			name: "tampered id",
+			data: CallbackData{Action: CallbackConfirmRemoveMovie, MediaId: 1},
+			alter: func(data string) string {
+				return strings.Replace(data, "|1|", "|2|", 1)
+			},
+			decodeAt: now,
+			wantErr:  ErrCallbackDataTampered,
+		},
+		{
+			name: "tampered instance",
+			data: CallbackData{Action: CallbackConfirmRemoveMovie, MediaId: 12, Instance: 1},
+			alter: func(data string) string {
+				return strings.Replace(data, "|c|0|0|1|", "|c|0|0|0|", 1)
+			},
+			decodeAt: now,
+			wantErr:  ErrCallbackDataTampered,
+		},
+		{
+			name: "tampered arg",
+			data: CallbackData{Action: CallbackAdminSetRole, UserId: 12, Arg: 1},
+			alter: func(data string) string {
+				return strings.Replace(data, "|0|0|1|", "|0|0|3|", 1)
+			},
+			decodeAt: now,
+			wantErr:  ErrCallbackDataTampered,
+		},
+		{
+			name: "tampered action",
+			data: CallbackData{Action: CallbackNextMovie, Page: 2},
+			alter: func(data string) string {
+				return strings.Replace(data, CallbackNextMovie.String(), CallbackLastMovie.String(), 1)
+			},
+			decodeAt: now,
+			wantErr:  ErrCallbackDataTampered,
+		},
+		{
+			name: "old format",
+			data: CallbackData{Action: CallbackNextMovie},
+			alter: func(data string) string {
+				return CallbackNextMovie.String()
+			},
+			decodeAt: now,
+			wantErr:  ErrCallbackDataMalformed,
+		},
+		{
+			name:     "stale",
+			data:     CallbackData{Action: CallbackNextMovie, Page: 2},
+			decodeAt: now.Add(CallbackDataMaxAge + time.Second),
+			wantErr:  ErrCallbackDataStale,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCallbackCodec("token")
+			c.now = func() time.Time { return now }
+
+			data, err := c.Encode(tt.data)
+			if err != nil {
+				t.Fatalf("CallbackCodec.Encode() error = %v", err)
+			}
+			if len(data) > MaxCallbackDataLength {
+				t.Fatalf("CallbackCodec.Encode() length = %d, want <= %d", len(data), MaxCallbackDataLength)
+			}
+			if tt.alter != nil {
+				data = tt.alter(data)
+			}
+
+			c.now = func() time.Time { return tt.decodeAt }
+			got, err := c.Decode(data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CallbackCodec.Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			want := tt.data
+			want.Nonce = now.Unix()
+			if got != want {
+				t.Errorf("CallbackCodec.Decode() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCallbackCodec_OtherSecret(t *testing.T) {
+	data, err := NewCallbackCodec("token").Encode(CallbackData{Action: CallbackNextMovie, Page: 2})
+	if err != nil {
+		t.Fatalf("CallbackCodec.Encode() error = %v", err)
+	}
+
+	_, err = NewCallbackCodec("other token").Decode(data)
+	if !errors.Is(err, ErrCallbackDataTampered) {
+		t.Errorf("CallbackCodec.Decode() error = %v, wantErr %v", err, ErrCallbackDataTampered)
+	}
+}
+
+func TestCallbackCodec_TooLong(t *testing.T) {
+	_, err := NewCallbackCodec("token").Encode(CallbackData{Action: CallbackAction(strings.Repeat("a", MaxCallbackDataLength))})
+	if !errors.Is(err, ErrCallbackDataTooLong) {
+		t.Errorf("CallbackCodec.Encode() error = %v, wantErr %v", err, ErrCallbackDataTooLong)
+	}
+}
@@ -58,7 +58,6 @@ func (d DownloadingStatus) PrintDownloadingStatus(refreshRateSec int64) string {
 	} else {
 		str += "_Not refreshing_\n"
 	}
-	str += "_movieId: " + strconv.Itoa(int(d.FilmId)) + "_"
 
 	return str
 }
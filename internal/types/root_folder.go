@@ -0,0 +1,17 @@
+package types
+
+import "fmt"
+
+type RootFolder struct {
+	// ID is the id of the root folder.
+	ID int64
+	// Path is the path of the root folder.
+	Path string
+	// FreeSpace is the free space of the disk of the root folder, in bytes.
+	FreeSpace int64
+}
+
+// PrintRootFolder returns the path of the root folder with its free space.
+func (r RootFolder) PrintRootFolder() string {
+	return r.Path + " (" + fmt.Sprintf("%.2F", float64(r.FreeSpace)/float64(GB)) + " GB free)"
+}
@@ -0,0 +1,208 @@
+package updates
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+func getAdminKeyboard(codec *types.CallbackCodec) telegram.InlineKeyboardMarkup {
+	return telegram.NewInlineKeyboardMarkup(
+		// wol button
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Wake on LAN the PC 🌐", types.CallbackData{Action: types.CallbackWakeOnLan})),
+		// users management
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "👥 Authorized users", types.CallbackData{Action: types.CallbackAdminAutorizedUsers})),
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "🚫 Blacklisted users", types.CallbackData{Action: types.CallbackAdminBlacklistedUsers})),
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "🎟 Invite codes", types.CallbackData{Action: types.CallbackAdminInvites})),
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "💬 Authorized groups", types.CallbackData{Action: types.CallbackAdminChats})),
+	)
+}
+
+// getAdminUsersKeyboard returns a button per user to show the actions on it, the admins are marked with a star.
+func getAdminUsersKeyboard(codec *types.CallbackCodec, users []authentication.User, admins []authentication.User) telegram.InlineKeyboardMarkup {
+	var rows [][]*telegram.InlineKeyboardButton
+	for _, user := range users {
+		text := printUser(user)
+		for _, admin := range admins {
+			if admin.Id == user.Id {
+				text = "⭐ " + text
+				break
+			}
+		}
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, text, types.CallbackData{Action: types.CallbackAdminUser, UserId: int64(user.Id)})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: types.CallbackAdminMenu})))
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+// getAdminUserKeyboard returns the actions available on the user: revoke and change its role if autorized, unblacklist otherwise.
+func getAdminUserKeyboard(codec *types.CallbackCodec, userId int, autorized bool, role authentication.Role) telegram.InlineKeyboardMarkup {
+	id := int64(userId)
+	var rows [][]*telegram.InlineKeyboardButton
+	back := types.CallbackAdminBlacklistedUsers
+	if autorized {
+		back = types.CallbackAdminAutorizedUsers
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "❌ Revoke access", types.CallbackData{Action: types.CallbackAdminRevokeUser, UserId: id})))
+
+		// a button per other role, the index of the role is sent as the arg
+		var roles []*telegram.InlineKeyboardButton
+		for i, r := range authentication.Roles {
+			if r == role {
+				continue
+			}
+			roles = append(roles, newCallbackButton(codec, printRole(r), types.CallbackData{Action: types.CallbackAdminSetRole, UserId: id, Arg: int64(i)}))
+		}
+		rows = append(rows, telegram.NewInlineKeyboardRow(roles...))
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "🔄 Reset quota", types.CallbackData{Action: types.CallbackAdminResetQuota, UserId: id})))
+	} else {
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "✅ Remove from blacklist", types.CallbackData{Action: types.CallbackAdminUnblacklistUser, UserId: id})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: back})))
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+// editAdminUsersList replaces the message with the autorized users, or the blacklisted ones.
+func editAdminUsersList(bot tgclient.Client, codec *types.CallbackCodec, auth *authentication.Auth, msg *telegram.Message, autorized bool) {
+	users := auth.GetBlacklist()
+	text := "🚫 *" + strconv.Itoa(len(users)) + " blacklisted users*"
+	if autorized {
+		users = auth.GetAutorized()
+		text = "👥 *" + strconv.Itoa(len(users)) + " authorized users*\n⭐ are the admins"
+	}
+	if len(users) > 0 {
+		text += "\n\nSelect a user:"
+	}
+
+	keyboard := getAdminUsersKeyboard(codec, users, auth.GetAdmins())
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// editAdminUser replaces the message with the user and the actions available on it.
+func editAdminUser(bot tgclient.Client, codec *types.CallbackCodec, auth *authentication.Auth, quotas *quotas, msg *telegram.Message, userId int) {
+	user, found := auth.GetUser(userId)
+	if !found {
+		editSimpleMessage(bot, msg.Chat.ID, msg.ID, "This user is not in the lists anymore.")
+		return
+	}
+
+	autorized := false
+	for _, u := range auth.GetAutorized() {
+		if u.Id == userId {
+			autorized = true
+			break
+		}
+	}
+	role, _ := auth.GetRole(userId)
+
+	text := "👤 *" + escapeMarkdown(printUser(user)) + "*\nId: " + strconv.Itoa(user.Id) + "\n"
+	if autorized {
+		text += "Status: authorized ✅\nRole: " + printRole(role) + "\n" + quotas.print(userId, role)
+	} else {
+		text += "Status: blacklisted 🚫"
+	}
+
+	keyboard := getAdminUserKeyboard(codec, userId, autorized, role)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// changeUser applies the admin action to the user and replaces the message with the result.
+func changeUser(bot tgclient.Client, codec *types.CallbackCodec, auth *authentication.Auth, auditor *auditor, rcvCallback *telegram.CallbackQuery, data types.CallbackData) {
+	action := data.Action
+	userId := int(data.UserId)
+	msg := rcvCallback.Message
+
+	// an admin can't lock himself out
+	if userId == rcvCallback.From.ID {
+		sendSimpleMessage(bot, msg.Chat.ID, "You can't change your own access.")
+		return
+	}
+
+	user, _ := auth.GetUser(userId)
+	name := escapeMarkdown(printUser(user))
+
+	var err error
+	var done string
+	entry := audit.Entry{Media: printUser(authentication.User{Id: userId, Username: user.Username})}
+	back := types.CallbackAdminAutorizedUsers
+	switch action {
+	case types.CallbackAdminRevokeUser:
+		err = auth.Revoke(userId)
+		done = "Access of *" + name + "* revoked ✅"
+		entry.Action = audit.ActionRevokeUser
+	case types.CallbackAdminUnblacklistUser:
+		err = auth.Unblacklist(userId)
+		done = "*" + name + "* removed from the blacklist ✅\nThe user can enter the password again."
+		entry.Action = audit.ActionUnblacklistUser
+		back = types.CallbackAdminBlacklistedUsers
+	case types.CallbackAdminSetRole:
+		if data.Arg < 0 || data.Arg >= int64(len(authentication.Roles)) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int64("role", data.Arg).Msg("unknown role")
+			sendSimpleMessage(bot, msg.Chat.ID, "This button is not valid anymore.\nPlease run the command again.")
+			return
+		}
+		role := authentication.Roles[data.Arg]
+		err = auth.SetRole(userId, role)
+		done = "*" + name + "* is now " + printRole(role) + " ✅"
+		entry.Action = audit.ActionSetRole
+		entry.Media += " as " + role.String()
+	}
+	auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, entry, err)
+	if errors.Is(err, authentication.ErrUserNotFound) {
+		editSimpleMessage(bot, msg.Chat.ID, msg.ID, "This user is not in the lists anymore.")
+		return
+	}
+	if err != nil {
+		log.Err(err).Str("username", rcvCallback.From.Username).Int("userId", userId).Str("action", action.String()).Msg("error when changing the user")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the users.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int("userId", userId).Str("action", action.String()).Msg("user changed by an admin")
+
+	keyboard := telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: back})))
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, done, &keyboard)
+}
+
+// resetQuota forgets the additions of the user, and replaces the message with the result.
+func resetQuota(bot tgclient.Client, codec *types.CallbackCodec, quotas *quotas, auditor *auditor, rcvCallback *telegram.CallbackQuery, userId int) {
+	msg := rcvCallback.Message
+
+	err := quotas.ledger.Reset(userId)
+	auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionResetQuota, Media: printUser(authentication.User{Id: userId})}, err)
+	if err != nil {
+		log.Err(err).Str("username", rcvCallback.From.Username).Int("userId", userId).Msg("error when resetting the quota")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the quotas.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int("userId", userId).Msg("quota reset by an admin")
+
+	keyboard := telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: types.CallbackAdminUser, UserId: int64(userId)})))
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, "Quota reset ✅\nThe user can add medias again.", &keyboard)
+}
+
+// printUser returns the username of the user, or its id if it has none.
+func printUser(user authentication.User) string {
+	if user.Username == "" {
+		return strconv.Itoa(user.Id)
+	}
+	return "@" + user.Username
+}
+
+// printRole returns the name of the role, with a star for the admins.
+func printRole(role authentication.Role) string {
+	if role == authentication.RoleAdmin {
+		return "admin ⭐"
+	}
+	return role.String()
+}
+
+// escapeMarkdown escapes the characters of the telegram markdown, for the texts written by the users.
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[").Replace(s)
+}
@@ -0,0 +1,182 @@
+package updates
+
+import (
+	"strconv"
+	"strings"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/session"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// auditPageSize is the number of entries in a page of the audit command.
+	auditPageSize = 10
+)
+
+// auditor records the actions of the users in the audit log, a failure to record is only logged.
+type auditor struct {
+	log *audit.Log
+}
+
+// record appends the entry done by the user, with the result of the error.
+func (a *auditor) record(user authentication.User, e audit.Entry, err error) {
+	e.UserId = user.Id
+	e.Username = user.Username
+	if e.Result == "" {
+		e.Result = audit.ResultOk
+	}
+	if err != nil {
+		e.Result = audit.ResultError
+		e.Error = err.Error()
+	}
+
+	recordErr := a.log.Record(e)
+	if recordErr != nil {
+		log.Err(recordErr).Int("userId", user.Id).Str("action", e.Action.String()).Msg("error when recording the action in the audit log")
+	}
+}
+
+// sendAudit sends the first page of the entries selected by the arguments of the command, and saves the filter for the next pages.
+func (a *auditor) sendAudit(bot tgclient.Client, codec *types.CallbackCodec, sessions session.Store, rcvMess *telegram.Message) {
+	if rcvMess.CommandArgument() == "help" {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, printAuditUsage())
+		return
+	}
+
+	filter, err := audit.ParseFilter(rcvMess.CommandArgument(), time.Now())
+	if err != nil {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, escapeMarkdown(err.Error())+"\n\n"+printAuditUsage())
+		return
+	}
+
+	text, keyboard, ok := a.printAuditPage(codec, filter, 1)
+	if !ok {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while reading the audit log.\nPlease contact the administrator.")
+		return
+	}
+	if sendMessageWithKeyboard(bot, rcvMess.Chat.ID, text, keyboard) > 0 {
+		s, _ := sessions.Get(rcvMess.From.ID)
+		s.AuditFilter = &filter
+		setUserSession(sessions, rcvMess.From.ID, s)
+	}
+}
+
+// editAuditPage replaces the message with the page of the entries selected by the filter saved in the session.
+func (a *auditor) editAuditPage(bot tgclient.Client, codec *types.CallbackCodec, sessions session.Store, rcvCallback *telegram.CallbackQuery, page int) {
+	msg := rcvCallback.Message
+
+	s, exist := sessions.Get(rcvCallback.From.ID)
+	if !exist || s.AuditFilter == nil {
+		editSimpleMessage(bot, msg.Chat.ID, msg.ID, "This search has expired.\nPlease run /audit again.")
+		return
+	}
+
+	text, keyboard, ok := a.printAuditPage(codec, *s.AuditFilter, page)
+	if !ok {
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while reading the audit log.\nPlease contact the administrator.")
+		return
+	}
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// printAuditPage returns the page of the entries selected by the filter, from the newest, with the buttons to the other pages.
+func (a *auditor) printAuditPage(codec *types.CallbackCodec, filter audit.Filter, page int) (string, telegram.InlineKeyboardMarkup, bool) {
+	entries, total, err := a.log.Query(filter, (page-1)*auditPageSize, auditPageSize)
+	if err != nil {
+		log.Err(err).Msg("error when reading the audit log")
+		return "", telegram.InlineKeyboardMarkup{}, false
+	}
+
+	totalPages := (total + auditPageSize - 1) / auditPageSize
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	text := "📜 *Audit log* (" + strconv.Itoa(total) + " entries)\n"
+	if total == 0 {
+		text += "\nNo action found."
+	}
+	for _, e := range entries {
+		text += "\n" + printAuditEntry(e)
+	}
+	text += "\n" + printPageNum(page, totalPages)
+
+	row := telegram.NewInlineKeyboardRow()
+	if page > 1 {
+		row = append(row, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackAuditPage, Page: page - 1}))
+	}
+	if page < totalPages {
+		row = append(row, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackAuditPage, Page: page + 1}))
+	}
+	keyboard := telegram.InlineKeyboardMarkup{}
+	if len(row) > 0 {
+		keyboard = telegram.NewInlineKeyboardMarkup(row)
+	}
+	return text, keyboard, true
+}
+
+// printAuditEntry returns the entry on one line, with the error on a second line if the action failed.
+func printAuditEntry(e audit.Entry) string {
+	var icon string
+	switch e.Result {
+	case audit.ResultOk:
+		icon = "✅"
+	case audit.ResultDenied:
+		icon = "🚫"
+	default:
+		icon = "❌"
+	}
+
+	str := icon + " `" + e.Time.Format("2006-01-02 15:04") + "` " + escapeMarkdown(printUser(authentication.User{Id: e.UserId, Username: e.Username})) + " *" + e.Action.String() + "*"
+	if e.Media != "" {
+		str += " " + escapeMarkdown(e.Media)
+	}
+	if len(e.MediaIds) > 0 {
+		ids := make([]string, len(e.MediaIds))
+		for i, id := range e.MediaIds {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		str += " (" + strings.Join(ids, ", ") + ")"
+	}
+	if e.Instance != "" {
+		str += " _" + escapeMarkdown(e.Instance) + "_"
+	}
+	if e.Error != "" {
+		str += "\n      " + escapeMarkdown(e.Error)
+	}
+	return str
+}
+
+// auditMediaIds returns the id of the media, none if the media was not added.
+func auditMediaIds(id int64) []int64 {
+	if id == 0 {
+		return nil
+	}
+	return []int64{id}
+}
+
+// printAuditMedia returns the title of the media for the audit log, without markdown.
+func printAuditMedia(title string, year int) string {
+	return title + " (" + strconv.Itoa(year) + ")"
+}
+
+// printAuditUsage returns the arguments of the audit command.
+func printAuditUsage() string {
+	return "Usage: `/audit [@username|user id] [action] [24h|7d|2006-01-02 [2006-01-02]]`\n" +
+		"Actions: " + escapeMarkdown(strings.Join(auditActionsNames(), ", "))
+}
+
+// auditActionsNames returns the names of the actions that can be filtered.
+func auditActionsNames() []string {
+	names := make([]string, len(audit.Actions))
+	for i, action := range audit.Actions {
+		names[i] = action.String()
+	}
+	return names
+}
@@ -2,14 +2,18 @@ package updates
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net"
 	"sort"
-	"strconv"
-	"strings"
-	"telarr/configuration"
+	"sync"
+	"sync/atomic"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
 	"telarr/internal/radarr"
+	"telarr/internal/request"
+	"telarr/internal/session"
 	"telarr/internal/sonarr"
+	"telarr/internal/tgclient"
 	"telarr/internal/types"
 	"time"
 
@@ -20,100 +24,108 @@ import (
 
 // callbacks is the struct designed to handle the callbacks.
 type callbacks struct {
-	// Bot is the telegram bot.
-	bot *telegram.Bot
-
-	radarrConfig configuration.Radarr
-	sonarrConfig configuration.Sonarr
-	wolConfig    configuration.WakeOnLan
-
-	// list of users actions
-	usersAction map[int]types.Action
-	// list of data to navigate between pages
-	usersData     map[int]interface{}
-	usersCurrPage map[int]int
+	// services are the instances managing the libraries and the reloadable settings.
+	services *atomic.Pointer[services]
+
+	// codec encodes and decodes the callback data of the keyboards.
+	codec *types.CallbackCodec
+
+	// sessions is the store of the users conversations (action and data to navigate between pages).
+	sessions session.Store
+	// auth manages the users lists, for the admins.
+	auth *authentication.Auth
+	// requests records the additions waiting for the approval of an admin.
+	requests *requests
+	// quotas counts the additions of the users.
+	quotas *quotas
+	// invites creates and revokes the invite codes, for the admins.
+	invites *invites
+	// auditor records the additions, the removals and the admin actions.
+	auditor *auditor
 	// list of users downloading status
-	usersDownloadingStatus map[int]types.DownloadingStatusMessage
+	usersDownloadingStatus   map[int]types.DownloadingStatusMessage
+	usersDownloadingStatusMu sync.Mutex
+
+	// wg to wait for the goroutines following the downloading status to finish.
+	wg *sync.WaitGroup
 }
 
-func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQuery) {
+// handle handles the callback, replying with the bot in the chat and the forum topic of the callback.
+func (cb *callbacks) handle(ctx context.Context, bot tgclient.Client, rcvCallback *telegram.CallbackQuery, role authentication.Role) {
 	if rcvCallback == nil {
 		return
 	}
 
 	log.Debug().Str("username", rcvCallback.From.Username).Str("callback", rcvCallback.Data).Msg("callback received")
 
-	var err error
+	// the services are read once, a reload doesn't change them in the middle of the callback
+	srv := cb.services.Load()
 
-	// if the callback is about the movies list
-	var films []radarr.Film
-	var series []sonarr.Serie
-	var messages []string
-	if strings.Contains(strings.ToLower(rcvCallback.Data), string(mediaTypeMovie)) {
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("getting movies list")
-		films, err = radarr.GetFilmsList(cb.radarrConfig)
-		if err != nil {
-			log.Err(err).Msg("error when getting movies messages")
-			editSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, "An error occurred while getting the movies list.\nPlease contact the administrator.")
-			return
-		}
-		messages = printMoviesList(films)
-	}
-	if strings.Contains(strings.ToLower(rcvCallback.Data), string(mediaTypeSerie)) {
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("getting series list")
-		series, err = sonarr.GetSeriesList(cb.sonarrConfig)
-		if err != nil {
-			log.Err(err).Msg("error when getting movies messages")
-			editSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, "An error occurred while getting the series list.\nPlease contact the administrator.")
-			return
+	// decode the callback data
+	data, err := cb.codec.Decode(rcvCallback.Data)
+	if err != nil {
+		log.Warn().Err(err).Str("username", rcvCallback.From.Username).Str("callback", rcvCallback.Data).Msg("invalid callback data")
+		if errors.Is(err, types.ErrCallbackDataStale) {
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This button has expired.\nPlease run the command again.")
+		} else {
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This button is not valid anymore.\nPlease run the command again.")
 		}
-		messages = printSeriesList(series)
+		return
 	}
 
-	callback := types.CallbackAction(rcvCallback.Data)
-	switch callback {
-	/* Movies */
-	// get the next page of the movies list
-	case types.CallbackNextMovie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing next page of movies list")
+	// the buttons can be pressed in a forwarded message, or after a change of role
+	if !callbackAllowed(role, data.Action) {
+		sendNotAllowed(bot, rcvCallback.Message.Chat.ID, rcvCallback.From.Username, role, data.Action.String())
+		return
+	}
 
-		// get the current page and the total number of pages
-		pageNb, totalPages, err := getMsgPageInfo(rcvCallback.Message.Text)
-		if err != nil {
-			log.Err(err).Msg("error when getting page status")
+	// get the instance the callback is about
+	var radarrService radarr.MovieService
+	var sonarrService sonarr.SeriesService
+	switch callbacksMediaType[data.Action] {
+	case mediaTypeMovie:
+		var ok bool
+		radarrService, ok = getInstance(srv.movies, data.Instance)
+		if !ok {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("instance", data.Instance).Msg("radarr instance not found")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This button is not valid anymore.\nPlease run the command again.")
 			return
 		}
+	case mediaTypeSerie:
+		var ok bool
+		sonarrService, ok = getInstance(srv.series, data.Instance)
+		if !ok {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("instance", data.Instance).Msg("sonarr instance not found")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This button is not valid anymore.\nPlease run the command again.")
+			return
+		}
+	}
 
-		keyboard := getMediaListKeyboard(pageNb+1, totalPages, mediaTypeMovie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb+1-1]+printPageNum(pageNb+1, len(messages)), &keyboard)
-	// get the previous page of the movies list
-	case types.CallbackPreviousMovie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing previous page of movies list")
+	switch data.Action {
+	/* Movies */
+	// get a page of the movies list (next, previous, first or last)
+	case types.CallbackNextMovie, types.CallbackPreviousMovie, types.CallbackFirstMovie, types.CallbackLastMovie:
+		log.Trace().Str("username", rcvCallback.From.Username).Int("page", data.Page).Msg("showing page of movies list")
 
-		// get the current page and the total number of pages
-		pageNb, totalPages, err := getMsgPageInfo(rcvCallback.Message.Text)
-		if err != nil {
-			log.Err(err).Msg("error when getting page status")
+		films, ok := getFilmsListOfCallback(bot, rcvCallback, radarrService)
+		if !ok {
 			return
 		}
+		messages := printMoviesList(films, getListInstanceName(srv.movies, data.Instance))
 
-		keyboard := getMediaListKeyboard(pageNb-1, totalPages, mediaTypeMovie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb-1-1]+printPageNum(pageNb-1, len(messages)), &keyboard)
-	// get the first page of the movies list
-	case types.CallbackFirstMovie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing first page of movies list")
-
-		keyboard := getMediaListKeyboard(1, len(messages), mediaTypeMovie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[0]+printPageNum(1, len(messages)), &keyboard)
-	// get the last page of the movies list
-	case types.CallbackLastMovie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing last page of movies list")
+		// the list may have changed since the keyboard was sent
+		pageNb := min(max(data.Page, 1), len(messages))
 
-		keyboard := getMediaListKeyboard(len(messages), len(messages), mediaTypeMovie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[len(messages)-1]+printPageNum(len(messages), len(messages)), &keyboard)
+		keyboard := getMediaListKeyboard(cb.codec, pageNb, len(messages), mediaTypeMovie, data.Instance)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb-1]+printPageNum(pageNb, len(messages)), &keyboard)
 	case types.CallbackMovieDetails:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing movie details")
 
+		films, ok := getFilmsListOfCallback(bot, rcvCallback, radarrService)
+		if !ok {
+			return
+		}
+
 		// show the movies list into a keyboard
 		var buttons [][]*telegram.KeyboardButton
 		sort.Slice(films, func(i, j int) bool {
@@ -131,22 +143,27 @@ func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQ
 			ResizeKeyboard:  true,
 			Keyboard:        buttons,
 		}
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the movie or write his name it", keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the movie or write his name it", keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionMovieDetails
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionMovieDetails, data.Instance)
 		}
 	case types.CallbackBackToMoviesList:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("back to movies list")
 
 		// remove the two last messages
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID-1)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID-1)
 
 		// show the movies list
-		sendMoviesList(cb.bot, rcvCallback.Message, cb.radarrConfig)
+		sendMoviesList(bot, cb.codec, rcvCallback.Message, srv.movies, data.Instance)
 	case types.CallbackRemoveMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("show movies list to remove")
 
+		films, ok := getFilmsListOfCallback(bot, rcvCallback, radarrService)
+		if !ok {
+			return
+		}
+
 		// show the movies list into a keyboard
 		var buttons [][]*telegram.KeyboardButton
 		sort.Slice(films, func(i, j int) bool {
@@ -164,267 +181,341 @@ func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQ
 			ResizeKeyboard:  true,
 			Keyboard:        buttons,
 		}
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the movie or write his name it", keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the movie or write his name it", keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionRemoveMovie
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionRemoveMovie, data.Instance)
 		}
 	case types.CallbackConfirmRemoveMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("confirm remove movie")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
-		// get the TMDb ID of the movie
-		movieIdStr, found := strings.CutPrefix(strings.Split(rcvCallback.Message.Text, "\n")[1], "MovieId: ") // get the second line and remove the "MovieId: " prefix
-		if !found {
-			log.Warn().Str("username", rcvCallback.From.Username).Msg("TMDb ID not found")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
-			return
-		}
-		movieId, err := strconv.Atoi(movieIdStr)
-		if err != nil {
-			log.Err(err).Msg("error when converting TMDb ID")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
-			return
-		}
+		movieId := int(data.MediaId)
 
 		// get the movie name
-		movieName, err := radarr.GetMovieName(cb.radarrConfig, movieId)
+		movieName, err := radarrService.GetMovieName(movieId)
 		if err != nil {
 			log.Err(err).Msg("error when getting movie name")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
 			return
 		}
 
 		// remove the movie
-		err = radarr.RemoveFilm(cb.radarrConfig, movieId)
+		err = radarrService.RemoveFilm(movieId)
+		cb.auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionRemoveMovie, MediaIds: []int64{data.MediaId}, Media: movieName, Instance: radarrService.Name()}, err)
 		if err != nil {
 			log.Err(err).Msg("error when removing movie")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the movie.\nPlease contact the administrator.")
 			return
 		}
 
 		log.Debug().Str("movieName", movieName).Str("username", rcvCallback.From.Username).Msg("movie removed successfully")
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Movie *"+movieName+"* removed successfully! ✅")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Movie *"+movieName+"* removed successfully! ✅")
 	case types.CallbackCancelRemoveMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("cancel remove movie")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Movie not removed! ✅")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Movie not removed! ✅")
 	case types.CallbackNextAddMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing next page of add media")
 
-		ok := checkUserAction(cb, rcvCallback.From, rcvCallback.Message)
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
 		if !ok {
 			return
 		}
 
-		cb.usersCurrPage[rcvCallback.From.ID]++
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		films := (cb.usersData[rcvCallback.From.ID].([]radarr.Film))
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Films) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		pageNb := userSession.CurrPage
+		films := userSession.Films
 		film := films[pageNb-1]
-		keyboard := getAddMediaKeyboard(pageNb, len(films), mediaTypeMovie, !film.IsInLibrary)
-		editImageMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, film.CoverImage, film.PrintMovieTitleAndInLibrary(), &keyboard)
+		keyboard := getAddMediaKeyboard(cb.codec, pageNb, len(films), mediaTypeMovie, userSession.Instance, !film.IsInLibrary)
+		editImageMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, film.CoverImage, film.PrintMovieTitleAndInLibrary(), &keyboard)
 	case types.CallbackPreviousAddMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing previous page of add media")
 
-		ok := checkUserAction(cb, rcvCallback.From, rcvCallback.Message)
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
 		if !ok {
 			return
 		}
 
-		cb.usersCurrPage[rcvCallback.From.ID]--
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		films := (cb.usersData[rcvCallback.From.ID].([]radarr.Film))
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Films) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		pageNb := userSession.CurrPage
+		films := userSession.Films
 		film := films[pageNb-1]
-		keyboard := getAddMediaKeyboard(pageNb, len(films), mediaTypeMovie, !film.IsInLibrary)
-		editImageMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, film.CoverImage, film.PrintMovieTitleAndInLibrary(), &keyboard)
+		keyboard := getAddMediaKeyboard(cb.codec, pageNb, len(films), mediaTypeMovie, userSession.Instance, !film.IsInLibrary)
+		editImageMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, film.CoverImage, film.PrintMovieTitleAndInLibrary(), &keyboard)
 	case types.CallbackEditRequestAddMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("edit request movie")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
-		cb.usersAction[rcvCallback.From.ID] = types.UserActionLookMovieToAdd
-		delete(cb.usersData, rcvCallback.From.ID)
-		delete(cb.usersCurrPage, rcvCallback.From.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		setUserSession(cb.sessions, rcvCallback.From.ID, session.Session{Action: types.UserActionLookMovieToAdd, Instance: data.Instance})
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Please enter the name of the movie you want to add:")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Please enter the name of the movie you want to add:")
 	case types.CallbackAddMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("add movie")
 
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		films := (cb.usersData[rcvCallback.From.ID].([]radarr.Film))
-		film := films[pageNb-1]
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok {
+			return
+		}
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Films) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		film := userSession.Films[userSession.CurrPage-1]
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
 		// show the quality profile list into a keyboard
-		profiles, err := radarr.GetQualityProfiles(cb.radarrConfig)
+		profiles, err := radarrService.GetQualityProfiles()
 		if err != nil {
 			log.Err(err).Msg("error when getting quality profiles")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the movie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the movie.\nPlease contact the administrator.")
 			return
 		}
 		keyboard := getQualityProfileKeyboard(profiles)
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the quality profile for the movie "+film.PrintMovieTitle(), keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the quality profile for the movie "+film.PrintMovieTitle(), keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionAddMovie
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionAddMovie, userSession.Instance)
+		}
+	case types.CallbackRootFolderAddMovie:
+		log.Trace().Str("username", rcvCallback.From.Username).Msg("select root folder of movie")
+
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok {
+			return
+		}
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Films) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		film := userSession.Films[userSession.CurrPage-1]
+
+		// the root folder may have been removed since the keyboard was sent
+		rootFolders, err := radarrService.GetRootFolders()
+		if err != nil {
+			log.Err(err).Msg("error when getting root folders")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the movie.\nPlease contact the administrator.")
+			return
+		}
+		rootFolderPath := ""
+		for _, folder := range rootFolders {
+			if folder.ID == data.Arg {
+				rootFolderPath = folder.Path
+				break
+			}
+		}
+		if rootFolderPath == "" {
+			log.Warn().Str("username", rcvCallback.From.Username).Int64("rootFolderId", data.Arg).Msg("root folder not found")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This root folder doesn't exist anymore.\nPlease select another one.")
+			return
+		}
+
+		// remove the last message
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+
+		if reason := cb.quotas.check(rcvCallback.From.ID, role, mediaTypeMovie, film.Size); reason != "" {
+			deleteUserSession(cb.sessions, rcvCallback.From.ID)
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, reason)
+			return
+		}
+		if !role.Allows(directAddRole) {
+			deleteUserSession(cb.sessions, rcvCallback.From.ID)
+			cb.requests.send(bot, rcvCallback.Message.Chat.ID, rcvCallback.From, request.Request{Instance: data.Instance, Film: &film, QualityProfileId: userSession.QualityProfileId, RootFolderPath: rootFolderPath})
+			return
+		}
+		if newFilm, added := addFilm(bot, cb.codec, cb.sessions, cb.auditor, rcvCallback.Message.Chat.ID, rcvCallback.From, radarrService, data.Instance, film, userSession.QualityProfileId, rootFolderPath); added {
+			cb.quotas.record(rcvCallback.From.ID, mediaTypeMovie, data.Instance, newFilm.MovieId, newFilm.Size)
 		}
 	case types.CallbackFollowDownloadingStatusMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("getting downloading status")
 
-		status, err := getDownloadingStatus(cb.bot, rcvCallback, cb.radarrConfig)
+		status, err := getDownloadingStatus(bot, rcvCallback, data.MediaId, radarrService)
 		if err != nil {
 			return
 		}
 
 		// send the downloading status
 		if !status.Found {
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue.\n If you just added it, please wait a minute.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue.\n If you just added it, please wait a minute.")
 			return
 		}
 
 		// remove the last message keyboard
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, rcvCallback.Message.Text, nil)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, rcvCallback.Message.Text, nil)
 
 		// send the downloading status
-		keyboard := getFollowDownloadingStatusKeyboard(false)
-		messId := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, status.PrintDownloadingStatus(5), keyboard)
+		keyboard := getFollowDownloadingStatusKeyboard(cb.codec, data.Instance, status.FilmId, false)
+		messId := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, status.PrintDownloadingStatus(5), keyboard)
 
 		// create the goroutine to update the downloading status every 5 seconds
 		ticker := time.NewTicker(5 * time.Second)
 		subCtx, cancel := context.WithCancel(ctx)
 		// if the user is already following a downloading status, we cancel the previous goroutine
-		if _, exist := cb.usersDownloadingStatus[rcvCallback.From.ID]; exist {
-			s, e := getDownloadingStatus(cb.bot, rcvCallback, cb.radarrConfig)
+		if ds, exist := cb.getUserDownloadingStatus(rcvCallback.From.ID); exist {
+			s, e := getDownloadingStatus(bot, rcvCallback, data.MediaId, radarrService)
 			if e == nil {
-				editSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, cb.usersDownloadingStatus[rcvCallback.From.ID].MessageId, s.PrintDownloadingStatus(-1))
+				editSimpleMessage(bot, rcvCallback.Message.Chat.ID, ds.MessageId, s.PrintDownloadingStatus(-1))
 			}
-			cb.usersDownloadingStatus[rcvCallback.From.ID].GoroutineContextCancel()
-			time.Sleep(10 * time.Millisecond)
+			ds.GoroutineContextCancel()
 		}
-		cb.usersDownloadingStatus[rcvCallback.From.ID] = types.DownloadingStatusMessage{
+		cb.setUserDownloadingStatus(rcvCallback.From.ID, types.DownloadingStatusMessage{
 			GoroutineContextCancel: cancel,
 			MessageId:              messId,
 			FilmId:                 status.FilmId,
 			Ticker:                 ticker,
-		}
+		})
+		cb.wg.Add(1)
 		go func() {
+			defer cb.wg.Done()
 			for {
 				select {
 				case <-subCtx.Done():
-					delete(cb.usersDownloadingStatus, rcvCallback.From.ID)
+					cb.deleteUserDownloadingStatus(rcvCallback.From.ID, messId)
 					ticker.Stop()
 					return
 				case <-ticker.C:
-					status, err = getDownloadingStatus(cb.bot, rcvCallback, cb.radarrConfig)
+					status, err := getDownloadingStatus(bot, rcvCallback, data.MediaId, radarrService)
 					if err != nil {
 						continue
 					}
 
 					if status.IsImported() {
-						cb.usersDownloadingStatus[rcvCallback.From.ID].GoroutineContextCancel()
+						cancel()
+						cb.deleteUserDownloadingStatus(rcvCallback.From.ID, messId)
+						ticker.Stop()
 						// remove the last message keyboard
-						editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, cb.usersDownloadingStatus[rcvCallback.From.ID].MessageId, rcvCallback.Message.Text, nil)
+						editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, messId, rcvCallback.Message.Text, nil)
 
-						sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "The movie is imported! ✅\n You can now watch it.")
+						str := "The movie is imported! ✅\n You can now watch it."
+						film, err := radarrService.GetFilm(int(data.MediaId))
+						if err != nil {
+							log.Err(err).Msg("error when getting the imported movie")
+						} else {
+							str = "The movie " + film.PrintMovieTitle() + " is imported! ✅\n You can now watch it.\n\n🔗 " + film.PrintLinks()
+						}
+						sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, str)
 
 						return
 					}
 
-					editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, cb.usersDownloadingStatus[rcvCallback.From.ID].MessageId, status.PrintDownloadingStatus(5), &keyboard)
+					editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, messId, status.PrintDownloadingStatus(5), &keyboard)
 				}
 			}
 		}()
 	case types.CallbackRefreshDownloadingStatusMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("refresh downloading status")
 
-		status, err := getDownloadingStatus(cb.bot, rcvCallback, cb.radarrConfig)
+		status, err := getDownloadingStatus(bot, rcvCallback, data.MediaId, radarrService)
 		if err != nil {
 			return
 		}
 
 		if !status.Found {
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue anymore.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue anymore.")
 			return
 		}
 
 		// if the user is already following the downloading status
 		refreshRate := 0
-		if cb.usersDownloadingStatus[rcvCallback.From.ID].FilmId == status.FilmId {
-			cb.usersDownloadingStatus[rcvCallback.From.ID].Ticker.Reset(5 * time.Second)
+		if ds, exist := cb.getUserDownloadingStatus(rcvCallback.From.ID); exist && ds.FilmId == status.FilmId {
+			ds.Ticker.Reset(5 * time.Second)
 			refreshRate = 5
 		}
-		keyboard := getFollowDownloadingStatusKeyboard(refreshRate == 0)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, status.PrintDownloadingStatus(int64(refreshRate)), &keyboard)
+		keyboard := getFollowDownloadingStatusKeyboard(cb.codec, data.Instance, status.FilmId, refreshRate == 0)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, status.PrintDownloadingStatus(int64(refreshRate)), &keyboard)
 	case types.CallbackCancelFollowDownloadingStatusMovie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("cancel follow downloading status")
 
-		status, err := getDownloadingStatus(cb.bot, rcvCallback, cb.radarrConfig)
+		status, err := getDownloadingStatus(bot, rcvCallback, data.MediaId, radarrService)
 		if err != nil {
 			return
 		}
 
 		if !status.Found {
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue anymore.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This movie is not in the queue anymore.")
 			return
 		}
 
 		// edit message with new keyboard
-		keyboard := getFollowDownloadingStatusKeyboard(true)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, status.PrintDownloadingStatus(0), &keyboard)
+		keyboard := getFollowDownloadingStatusKeyboard(cb.codec, data.Instance, status.FilmId, true)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, status.PrintDownloadingStatus(0), &keyboard)
 
 		// cancel the goroutine
-		if ds, exist := cb.usersDownloadingStatus[rcvCallback.From.ID]; exist {
+		if ds, exist := cb.getUserDownloadingStatus(rcvCallback.From.ID); exist {
 			ds.GoroutineContextCancel()
 		}
+	case types.CallbackFilmDetails, types.CallbackSearchFilm, types.CallbackRefreshFilm, types.CallbackToggleMonitoredFilm, types.CallbackSetQualityProfileFilm:
+		log.Trace().Str("username", rcvCallback.From.Username).Int64("movieId", data.MediaId).Str("action", data.Action.String()).Msg("movie action")
 
-		/* Series */
-	// get the next page of the series list
-	case types.CallbackNextSerie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing next page of series list")
+		filmAction(bot, cb.codec, cb.auditor, rcvCallback, radarrService, data)
+	case types.CallbackQualityProfilesFilm:
+		log.Trace().Str("username", rcvCallback.From.Username).Int64("movieId", data.MediaId).Msg("showing quality profiles of movie")
 
-		// get the current page and the total number of pages
-		pageNb, totalPages, err := getMsgPageInfo(rcvCallback.Message.Text)
-		if err != nil {
-			log.Err(err).Msg("error when getting page status")
+		editFilmQualityProfiles(bot, cb.codec, rcvCallback, radarrService, data)
+	case types.CallbackSearchReleases:
+		log.Trace().Str("username", rcvCallback.From.Username).Int64("movieId", data.MediaId).Msg("searching releases")
+
+		searchReleases(bot, cb.codec, cb.sessions, rcvCallback, radarrService, data)
+	case types.CallbackReleasesPage:
+		log.Trace().Str("username", rcvCallback.From.Username).Int("page", data.Page).Msg("showing page of releases")
+
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok || !checkReleases(bot, rcvCallback.From, rcvCallback.Message, userSession, data) {
 			return
 		}
+		editReleasesPage(bot, cb.codec, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, userSession.Releases, data.Instance, data.MediaId, data.Page)
+	case types.CallbackGrabRelease:
+		log.Trace().Str("username", rcvCallback.From.Username).Int64("release", data.Arg).Msg("grab release")
 
-		keyboard := getMediaListKeyboard(pageNb+1, totalPages, mediaTypeSerie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb+1-1]+printPageNum(pageNb+1, len(messages)), &keyboard)
-	// get the previous page of the series list
-	case types.CallbackPreviousSerie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing previous page of series list")
-
-		// get the current page and the total number of pages
-		pageNb, totalPages, err := getMsgPageInfo(rcvCallback.Message.Text)
-		if err != nil {
-			log.Err(err).Msg("error when getting page status")
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok || !checkReleases(bot, rcvCallback.From, rcvCallback.Message, userSession, data) {
 			return
 		}
+		grabRelease(bot, cb.codec, cb.sessions, cb.quotas, cb.auditor, rcvCallback, role, radarrService, userSession.Releases, data)
 
-		keyboard := getMediaListKeyboard(pageNb-1, totalPages, mediaTypeSerie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb-1-1]+printPageNum(pageNb-1, len(messages)), &keyboard)
-	// get the first page of the series list
-	case types.CallbackFirstSerie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing first page of series list")
+		/* Series */
+	// get a page of the series list (next, previous, first or last)
+	case types.CallbackNextSerie, types.CallbackPreviousSerie, types.CallbackFirstSerie, types.CallbackLastSerie:
+		log.Trace().Str("username", rcvCallback.From.Username).Int("page", data.Page).Msg("showing page of series list")
+
+		series, ok := getSeriesListOfCallback(bot, rcvCallback, sonarrService)
+		if !ok {
+			return
+		}
+		messages := printSeriesList(series, getListInstanceName(srv.series, data.Instance))
 
-		keyboard := getMediaListKeyboard(1, len(messages), mediaTypeSerie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[0]+printPageNum(1, len(messages)), &keyboard)
-	// get the last page of the series list
-	case types.CallbackLastSerie:
-		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing last page of series list")
+		// the list may have changed since the keyboard was sent
+		pageNb := min(max(data.Page, 1), len(messages))
 
-		keyboard := getMediaListKeyboard(len(messages), len(messages), mediaTypeSerie)
-		editMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[len(messages)-1]+printPageNum(len(messages), len(messages)), &keyboard)
+		keyboard := getMediaListKeyboard(cb.codec, pageNb, len(messages), mediaTypeSerie, data.Instance)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, messages[pageNb-1]+printPageNum(pageNb, len(messages)), &keyboard)
 	case types.CallbackSerieDetails:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing serie details")
 
+		series, ok := getSeriesListOfCallback(bot, rcvCallback, sonarrService)
+		if !ok {
+			return
+		}
+
 		// show the series list into a keyboard
 		var buttons [][]*telegram.KeyboardButton
 		sort.Slice(series, func(i, j int) bool {
@@ -442,22 +533,27 @@ func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQ
 			ResizeKeyboard:  true,
 			Keyboard:        buttons,
 		}
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the serie or write his name it", keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the serie or write his name it", keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionSerieDetails
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionSerieDetails, data.Instance)
 		}
 	case types.CallbackBackToSeriesList:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("back to series list")
 
 		// remove the two last messages
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID-1)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID-1)
 
 		// show the series list
-		sendSeriesList(cb.bot, rcvCallback.Message, cb.sonarrConfig)
+		sendSeriesList(bot, cb.codec, rcvCallback.Message, srv.series, data.Instance)
 	case types.CallbackRemoveSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("show series list to remove")
 
+		series, ok := getSeriesListOfCallback(bot, rcvCallback, sonarrService)
+		if !ok {
+			return
+		}
+
 		// show the series list into a keyboard
 		var buttons [][]*telegram.KeyboardButton
 		sort.Slice(series, func(i, j int) bool {
@@ -475,115 +571,169 @@ func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQ
 			ResizeKeyboard:  true,
 			Keyboard:        buttons,
 		}
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the serie or write his name it", keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the serie or write his name it", keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionRemoveSerie
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionRemoveSerie, data.Instance)
 		}
 	case types.CallbackConfirmRemoveSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("confirm remove serie")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
-		// get the serie ID
-		serieIdStr, found := strings.CutPrefix(strings.Split(rcvCallback.Message.Text, "\n")[1], "SerieId: ") // get the second line and remove the "SerieId: " prefix
-		if !found {
-			log.Warn().Str("username", rcvCallback.From.Username).Msg("serie ID not found")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
-			return
-		}
-		serieId, err := strconv.Atoi(serieIdStr)
-		if err != nil {
-			log.Err(err).Msg("error when converting serie ID")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
-			return
-		}
+		serieId := int(data.MediaId)
 
 		// get the serie name
-		serieName, err := sonarr.GetSerieName(cb.sonarrConfig, serieId)
+		serieName, err := sonarrService.GetSerieName(serieId)
 		if err != nil {
 			log.Err(err).Msg("error when getting serie name")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
 			return
 		}
 
 		// remove the serie
-		err = sonarr.RemoveSerie(cb.sonarrConfig, serieId)
+		err = sonarrService.RemoveSerie(serieId)
+		cb.auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionRemoveSerie, MediaIds: []int64{data.MediaId}, Media: serieName, Instance: sonarrService.Name()}, err)
 		if err != nil {
 			log.Err(err).Msg("error when removing serie")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while removing the serie.\nPlease contact the administrator.")
 			return
 		}
 
 		log.Debug().Str("serieName", serieName).Str("username", rcvCallback.From.Username).Msg("serie removed successfully")
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Serie *"+serieName+"* removed successfully! ✅")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Serie *"+serieName+"* removed successfully! ✅")
 	case types.CallbackCancelRemoveSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("cancel remove serie")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Serie not removed! ✅")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Serie not removed! ✅")
 	case types.CallbackNextAddSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing next page of add media")
 
-		ok := checkUserAction(cb, rcvCallback.From, rcvCallback.Message)
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
 		if !ok {
 			return
 		}
 
-		cb.usersCurrPage[rcvCallback.From.ID]++
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		series := (cb.usersData[rcvCallback.From.ID].([]sonarr.Serie))
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Series) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		pageNb := userSession.CurrPage
+		series := userSession.Series
 		serie := series[pageNb-1]
-		keyboard := getAddMediaKeyboard(pageNb, len(series), mediaTypeSerie, !serie.IsInLibrary)
-		editImageMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, serie.CoverImage, serie.PrintSerieTitleAndInLibrary(), &keyboard)
+		keyboard := getAddMediaKeyboard(cb.codec, pageNb, len(series), mediaTypeSerie, userSession.Instance, !serie.IsInLibrary)
+		editImageMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, serie.CoverImage, serie.PrintSerieTitleAndInLibrary(), &keyboard)
 	case types.CallbackPreviousAddSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("showing previous page of add media")
 
-		ok := checkUserAction(cb, rcvCallback.From, rcvCallback.Message)
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
 		if !ok {
 			return
 		}
 
-		cb.usersCurrPage[rcvCallback.From.ID]--
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		series := (cb.usersData[rcvCallback.From.ID].([]sonarr.Serie))
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Series) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		pageNb := userSession.CurrPage
+		series := userSession.Series
 		serie := series[pageNb-1]
-		keyboard := getAddMediaKeyboard(pageNb, len(series), mediaTypeSerie, !serie.IsInLibrary)
-		editImageMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, serie.CoverImage, serie.PrintSerieTitleAndInLibrary(), &keyboard)
+		keyboard := getAddMediaKeyboard(cb.codec, pageNb, len(series), mediaTypeSerie, userSession.Instance, !serie.IsInLibrary)
+		editImageMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, serie.CoverImage, serie.PrintSerieTitleAndInLibrary(), &keyboard)
 	case types.CallbackEditRequestAddSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("edit request series")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
-		cb.usersAction[rcvCallback.From.ID] = types.UserActionLookSerieToAdd
-		delete(cb.usersData, rcvCallback.From.ID)
-		delete(cb.usersCurrPage, rcvCallback.From.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		setUserSession(cb.sessions, rcvCallback.From.ID, session.Session{Action: types.UserActionLookSerieToAdd, Instance: data.Instance})
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Please enter the name of the serie you want to add:")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Please enter the name of the serie you want to add:")
 	case types.CallbackAddSerie:
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("add serie")
 
-		pageNb := cb.usersCurrPage[rcvCallback.From.ID]
-		series := (cb.usersData[rcvCallback.From.ID].([]sonarr.Serie))
-		serie := series[pageNb-1]
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok {
+			return
+		}
+		userSession.CurrPage = data.Page
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Series) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		setUserSession(cb.sessions, rcvCallback.From.ID, userSession)
+		serie := userSession.Series[userSession.CurrPage-1]
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
 		// show the quality profile list into a keyboard
-		profiles, err := sonarr.GetQualityProfiles(cb.sonarrConfig)
+		profiles, err := sonarrService.GetQualityProfiles()
 		if err != nil {
 			log.Err(err).Msg("error when getting quality profiles")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the serie.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the serie.\nPlease contact the administrator.")
 			return
 		}
 		keyboard := getQualityProfileKeyboard(profiles)
-		sent := sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Select the quality profile for the serie "+serie.PrintSerieTitle(), keyboard) > 0
+		sent := sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Select the quality profile for the serie "+serie.PrintSerieTitle(), keyboard) > 0
 		if sent {
-			cb.usersAction[rcvCallback.From.ID] = types.UserActionAddSerie
+			setUserAction(cb.sessions, rcvCallback.From.ID, types.UserActionAddSerie, userSession.Instance)
+		}
+	case types.CallbackRootFolderAddSerie:
+		log.Trace().Str("username", rcvCallback.From.Username).Msg("select root folder of serie")
+
+		userSession, ok := checkUserAction(cb, bot, rcvCallback.From, rcvCallback.Message)
+		if !ok {
+			return
+		}
+		if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Series) {
+			log.Warn().Str("username", rcvCallback.From.Username).Int("page", userSession.CurrPage).Msg("page out of range")
+			return
+		}
+		serie := userSession.Series[userSession.CurrPage-1]
+
+		// the root folder may have been removed since the keyboard was sent
+		rootFolders, err := sonarrService.GetRootFolders()
+		if err != nil {
+			log.Err(err).Msg("error when getting root folders")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while adding the serie.\nPlease contact the administrator.")
+			return
+		}
+		rootFolderPath := ""
+		for _, folder := range rootFolders {
+			if folder.ID == data.Arg {
+				rootFolderPath = folder.Path
+				break
+			}
+		}
+		if rootFolderPath == "" {
+			log.Warn().Str("username", rcvCallback.From.Username).Int64("rootFolderId", data.Arg).Msg("root folder not found")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "This root folder doesn't exist anymore.\nPlease select another one.")
+			return
+		}
+
+		// remove the last message
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+
+		if reason := cb.quotas.check(rcvCallback.From.ID, role, mediaTypeSerie, serie.Size); reason != "" {
+			deleteUserSession(cb.sessions, rcvCallback.From.ID)
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, reason)
+			return
+		}
+		if !role.Allows(directAddRole) {
+			deleteUserSession(cb.sessions, rcvCallback.From.ID)
+			cb.requests.send(bot, rcvCallback.Message.Chat.ID, rcvCallback.From, request.Request{Instance: data.Instance, Serie: &serie, QualityProfileId: userSession.QualityProfileId, RootFolderPath: rootFolderPath})
+			return
+		}
+		if newSerie, added := addSerie(bot, cb.sessions, cb.auditor, rcvCallback.Message.Chat.ID, rcvCallback.From, sonarrService, serie, userSession.QualityProfileId, rootFolderPath); added {
+			cb.quotas.record(rcvCallback.From.ID, mediaTypeSerie, data.Instance, newSerie.SerieId, newSerie.Size)
 		}
 
 	/* Common */
@@ -591,77 +741,125 @@ func (cb *callbacks) handle(ctx context.Context, rcvCallback *telegram.CallbackQ
 		log.Trace().Str("username", rcvCallback.From.Username).Msg("canceling action")
 
 		// remove the last message
-		cb.bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
+		bot.DeleteMessage(rcvCallback.Message.Chat.ID, rcvCallback.Message.ID)
 
-		sendMessageWithKeyboard(cb.bot, rcvCallback.Message.Chat.ID, "Action canceled ✅", telegram.NewReplyKeyboardRemove(false))
+		sendMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, "Action canceled ✅", telegram.NewReplyKeyboardRemove(false))
 	case types.CallbackWakeOnLan:
-		log.Trace().Str("username", rcvCallback.From.Username).Str("mac", cb.wolConfig.MacAddress).Msg("sending Wake-on-LAN")
+		log.Trace().Str("username", rcvCallback.From.Username).Str("mac", srv.wolConfig.MacAddress).Msg("sending Wake-on-LAN")
 
 		// send the Wake-on-LAN
 		c, err := wol.NewClient()
 		if err != nil {
 			log.Err(err).Msg("error when creating Wake-on-LAN client")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while sending the Wake-on-LAN.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while sending the Wake-on-LAN.\nPlease contact the administrator.")
 			return
 		}
 		defer c.Close()
 
-		target, err := net.ParseMAC(cb.wolConfig.MacAddress)
+		target, err := net.ParseMAC(srv.wolConfig.MacAddress)
 		if err != nil {
 			log.Err(err).Msg("error when parsing MAC address")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while parsing the MAC address.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while parsing the MAC address.\nPlease contact the administrator.")
 			return
 		}
 		var password []byte
-		if cb.wolConfig.Password != "" {
-			password = []byte(cb.wolConfig.Password)
+		if srv.wolConfig.Password != "" {
+			password = []byte(srv.wolConfig.Password)
 		}
 
-		err = c.WakePassword(cb.wolConfig.IP, target, password)
+		err = c.WakePassword(srv.wolConfig.IP, target, password)
+		cb.auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionWakeOnLan, Media: srv.wolConfig.MacAddress}, err)
 		if err != nil {
 			log.Err(err).Msg("error when sending Wake-on-LAN")
-			sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "An error occurred while sending the Wake-on-LAN.\nPlease contact the administrator.")
+			sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while sending the Wake-on-LAN.\nPlease contact the administrator.")
 			return
 		}
 
-		sendSimpleMessage(cb.bot, rcvCallback.Message.Chat.ID, "Wake-on-LAN sent successfully! ✅")
+		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "Wake-on-LAN sent successfully! ✅")
+
+	/* Requests */
+	case types.CallbackApproveRequest, types.CallbackRejectRequest:
+		cb.requests.handle(bot, rcvCallback, data)
+
+	/* Admin */
+	case types.CallbackAdminMenu:
+		keyboard := getAdminKeyboard(cb.codec)
+		editMessageWithKeyboard(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, "Select an action:", &keyboard)
+	case types.CallbackAdminAutorizedUsers:
+		editAdminUsersList(bot, cb.codec, cb.auth, rcvCallback.Message, true)
+	case types.CallbackAdminBlacklistedUsers:
+		editAdminUsersList(bot, cb.codec, cb.auth, rcvCallback.Message, false)
+	case types.CallbackAdminUser:
+		editAdminUser(bot, cb.codec, cb.auth, cb.quotas, rcvCallback.Message, int(data.UserId))
+	case types.CallbackAdminResetQuota:
+		resetQuota(bot, cb.codec, cb.quotas, cb.auditor, rcvCallback, int(data.UserId))
+	case types.CallbackAdminRevokeUser, types.CallbackAdminUnblacklistUser, types.CallbackAdminSetRole:
+		changeUser(bot, cb.codec, cb.auth, cb.auditor, rcvCallback, data)
+	case types.CallbackAdminInvites:
+		cb.invites.editList(bot, rcvCallback.Message)
+	case types.CallbackAdminCreateInvite:
+		cb.invites.create(bot, rcvCallback, int(data.Arg))
+	case types.CallbackAdminRevokeInvite:
+		cb.invites.revoke(bot, rcvCallback, data.Arg)
+	case types.CallbackAdminChats:
+		editAdminChats(bot, cb.codec, cb.auth, rcvCallback.Message)
+	case types.CallbackAdminRevokeChat:
+		revokeChatFromList(bot, cb.codec, cb.auth, cb.auditor, rcvCallback, data.Arg)
+
+	/* Audit */
+	case types.CallbackAuditPage:
+		cb.auditor.editAuditPage(bot, cb.codec, cb.sessions, rcvCallback, data.Page)
 
 	default:
 		log.Warn().Str("username", rcvCallback.From.Username).Str("callback", rcvCallback.Data).Msg("unknown callback")
 	}
 }
 
-// checkUserAction checks if the user has an action in progress.
-// Return true if the user has an action in progress, false otherwise.
-func checkUserAction(cb *callbacks, user *telegram.User, currentMsg *telegram.Message) bool {
-	if cb.usersData[user.ID] == nil {
-		log.Warn().Str("username", user.Username).Msg("no data found")
-		cb.bot.DeleteMessage(currentMsg.Chat.ID, currentMsg.ID)
-		sendSimpleMessage(cb.bot, currentMsg.Chat.ID, "Request timed out.\nPlease try again.")
-		return false
-	}
+// getUserDownloadingStatus returns the downloading status followed by the user.
+func (cb *callbacks) getUserDownloadingStatus(userId int) (types.DownloadingStatusMessage, bool) {
+	cb.usersDownloadingStatusMu.Lock()
+	defer cb.usersDownloadingStatusMu.Unlock()
 
-	return true
+	ds, exist := cb.usersDownloadingStatus[userId]
+	return ds, exist
 }
 
-func getDownloadingStatus(bot *telegram.Bot, rcvCallback *telegram.CallbackQuery, radarrConfig configuration.Radarr) (types.DownloadingStatus, error) {
-	// get the film id from the message
-	msgParts := strings.Split(rcvCallback.Message.Text, "\n")
-	filmIdStr, found := strings.CutPrefix(msgParts[len(msgParts)-1], "movieId: ") // get the second line and remove the "MovieId: " prefix
-	if !found {
-		log.Warn().Str("username", rcvCallback.From.Username).Msg("film ID not found")
-		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while getting the downloading status.\nPlease contact the administrator.")
-		return types.DownloadingStatus{}, fmt.Errorf("film ID not found in %v", rcvCallback.Message.Text)
+// setUserDownloadingStatus sets the downloading status followed by the user.
+func (cb *callbacks) setUserDownloadingStatus(userId int, ds types.DownloadingStatusMessage) {
+	cb.usersDownloadingStatusMu.Lock()
+	defer cb.usersDownloadingStatusMu.Unlock()
+
+	cb.usersDownloadingStatus[userId] = ds
+}
+
+// deleteUserDownloadingStatus removes the downloading status followed by the user,
+// only if it is still the one displayed in the message, as the user may follow another one since.
+func (cb *callbacks) deleteUserDownloadingStatus(userId int, messageId int) {
+	cb.usersDownloadingStatusMu.Lock()
+	defer cb.usersDownloadingStatusMu.Unlock()
+
+	if ds, exist := cb.usersDownloadingStatus[userId]; exist && ds.MessageId == messageId {
+		delete(cb.usersDownloadingStatus, userId)
 	}
-	filmId, err := strconv.Atoi(filmIdStr)
-	if err != nil {
-		log.Err(err).Str("filmIdStr", filmIdStr).Msg("error when converting film ID")
-		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while getting the downloading status.\nPlease contact the administrator.")
-		return types.DownloadingStatus{}, err
+}
+
+// checkUserAction checks if the user has an action in progress.
+// Return the session and true if the user has an action in progress, false otherwise.
+func checkUserAction(cb *callbacks, bot tgclient.Client, user *telegram.User, currentMsg *telegram.Message) (session.Session, bool) {
+	userSession, exist := cb.sessions.Get(user.ID)
+	if !exist || !userSession.HasData() {
+		log.Warn().Str("username", user.Username).Msg("no data found")
+		bot.DeleteMessage(currentMsg.Chat.ID, currentMsg.ID)
+		sendSimpleMessage(bot, currentMsg.Chat.ID, "Request timed out.\nPlease try again.")
+		return session.Session{}, false
 	}
 
+	return userSession, true
+}
+
+func getDownloadingStatus(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, filmId int64, movies radarr.MovieService) (types.DownloadingStatus, error) {
 	// get the downloading status
-	status, err := radarr.GetDownloadingStatus(radarrConfig, filmId)
+	status, err := movies.GetDownloadingStatus(int(filmId))
 	if err != nil {
 		log.Err(err).Msg("error when getting downloading status")
 		sendSimpleMessage(bot, rcvCallback.Message.Chat.ID, "An error occurred while getting the downloading status.\nPlease contact the administrator.")
@@ -670,3 +868,29 @@ func getDownloadingStatus(bot *telegram.Bot, rcvCallback *telegram.CallbackQuery
 
 	return status, nil
 }
+
+// getFilmsListOfCallback returns the movies of the library of the instance,
+// false after replacing the message of the callback with an error if they can't be read.
+func getFilmsListOfCallback(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, radarrService radarr.MovieService) ([]radarr.Film, bool) {
+	log.Trace().Str("username", rcvCallback.From.Username).Str("instance", radarrService.Name()).Msg("getting movies list")
+	films, err := radarrService.GetFilmsList()
+	if err != nil {
+		log.Err(err).Msg("error when getting movies list")
+		editSimpleMessage(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, "An error occurred while getting the movies list.\nPlease contact the administrator.")
+		return nil, false
+	}
+	return films, true
+}
+
+// getSeriesListOfCallback returns the series of the library of the instance,
+// false after replacing the message of the callback with an error if they can't be read.
+func getSeriesListOfCallback(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, sonarrService sonarr.SeriesService) ([]sonarr.Serie, bool) {
+	log.Trace().Str("username", rcvCallback.From.Username).Str("instance", sonarrService.Name()).Msg("getting series list")
+	series, err := sonarrService.GetSeriesList()
+	if err != nil {
+		log.Err(err).Msg("error when getting series list")
+		editSimpleMessage(bot, rcvCallback.Message.Chat.ID, rcvCallback.Message.ID, "An error occurred while getting the series list.\nPlease contact the administrator.")
+		return nil, false
+	}
+	return series, true
+}
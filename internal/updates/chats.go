@@ -0,0 +1,170 @@
+package updates
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/session"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+	"unicode/utf16"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// defaultChatRole is the role of the members of a group chat autorized without a role.
+	defaultChatRole = authentication.RoleViewer
+)
+
+// addressedToBot checks if the message of a group chat is for the bot: a command without the username of another bot,
+// a mention or a reply to one of its messages, or the answer of a user with an action in progress.
+// The mention of the bot is removed from the text.
+func addressedToBot(sessions session.Store, botUsername string, m *telegram.Message) bool {
+	if m.IsCommand() {
+		// the commands of the other bots of the group are ignored
+		_, to, found := strings.Cut(m.RawCommand(), "@")
+		return !found || strings.EqualFold(to, botUsername)
+	}
+	if removeMention(m, botUsername) {
+		return true
+	}
+	if m.ReplyToMessage != nil && m.ReplyToMessage.From != nil && botUsername != "" && strings.EqualFold(m.ReplyToMessage.From.Username, botUsername) {
+		return true
+	}
+	s, exist := sessions.Get(m.From.ID)
+	return exist && s.Action != ""
+}
+
+// removeMention removes the mention of the bot from the text of the message, and returns true if there was one.
+// The entities are removed too, as their offsets don't match the text anymore.
+func removeMention(m *telegram.Message, botUsername string) bool {
+	if botUsername == "" {
+		return false
+	}
+
+	// the offsets of the entities are in UTF-16 code units
+	text := utf16.Encode([]rune(m.Text))
+	for _, e := range m.Entities {
+		if !e.IsMention() || e.Offset < 0 || e.Offset+e.Length > len(text) {
+			continue
+		}
+		if !strings.EqualFold(string(utf16.Decode(text[e.Offset:e.Offset+e.Length])), "@"+botUsername) {
+			continue
+		}
+		m.Text = strings.TrimSpace(string(utf16.Decode(text[:e.Offset])) + string(utf16.Decode(text[e.Offset+e.Length:])))
+		m.Entities = nil
+		return true
+	}
+	return false
+}
+
+// allowChat autorizes the members of the group chat of the message with the role given in argument, viewer if none.
+func allowChat(bot tgclient.Client, auth *authentication.Auth, auditor *auditor, rcvMess *telegram.Message) {
+	if rcvMess.Chat.IsPrivate() {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "Send this command in the group to authorize.")
+		return
+	}
+
+	role := defaultChatRole
+	if rcvMess.HasCommandArgument() {
+		var err error
+		role, err = authentication.ParseRole(strings.ToLower(rcvMess.CommandArgument()))
+		if err != nil || role == authentication.RoleAdmin {
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "Usage: `/allowchat [viewer|requester|manager]`\nThe admin role can't be given to a whole group.")
+			return
+		}
+	}
+
+	chat := authentication.Chat{Id: rcvMess.Chat.ID, Title: rcvMess.Chat.Title, Role: role}
+	err := auth.AutorizeChat(chat)
+	auditor.record(authentication.User{Id: rcvMess.From.ID, Username: rcvMess.From.Username}, audit.Entry{Action: audit.ActionAllowChat, ChatId: chat.Id, Media: printChat(chat) + " as " + role.String()}, err)
+	if err != nil {
+		log.Err(err).Str("username", rcvMess.From.Username).Int64("chatId", rcvMess.Chat.ID).Msg("error when authorizing the chat")
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while saving the chats.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvMess.From.Username).Int64("chatId", rcvMess.Chat.ID).Str("role", role.String()).Msg("chat authorized")
+
+	sendSimpleMessage(bot, rcvMess.Chat.ID, "This group is now authorized ✅\nIts members are "+printRole(role)+", use /help to see the commands list.")
+}
+
+// revokeChat removes the group chat of the message from the autorized chats.
+func revokeChat(bot tgclient.Client, auth *authentication.Auth, auditor *auditor, rcvMess *telegram.Message) {
+	if rcvMess.Chat.IsPrivate() {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "Send this command in the group to revoke.")
+		return
+	}
+
+	err := auth.RevokeChat(rcvMess.Chat.ID)
+	if errors.Is(err, authentication.ErrChatNotFound) {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "This group is not authorized.")
+		return
+	}
+	chat := authentication.Chat{Id: rcvMess.Chat.ID, Title: rcvMess.Chat.Title}
+	auditor.record(authentication.User{Id: rcvMess.From.ID, Username: rcvMess.From.Username}, audit.Entry{Action: audit.ActionRevokeChat, ChatId: chat.Id, Media: printChat(chat)}, err)
+	if err != nil {
+		log.Err(err).Str("username", rcvMess.From.Username).Int64("chatId", rcvMess.Chat.ID).Msg("error when revoking the chat")
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while saving the chats.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvMess.From.Username).Int64("chatId", rcvMess.Chat.ID).Msg("chat revoked")
+
+	sendSimpleMessage(bot, rcvMess.Chat.ID, "Access of this group revoked ✅\nIts members need their own access to use the bot.")
+}
+
+// editAdminChats replaces the message with the autorized group chats, with a button to revoke each.
+func editAdminChats(bot tgclient.Client, codec *types.CallbackCodec, auth *authentication.Auth, msg *telegram.Message) {
+	chats := auth.GetChats()
+	text := "💬 *" + strconv.Itoa(len(chats)) + " authorized groups*"
+	for _, chat := range chats {
+		text += "\n\t" + escapeMarkdown(printChat(chat)) + " " + printRole(auth.ChatRole(chat))
+	}
+	text += "\n\nSend /allowchat in a group to authorize its members."
+
+	var rows [][]*telegram.InlineKeyboardButton
+	for _, chat := range chats {
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "❌ Revoke "+printChat(chat), types.CallbackData{Action: types.CallbackAdminRevokeChat, Arg: chat.Id})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: types.CallbackAdminMenu})))
+	keyboard := telegram.NewInlineKeyboardMarkup(rows...)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// revokeChatFromList removes the group chat from the autorized chats, and shows the chats again.
+func revokeChatFromList(bot tgclient.Client, codec *types.CallbackCodec, auth *authentication.Auth, auditor *auditor, rcvCallback *telegram.CallbackQuery, chatId int64) {
+	msg := rcvCallback.Message
+
+	chat := authentication.Chat{Id: chatId}
+	for _, c := range auth.GetChats() {
+		if c.Id == chatId {
+			chat = c
+			break
+		}
+	}
+	err := auth.RevokeChat(chatId)
+	if errors.Is(err, authentication.ErrChatNotFound) {
+		editAdminChats(bot, codec, auth, msg)
+		return
+	}
+	auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionRevokeChat, ChatId: chat.Id, Media: printChat(chat)}, err)
+	if err != nil {
+		log.Err(err).Str("username", rcvCallback.From.Username).Int64("chatId", chatId).Msg("error when revoking the chat")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the chats.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int64("chatId", chatId).Msg("chat revoked")
+
+	editAdminChats(bot, codec, auth, msg)
+}
+
+// printChat returns the title of the group chat, or its id if it has none.
+func printChat(chat authentication.Chat) string {
+	if chat.Title == "" {
+		return strconv.FormatInt(chat.Id, 10)
+	}
+	return chat.Title
+}
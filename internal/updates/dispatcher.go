@@ -0,0 +1,98 @@
+package updates
+
+import (
+	"context"
+	"sync"
+	"telarr/internal/tgclient"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxQueuedUpdates is the maximum number of updates waiting for the worker of a user,
+	// the next ones are dropped so that a user flooding the bot can't fill the memory.
+	maxQueuedUpdates = 20
+)
+
+// dispatcher dispatches the updates to one worker per user.
+// The updates of a user are handled one after the other, in the order they were received,
+// while the updates of different users are handled concurrently.
+type dispatcher struct {
+	// handle is the function called for each update.
+	handle func(ctx context.Context, upd *tgclient.Update)
+
+	// wg to wait for the workers to finish.
+	wg *sync.WaitGroup
+
+	// queues is the list of updates waiting to be handled, for each user with a running worker.
+	queues map[int][]*tgclient.Update
+	// dropped is the number of updates dropped, because the queue of the user was full or the bot stopped.
+	dropped  int
+	queuesMu sync.Mutex
+}
+
+func newDispatcher(wg *sync.WaitGroup, handle func(ctx context.Context, upd *tgclient.Update)) *dispatcher {
+	return &dispatcher{
+		handle: handle,
+		wg:     wg,
+		queues: make(map[int][]*tgclient.Update),
+	}
+}
+
+// dispatch queues the update of the user, and starts the worker of the user if it is not running.
+// The update is dropped if the queue of the user is full.
+func (d *dispatcher) dispatch(ctx context.Context, userId int, upd *tgclient.Update) {
+	d.queuesMu.Lock()
+	defer d.queuesMu.Unlock()
+
+	// a worker is already running for this user
+	if queue, running := d.queues[userId]; running {
+		if len(queue) >= maxQueuedUpdates {
+			log.Warn().Int("userId", userId).Int("updateId", upd.UpdateID).Msg("too many updates waiting for the user, update dropped")
+			d.dropped++
+			return
+		}
+		d.queues[userId] = append(queue, upd)
+		return
+	}
+
+	d.queues[userId] = []*tgclient.Update{}
+	d.wg.Add(1)
+	go d.work(ctx, userId, upd)
+}
+
+// work handles the updates of the user until its queue is empty.
+// Once the context is done, the updates still waiting are dropped, they can't be handled with a canceled context.
+func (d *dispatcher) work(ctx context.Context, userId int, upd *tgclient.Update) {
+	defer d.wg.Done()
+
+	for {
+		d.handle(ctx, upd)
+
+		d.queuesMu.Lock()
+		queue := d.queues[userId]
+		if len(queue) > 0 && ctx.Err() != nil {
+			log.Warn().Int("userId", userId).Int("dropped", len(queue)).Msg("bot stopped, updates waiting for the user dropped")
+			d.dropped += len(queue)
+			queue = nil
+		}
+		if len(queue) == 0 {
+			delete(d.queues, userId)
+			d.queuesMu.Unlock()
+			return
+		}
+		upd = queue[0]
+		d.queues[userId] = queue[1:]
+		d.queuesMu.Unlock()
+	}
+}
+
+// getUpdateUserId returns the id of the user who sent the update, false if the update is not supported.
+func getUpdateUserId(upd *tgclient.Update) (int, bool) {
+	if upd.IsMessage() && upd.Message.From != nil {
+		return upd.Message.From.ID, true
+	} else if upd.IsCallbackQuery() && upd.CallbackQuery.From != nil && upd.CallbackQuery.Message != nil {
+		return upd.CallbackQuery.From.ID, true
+	}
+	return 0, false
+}
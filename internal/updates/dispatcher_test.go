@@ -0,0 +1,167 @@
+package updates
+
+import (
+	"context"
+	"sync"
+	"telarr/internal/tgclient"
+	"testing"
+	"time"
+
+	"gitlab.com/toby3d/telegram"
+)
+
+func newTestUpdate(updateId int, userId int) *tgclient.Update {
+	return &tgclient.Update{Update: &telegram.Update{
+		UpdateID: updateId,
+		Message: &telegram.Message{
+			From: &telegram.User{ID: userId},
+			Chat: &telegram.Chat{ID: int64(userId)},
+			Text: "text",
+		},
+	}}
+}
+
+func TestDispatcher_SerializedPerUser(t *testing.T) {
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+
+	var mu sync.Mutex
+	handled := make(map[int][]int)
+	running := make(map[int]bool)
+	d := newDispatcher(wg, func(ctx context.Context, upd *tgclient.Update) {
+		userId := upd.Message.From.ID
+
+		mu.Lock()
+		if running[userId] {
+			t.Errorf("two updates of user %v handled at the same time", userId)
+		}
+		running[userId] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running[userId] = false
+		handled[userId] = append(handled[userId], upd.UpdateID)
+		mu.Unlock()
+	})
+
+	const nbUpdates = 20
+	for i := 0; i < nbUpdates; i++ {
+		for userId := 1; userId <= 3; userId++ {
+			d.dispatch(ctx, userId, newTestUpdate(i, userId))
+		}
+	}
+	wg.Wait()
+
+	for userId := 1; userId <= 3; userId++ {
+		if len(handled[userId]) != nbUpdates {
+			t.Fatalf("user %v: %v updates handled, want %v", userId, len(handled[userId]), nbUpdates)
+		}
+		for i, updateId := range handled[userId] {
+			if updateId != i {
+				t.Errorf("user %v: update %v handled at position %v", userId, updateId, i)
+			}
+		}
+	}
+}
+
+func TestDispatcher_ConcurrentUsers(t *testing.T) {
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+
+	// the update of user 1 blocks until the update of user 2 is handled
+	user2Handled := make(chan struct{})
+	d := newDispatcher(wg, func(ctx context.Context, upd *tgclient.Update) {
+		switch upd.Message.From.ID {
+		case 1:
+			select {
+			case <-user2Handled:
+			case <-time.After(time.Second):
+				t.Errorf("user 2 blocked by user 1")
+			}
+		case 2:
+			close(user2Handled)
+		}
+	})
+
+	d.dispatch(ctx, 1, newTestUpdate(1, 1))
+	d.dispatch(ctx, 2, newTestUpdate(2, 2))
+	wg.Wait()
+
+	if len(d.queues) != 0 {
+		t.Errorf("%v queues left after all updates handled", len(d.queues))
+	}
+}
+
+func TestDispatcher_QueueFull(t *testing.T) {
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+
+	// the first update blocks the worker until all the updates are dispatched
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []int
+	d := newDispatcher(wg, func(ctx context.Context, upd *tgclient.Update) {
+		if upd.UpdateID == 0 {
+			<-release
+		}
+		mu.Lock()
+		handled = append(handled, upd.UpdateID)
+		mu.Unlock()
+	})
+
+	for i := 0; i < maxQueuedUpdates+5; i++ {
+		d.dispatch(ctx, 1, newTestUpdate(i, 1))
+	}
+	close(release)
+	wg.Wait()
+
+	// the running update and the full queue are handled, the next ones are dropped
+	if len(handled) != maxQueuedUpdates+1 {
+		t.Fatalf("%v updates handled, want %v", len(handled), maxQueuedUpdates+1)
+	}
+	if last := handled[len(handled)-1]; last != maxQueuedUpdates {
+		t.Errorf("last update handled = %v, want %v", last, maxQueuedUpdates)
+	}
+	if d.dropped != 4 {
+		t.Errorf("%v updates dropped, want 4", d.dropped)
+	}
+}
+
+func TestDispatcher_Stopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+
+	// the bot stops while the first update of user 1 is handled
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []int
+	d := newDispatcher(wg, func(ctx context.Context, upd *tgclient.Update) {
+		if upd.UpdateID == 0 {
+			<-release
+		}
+		mu.Lock()
+		handled = append(handled, upd.UpdateID)
+		mu.Unlock()
+	})
+
+	const nbQueued = 3
+	for i := 0; i <= nbQueued; i++ {
+		d.dispatch(ctx, 1, newTestUpdate(i, 1))
+	}
+	cancel()
+	close(release)
+	wg.Wait()
+
+	// the running update is finished, the queued ones are dropped and counted
+	if len(handled) != 1 {
+		t.Errorf("%v updates handled, want 1", len(handled))
+	}
+	if d.dropped != nbQueued {
+		t.Errorf("%v updates dropped, want %v", d.dropped, nbQueued)
+	}
+	if len(d.queues) != 0 {
+		t.Errorf("%v queues left after the bot stopped", len(d.queues))
+	}
+}
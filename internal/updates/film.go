@@ -0,0 +1,126 @@
+package updates
+
+import (
+	"sort"
+	"strings"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/radarr"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+// filmAction does the action of the button on the movie of the library, and updates its details in place with the result.
+func filmAction(bot tgclient.Client, codec *types.CallbackCodec, auditor *auditor, rcvCallback *telegram.CallbackQuery, radarrService radarr.MovieService, data types.CallbackData) {
+	msg := rcvCallback.Message
+	movieId := int(data.MediaId)
+	user := authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}
+
+	film, err := radarrService.GetFilm(movieId)
+	if err != nil {
+		log.Err(err).Int("movieId", movieId).Msg("error when getting movie")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
+		return
+	}
+
+	var result string
+	switch data.Action {
+	case types.CallbackSearchFilm:
+		err = radarrService.SearchFilm(movieId)
+		auditor.record(user, audit.Entry{Action: audit.ActionSearchMovie, MediaIds: []int64{data.MediaId}, Media: film.Title, Instance: radarrService.Name()}, err)
+		result = "🔍 Search started, the best release will be downloaded ✅"
+	case types.CallbackRefreshFilm:
+		err = radarrService.RefreshFilm(movieId)
+		auditor.record(user, audit.Entry{Action: audit.ActionRefreshMovie, MediaIds: []int64{data.MediaId}, Media: film.Title, Instance: radarrService.Name()}, err)
+		result = "🔄 Refresh and rescan started ✅"
+	case types.CallbackToggleMonitoredFilm:
+		var updated radarr.Film
+		updated, err = radarrService.SetMonitored(movieId, !film.Monitored)
+		change := "monitored"
+		result = "👁 The movie is now monitored ✅"
+		if film.Monitored {
+			change = "unmonitored"
+			result = "👁 The movie is not monitored anymore ✅"
+		}
+		auditor.record(user, audit.Entry{Action: audit.ActionEditMovie, MediaIds: []int64{data.MediaId}, Media: film.Title + ": " + change, Instance: radarrService.Name()}, err)
+		if err == nil {
+			film = updated
+		}
+	case types.CallbackSetQualityProfileFilm:
+		// the profile may have been removed since the keyboard was sent
+		var profiles []types.QualityProfile
+		profiles, err = radarrService.GetQualityProfiles()
+		if err != nil {
+			break
+		}
+		profileName := ""
+		for _, profile := range profiles {
+			if profile.ID == data.Arg {
+				profileName = profile.Name
+				break
+			}
+		}
+		if profileName == "" {
+			log.Warn().Str("username", rcvCallback.From.Username).Int64("qualityProfileId", data.Arg).Msg("quality profile not found")
+			sendSimpleMessage(bot, msg.Chat.ID, "This quality profile doesn't exist anymore.\nPlease select another one.")
+			return
+		}
+
+		var updated radarr.Film
+		updated, err = radarrService.SetQualityProfile(movieId, data.Arg)
+		auditor.record(user, audit.Entry{Action: audit.ActionEditMovie, MediaIds: []int64{data.MediaId}, Media: film.Title + ": quality profile " + profileName, Instance: radarrService.Name()}, err)
+		if err == nil {
+			film = updated
+		}
+		result = "📺 Quality profile changed to *" + profileName + "* ✅"
+	}
+	if err != nil {
+		log.Err(err).Str("movieName", film.Title).Str("action", data.Action.String()).Msg("error when updating movie")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while updating the movie.\nPlease contact the administrator.")
+		return
+	}
+
+	text := film.PrintMovieDetails()
+	if result != "" {
+		log.Debug().Str("movieName", film.Title).Str("action", data.Action.String()).Str("username", rcvCallback.From.Username).Msg("movie updated successfully")
+		text = strings.TrimSpace(text) + "\n\n" + result
+	}
+	keyboard := getMovieDetailsKeyboard(codec, data.Instance, film)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// editFilmQualityProfiles replaces the keyboard of the details of the movie with the quality profiles to select, the one of the movie checked.
+func editFilmQualityProfiles(bot tgclient.Client, codec *types.CallbackCodec, rcvCallback *telegram.CallbackQuery, radarrService radarr.MovieService, data types.CallbackData) {
+	msg := rcvCallback.Message
+
+	film, err := radarrService.GetFilm(int(data.MediaId))
+	if err != nil {
+		log.Err(err).Int64("movieId", data.MediaId).Msg("error when getting movie")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
+		return
+	}
+	profiles, err := radarrService.GetQualityProfiles()
+	if err != nil {
+		log.Err(err).Msg("error when getting quality profiles")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while getting the quality profiles.\nPlease contact the administrator.")
+		return
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+
+	var rows [][]*telegram.InlineKeyboardButton
+	for _, profile := range profiles {
+		text := profile.Name
+		if profile.ID == film.QualityProfileId {
+			text += " ✅"
+		}
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, text, types.CallbackData{Action: types.CallbackSetQualityProfileFilm, Instance: data.Instance, MediaId: data.MediaId, Arg: profile.ID})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: types.CallbackFilmDetails, Instance: data.Instance, MediaId: data.MediaId})))
+	keyboard := telegram.NewInlineKeyboardMarkup(rows...)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, strings.TrimSpace(film.PrintMovieDetails())+"\n\nSelect the quality profile of the movie:", &keyboard)
+}
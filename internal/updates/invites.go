@@ -0,0 +1,226 @@
+package updates
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/invite"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// maxRedemptionsShown is the number of last redemptions shown in the invites menu.
+	maxRedemptionsShown = 5
+)
+
+// invites is the struct designed to create the invite codes and to let the new users redeem them.
+type invites struct {
+	bot   tgclient.Client
+	codec *types.CallbackCodec
+	auth  *authentication.Auth
+	store *invite.Store
+
+	// auditor records the codes created, revoked and redeemed.
+	auditor *auditor
+
+	// services hold the ttl of the codes, reloadable.
+	services *atomic.Pointer[services]
+
+	// botUsername is the username of the bot for the deep links, empty if unknown.
+	botUsername string
+}
+
+// redeem autorizes the user if the code can be redeemed, tells it and notifies the admins.
+// The error is returned without telling the user, to let the caller choose what to do.
+func (inv *invites) redeem(chatID int64, user authentication.User, code string) error {
+	// the use of the code is only recorded once the user is authorized
+	i, err := inv.store.Redeem(code, user.Id, user.Username, func(i invite.Invite) error {
+		err := inv.auth.AutorizeInvitedUser(user, i.Role)
+		inv.auditor.record(user, audit.Entry{Action: audit.ActionRedeemInvite, MediaIds: []int64{i.Id}, Media: printAuditInvite(i)}, err)
+		if err != nil {
+			log.Err(err).Int("userId", user.Id).Int64("inviteId", i.Id).Msg("error when autorizing the invited user")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	role, _ := inv.auth.GetRole(user.Id)
+	log.Info().Str("username", user.Username).Int64("inviteId", i.Id).Str("role", role.String()).Msg("user authorized with an invite code")
+
+	sendSimpleMessage(inv.bot, chatID, "You are now authorized! 🎉\nYour role is *"+role.String()+"*, use /help to see the commands list.")
+	for _, admin := range inv.auth.GetAdmins() {
+		if admin.Id == user.Id {
+			continue
+		}
+		sendSimpleMessage(inv.bot, int64(admin.Id), "🎟 *"+escapeMarkdown(printUser(user))+"* joined with the invite code `"+i.Code+"`\nRole: "+printRole(role))
+	}
+	return nil
+}
+
+// create creates a code for the role given by its index, and replaces the message with it.
+func (inv *invites) create(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, roleIndex int) {
+	msg := rcvCallback.Message
+	if roleIndex < 0 || roleIndex >= len(authentication.Roles) {
+		log.Warn().Str("username", rcvCallback.From.Username).Int("role", roleIndex).Msg("unknown role")
+		sendSimpleMessage(bot, msg.Chat.ID, "This button is not valid anymore.\nPlease run the command again.")
+		return
+	}
+
+	admin := authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}
+	ttl := inv.services.Load().invites.Ttl
+	if ttl == 0 {
+		ttl = invite.DefaultTtl
+	}
+	i, err := inv.store.Create(invite.Invite{
+		Role:      authentication.Roles[roleIndex],
+		MaxUses:   1,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: printUser(admin),
+	})
+	inv.auditor.record(admin, audit.Entry{Action: audit.ActionCreateInvite, Media: printAuditInvite(i)}, err)
+	if err != nil {
+		log.Err(err).Str("username", rcvCallback.From.Username).Msg("error when creating the invite code")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the invite codes.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int64("inviteId", i.Id).Str("role", i.Role.String()).Msg("invite code created")
+
+	text := "Invite code created ✅\n\nCode: `" + i.Code + "`\nRole: " + printRole(i.Role) + "\nSingle use, expires in " + authentication.PrintDuration(ttl) + "\n\n"
+	if inv.botUsername != "" {
+		text += "Share this [invite link](https://t.me/" + inv.botUsername + "?start=" + i.Code + ") with the new user, or the code to send with /start."
+	} else {
+		text += "The new user sends `/start " + i.Code + "` to the bot."
+	}
+	keyboard := telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(newCallbackButton(inv.codec, "<- Back", types.CallbackData{Action: types.CallbackAdminInvites})))
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// revoke revokes the code, and shows the codes again.
+func (inv *invites) revoke(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, id int64) {
+	msg := rcvCallback.Message
+
+	i, err := inv.store.Revoke(id)
+	if !errors.Is(err, invite.ErrInviteNotFound) {
+		inv.auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionRevokeInvite, MediaIds: []int64{id}, Media: printAuditInvite(i)}, err)
+	}
+	if errors.Is(err, invite.ErrInviteNotFound) {
+		editSimpleMessage(bot, msg.Chat.ID, msg.ID, "This invite code doesn't exist anymore.")
+		return
+	}
+	if err != nil {
+		log.Err(err).Str("username", rcvCallback.From.Username).Int64("inviteId", id).Msg("error when revoking the invite code")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the invite codes.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int64("inviteId", i.Id).Msg("invite code revoked")
+
+	inv.editList(bot, msg)
+}
+
+// editList replaces the message with the codes that can be redeemed and the last redemptions,
+// with the buttons to create a code for each role and to revoke the codes.
+func (inv *invites) editList(bot tgclient.Client, msg *telegram.Message) {
+	list, err := inv.store.List()
+	if err != nil {
+		log.Err(err).Msg("error when reading the invite codes")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while reading the invite codes.\nPlease contact the administrator.")
+		return
+	}
+
+	type redeemed struct {
+		code string
+		invite.Redemption
+	}
+	var usable []invite.Invite
+	var redemptions []redeemed
+	for _, i := range list {
+		if i.Check() == nil {
+			usable = append(usable, i)
+		}
+		for _, r := range i.Redemptions {
+			redemptions = append(redemptions, redeemed{code: i.Code, Redemption: r})
+		}
+	}
+	sort.Slice(redemptions, func(a, b int) bool { return redemptions[a].RedeemedAt.Before(redemptions[b].RedeemedAt) })
+
+	text := "🎟 *" + strconv.Itoa(len(usable)) + " invite codes*"
+	for _, i := range usable {
+		text += "\n\t`" + i.Code + "` " + printInvite(i, inv.auth.GetDefaultRole())
+	}
+	if len(redemptions) > 0 {
+		if len(redemptions) > maxRedemptionsShown {
+			redemptions = redemptions[len(redemptions)-maxRedemptionsShown:]
+		}
+		text += "\n\n*Last redeemed:*"
+		for _, r := range redemptions {
+			text += "\n\t" + r.RedeemedAt.Format("2006-01-02") + " " + escapeMarkdown(printUser(authentication.User{Id: r.UserId, Username: r.Username})) + " with `" + r.code + "`"
+		}
+	}
+	text += "\n\nCreate a single use code for the role:"
+
+	keyboard := getInvitesKeyboard(inv.codec, usable)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, text, &keyboard)
+}
+
+// getInvitesKeyboard returns a button to create a code per role, and a button to revoke each code.
+func getInvitesKeyboard(codec *types.CallbackCodec, usable []invite.Invite) telegram.InlineKeyboardMarkup {
+	var roles []*telegram.InlineKeyboardButton
+	for i, r := range authentication.Roles {
+		roles = append(roles, newCallbackButton(codec, "➕ "+r.String(), types.CallbackData{Action: types.CallbackAdminCreateInvite, Arg: int64(i)}))
+	}
+	rows := [][]*telegram.InlineKeyboardButton{telegram.NewInlineKeyboardRow(roles...)}
+	for _, i := range usable {
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "❌ Revoke "+i.Code, types.CallbackData{Action: types.CallbackAdminRevokeInvite, Arg: i.Id})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<- Back", types.CallbackData{Action: types.CallbackAdminMenu})))
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+// printInvite returns the role, the default role if the code has none, the uses and the expiration of the code.
+func printInvite(i invite.Invite, defaultRole authentication.Role) string {
+	role := i.Role
+	if role == "" {
+		role = defaultRole
+	}
+	str := role.String() + ", " + strconv.Itoa(len(i.Redemptions))
+	if i.MaxUses > 0 {
+		str += "/" + strconv.Itoa(i.MaxUses)
+	}
+	str += " uses"
+	if !i.ExpiresAt.IsZero() {
+		str += ", expires in " + authentication.PrintDuration(time.Until(i.ExpiresAt))
+	}
+	return str
+}
+
+// printAuditInvite returns the code and the role of the invite for the audit log, empty if the invite is unknown.
+func printAuditInvite(i invite.Invite) string {
+	if i.Code == "" {
+		return ""
+	}
+	return i.Code + " for " + i.Role.String()
+}
+
+// printInviteError returns the message telling the user why the code can't be redeemed.
+func printInviteError(err error) string {
+	switch {
+	case errors.Is(err, invite.ErrInviteNotFound):
+		return "This invite code is not valid ❌"
+	case errors.Is(err, invite.ErrInviteExpired):
+		return "This invite code has expired ❌\nPlease ask an administrator for a new one."
+	case errors.Is(err, invite.ErrInviteUsed):
+		return "This invite code was already used ❌\nPlease ask an administrator for a new one."
+	case errors.Is(err, invite.ErrInviteRevoked):
+		return "This invite code was revoked ❌\nPlease ask an administrator for a new one."
+	}
+	return "An error occurred while checking the invite code.\nPlease contact the administrator."
+}
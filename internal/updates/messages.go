@@ -2,9 +2,14 @@ package updates
 
 import (
 	"strconv"
-	"telarr/configuration"
+	"sync/atomic"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
 	"telarr/internal/radarr"
+	"telarr/internal/request"
+	"telarr/internal/session"
 	"telarr/internal/sonarr"
+	"telarr/internal/tgclient"
 	"telarr/internal/types"
 	"time"
 
@@ -20,26 +25,34 @@ const (
 
 // messages is the struct designed to handle the messages.
 type messages struct {
-	// Bot is the telegram bot.
-	bot *telegram.Bot
-
-	radarrConfig     configuration.Radarr
-	sonarrConfig     configuration.Sonarr
-	pathForDiskUsage string
-
-	// list of users actions
-	usersAction map[int]types.Action
-	// list of data to navigate between pages
-	usersData     map[int]interface{}
-	usersCurrPage map[int]int
+	// services are the instances managing the libraries and the reloadable settings.
+	services *atomic.Pointer[services]
+
+	// codec encodes and decodes the callback data of the keyboards.
+	codec *types.CallbackCodec
+
+	// sessions is the store of the users conversations (action and data to navigate between pages).
+	sessions session.Store
+	// auth manages the autorized group chats, for the admins.
+	auth *authentication.Auth
+	// requests records the additions waiting for the approval of an admin.
+	requests *requests
+	// quotas counts the additions of the users.
+	quotas *quotas
+	// auditor records the additions, and shows the audit log to the admins.
+	auditor *auditor
 }
 
-func (mess *messages) handle(rcvMess *telegram.Message, isAdmin bool) {
+// handle handles the message, replying with the bot in the chat and the forum topic of the message.
+func (mess *messages) handle(bot tgclient.Client, rcvMess *telegram.Message, role authentication.Role) {
 	if rcvMess == nil {
 		log.Warn().Msg("received nil message")
 		return
 	}
 
+	// the services are read once, a reload doesn't change them in the middle of the message
+	srv := mess.services.Load()
+
 	// check if the message is too old
 	if time.Now().Unix()-rcvMess.Date > messageTimeOut {
 		log.Warn().Msg("message is too old")
@@ -49,39 +62,89 @@ func (mess *messages) handle(rcvMess *telegram.Message, isAdmin bool) {
 	// if it's a command
 	if rcvMess.IsCommand() {
 		log.Debug().Str("username", rcvMess.From.Username).Str("command", rcvMess.Command()).Msg("command received")
-		delete(mess.usersAction, rcvMess.From.ID)
+		clearUserAction(mess.sessions, rcvMess.From.ID)
+
+		if !commandAllowed(role, rcvMess.Command()) {
+			sendNotAllowed(bot, rcvMess.Chat.ID, rcvMess.From.Username, role, rcvMess.Command())
+			return
+		}
 
 		switch rcvMess.Command() {
-		case "help":
-			sendSimpleMessage(mess.bot, rcvMess.Chat.ID, printHelp())
+		case "help", "start":
+			sendSimpleMessage(bot, rcvMess.Chat.ID, printHelp(role))
+		case "me":
+			user := authentication.User{Id: rcvMess.From.ID, Username: rcvMess.From.Username}
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "👤 *"+escapeMarkdown(printUser(user))+"*\nRole: "+printRole(role)+"\n"+mess.quotas.print(rcvMess.From.ID, role))
 		case "movies":
-			sendMoviesList(mess.bot, rcvMess, mess.radarrConfig)
+			// with several instances, the user selects the one to show
+			if len(srv.movies) > 1 {
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the radarr instance:", getInstancesKeyboard(mess.codec, getInstancesNames(srv.movies), types.CallbackData{Action: types.CallbackFirstMovie, Page: 1}))
+				return
+			}
+			sendMoviesList(bot, mess.codec, rcvMess, srv.movies, 0)
 		case "addmovie":
 			log.Trace().Str("username", rcvMess.From.Username).Msg("adding movie")
-			mess.usersAction[rcvMess.From.ID] = types.UserActionLookMovieToAdd
+			if len(srv.movies) == 0 {
+				sendSimpleMessage(bot, rcvMess.Chat.ID, "Radarr is not configured.\nPlease contact the administrator.")
+				return
+			}
+			if reason := mess.quotas.check(rcvMess.From.ID, role, mediaTypeMovie, 0); reason != "" {
+				sendSimpleMessage(bot, rcvMess.Chat.ID, reason)
+				return
+			}
 
-			sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Please enter the name of the movie you want to add:")
+			// with several instances, the user selects the one to add the movie to
+			if len(srv.movies) > 1 {
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the radarr instance to add the movie to:", getInstancesKeyboard(mess.codec, getInstancesNames(srv.movies), types.CallbackData{Action: types.CallbackEditRequestAddMovie}))
+				return
+			}
+			setUserSession(mess.sessions, rcvMess.From.ID, session.Session{Action: types.UserActionLookMovieToAdd})
+
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "Please enter the name of the movie you want to add:")
 		case "series":
-			sendSeriesList(mess.bot, rcvMess, mess.sonarrConfig)
+			// with several instances, the user selects the one to show
+			if len(srv.series) > 1 {
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the sonarr instance:", getInstancesKeyboard(mess.codec, getInstancesNames(srv.series), types.CallbackData{Action: types.CallbackFirstSerie, Page: 1}))
+				return
+			}
+			sendSeriesList(bot, mess.codec, rcvMess, srv.series, 0)
 		case "addserie":
 			log.Trace().Str("username", rcvMess.From.Username).Msg("adding serie")
-			mess.usersAction[rcvMess.From.ID] = types.UserActionLookSerieToAdd
+			if len(srv.series) == 0 {
+				sendSimpleMessage(bot, rcvMess.Chat.ID, "Sonarr is not configured.\nPlease contact the administrator.")
+				return
+			}
+			if reason := mess.quotas.check(rcvMess.From.ID, role, mediaTypeSerie, 0); reason != "" {
+				sendSimpleMessage(bot, rcvMess.Chat.ID, reason)
+				return
+			}
+
+			// with several instances, the user selects the one to add the serie to
+			if len(srv.series) > 1 {
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the sonarr instance to add the serie to:", getInstancesKeyboard(mess.codec, getInstancesNames(srv.series), types.CallbackData{Action: types.CallbackEditRequestAddSerie}))
+				return
+			}
+			setUserSession(mess.sessions, rcvMess.From.ID, session.Session{Action: types.UserActionLookSerieToAdd})
 
-			sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Please enter the name of the serie you want to add:")
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "Please enter the name of the serie you want to add:")
 		case "status":
 			log.Trace().Str("username", rcvMess.From.Username).Msg("getting status")
 
-			mId := sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Getting radarr status...")
-			radarrStatus := radarr.GetStatus(mess.radarrConfig)
-			mess.bot.DeleteMessage(rcvMess.Chat.ID, mId)
-			mId = sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Getting sonarr status...")
-			sonarrStatus := sonarr.GetStatus(mess.sonarrConfig)
-			mess.bot.DeleteMessage(rcvMess.Chat.ID, mId)
-			str := radarrStatus.String() + "\n" + sonarrStatus.String() + "\n"
+			str := ""
+			for _, movies := range srv.movies {
+				mId := sendSimpleMessage(bot, rcvMess.Chat.ID, "Getting radarr status...")
+				str += movies.GetStatus().String() + "\n"
+				bot.DeleteMessage(rcvMess.Chat.ID, mId)
+			}
+			for _, series := range srv.series {
+				mId := sendSimpleMessage(bot, rcvMess.Chat.ID, "Getting sonarr status...")
+				str += series.GetStatus().String() + "\n"
+				bot.DeleteMessage(rcvMess.Chat.ID, mId)
+			}
 
 			// get the speedtest
 			log.Trace().Msg("getting speedtest")
-			mId = sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Getting speedtest...")
+			mId := sendSimpleMessage(bot, rcvMess.Chat.ID, "Getting speedtest...")
 			spd := speedtest.New()
 			srvList, err := spd.FetchServers()
 			if err != nil {
@@ -115,65 +178,96 @@ func (mess *messages) handle(rcvMess *telegram.Message, isAdmin bool) {
 					s.Context.Reset()
 				}
 			}
-			mess.bot.DeleteMessage(rcvMess.Chat.ID, mId)
+			bot.DeleteMessage(rcvMess.Chat.ID, mId)
 
-			mId = sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Getting disk usage...")
-			diskStatus, err := getDiskUsage(mess.pathForDiskUsage)
+			mId = sendSimpleMessage(bot, rcvMess.Chat.ID, "Getting disk usage...")
+			diskStatus, err := getDiskUsage(srv.pathForDiskUsage)
+			str += "\n*Disk usage*:\n"
 			if err != nil {
+				// the path may not exist yet (e.g. a disk not mounted), see Configuration.Warnings
 				log.Err(err).Msg("error when getting disk usage")
+				str += "\tunavailable\n"
+			} else {
+				str += "\tfree: " + diskStatus.FreeOfAll() + " (" + strconv.FormatFloat(diskStatus.FreePercent(), 'f', 2, 64) + "%)\n"
 			}
-			str += "\n*Disk usage*:\n"
-			str += "\tfree: " + diskStatus.FreeOfAll() + " (" + strconv.FormatFloat(diskStatus.FreePercent(), 'f', 2, 64) + "%)\n"
-			mess.bot.DeleteMessage(rcvMess.Chat.ID, mId)
+			bot.DeleteMessage(rcvMess.Chat.ID, mId)
 
-			sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, str, telegram.NewReplyKeyboardRemove(false))
+			sendMessageWithKeyboard(bot, rcvMess.Chat.ID, str, telegram.NewReplyKeyboardRemove(false))
 		case "stop":
 			log.Trace().Str("username", rcvMess.From.Username).Msg("canceling action")
 
 			// remove the data from the user
-			delete(mess.usersData, rcvMess.From.ID)
-			delete(mess.usersCurrPage, rcvMess.From.ID)
+			deleteUserSession(mess.sessions, rcvMess.From.ID)
 
-			sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, "Action canceled ✅", telegram.NewReplyKeyboardRemove(false))
+			sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Action canceled ✅", telegram.NewReplyKeyboardRemove(false))
 		case "admin":
-			if !isAdmin {
-				log.Warn().Str("username", rcvMess.From.Username).Msg("user is not admin")
-				sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "You are not an administrator.")
-				return
-			}
-			sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, "Select an action:", getAdminKeyboard())
+			sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select an action:", getAdminKeyboard(mess.codec))
+		case "audit":
+			log.Trace().Str("username", rcvMess.From.Username).Str("filter", rcvMess.CommandArgument()).Msg("showing the audit log")
+			mess.auditor.sendAudit(bot, mess.codec, mess.sessions, rcvMess)
+		case "allowchat":
+			allowChat(bot, mess.auth, mess.auditor, rcvMess)
+		case "revokechat":
+			revokeChat(bot, mess.auth, mess.auditor, rcvMess)
 
 		default:
 			log.Warn().Str("username", rcvMess.From.Username).Str("command", rcvMess.Command()).Msg("unknown command")
-			sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "I don't understand this command.\nPlease use /help to see the commands list.")
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "I don't understand this command.\nPlease use /help to see the commands list.")
 		}
 	} else {
 		// if it's a message
 		log.Debug().Str("username", rcvMess.From.Username).Msg("message received")
 
-		if action, exist := mess.usersAction[rcvMess.From.ID]; exist {
-			delete(mess.usersAction, rcvMess.From.ID)
+		if userSession, exist := mess.sessions.Get(rcvMess.From.ID); exist && userSession.Action != "" {
+			clearUserAction(mess.sessions, rcvMess.From.ID)
 
-			switch action.(types.UserAction) {
+			// the role may have changed since the beginning of the conversation
+			if !userActionAllowed(role, userSession.Action) {
+				sendNotAllowed(bot, rcvMess.Chat.ID, rcvMess.From.Username, role, userSession.Action.String())
+				return
+			}
+
+			// get the instance the action is about
+			var radarrService radarr.MovieService
+			var sonarrService sonarr.SeriesService
+			switch userActionsMediaType[userSession.Action] {
+			case mediaTypeMovie:
+				var ok bool
+				radarrService, ok = getInstance(srv.movies, userSession.Instance)
+				if !ok {
+					log.Warn().Str("username", rcvMess.From.Username).Int("instance", userSession.Instance).Msg("radarr instance not found")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "Request timed out.\nPlease try again.")
+					return
+				}
+			case mediaTypeSerie:
+				var ok bool
+				sonarrService, ok = getInstance(srv.series, userSession.Instance)
+				if !ok {
+					log.Warn().Str("username", rcvMess.From.Username).Int("instance", userSession.Instance).Msg("sonarr instance not found")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "Request timed out.\nPlease try again.")
+					return
+				}
+			}
+
+			switch userSession.Action {
 			/* Movies */
 			case types.UserActionLookMovieToAdd:
 				movieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("movieName", movieName).Msg("looking for movie to add")
 
-				foundFilms, err := radarr.LookupFilm(mess.radarrConfig, movieName)
+				foundFilms, err := radarrService.LookupFilm(movieName)
 				if err != nil {
 					log.Err(err).Msg("error when looking for movie")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while looking for the movie.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while looking for the movie.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundFilms) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No movie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No movie found with this name.")
 					return
 				}
 
-				mess.usersData[rcvMess.From.ID] = foundFilms
-				mess.usersCurrPage[rcvMess.From.ID] = 1
+				setUserSession(mess.sessions, rcvMess.From.ID, session.Session{Instance: userSession.Instance, Films: foundFilms, CurrPage: 1})
 
 				// send the first movie found
 				film := foundFilms[0]
@@ -181,101 +275,116 @@ func (mess *messages) handle(rcvMess *telegram.Message, isAdmin bool) {
 				if film.IsInLibrary {
 					str += "\n\nAlready in your library ✅"
 				}
-				sendImageMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, film.CoverImage, str, getAddMediaKeyboard(1, len(foundFilms), mediaTypeMovie, !film.IsInLibrary))
+				sendImageMessageWithKeyboard(bot, rcvMess.Chat.ID, film.CoverImage, str, getAddMediaKeyboard(mess.codec, 1, len(foundFilms), mediaTypeMovie, userSession.Instance, !film.IsInLibrary))
 			case types.UserActionMovieDetails:
 				movieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("movieName", movieName).Msg("getting movie details")
 
-				foundFilms, err := radarr.GetFilmDetails(mess.radarrConfig, movieName)
+				foundFilms, err := radarrService.GetFilmDetails(movieName)
 				if err != nil {
 					log.Err(err).Msg("error when getting movie details")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundFilms) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No movie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No movie found with this name.")
 					return
 				}
 
 				// send the movie details
 				film := foundFilms[0]
 				log.Trace().Str("username", rcvMess.From.Username).Str("movieName", film.Title).Msg("sending movie details")
-				sendImageMessage(mess.bot, rcvMess.Chat.ID, film.CoverImage, film.PrintMovieTitle())
-				sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, film.PrintMovieDetails(), telegram.NewInlineKeyboardMarkup([]*telegram.InlineKeyboardButton{telegram.NewInlineKeyboardButton("<< Back to movies list", "backToMoviesList")}))
+				sendImageMessage(bot, rcvMess.Chat.ID, film.CoverImage, film.PrintMovieTitle())
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, film.PrintMovieDetails(), getMovieDetailsKeyboard(mess.codec, userSession.Instance, film))
 			case types.UserActionRemoveMovie:
 				movieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("movieName", movieName).Msg("getting movie to remove")
 
-				foundFilms, err := radarr.GetFilmDetails(mess.radarrConfig, movieName)
+				foundFilms, err := radarrService.GetFilmDetails(movieName)
 				if err != nil {
 					log.Err(err).Msg("error when getting movie details")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the movie details.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundFilms) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No movie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No movie found with this name.")
 					return
 				}
 
 				film := foundFilms[0]
 				str := film.PrintMovieTitle()
-				str += "\n_MovieId: " + strconv.Itoa(int(film.MovieId)) + "_"
 				str += "\n\nAre you sure you want to remove this movie from your library?"
-				sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, str, getConfirmRemoveKeyboard(mediaTypeMovie))
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, str, getConfirmRemoveKeyboard(mess.codec, mediaTypeMovie, userSession.Instance, film.MovieId))
 			case types.UserActionAddMovie:
 				qualityProfileName := rcvMess.Text
 
-				pageNb := mess.usersCurrPage[rcvMess.From.ID]
-				films := (mess.usersData[rcvMess.From.ID].([]radarr.Film))
-				film := films[pageNb-1]
+				if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Films) {
+					log.Warn().Str("username", rcvMess.From.Username).Msg("no movie found in the session")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "Request timed out.\nPlease try again.")
+					return
+				}
+				film := userSession.Films[userSession.CurrPage-1]
 
 				log.Trace().Str("username", rcvMess.From.Username).Str("qualityProfileName", qualityProfileName).Str("movie", film.Title).Msg("adding movie")
 
 				// get the quality profile id
-				qualityProfileId, err := radarr.GetQualityProfileId(mess.radarrConfig, qualityProfileName)
+				qualityProfileId, err := radarrService.GetQualityProfileId(qualityProfileName)
 				if err != nil {
 					log.Err(err).Msg("error when getting quality profile id")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the quality profile id.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the quality profile id.\nPlease contact the administrator.")
 					return
 				}
 
-				// add the movie
-				newFilmId, err := radarr.AddFilm(mess.radarrConfig, film, qualityProfileId)
+				// get the root folder, the user selects it if there are several
+				rootFolderPath, rootFolders, err := getRootFolder(radarrService)
 				if err != nil {
-					log.Err(err).Msg("error when adding movie")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while adding the movie.\nPlease contact the administrator.")
+					log.Err(err).Msg("error when getting root folders")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the root folders.\nPlease contact the administrator.")
 					return
 				}
+				if rootFolderPath == "" {
+					userSession.Action = ""
+					userSession.QualityProfileId = qualityProfileId
+					setUserSession(mess.sessions, rcvMess.From.ID, userSession)
 
-				// remove the data from the user
-				delete(mess.usersData, rcvMess.From.ID)
-				delete(mess.usersCurrPage, rcvMess.From.ID)
+					sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the root folder for the movie "+film.PrintMovieTitle(), getRootFolderKeyboard(mess.codec, mediaTypeMovie, userSession.Instance, rootFolders))
+					return
+				}
 
-				// send the confirmation message
-				log.Trace().Str("username", rcvMess.From.Username).Str("movie", film.Title).Msg("movie added")
-				sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, "Movie "+film.PrintMovieTitle()+" added ✅\n_movieId: "+strconv.Itoa(int(newFilmId))+"_", telegram.NewInlineKeyboardMarkup([]*telegram.InlineKeyboardButton{telegram.NewInlineKeyboardButton("Follow downloading status 📡", types.CallbackFollowDownloadingStatusMovie.String())}))
+				if reason := mess.quotas.check(rcvMess.From.ID, role, mediaTypeMovie, film.Size); reason != "" {
+					deleteUserSession(mess.sessions, rcvMess.From.ID)
+					sendSimpleMessage(bot, rcvMess.Chat.ID, reason)
+					return
+				}
+				if !role.Allows(directAddRole) {
+					deleteUserSession(mess.sessions, rcvMess.From.ID)
+					mess.requests.send(bot, rcvMess.Chat.ID, rcvMess.From, request.Request{Instance: userSession.Instance, Film: &film, QualityProfileId: qualityProfileId, RootFolderPath: rootFolderPath})
+					return
+				}
+				if newFilm, added := addFilm(bot, mess.codec, mess.sessions, mess.auditor, rcvMess.Chat.ID, rcvMess.From, radarrService, userSession.Instance, film, qualityProfileId, rootFolderPath); added {
+					mess.quotas.record(rcvMess.From.ID, mediaTypeMovie, userSession.Instance, newFilm.MovieId, newFilm.Size)
+				}
 
 				/* Series */
 			case types.UserActionLookSerieToAdd:
 				serieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("serieName", serieName).Msg("looking for serie to add")
 
-				foundSeries, err := sonarr.LookupSerie(mess.sonarrConfig, serieName)
+				foundSeries, err := sonarrService.LookupSerie(serieName)
 				if err != nil {
 					log.Err(err).Msg("error when looking for serie")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while looking for the serie.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while looking for the serie.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundSeries) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No serie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No serie found with this name.")
 					return
 				}
 
-				mess.usersData[rcvMess.From.ID] = foundSeries
-				mess.usersCurrPage[rcvMess.From.ID] = 1
+				setUserSession(mess.sessions, rcvMess.From.ID, session.Session{Instance: userSession.Instance, Series: foundSeries, CurrPage: 1})
 
 				// send the first serie found
 				serie := foundSeries[0]
@@ -283,124 +392,196 @@ func (mess *messages) handle(rcvMess *telegram.Message, isAdmin bool) {
 				if serie.IsInLibrary {
 					str += "\n\nAlready in your library ✅"
 				}
-				sendImageMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, serie.CoverImage, serie.PrintSerieTitle(), getAddMediaKeyboard(1, len(foundSeries), mediaTypeSerie, !serie.IsInLibrary))
+				sendImageMessageWithKeyboard(bot, rcvMess.Chat.ID, serie.CoverImage, serie.PrintSerieTitle(), getAddMediaKeyboard(mess.codec, 1, len(foundSeries), mediaTypeSerie, userSession.Instance, !serie.IsInLibrary))
 			case types.UserActionSerieDetails:
 				serieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("serieName", serieName).Msg("getting serie details")
 
-				foundSeries, err := sonarr.GetSerieDetails(mess.sonarrConfig, serieName)
+				foundSeries, err := sonarrService.GetSerieDetails(serieName)
 				if err != nil {
 					log.Err(err).Msg("error when getting serie details")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the serie details.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the serie details.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundSeries) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No serie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No serie found with this name.")
 					return
 				}
 
 				// send the serie details
 				serie := foundSeries[0]
 				log.Trace().Str("username", rcvMess.From.Username).Str("serieName", serie.Title).Msg("sending serie details")
-				sendImageMessage(mess.bot, rcvMess.Chat.ID, serie.CoverImage, serie.PrintSerieTitle())
-				sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, serie.PrintSerieDetails(), telegram.NewInlineKeyboardMarkup([]*telegram.InlineKeyboardButton{telegram.NewInlineKeyboardButton("<< Back to series list", "backToSeriesList")}))
+				sendImageMessage(bot, rcvMess.Chat.ID, serie.CoverImage, serie.PrintSerieTitle())
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, serie.PrintSerieDetails(), getBackToListKeyboard(mess.codec, mediaTypeSerie, userSession.Instance))
 			case types.UserActionRemoveSerie:
 				serieName := rcvMess.Text
 				log.Trace().Str("username", rcvMess.From.Username).Str("serieName", serieName).Msg("getting serie to remove")
 
-				foundSeries, err := sonarr.GetSerieDetails(mess.sonarrConfig, serieName)
+				foundSeries, err := sonarrService.GetSerieDetails(serieName)
 				if err != nil {
 					log.Err(err).Msg("error when getting serie details")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the serie details.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the serie details.\nPlease contact the administrator.")
 					return
 				}
 
 				if len(foundSeries) == 0 {
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "No serie found with this name.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "No serie found with this name.")
 					return
 				}
 
 				serie := foundSeries[0]
 				str := serie.PrintSerieTitle()
-				str += "\n_SerieId: " + strconv.Itoa(int(serie.SerieId)) + "_"
 				str += "\n\nAre you sure you want to remove this serie from your library?"
-				sendMessageWithKeyboard(mess.bot, rcvMess.Chat.ID, str, getConfirmRemoveKeyboard(mediaTypeSerie))
+				sendMessageWithKeyboard(bot, rcvMess.Chat.ID, str, getConfirmRemoveKeyboard(mess.codec, mediaTypeSerie, userSession.Instance, serie.SerieId))
 			case types.UserActionAddSerie:
 				qualityProfileName := rcvMess.Text
 
-				pageNb := mess.usersCurrPage[rcvMess.From.ID]
-				series := (mess.usersData[rcvMess.From.ID].([]sonarr.Serie))
-				serie := series[pageNb-1]
+				if userSession.CurrPage < 1 || userSession.CurrPage > len(userSession.Series) {
+					log.Warn().Str("username", rcvMess.From.Username).Msg("no serie found in the session")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "Request timed out.\nPlease try again.")
+					return
+				}
+				serie := userSession.Series[userSession.CurrPage-1]
 
 				log.Trace().Str("username", rcvMess.From.Username).Str("qualityProfileName", qualityProfileName).Str("serie", serie.Title).Msg("adding serie")
 
 				// get the quality profile id
-				qualityProfileId, err := sonarr.GetQualityProfileId(mess.sonarrConfig, qualityProfileName)
+				qualityProfileId, err := sonarrService.GetQualityProfileId(qualityProfileName)
 				if err != nil {
 					log.Err(err).Msg("error when getting quality profile id")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while getting the quality profile id.\nPlease contact the administrator.")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the quality profile id.\nPlease contact the administrator.")
 					return
 				}
 
-				// add the serie
-				err = sonarr.AddSerie(mess.sonarrConfig, serie, qualityProfileId)
+				// get the root folder, the user selects it if there are several
+				rootFolderPath, rootFolders, err := getRootFolder(sonarrService)
 				if err != nil {
-					log.Err(err).Msg("error when adding serie")
-					sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "An error occurred while adding the serie.\nPlease contact the administrator.")
+					log.Err(err).Msg("error when getting root folders")
+					sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the root folders.\nPlease contact the administrator.")
 					return
 				}
+				if rootFolderPath == "" {
+					userSession.Action = ""
+					userSession.QualityProfileId = qualityProfileId
+					setUserSession(mess.sessions, rcvMess.From.ID, userSession)
 
-				// remove the data from the user
-				delete(mess.usersData, rcvMess.From.ID)
-				delete(mess.usersCurrPage, rcvMess.From.ID)
+					sendMessageWithKeyboard(bot, rcvMess.Chat.ID, "Select the root folder for the serie "+serie.PrintSerieTitle(), getRootFolderKeyboard(mess.codec, mediaTypeSerie, userSession.Instance, rootFolders))
+					return
+				}
 
-				// send the confirmation message
-				log.Trace().Str("username", rcvMess.From.Username).Str("serie", serie.Title).Msg("serie added")
-				sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "Serie "+serie.PrintSerieTitle()+" added ✅")
+				if reason := mess.quotas.check(rcvMess.From.ID, role, mediaTypeSerie, serie.Size); reason != "" {
+					deleteUserSession(mess.sessions, rcvMess.From.ID)
+					sendSimpleMessage(bot, rcvMess.Chat.ID, reason)
+					return
+				}
+				if !role.Allows(directAddRole) {
+					deleteUserSession(mess.sessions, rcvMess.From.ID)
+					mess.requests.send(bot, rcvMess.Chat.ID, rcvMess.From, request.Request{Instance: userSession.Instance, Serie: &serie, QualityProfileId: qualityProfileId, RootFolderPath: rootFolderPath})
+					return
+				}
+				if newSerie, added := addSerie(bot, mess.sessions, mess.auditor, rcvMess.Chat.ID, rcvMess.From, sonarrService, serie, qualityProfileId, rootFolderPath); added {
+					mess.quotas.record(rcvMess.From.ID, mediaTypeSerie, userSession.Instance, newSerie.SerieId, newSerie.Size)
+				}
 
 			default:
-				log.Warn().Str("username", rcvMess.From.Username).Str("action", action.String()).Msg("unknown action")
+				log.Warn().Str("username", rcvMess.From.Username).Str("action", userSession.Action.String()).Msg("unknown action")
 			}
 		} else {
 			log.Trace().Str("username", rcvMess.From.Username).Msg("unknown message")
-			sendSimpleMessage(mess.bot, rcvMess.Chat.ID, "I don't understand what you mean.\nPlease use /help to see the commands list.")
+			sendSimpleMessage(bot, rcvMess.Chat.ID, "I don't understand what you mean.\nPlease use /help to see the commands list.")
 		}
 	}
 }
 
 /* Tools */
 
-// sendMoviesList sends the movies list to the user.
-func sendMoviesList(bot *telegram.Bot, rcvMess *telegram.Message, radarrConfig configuration.Radarr) {
-	log.Trace().Str("username", rcvMess.From.Username).Msg("getting movies list")
-	films, err := radarr.GetFilmsList(radarrConfig)
+// sendMoviesList sends the movies list of the instance to the user.
+func sendMoviesList(bot tgclient.Client, codec *types.CallbackCodec, rcvMess *telegram.Message, movies []radarr.MovieService, instance int) {
+	radarrService, ok := getInstance(movies, instance)
+	if !ok {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "Radarr is not configured.\nPlease contact the administrator.")
+		return
+	}
+
+	log.Trace().Str("username", rcvMess.From.Username).Str("instance", radarrService.Name()).Msg("getting movies list")
+	films, err := radarrService.GetFilmsList()
 	if err != nil {
 		log.Err(err).Msg("error when getting movies messages")
 		sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the movies list.\nPlease contact the administrator.")
 		return
 	}
-	messages := printMoviesList(films)
+	messages := printMoviesList(films, getListInstanceName(movies, instance))
 
 	// send the movies list
 	log.Trace().Str("username", rcvMess.From.Username).Msg("sending movies list")
-	keyboard := getMediaListKeyboard(1, len(messages), mediaTypeMovie)
+	keyboard := getMediaListKeyboard(codec, 1, len(messages), mediaTypeMovie, instance)
 	sendMessageWithKeyboard(bot, rcvMess.Chat.ID, messages[0]+printPageNum(1, len(messages)), keyboard)
 }
 
-// sendSeriesList sends the series list to the user.
-func sendSeriesList(bot *telegram.Bot, rcvMess *telegram.Message, sonarrConfig configuration.Sonarr) {
-	log.Trace().Str("username", rcvMess.From.Username).Msg("getting series list")
-	series, err := sonarr.GetSeriesList(sonarrConfig)
+// sendSeriesList sends the series list of the instance to the user.
+func sendSeriesList(bot tgclient.Client, codec *types.CallbackCodec, rcvMess *telegram.Message, series []sonarr.SeriesService, instance int) {
+	sonarrService, ok := getInstance(series, instance)
+	if !ok {
+		sendSimpleMessage(bot, rcvMess.Chat.ID, "Sonarr is not configured.\nPlease contact the administrator.")
+		return
+	}
+
+	log.Trace().Str("username", rcvMess.From.Username).Str("instance", sonarrService.Name()).Msg("getting series list")
+	seriesList, err := sonarrService.GetSeriesList()
 	if err != nil {
 		log.Err(err).Msg("error when getting series messages")
 		sendSimpleMessage(bot, rcvMess.Chat.ID, "An error occurred while getting the series list.\nPlease contact the administrator.")
 		return
 	}
-	messages := printSeriesList(series)
+	messages := printSeriesList(seriesList, getListInstanceName(series, instance))
 
 	// send the series list
 	log.Trace().Str("username", rcvMess.From.Username).Msg("sending series list")
-	keyboard := getMediaListKeyboard(1, len(messages), mediaTypeSerie)
+	keyboard := getMediaListKeyboard(codec, 1, len(messages), mediaTypeSerie, instance)
 	sendMessageWithKeyboard(bot, rcvMess.Chat.ID, messages[0]+printPageNum(1, len(messages)), keyboard)
 }
+
+// addFilm adds the film to the radarr instance, in the root folder, and sends the confirmation to the user.
+// It returns the film added, false if it was not.
+func addFilm(bot tgclient.Client, codec *types.CallbackCodec, sessions session.Store, auditor *auditor, chatID int64, user *telegram.User, radarrService radarr.MovieService, instance int, film radarr.Film, qualityProfileId int64, rootFolderPath string) (radarr.Film, bool) {
+	log.Trace().Str("username", user.Username).Str("movie", film.Title).Str("rootFolder", rootFolderPath).Msg("adding movie to the root folder")
+
+	newFilm, err := radarrService.AddFilm(film, qualityProfileId, rootFolderPath)
+	auditor.record(authentication.User{Id: user.ID, Username: user.Username}, audit.Entry{Action: audit.ActionAddMovie, MediaIds: auditMediaIds(newFilm.MovieId), Media: printAuditMedia(film.Title, film.Year), Instance: radarrService.Name()}, err)
+	if err != nil {
+		log.Err(err).Msg("error when adding movie")
+		sendSimpleMessage(bot, chatID, "An error occurred while adding the movie.\nPlease contact the administrator.")
+		return radarr.Film{}, false
+	}
+
+	// remove the data from the user
+	deleteUserSession(sessions, user.ID)
+
+	// send the confirmation message
+	log.Trace().Str("username", user.Username).Str("movie", film.Title).Msg("movie added")
+	sendMessageWithKeyboard(bot, chatID, "Movie "+newFilm.PrintMovieTitle()+" added ✅\n\n🔗 "+newFilm.PrintLinks(), getFollowDownloadingStatusButtonKeyboard(codec, instance, newFilm.MovieId))
+	return newFilm, true
+}
+
+// addSerie adds the serie to the sonarr instance, in the root folder, and sends the confirmation to the user.
+// It returns the serie added, false if it was not.
+func addSerie(bot tgclient.Client, sessions session.Store, auditor *auditor, chatID int64, user *telegram.User, sonarrService sonarr.SeriesService, serie sonarr.Serie, qualityProfileId int64, rootFolderPath string) (sonarr.Serie, bool) {
+	log.Trace().Str("username", user.Username).Str("serie", serie.Title).Str("rootFolder", rootFolderPath).Msg("adding serie to the root folder")
+
+	newSerie, err := sonarrService.AddSerie(serie, qualityProfileId, rootFolderPath)
+	auditor.record(authentication.User{Id: user.ID, Username: user.Username}, audit.Entry{Action: audit.ActionAddSerie, MediaIds: auditMediaIds(newSerie.SerieId), Media: printAuditMedia(serie.Title, serie.Year), Instance: sonarrService.Name()}, err)
+	if err != nil {
+		log.Err(err).Msg("error when adding serie")
+		sendSimpleMessage(bot, chatID, "An error occurred while adding the serie.\nPlease contact the administrator.")
+		return sonarr.Serie{}, false
+	}
+
+	// remove the data from the user
+	deleteUserSession(sessions, user.ID)
+
+	// send the confirmation message
+	log.Trace().Str("username", user.Username).Str("serie", serie.Title).Msg("serie added")
+	sendSimpleMessage(bot, chatID, "Serie "+newSerie.PrintSerieTitle()+" added ✅\n\n🔗 "+newSerie.PrintLinks())
+	return newSerie, true
+}
@@ -0,0 +1,138 @@
+package updates
+
+import (
+	"telarr/internal/authentication"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// directAddRole is the lowest role adding the medias without the approval of an admin.
+	// The users with a lower role send a request to the admins instead.
+	directAddRole = authentication.RoleManager
+)
+
+var (
+	// commandsRole is the lowest role allowed to use each command, the unknown commands are answered to everyone.
+	commandsRole = map[string]authentication.Role{
+		"start":    authentication.RoleViewer,
+		"help":     authentication.RoleViewer,
+		"me":       authentication.RoleViewer,
+		"stop":     authentication.RoleViewer,
+		"status":   authentication.RoleViewer,
+		"movies":   authentication.RoleViewer,
+		"series":   authentication.RoleViewer,
+		"addmovie": authentication.RoleRequester,
+		"addserie": authentication.RoleRequester,
+		"admin":    authentication.RoleAdmin,
+		"audit":    authentication.RoleAdmin,
+
+		"allowchat":  authentication.RoleAdmin,
+		"revokechat": authentication.RoleAdmin,
+	}
+
+	// userActionsRole is the lowest role allowed to answer each action of a conversation.
+	userActionsRole = map[types.UserAction]authentication.Role{
+		types.UserActionMovieDetails:   authentication.RoleViewer,
+		types.UserActionSerieDetails:   authentication.RoleViewer,
+		types.UserActionLookMovieToAdd: authentication.RoleRequester,
+		types.UserActionLookSerieToAdd: authentication.RoleRequester,
+		types.UserActionAddMovie:       authentication.RoleRequester,
+		types.UserActionAddSerie:       authentication.RoleRequester,
+		types.UserActionRemoveMovie:    authentication.RoleManager,
+		types.UserActionRemoveSerie:    authentication.RoleManager,
+	}
+
+	// callbacksRole is the lowest role allowed to press each button, the unknown buttons are for the admins only.
+	callbacksRole = map[types.CallbackAction]authentication.Role{
+		// browse the libraries
+		types.CallbackNextMovie:                          authentication.RoleViewer,
+		types.CallbackPreviousMovie:                      authentication.RoleViewer,
+		types.CallbackFirstMovie:                         authentication.RoleViewer,
+		types.CallbackLastMovie:                          authentication.RoleViewer,
+		types.CallbackMovieDetails:                       authentication.RoleViewer,
+		types.CallbackBackToMoviesList:                   authentication.RoleViewer,
+		types.CallbackFilmDetails:                        authentication.RoleViewer,
+		types.CallbackCancelRemoveMovie:                  authentication.RoleViewer,
+		types.CallbackFollowDownloadingStatusMovie:       authentication.RoleViewer,
+		types.CallbackRefreshDownloadingStatusMovie:      authentication.RoleViewer,
+		types.CallbackCancelFollowDownloadingStatusMovie: authentication.RoleViewer,
+		types.CallbackNextSerie:                          authentication.RoleViewer,
+		types.CallbackPreviousSerie:                      authentication.RoleViewer,
+		types.CallbackFirstSerie:                         authentication.RoleViewer,
+		types.CallbackLastSerie:                          authentication.RoleViewer,
+		types.CallbackSerieDetails:                       authentication.RoleViewer,
+		types.CallbackBackToSeriesList:                   authentication.RoleViewer,
+		types.CallbackCancelRemoveSerie:                  authentication.RoleViewer,
+		types.CallbackCancel:                             authentication.RoleViewer,
+
+		// add medias
+		types.CallbackAddMovie:            authentication.RoleRequester,
+		types.CallbackNextAddMovie:        authentication.RoleRequester,
+		types.CallbackPreviousAddMovie:    authentication.RoleRequester,
+		types.CallbackEditRequestAddMovie: authentication.RoleRequester,
+		types.CallbackRootFolderAddMovie:  authentication.RoleRequester,
+		types.CallbackAddSerie:            authentication.RoleRequester,
+		types.CallbackNextAddSerie:        authentication.RoleRequester,
+		types.CallbackPreviousAddSerie:    authentication.RoleRequester,
+		types.CallbackEditRequestAddSerie: authentication.RoleRequester,
+		types.CallbackRootFolderAddSerie:  authentication.RoleRequester,
+
+		// remove medias with their files
+		types.CallbackRemoveMovie:        authentication.RoleManager,
+		types.CallbackConfirmRemoveMovie: authentication.RoleManager,
+		types.CallbackRemoveSerie:        authentication.RoleManager,
+		types.CallbackConfirmRemoveSerie: authentication.RoleManager,
+
+		// manage the movies of the library
+		types.CallbackSearchFilm:            authentication.RoleManager,
+		types.CallbackRefreshFilm:           authentication.RoleManager,
+		types.CallbackToggleMonitoredFilm:   authentication.RoleManager,
+		types.CallbackQualityProfilesFilm:   authentication.RoleManager,
+		types.CallbackSetQualityProfileFilm: authentication.RoleManager,
+
+		// download the releases chosen instead of the ones radarr picks
+		types.CallbackSearchReleases: authentication.RoleManager,
+		types.CallbackReleasesPage:   authentication.RoleManager,
+		types.CallbackGrabRelease:    authentication.RoleManager,
+
+		// handle the requests of the users
+		types.CallbackApproveRequest: authentication.RoleAdmin,
+		types.CallbackRejectRequest:  authentication.RoleAdmin,
+	}
+)
+
+// commandAllowed returns true if the role can use the command.
+func commandAllowed(role authentication.Role, command string) bool {
+	required, found := commandsRole[command]
+	if !found {
+		return true
+	}
+	return role.Allows(required)
+}
+
+// userActionAllowed returns true if the role can answer the action of the conversation.
+func userActionAllowed(role authentication.Role, action types.UserAction) bool {
+	required, found := userActionsRole[action]
+	if !found {
+		required = authentication.RoleAdmin
+	}
+	return role.Allows(required)
+}
+
+// callbackAllowed returns true if the role can press the button.
+func callbackAllowed(role authentication.Role, action types.CallbackAction) bool {
+	required, found := callbacksRole[action]
+	if !found {
+		required = authentication.RoleAdmin
+	}
+	return role.Allows(required)
+}
+
+// sendNotAllowed tells the user that its role doesn't allow the action.
+func sendNotAllowed(bot tgclient.Client, chatID int64, username string, role authentication.Role, action string) {
+	log.Warn().Str("username", username).Str("role", role.String()).Str("action", action).Msg("action not allowed")
+	sendSimpleMessage(bot, chatID, "🚫 You are not allowed to do this.\nYour role is *"+role.String()+"*, please contact the administrator.")
+}
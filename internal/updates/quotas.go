@@ -0,0 +1,306 @@
+package updates
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"telarr/configuration"
+	"telarr/internal/authentication"
+	"telarr/internal/quota"
+	"telarr/internal/request"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// quotas is the struct designed to count the additions of the users and to enforce their quotas.
+type quotas struct {
+	ledger *quota.Ledger
+	// requests are the pending requests, counted in the quotas of their users.
+	requests *request.Store
+
+	// services are the instances to get the size of the medias, and the quotas of the configuration.
+	services *atomic.Pointer[services]
+}
+
+const (
+	// releaseAddition is the media of the additions of the releases grabbed for a movie already added,
+	// they only count in the size of the quota.
+	releaseAddition mediaType = "release"
+
+	// quotaSizesInterval is the interval between two reads of the sizes of the medias added, once downloaded.
+	quotaSizesInterval = 10 * time.Minute
+
+	// defaultMovieEstimate is the size in GB counted for a movie not downloaded yet, when quotas.estimates.movie is not set.
+	defaultMovieEstimate = 10
+	// defaultSerieEstimate is the size in GB counted for a serie not downloaded yet, when quotas.estimates.serie is not set.
+	defaultSerieEstimate = 50
+)
+
+// quotaUsage is what a user added in the periods of its quota, with its pending requests.
+type quotaUsage struct {
+	movies int
+	series int
+	// size is the size in GB of the releases of the medias added, estimated for the medias not downloaded yet.
+	size float64
+	// estimated is the number of medias whose size is estimated.
+	estimated int
+	// pending is the number of pending requests of the user, counted in the movies and the series.
+	pending int
+}
+
+// quotaOf returns the quota of the user: its own one or the one of its role, false if it is unlimited.
+func quotaOf(config configuration.Quotas, userId int, role authentication.Role) (configuration.Quota, bool) {
+	if role == authentication.RoleAdmin {
+		return configuration.Quota{}, false
+	}
+	if q, found := config.Users[userId]; found {
+		return q, true
+	}
+	q, found := config.Roles[role.String()]
+	return q, found
+}
+
+// estimate returns the size in GB to count for the media, its estimated size if its size is not known yet.
+// The second value is true if the size is estimated.
+func estimate(config configuration.Estimates, media mediaType, size float64) (float64, bool) {
+	if size > 0 {
+		return size, false
+	}
+	switch media {
+	case mediaTypeMovie:
+		if config.Movie > 0 {
+			return config.Movie, true
+		}
+		return defaultMovieEstimate, true
+	case mediaTypeSerie:
+		if config.Serie > 0 {
+			return config.Serie, true
+		}
+		return defaultSerieEstimate, true
+	}
+	return size, false
+}
+
+// add counts the size of the media in the usage, its estimated size if it is not downloaded yet.
+func (u *quotaUsage) add(config configuration.Estimates, media mediaType, size float64) {
+	size, estimated := estimate(config, media, size)
+	u.size += size
+	if estimated {
+		u.estimated++
+	}
+}
+
+// usage returns what the user added in the periods of the quota, the pending requests of the user included.
+// The medias not downloaded yet count for their estimated size, until refreshSizes saves their size.
+func (q *quotas) usage(userId int, quota configuration.Quota) quotaUsage {
+	estimates := q.services.Load().quotas.Estimates
+	var u quotaUsage
+	if quota.Movies.Enabled() {
+		u.movies = len(q.ledger.Since(userId, string(mediaTypeMovie), time.Now().Add(-quota.Movies.Period)))
+	}
+	if quota.Series.Enabled() {
+		u.series = len(q.ledger.Since(userId, string(mediaTypeSerie), time.Now().Add(-quota.Series.Period)))
+	}
+	if quota.Size.Enabled() {
+		for _, a := range q.ledger.Since(userId, "", time.Now().Add(-quota.Size.Period)) {
+			u.add(estimates, mediaType(a.Media), a.Size)
+		}
+	}
+
+	// the pending requests would be over the quota once approved
+	for _, r := range q.requests.List() {
+		if r.UserId != userId {
+			continue
+		}
+		u.pending++
+		switch {
+		case r.Film != nil:
+			u.movies++
+			if quota.Size.Enabled() {
+				u.add(estimates, mediaTypeMovie, r.Film.Size)
+			}
+		case r.Serie != nil:
+			u.series++
+			if quota.Size.Enabled() {
+				u.add(estimates, mediaTypeSerie, r.Serie.Size)
+			}
+		}
+	}
+	return u
+}
+
+// check returns an empty string if the user can add a media of the type with the size in GB (0 if unknown),
+// the message explaining why not otherwise. A movie or a serie of unknown size counts for its estimated size.
+func (q *quotas) check(userId int, role authentication.Role, media mediaType, size float64) string {
+	config := q.services.Load().quotas
+	quota, limited := quotaOf(config, userId, role)
+	if !limited {
+		return ""
+	}
+
+	u := q.usage(userId, quota)
+	size, estimated := estimate(config.Estimates, media, size)
+	switch {
+	case media == mediaTypeMovie && quota.Movies.Enabled() && float64(u.movies) >= quota.Movies.Max:
+		return "🚫 You have reached your quota of " + printLimit(quota.Movies, "movies") + ".\nPlease try again later or ask an administrator."
+	case media == mediaTypeSerie && quota.Series.Enabled() && float64(u.series) >= quota.Series.Max:
+		return "🚫 You have reached your quota of " + printLimit(quota.Series, "series") + ".\nPlease try again later or ask an administrator."
+	case quota.Size.Enabled() && u.size >= quota.Size.Max:
+		return "🚫 You have reached your quota of " + printLimit(quota.Size, "GB") + ".\nPlease try again later or ask an administrator."
+	case quota.Size.Enabled() && u.size+size > quota.Size.Max && media == releaseAddition:
+		return "🚫 This release of " + strconv.FormatFloat(size, 'f', 2, 64) + " GB is over your quota of " + printLimit(quota.Size, "GB") + ".\nPlease select a smaller one or ask an administrator."
+	case quota.Size.Enabled() && u.size+size > quota.Size.Max && estimated:
+		return "🚫 A " + string(media) + " counts for " + strconv.FormatFloat(size, 'f', -1, 64) + " GB until it is downloaded, it is over your quota of " + printLimit(quota.Size, "GB") + ".\nPlease try again later or ask an administrator."
+	case quota.Size.Enabled() && u.size+size > quota.Size.Max:
+		return "🚫 This " + string(media) + " of " + strconv.FormatFloat(size, 'f', 2, 64) + " GB is over your quota of " + printLimit(quota.Size, "GB") + ".\nPlease try again later or ask an administrator."
+	}
+	return ""
+}
+
+// record counts the media added by the user in its quota, with the size in GB of its release (0 if unknown).
+func (q *quotas) record(userId int, media mediaType, instance int, mediaId int64, size float64) {
+	err := q.ledger.Record(quota.Addition{UserId: userId, Media: string(media), Instance: instance, MediaId: mediaId, Size: size})
+	if err != nil {
+		log.Err(err).Int("userId", userId).Msg("error when saving the additions for the quotas")
+	}
+}
+
+// watchSizes saves the sizes of the medias added once they are downloaded, until the context is done.
+// The libraries are read in the background, the checks of the quotas only read the ledger.
+func (q *quotas) watchSizes(ctx context.Context) {
+	ticker := time.NewTicker(quotaSizesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.refreshSizes()
+		}
+	}
+}
+
+// refreshSizes saves the sizes of the medias added in the longest period of the size quotas, whose size is not known yet.
+// The library of an instance is read once, only if one of its medias has no size.
+func (q *quotas) refreshSizes() {
+	srv := q.services.Load()
+	period := maxSizePeriod(srv.quotas)
+	if period == 0 {
+		return
+	}
+
+	sizes := make(map[string]map[int64]float64)
+	for _, a := range q.ledger.Unsized(time.Now().Add(-period)) {
+		if mediaType(a.Media) == releaseAddition {
+			continue
+		}
+		key := a.Media + strconv.Itoa(a.Instance)
+		if _, read := sizes[key]; !read {
+			sizes[key] = librarySizes(srv, mediaType(a.Media), a.Instance)
+		}
+		size := sizes[key][a.MediaId]
+		if size == 0 {
+			continue
+		}
+		err := q.ledger.SetSize(a.Media, a.Instance, a.MediaId, size)
+		if err != nil {
+			log.Err(err).Msg("error when saving the sizes for the quotas")
+			return
+		}
+	}
+}
+
+// maxSizePeriod returns the longest period of the size quotas, 0 if there is none.
+func maxSizePeriod(config configuration.Quotas) time.Duration {
+	var period time.Duration
+	for _, q := range config.Roles {
+		if q.Size.Enabled() {
+			period = max(period, q.Size.Period)
+		}
+	}
+	for _, q := range config.Users {
+		if q.Size.Enabled() {
+			period = max(period, q.Size.Period)
+		}
+	}
+	return period
+}
+
+// librarySizes returns the sizes in GB of the medias of the instance, by id.
+func librarySizes(srv *services, media mediaType, instance int) map[int64]float64 {
+	sizes := make(map[int64]float64)
+	switch media {
+	case mediaTypeMovie:
+		radarrService, ok := getInstance(srv.movies, instance)
+		if !ok {
+			return sizes
+		}
+		films, err := radarrService.GetFilmsList()
+		if err != nil {
+			log.Err(err).Msg("error when getting the movies list for the quotas")
+			return sizes
+		}
+		for _, film := range films {
+			sizes[film.MovieId] = film.Size
+		}
+	case mediaTypeSerie:
+		sonarrService, ok := getInstance(srv.series, instance)
+		if !ok {
+			return sizes
+		}
+		series, err := sonarrService.GetSeriesList()
+		if err != nil {
+			log.Err(err).Msg("error when getting the series list for the quotas")
+			return sizes
+		}
+		for _, serie := range series {
+			sizes[serie.SerieId] = serie.Size
+		}
+	}
+	return sizes
+}
+
+// print returns the remaining quota of the user.
+func (q *quotas) print(userId int, role authentication.Role) string {
+	quota, limited := quotaOf(q.services.Load().quotas, userId, role)
+	if !limited || (!quota.Movies.Enabled() && !quota.Series.Enabled() && !quota.Size.Enabled()) {
+		return "Quota: unlimited ♾"
+	}
+
+	u := q.usage(userId, quota)
+	str := "Quota:"
+	if quota.Movies.Enabled() {
+		str += "\n\t🎬 " + strconv.Itoa(u.movies) + "/" + printLimit(quota.Movies, "movies")
+	}
+	if quota.Series.Enabled() {
+		str += "\n\t📺 " + strconv.Itoa(u.series) + "/" + printLimit(quota.Series, "series")
+	}
+	if quota.Size.Enabled() {
+		str += "\n\t💾 " + strconv.FormatFloat(u.size, 'f', 2, 64) + "/" + printLimit(quota.Size, "GB")
+		if u.estimated > 0 {
+			str += "\n\t📐 " + strconv.Itoa(u.estimated) + " medias not downloaded yet counted for their estimated size"
+		}
+	}
+	if u.pending > 0 {
+		str += "\n\t⏳ " + strconv.Itoa(u.pending) + " pending requests counted"
+	}
+	return str
+}
+
+// printLimit returns the limit with its unit and period, e.g. "5 movies per 7 days".
+func printLimit(limit configuration.Limit, unit string) string {
+	return strconv.FormatFloat(limit.Max, 'f', -1, 64) + " " + unit + " per " + printPeriod(limit.Period)
+}
+
+// printPeriod returns the period in days when it is a number of days, as a duration otherwise.
+func printPeriod(period time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case period == day:
+		return "day"
+	case period%day == 0:
+		return strconv.Itoa(int(period/day)) + " days"
+	}
+	return period.String()
+}
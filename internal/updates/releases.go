@@ -0,0 +1,142 @@
+package updates
+
+import (
+	"strconv"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/radarr"
+	"telarr/internal/session"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// releasesPerPage is the number of releases in a page of the search results.
+	releasesPerPage = 5
+)
+
+// searchReleases searches the releases of the movie of the button, and sends the first page of the results.
+// The releases are kept in the session of the user, to show the other pages and grab one.
+func searchReleases(bot tgclient.Client, codec *types.CallbackCodec, sessions session.Store, rcvCallback *telegram.CallbackQuery, radarrService radarr.MovieService, data types.CallbackData) {
+	chatID := rcvCallback.Message.Chat.ID
+
+	movieName, err := radarrService.GetMovieName(int(data.MediaId))
+	if err != nil {
+		log.Err(err).Int64("movieId", data.MediaId).Msg("error when getting movie name")
+		sendSimpleMessage(bot, chatID, "An error occurred while searching the releases.\nPlease contact the administrator.")
+		return
+	}
+
+	// the indexers may take a while to answer, the next updates of the user wait for the search as they are handled in order
+	messId := sendSimpleMessage(bot, chatID, "🔎 Searching the releases of *"+movieName+"*...\nIt may take a minute, your next messages will be answered once the search is done.")
+	if messId < 0 {
+		return
+	}
+
+	releases, err := radarrService.SearchReleases(int(data.MediaId))
+	if err != nil {
+		log.Err(err).Int64("movieId", data.MediaId).Msg("error when searching releases")
+		editSimpleMessage(bot, chatID, messId, "An error occurred while searching the releases.\nPlease contact the administrator.")
+		return
+	}
+	if len(releases) == 0 {
+		editSimpleMessage(bot, chatID, messId, "No release found for *"+movieName+"*.")
+		return
+	}
+	log.Debug().Str("movieName", movieName).Int("releases", len(releases)).Str("username", rcvCallback.From.Username).Msg("releases found")
+
+	setUserSession(sessions, rcvCallback.From.ID, session.Session{Instance: data.Instance, Releases: releases, CurrPage: 1})
+	editReleasesPage(bot, codec, chatID, messId, releases, data.Instance, data.MediaId, 1)
+}
+
+// editReleasesPage replaces the message with a page of the releases, with a button to grab each of them.
+func editReleasesPage(bot tgclient.Client, codec *types.CallbackCodec, chatID int64, messageID int, releases []radarr.Release, instance int, movieId int64, pageNb int) {
+	totalPages := (len(releases) + releasesPerPage - 1) / releasesPerPage
+	pageNb = min(max(pageNb, 1), totalPages)
+	start := (pageNb - 1) * releasesPerPage
+	end := min(start+releasesPerPage, len(releases))
+
+	text := "🔎 *" + strconv.Itoa(len(releases)) + " releases found*\n"
+	var grabRow []*telegram.InlineKeyboardButton
+	for i := start; i < end; i++ {
+		text += "\n" + printRelease(i+1, releases[i])
+		grabRow = append(grabRow, newCallbackButton(codec, "⬇️ "+strconv.Itoa(i+1), types.CallbackData{Action: types.CallbackGrabRelease, Instance: instance, MediaId: movieId, Arg: int64(i + 1)}))
+	}
+	text += "\nSelect the release to download:"
+	if totalPages > 1 {
+		text += printPageNum(pageNb, totalPages)
+	}
+
+	rows := [][]*telegram.InlineKeyboardButton{grabRow}
+	var navRow []*telegram.InlineKeyboardButton
+	if pageNb > 1 {
+		navRow = append(navRow, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackReleasesPage, Instance: instance, MediaId: movieId, Page: pageNb - 1}))
+	}
+	if pageNb < totalPages {
+		navRow = append(navRow, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackReleasesPage, Instance: instance, MediaId: movieId, Page: pageNb + 1}))
+	}
+	if len(navRow) > 0 {
+		rows = append(rows, navRow)
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancel})))
+	keyboard := telegram.NewInlineKeyboardMarkup(rows...)
+	editMessageWithKeyboard(bot, chatID, messageID, text, &keyboard)
+}
+
+// grabRelease sends the release of the button to the download client,
+// and replaces the message with the button to follow the downloading status of the movie.
+// The size of the release is counted in the quota of the user.
+func grabRelease(bot tgclient.Client, codec *types.CallbackCodec, sessions session.Store, quotas *quotas, auditor *auditor, rcvCallback *telegram.CallbackQuery, role authentication.Role, radarrService radarr.MovieService, releases []radarr.Release, data types.CallbackData) {
+	msg := rcvCallback.Message
+	if data.Arg < 1 || data.Arg > int64(len(releases)) {
+		log.Warn().Str("username", rcvCallback.From.Username).Int64("release", data.Arg).Msg("release out of range")
+		return
+	}
+	release := releases[data.Arg-1]
+
+	if reason := quotas.check(rcvCallback.From.ID, role, releaseAddition, release.Size); reason != "" {
+		sendSimpleMessage(bot, msg.Chat.ID, reason)
+		return
+	}
+	err := radarrService.GrabRelease(release)
+	auditor.record(authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}, audit.Entry{Action: audit.ActionGrabRelease, MediaIds: []int64{data.MediaId}, Media: release.Title, Instance: radarrService.Name()}, err)
+	if err != nil {
+		log.Err(err).Str("release", release.Title).Msg("error when grabbing release")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while grabbing the release.\nThe search may have expired, please search the releases again.")
+		return
+	}
+
+	log.Debug().Str("release", release.Title).Str("username", rcvCallback.From.Username).Msg("release grabbed successfully")
+	quotas.record(rcvCallback.From.ID, releaseAddition, data.Instance, data.MediaId, release.Size)
+	deleteUserSession(sessions, rcvCallback.From.ID)
+
+	keyboard := getFollowDownloadingStatusButtonKeyboard(codec, data.Instance, data.MediaId)
+	editMessageWithKeyboard(bot, msg.Chat.ID, msg.ID, "Release grabbed ✅\n"+escapeMarkdown(release.Title)+"\n\nIt is sent to the download client.", &keyboard)
+}
+
+// checkReleases checks that the releases of the session are the ones of the movie and the instance of the button,
+// the user may have searched another movie since, and the ids of the movies are not unique across the instances.
+func checkReleases(bot tgclient.Client, user *telegram.User, currentMsg *telegram.Message, userSession session.Session, data types.CallbackData) bool {
+	releases := userSession.Releases
+	if len(releases) == 0 || releases[0].MovieId != data.MediaId || userSession.Instance != data.Instance {
+		log.Warn().Str("username", user.Username).Int64("movieId", data.MediaId).Int("instance", data.Instance).Msg("no releases found")
+		bot.DeleteMessage(currentMsg.Chat.ID, currentMsg.ID)
+		sendSimpleMessage(bot, currentMsg.Chat.ID, "Request timed out.\nPlease try again.")
+		return false
+	}
+	return true
+}
+
+// printRelease returns the release with its number, quality, size, indexer, seeders, age and rejection reasons.
+func printRelease(nb int, r radarr.Release) string {
+	str := "*" + strconv.Itoa(nb) + ".* " + escapeMarkdown(r.Title) + "\n"
+	str += "📺 " + escapeMarkdown(r.Quality) + " | 💾 " + strconv.FormatFloat(r.Size, 'f', 2, 64) + " GB | 🔍 " + escapeMarkdown(r.Indexer) + "\n"
+	str += "🌱 " + r.PrintSeeders() + " | 📅 " + r.PrintAge() + "\n"
+	for _, rejection := range r.Rejections {
+		str += "⚠️ " + escapeMarkdown(rejection) + "\n"
+	}
+	return str
+}
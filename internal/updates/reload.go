@@ -0,0 +1,161 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"os"
+	"telarr/configuration"
+	"telarr/internal/radarr"
+	"telarr/internal/sonarr"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// watchInterval is the time between two checks of the configuration and authorization files.
+	watchInterval = 5 * time.Second
+)
+
+// services are the instances and the settings that can be reloaded while the bot is running.
+// They are never modified, a reload stores new ones.
+type services struct {
+	// movies and series are the instances managing the libraries.
+	movies []radarr.MovieService
+	series []sonarr.SeriesService
+
+	wolConfig        configuration.WakeOnLan
+	pathForDiskUsage string
+	quotas           configuration.Quotas
+	invites          configuration.Invites
+}
+
+// newServices creates the services of the configuration.
+func newServices(config configuration.Configuration) *services {
+	srv := &services{
+		wolConfig:        config.WakeOnLan,
+		pathForDiskUsage: config.PathForDiskUsage,
+		quotas:           config.Quotas,
+		invites:          config.Invites,
+	}
+	for _, instance := range config.Radarr {
+		srv.movies = append(srv.movies, radarr.New(instance))
+	}
+	for _, instance := range config.Sonarr {
+		srv.series = append(srv.series, sonarr.New(instance))
+	}
+	return srv
+}
+
+// Reload reads the configuration and the authorization files again and applies them without stopping the bot.
+// An invalid file is rejected and logged, the running settings are kept.
+func (upd *Updates) Reload() error {
+	return errors.Join(upd.reloadConfiguration(), upd.reloadAuth())
+}
+
+// reloadConfiguration reads the configuration file again and swaps the services.
+// The conversations in progress are kept, the ones about a removed instance end with an error message.
+// The telegram token, the webhook, the sessions, the auth store and the audit log settings are only applied after a restart.
+func (upd *Updates) reloadConfiguration() error {
+	upd.reloadMu.Lock()
+	defer upd.reloadMu.Unlock()
+
+	config, err := configuration.GetConfiguration()
+	if err != nil {
+		log.Err(err).Msg("the new configuration is invalid, keeping the running one")
+		return err
+	}
+
+	// the bot, the webhook, the sessions store, the auth store and the audit log are not recreated
+	if config.Telegram.Token != upd.config.Telegram.Token || config.Telegram.Webhook != upd.config.Telegram.Webhook || config.Session != upd.config.Session || config.Auth != upd.config.Auth || config.Audit != upd.config.Audit {
+		log.Warn().Msg("the telegram token, the webhook, the sessions, the auth and the audit settings are only applied after a restart")
+		config.Telegram.Token = upd.config.Telegram.Token
+		config.Telegram.Webhook = upd.config.Telegram.Webhook
+		config.Session = upd.config.Session
+		config.Auth = upd.config.Auth
+		config.Audit = upd.config.Audit
+	}
+
+	upd.services.Store(newServices(config))
+	upd.auth.SetConfiguration(config)
+	upd.config = config
+
+	log.Info().Int("radarr", len(config.Radarr)).Int("sonarr", len(config.Sonarr)).Msg("configuration reloaded")
+	return nil
+}
+
+// reloadAuth reads the users lists again.
+func (upd *Updates) reloadAuth() error {
+	err := upd.auth.Reload()
+	if err != nil {
+		log.Err(err).Msg("the authorization files are invalid, keeping the running users lists")
+		return err
+	}
+
+	log.Info().Msg("authorization files reloaded")
+	return nil
+}
+
+// watchFiles reloads the configuration or the users lists when their files change, until the context is done.
+// The files are polled, as the file system events are not always received through the docker volumes.
+func (upd *Updates) watchFiles(ctx context.Context) {
+	configFile := newWatchedFiles(configuration.FilePath())
+	authFiles := newWatchedFiles(upd.auth.FilesPaths()...)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if configFile.changed() {
+				log.Info().Str("filePath", configuration.FilePath()).Msg("configuration file changed")
+				upd.reloadConfiguration()
+			}
+			if authFiles.changed() {
+				log.Info().Msg("authorization files changed")
+				upd.reloadAuth()
+			}
+		}
+	}
+}
+
+// fileState is what is compared to know if a file changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFiles are files with their last known state.
+type watchedFiles map[string]fileState
+
+func newWatchedFiles(paths ...string) watchedFiles {
+	w := make(watchedFiles)
+	for _, p := range paths {
+		w[p] = statFile(p)
+	}
+	return w
+}
+
+// changed updates the states of the files and returns true if at least one of them changed.
+func (w watchedFiles) changed() bool {
+	changed := false
+	for p, state := range w {
+		newState := statFile(p)
+		if newState != state {
+			w[p] = newState
+			changed = true
+		}
+	}
+	return changed
+}
+
+// statFile returns the state of the file, the zero state if it doesn't exist.
+func statFile(p string) fileState {
+	info, err := os.Stat(p)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
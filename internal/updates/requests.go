@@ -0,0 +1,230 @@
+package updates
+
+import (
+	"errors"
+	"sync/atomic"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/request"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.com/toby3d/telegram"
+)
+
+// requests is the struct designed to record the additions asked by the users and to apply the decisions of the admins.
+type requests struct {
+	bot   tgclient.Client
+	codec *types.CallbackCodec
+	auth  *authentication.Auth
+	store *request.Store
+
+	// quotas counts the medias of the approved requests.
+	quotas *quotas
+	// auditor records the requests and the decisions of the admins.
+	auditor *auditor
+
+	// services are the instances the approved medias are added to.
+	services *atomic.Pointer[services]
+}
+
+// send records the request of the user and notifies all the admins, with the buttons to approve or reject it.
+// The outcome is sent to the chat and the forum topic the user sent the request from.
+func (req *requests) send(bot tgclient.Client, chatID int64, user *telegram.User, r request.Request) {
+	r.UserId = user.ID
+	r.Username = user.Username
+	r.ChatId = chatID
+	r.ThreadId = tgclient.ThreadID(bot, chatID)
+
+	r, err := req.store.Add(r)
+	req.auditor.record(authentication.User{Id: user.ID, Username: user.Username}, req.auditEntry(audit.ActionRequest, r, 0), err)
+	if err != nil {
+		log.Err(err).Str("username", user.Username).Msg("error when saving the request")
+		sendSimpleMessage(bot, chatID, "An error occurred while sending the request.\nPlease contact the administrator.")
+		return
+	}
+	log.Info().Str("username", user.Username).Int64("requestId", r.Id).Str("media", r.Title()).Msg("new request")
+
+	// notify the admins
+	text := "📬 *New request* from " + escapeMarkdown(printRequester(r)) + "\n\n" + r.Title()
+	if instanceName := req.instanceName(r); instanceName != "" {
+		text += "\nInstance: " + instanceName
+	}
+	keyboard := getRequestKeyboard(req.codec, r.Id)
+	var notifications []request.Notification
+	for _, admin := range req.auth.GetAdmins() {
+		messageID := sendMessageWithKeyboard(req.bot, int64(admin.Id), text, keyboard)
+		if messageID > 0 {
+			notifications = append(notifications, request.Notification{ChatId: int64(admin.Id), MessageId: messageID})
+		}
+	}
+	if len(notifications) == 0 {
+		log.Warn().Int64("requestId", r.Id).Msg("no admin notified of the request")
+	}
+	err = req.store.SetNotifications(r.Id, notifications)
+	if err != nil {
+		log.Err(err).Int64("requestId", r.Id).Msg("error when saving the notifications of the request")
+	}
+
+	sendSimpleMessage(bot, chatID, "Your request for "+r.Title()+" was sent to the administrators ⏳\nYou will be notified of their decision.")
+}
+
+// handle approves or rejects the request, tells the requester and replaces the notifications of all the admins with the outcome.
+func (req *requests) handle(bot tgclient.Client, rcvCallback *telegram.CallbackQuery, data types.CallbackData) {
+	msg := rcvCallback.Message
+
+	// the request is taken so two admins can't handle it at the same time
+	r, err := req.store.Take(data.Arg)
+	if errors.Is(err, request.ErrRequestNotFound) {
+		editSimpleMessage(bot, msg.Chat.ID, msg.ID, "This request was already handled.")
+		return
+	}
+	if err != nil {
+		log.Err(err).Int64("requestId", data.Arg).Msg("error when saving the requests")
+		sendSimpleMessage(bot, msg.Chat.ID, "An error occurred while saving the requests.\nPlease contact the administrator.")
+		return
+	}
+
+	adminUser := authentication.User{Id: rcvCallback.From.ID, Username: rcvCallback.From.Username}
+	admin := escapeMarkdown(printUser(adminUser))
+	var outcome string
+	switch data.Action {
+	case types.CallbackApproveRequest:
+		ok := req.add(bot, r, adminUser, msg.Chat.ID)
+		if !ok {
+			// the request stays pending, the admin can try again
+			err = req.store.Restore(r)
+			if err != nil {
+				log.Err(err).Int64("requestId", r.Id).Msg("error when restoring the request")
+			}
+			return
+		}
+		outcome = "✅ Approved by " + admin
+	case types.CallbackRejectRequest:
+		req.auditor.record(adminUser, req.auditEntry(audit.ActionRejectRequest, r, 0), nil)
+		sendSimpleMessage(req.requester(r), r.ChatId, "Your request for "+r.Title()+" was rejected ❌")
+		outcome = "❌ Rejected by " + admin
+	}
+	log.Info().Str("username", rcvCallback.From.Username).Int64("requestId", r.Id).Str("action", data.Action.String()).Msg("request handled")
+
+	text := outcome + "\n\n" + r.Title() + "\nRequested by " + escapeMarkdown(printRequester(r))
+	for _, n := range r.Notifications {
+		editSimpleMessage(req.bot, n.ChatId, n.MessageId, text)
+	}
+}
+
+// add adds the media of the request to its instance and tells the requester, it returns false if the media wasn't added.
+// The addition is recorded in the audit log as done by the admin approving the request.
+// The quota of the requester is checked again, it may have been used since the request was sent.
+func (req *requests) add(bot tgclient.Client, r request.Request, admin authentication.User, adminChatID int64) bool {
+	srv := req.services.Load()
+
+	switch {
+	case r.Film != nil:
+		radarrService, ok := getInstance(srv.movies, r.Instance)
+		if !ok {
+			log.Warn().Int64("requestId", r.Id).Int("instance", r.Instance).Msg("radarr instance not found")
+			sendSimpleMessage(bot, adminChatID, "The radarr instance of this request doesn't exist anymore.")
+			return false
+		}
+		if !req.checkQuota(bot, r, mediaTypeMovie, r.Film.Size, adminChatID) {
+			return false
+		}
+		newFilm, err := radarrService.AddFilm(*r.Film, r.QualityProfileId, r.RootFolderPath)
+		req.auditor.record(admin, req.auditEntry(audit.ActionApproveRequest, r, newFilm.MovieId), err)
+		if err != nil {
+			log.Err(err).Int64("requestId", r.Id).Msg("error when adding movie")
+			sendSimpleMessage(bot, adminChatID, "An error occurred while adding the movie.\nPlease contact the administrator.")
+			return false
+		}
+		req.quotas.record(r.UserId, mediaTypeMovie, r.Instance, newFilm.MovieId, newFilm.Size)
+		sendMessageWithKeyboard(req.requester(r), r.ChatId, "Your request was approved ✅\nMovie "+newFilm.PrintMovieTitle()+" added\n\n🔗 "+newFilm.PrintLinks(), getFollowDownloadingStatusButtonKeyboard(req.codec, r.Instance, newFilm.MovieId))
+	case r.Serie != nil:
+		sonarrService, ok := getInstance(srv.series, r.Instance)
+		if !ok {
+			log.Warn().Int64("requestId", r.Id).Int("instance", r.Instance).Msg("sonarr instance not found")
+			sendSimpleMessage(bot, adminChatID, "The sonarr instance of this request doesn't exist anymore.")
+			return false
+		}
+		if !req.checkQuota(bot, r, mediaTypeSerie, r.Serie.Size, adminChatID) {
+			return false
+		}
+		newSerie, err := sonarrService.AddSerie(*r.Serie, r.QualityProfileId, r.RootFolderPath)
+		req.auditor.record(admin, req.auditEntry(audit.ActionApproveRequest, r, newSerie.SerieId), err)
+		if err != nil {
+			log.Err(err).Int64("requestId", r.Id).Msg("error when adding serie")
+			sendSimpleMessage(bot, adminChatID, "An error occurred while adding the serie.\nPlease contact the administrator.")
+			return false
+		}
+		req.quotas.record(r.UserId, mediaTypeSerie, r.Instance, newSerie.SerieId, newSerie.Size)
+		sendSimpleMessage(req.requester(r), r.ChatId, "Your request was approved ✅\nSerie "+newSerie.PrintSerieTitle()+" added\n\n🔗 "+newSerie.PrintLinks())
+	default:
+		log.Warn().Int64("requestId", r.Id).Msg("request without media")
+		return false
+	}
+	return true
+}
+
+// checkQuota returns true if the requester can still add the media of the request, it tells the admin why not otherwise.
+// The request is taken, so it is not counted in the pending requests of the requester.
+func (req *requests) checkQuota(bot tgclient.Client, r request.Request, media mediaType, size float64, adminChatID int64) bool {
+	role, _ := req.auth.GetRole(r.UserId)
+	if reason := req.quotas.check(r.UserId, role, media, size); reason != "" {
+		log.Info().Int64("requestId", r.Id).Int("userId", r.UserId).Msg("quota of the requester reached")
+		sendSimpleMessage(bot, adminChatID, "⚠️ "+escapeMarkdown(printRequester(r))+" has reached the quota, the request stays pending.\nReject it, or approve it once the quota allows it.")
+		return false
+	}
+	return true
+}
+
+// requester returns the bot sending the messages to the forum topic of the request.
+func (req *requests) requester(r request.Request) tgclient.Client {
+	return tgclient.InThread(req.bot, r.ChatId, r.ThreadId)
+}
+
+// instanceName returns the name of the instance of the request, empty if there is only one instance.
+func (req *requests) instanceName(r request.Request) string {
+	srv := req.services.Load()
+	if r.Film != nil {
+		return getListInstanceName(srv.movies, r.Instance)
+	}
+	return getListInstanceName(srv.series, r.Instance)
+}
+
+// auditEntry returns the entry of the action on the request, with the id of the media added if any.
+func (req *requests) auditEntry(action audit.Action, r request.Request, mediaId int64) audit.Entry {
+	e := audit.Entry{Action: action, MediaIds: auditMediaIds(mediaId)}
+	srv := req.services.Load()
+	switch {
+	case r.Film != nil:
+		e.Media = printAuditMedia(r.Film.Title, r.Film.Year)
+		if radarrService, ok := getInstance(srv.movies, r.Instance); ok {
+			e.Instance = radarrService.Name()
+		}
+	case r.Serie != nil:
+		e.Media = printAuditMedia(r.Serie.Title, r.Serie.Year)
+		if sonarrService, ok := getInstance(srv.series, r.Instance); ok {
+			e.Instance = sonarrService.Name()
+		}
+	}
+	if action != audit.ActionRequest {
+		e.Media += " requested by " + printRequester(r)
+	}
+	return e
+}
+
+// getRequestKeyboard returns the keyboard to approve or reject the request.
+func getRequestKeyboard(codec *types.CallbackCodec, requestId int64) telegram.InlineKeyboardMarkup {
+	return telegram.NewInlineKeyboardMarkup(
+		telegram.NewInlineKeyboardRow(
+			newCallbackButton(codec, "✅ Approve", types.CallbackData{Action: types.CallbackApproveRequest, Arg: requestId}),
+			newCallbackButton(codec, "❌ Reject", types.CallbackData{Action: types.CallbackRejectRequest, Arg: requestId}),
+		),
+	)
+}
+
+// printRequester returns the username of the user who sent the request, or its id if it has none.
+func printRequester(r request.Request) string {
+	return printUser(authentication.User{Id: r.UserId, Username: r.Username})
+}
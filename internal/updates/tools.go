@@ -3,9 +3,8 @@ package updates
 import (
 	"errors"
 	"sort"
-	"strconv"
-	"strings"
 	"syscall"
+	"telarr/internal/radarr"
 	"telarr/internal/types"
 
 	"github.com/rs/zerolog/log"
@@ -19,48 +18,128 @@ const (
 	mediaTypeSerie mediaType = "serie"
 )
 
-// getMsgPageInfo returns the current page and the total number of pages.
-func getMsgPageInfo(message string) (int, int, error) {
-	// get "page x/y" from the message and get only the x and y
-	pageStr, found := strings.CutPrefix(message[strings.LastIndex(message, "\n")+1:], "page ")
-	if !found {
-		return 0, 0, errors.New("page not found")
+var (
+	// userActionsMediaType is the media type of each action of a conversation, to get the radarr or sonarr instance it is about.
+	userActionsMediaType = map[types.UserAction]mediaType{
+		types.UserActionLookMovieToAdd: mediaTypeMovie,
+		types.UserActionMovieDetails:   mediaTypeMovie,
+		types.UserActionRemoveMovie:    mediaTypeMovie,
+		types.UserActionAddMovie:       mediaTypeMovie,
+
+		types.UserActionLookSerieToAdd: mediaTypeSerie,
+		types.UserActionSerieDetails:   mediaTypeSerie,
+		types.UserActionRemoveSerie:    mediaTypeSerie,
+		types.UserActionAddSerie:       mediaTypeSerie,
 	}
 
-	pageNbStr := strings.Split(pageStr, "/")[0]
-	pageNb, err := strconv.Atoi(pageNbStr)
-	if err != nil {
-		return 0, 0, errors.Join(err, errors.New("error when converting page number (pageNbStr: "+pageNbStr+")"))
+	// callbacksMediaType is the media type of each button about a media, to get the radarr or sonarr instance it is about.
+	// The other buttons are not about an instance.
+	callbacksMediaType = map[types.CallbackAction]mediaType{
+		types.CallbackNextMovie:                          mediaTypeMovie,
+		types.CallbackPreviousMovie:                      mediaTypeMovie,
+		types.CallbackFirstMovie:                         mediaTypeMovie,
+		types.CallbackLastMovie:                          mediaTypeMovie,
+		types.CallbackMovieDetails:                       mediaTypeMovie,
+		types.CallbackBackToMoviesList:                   mediaTypeMovie,
+		types.CallbackRemoveMovie:                        mediaTypeMovie,
+		types.CallbackConfirmRemoveMovie:                 mediaTypeMovie,
+		types.CallbackCancelRemoveMovie:                  mediaTypeMovie,
+		types.CallbackAddMovie:                           mediaTypeMovie,
+		types.CallbackNextAddMovie:                       mediaTypeMovie,
+		types.CallbackPreviousAddMovie:                   mediaTypeMovie,
+		types.CallbackEditRequestAddMovie:                mediaTypeMovie,
+		types.CallbackRootFolderAddMovie:                 mediaTypeMovie,
+		types.CallbackFollowDownloadingStatusMovie:       mediaTypeMovie,
+		types.CallbackRefreshDownloadingStatusMovie:      mediaTypeMovie,
+		types.CallbackCancelFollowDownloadingStatusMovie: mediaTypeMovie,
+		types.CallbackFilmDetails:                        mediaTypeMovie,
+		types.CallbackSearchFilm:                         mediaTypeMovie,
+		types.CallbackRefreshFilm:                        mediaTypeMovie,
+		types.CallbackToggleMonitoredFilm:                mediaTypeMovie,
+		types.CallbackQualityProfilesFilm:                mediaTypeMovie,
+		types.CallbackSetQualityProfileFilm:              mediaTypeMovie,
+		types.CallbackSearchReleases:                     mediaTypeMovie,
+		types.CallbackReleasesPage:                       mediaTypeMovie,
+		types.CallbackGrabRelease:                        mediaTypeMovie,
+
+		types.CallbackNextSerie:           mediaTypeSerie,
+		types.CallbackPreviousSerie:       mediaTypeSerie,
+		types.CallbackFirstSerie:          mediaTypeSerie,
+		types.CallbackLastSerie:           mediaTypeSerie,
+		types.CallbackSerieDetails:        mediaTypeSerie,
+		types.CallbackBackToSeriesList:    mediaTypeSerie,
+		types.CallbackRemoveSerie:         mediaTypeSerie,
+		types.CallbackConfirmRemoveSerie:  mediaTypeSerie,
+		types.CallbackCancelRemoveSerie:   mediaTypeSerie,
+		types.CallbackAddSerie:            mediaTypeSerie,
+		types.CallbackNextAddSerie:        mediaTypeSerie,
+		types.CallbackPreviousAddSerie:    mediaTypeSerie,
+		types.CallbackEditRequestAddSerie: mediaTypeSerie,
+		types.CallbackRootFolderAddSerie:  mediaTypeSerie,
 	}
+)
 
-	totalPagesStr := strings.Split(pageStr, "/")[1]
-	totalPages, err := strconv.Atoi(totalPagesStr)
+// newCallbackButton returns an inline keyboard button with the encoded callback data, nil if the data can't be encoded.
+// Telegram rejects a whole message with an invalid button, so the nil buttons are left out when the keyboard is sent, see withoutMissingButtons.
+func newCallbackButton(codec *types.CallbackCodec, text string, data types.CallbackData) *telegram.InlineKeyboardButton {
+	encoded, err := codec.Encode(data)
 	if err != nil {
-		return 0, 0, errors.Join(err, errors.New("error when converting total pages number (totalPagesStr: "+totalPagesStr+")"))
+		log.Err(err).Str("action", data.Action.String()).Str("button", text).Msg("error when encoding callback data, the button is left out")
+		return nil
 	}
+	return telegram.NewInlineKeyboardButton(text, encoded)
+}
 
-	return pageNb, totalPages, nil
+// withoutMissingButtons returns the inline keyboard without the buttons newCallbackButton couldn't create, the other keyboards as is.
+func withoutMissingButtons(markup telegram.ReplyMarkup) telegram.ReplyMarkup {
+	switch keyboard := markup.(type) {
+	case telegram.InlineKeyboardMarkup:
+		return *dropMissingButtons(&keyboard)
+	case *telegram.InlineKeyboardMarkup:
+		return dropMissingButtons(keyboard)
+	}
+	return markup
+}
+
+// dropMissingButtons returns the inline keyboard without the nil buttons, and without the rows left empty.
+func dropMissingButtons(keyboard *telegram.InlineKeyboardMarkup) *telegram.InlineKeyboardMarkup {
+	if keyboard == nil {
+		return nil
+	}
+	rows := make([][]*telegram.InlineKeyboardButton, 0, len(keyboard.InlineKeyboard))
+	for _, row := range keyboard.InlineKeyboard {
+		var buttons []*telegram.InlineKeyboardButton
+		for _, button := range row {
+			if button != nil {
+				buttons = append(buttons, button)
+			}
+		}
+		if len(buttons) > 0 {
+			rows = append(rows, buttons)
+		}
+	}
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
 // getMediaListKeyboard returns the keyboard for the media type (movie or serie) to navigate between pages and show the details of a media.
-func getMediaListKeyboard(pageNb int, totalPages int, mediaType mediaType) telegram.InlineKeyboardMarkup {
-	keyboard := getNavigationKeyboard(pageNb, totalPages, mediaType)
+func getMediaListKeyboard(codec *types.CallbackCodec, pageNb int, totalPages int, mediaType mediaType, instance int) telegram.InlineKeyboardMarkup {
+	keyboard := getNavigationKeyboard(codec, pageNb, totalPages, mediaType, instance)
 	if mediaType == mediaTypeMovie {
 		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard,
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("ℹ️ Show movie details", types.CallbackMovieDetails.String())),
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("🗑 Remove movie", types.CallbackRemoveMovie.String())),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "ℹ️ Show movie details", types.CallbackData{Action: types.CallbackMovieDetails, Instance: instance})),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "🗑 Remove movie", types.CallbackData{Action: types.CallbackRemoveMovie, Instance: instance})),
 		)
 	} else if mediaType == mediaTypeSerie {
 		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard,
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("ℹ️ Show serie details", types.CallbackSerieDetails.String())),
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("🗑 Remove serie", types.CallbackRemoveSerie.String())),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "ℹ️ Show serie details", types.CallbackData{Action: types.CallbackSerieDetails, Instance: instance})),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "🗑 Remove serie", types.CallbackData{Action: types.CallbackRemoveSerie, Instance: instance})),
 		)
 	}
 	return keyboard
 }
 
 // getNavigationKeyboard returns the navigation keyboard for the media type to navigate between pages.
-func getNavigationKeyboard(pageNb int, totalPages int, mediaType mediaType) telegram.InlineKeyboardMarkup {
+func getNavigationKeyboard(codec *types.CallbackCodec, pageNb int, totalPages int, mediaType mediaType, instance int) telegram.InlineKeyboardMarkup {
 	var row = telegram.NewInlineKeyboardRow()
 
 	if totalPages <= 1 {
@@ -69,42 +148,42 @@ func getNavigationKeyboard(pageNb int, totalPages int, mediaType mediaType) tele
 
 	if mediaType == mediaTypeMovie {
 		if pageNb == 1 {
-			row = append(row, telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextMovie.String()))
+			row = append(row, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextMovie, Instance: instance, Page: pageNb + 1}))
 			if totalPages > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton(">>", types.CallbackLastMovie.String()))
+				row = append(row, newCallbackButton(codec, ">>", types.CallbackData{Action: types.CallbackLastMovie, Instance: instance, Page: totalPages}))
 			}
 		} else if pageNb == totalPages {
 			if totalPages > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton("<<", types.CallbackFirstMovie.String()))
+				row = append(row, newCallbackButton(codec, "<<", types.CallbackData{Action: types.CallbackFirstMovie, Instance: instance, Page: 1}))
 			}
-			row = append(row, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousMovie.String()))
+			row = append(row, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousMovie, Instance: instance, Page: pageNb - 1}))
 		} else {
 			if totalPages > 2 && pageNb > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton("<<", types.CallbackFirstMovie.String()))
+				row = append(row, newCallbackButton(codec, "<<", types.CallbackData{Action: types.CallbackFirstMovie, Instance: instance, Page: 1}))
 			}
-			row = append(row, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousMovie.String()), telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextMovie.String()))
+			row = append(row, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousMovie, Instance: instance, Page: pageNb - 1}), newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextMovie, Instance: instance, Page: pageNb + 1}))
 			if totalPages > 2 && pageNb < totalPages-1 {
-				row = append(row, telegram.NewInlineKeyboardButton(">>", types.CallbackLastMovie.String()))
+				row = append(row, newCallbackButton(codec, ">>", types.CallbackData{Action: types.CallbackLastMovie, Instance: instance, Page: totalPages}))
 			}
 		}
 	} else if mediaType == mediaTypeSerie {
 		if pageNb == 1 {
-			row = append(row, telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextSerie.String()))
+			row = append(row, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextSerie, Instance: instance, Page: pageNb + 1}))
 			if totalPages > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton(">>", types.CallbackLastSerie.String()))
+				row = append(row, newCallbackButton(codec, ">>", types.CallbackData{Action: types.CallbackLastSerie, Instance: instance, Page: totalPages}))
 			}
 		} else if pageNb == totalPages {
 			if totalPages > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton("<<", types.CallbackFirstSerie.String()))
+				row = append(row, newCallbackButton(codec, "<<", types.CallbackData{Action: types.CallbackFirstSerie, Instance: instance, Page: 1}))
 			}
-			row = append(row, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousSerie.String()))
+			row = append(row, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousSerie, Instance: instance, Page: pageNb - 1}))
 		} else {
 			if totalPages > 2 && pageNb > 2 {
-				row = append(row, telegram.NewInlineKeyboardButton("<<", types.CallbackFirstSerie.String()))
+				row = append(row, newCallbackButton(codec, "<<", types.CallbackData{Action: types.CallbackFirstSerie, Instance: instance, Page: 1}))
 			}
-			row = append(row, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousSerie.String()), telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextSerie.String()))
+			row = append(row, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousSerie, Instance: instance, Page: pageNb - 1}), newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextSerie, Instance: instance, Page: pageNb + 1}))
 			if totalPages > 2 && pageNb < totalPages-1 {
-				row = append(row, telegram.NewInlineKeyboardButton(">>", types.CallbackLastSerie.String()))
+				row = append(row, newCallbackButton(codec, ">>", types.CallbackData{Action: types.CallbackLastSerie, Instance: instance, Page: totalPages}))
 			}
 		}
 	}
@@ -112,38 +191,38 @@ func getNavigationKeyboard(pageNb int, totalPages int, mediaType mediaType) tele
 	return telegram.NewInlineKeyboardMarkup(row)
 }
 
-func getConfirmRemoveKeyboard(mediaType mediaType) telegram.InlineKeyboardMarkup {
+func getConfirmRemoveKeyboard(codec *types.CallbackCodec, mediaType mediaType, instance int, mediaId int64) telegram.InlineKeyboardMarkup {
 	if mediaType == mediaTypeMovie {
 		return telegram.NewInlineKeyboardMarkup(
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("Confirm ✅", types.CallbackConfirmRemoveMovie.String()), telegram.NewInlineKeyboardButton("Cancel ❌", types.CallbackCancelRemoveMovie.String())),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Confirm ✅", types.CallbackData{Action: types.CallbackConfirmRemoveMovie, Instance: instance, MediaId: mediaId}), newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancelRemoveMovie, Instance: instance})),
 		)
 	} else if mediaType == mediaTypeSerie {
 		return telegram.NewInlineKeyboardMarkup(
-			telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("Confirm ✅", types.CallbackConfirmRemoveSerie.String()), telegram.NewInlineKeyboardButton("Cancel ❌", types.CallbackCancelRemoveSerie.String())),
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Confirm ✅", types.CallbackData{Action: types.CallbackConfirmRemoveSerie, Instance: instance, MediaId: mediaId}), newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancelRemoveSerie, Instance: instance})),
 		)
 	}
 
 	return telegram.InlineKeyboardMarkup{}
 }
 
-func getAddMediaKeyboard(pageNb int, totalPages int, mediaType mediaType, addable bool) telegram.InlineKeyboardMarkup {
+func getAddMediaKeyboard(codec *types.CallbackCodec, pageNb int, totalPages int, mediaType mediaType, instance int, addable bool) telegram.InlineKeyboardMarkup {
 	var addRow []*telegram.InlineKeyboardButton
 	if mediaType == mediaTypeMovie {
-		addRow = append(addRow, telegram.NewInlineKeyboardButton("Add to Radarr 🎬", types.CallbackAddMovie.String()))
+		addRow = append(addRow, newCallbackButton(codec, "Add to Radarr 🎬", types.CallbackData{Action: types.CallbackAddMovie, Instance: instance, Page: pageNb}))
 	} else if mediaType == mediaTypeSerie {
-		addRow = append(addRow, telegram.NewInlineKeyboardButton("Add to Sonarr 📺", types.CallbackAddSerie.String()))
+		addRow = append(addRow, newCallbackButton(codec, "Add to Sonarr 📺", types.CallbackData{Action: types.CallbackAddSerie, Instance: instance, Page: pageNb}))
 	}
 
 	var editRow []*telegram.InlineKeyboardButton
 	if mediaType == mediaTypeMovie {
 		editRow = []*telegram.InlineKeyboardButton{
-			telegram.NewInlineKeyboardButton("Edit request 🔍", types.CallbackEditRequestAddMovie.String()),
-			telegram.NewInlineKeyboardButton("Cancel ❌", types.CallbackCancel.String()),
+			newCallbackButton(codec, "Edit request 🔍", types.CallbackData{Action: types.CallbackEditRequestAddMovie, Instance: instance}),
+			newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancel, Instance: instance}),
 		}
 	} else if mediaType == mediaTypeSerie {
 		editRow = []*telegram.InlineKeyboardButton{
-			telegram.NewInlineKeyboardButton("Edit request 🔍", types.CallbackEditRequestAddSerie.String()),
-			telegram.NewInlineKeyboardButton("Cancel ❌", types.CallbackCancel.String()),
+			newCallbackButton(codec, "Edit request 🔍", types.CallbackData{Action: types.CallbackEditRequestAddSerie, Instance: instance}),
+			newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancel, Instance: instance}),
 		}
 	}
 
@@ -158,19 +237,19 @@ func getAddMediaKeyboard(pageNb int, totalPages int, mediaType mediaType, addabl
 
 	if mediaType == mediaTypeMovie {
 		if pageNb == 1 {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextAddMovie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextAddMovie, Instance: instance, Page: pageNb + 1}))
 		} else if pageNb == totalPages {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousAddMovie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousAddMovie, Instance: instance, Page: pageNb - 1}))
 		} else {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousAddMovie.String()), telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextAddMovie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousAddMovie, Instance: instance, Page: pageNb - 1}), newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextAddMovie, Instance: instance, Page: pageNb + 1}))
 		}
 	} else if mediaType == mediaTypeSerie {
 		if pageNb == 1 {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextAddSerie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextAddSerie, Instance: instance, Page: pageNb + 1}))
 		} else if pageNb == totalPages {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousAddSerie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousAddSerie, Instance: instance, Page: pageNb - 1}))
 		} else {
-			navRow = append(navRow, telegram.NewInlineKeyboardButton("<- Previous", types.CallbackPreviousAddSerie.String()), telegram.NewInlineKeyboardButton("Next ->", types.CallbackNextAddSerie.String()))
+			navRow = append(navRow, newCallbackButton(codec, "<- Previous", types.CallbackData{Action: types.CallbackPreviousAddSerie, Instance: instance, Page: pageNb - 1}), newCallbackButton(codec, "Next ->", types.CallbackData{Action: types.CallbackNextAddSerie, Instance: instance, Page: pageNb + 1}))
 		}
 	}
 
@@ -201,27 +280,116 @@ func getQualityProfileKeyboard(profiles []types.QualityProfile) telegram.ReplyKe
 	return keyboard
 }
 
-func getFollowDownloadingStatusKeyboard(followButtonInstedOfStopRefresh bool) telegram.InlineKeyboardMarkup {
+func getFollowDownloadingStatusKeyboard(codec *types.CallbackCodec, instance int, filmId int64, followButtonInstedOfStopRefresh bool) telegram.InlineKeyboardMarkup {
 	kRow := []*telegram.InlineKeyboardButton{
-		telegram.NewInlineKeyboardButton("Refresh now 🔄", types.CallbackRefreshDownloadingStatusMovie.String()),
+		newCallbackButton(codec, "Refresh now 🔄", types.CallbackData{Action: types.CallbackRefreshDownloadingStatusMovie, Instance: instance, MediaId: filmId}),
 	}
 
 	if followButtonInstedOfStopRefresh {
-		kRow = append(kRow, telegram.NewInlineKeyboardButton("Follow downloading status 📡", types.CallbackFollowDownloadingStatusMovie.String()))
+		kRow = append(kRow, newCallbackButton(codec, "Follow downloading status 📡", types.CallbackData{Action: types.CallbackFollowDownloadingStatusMovie, Instance: instance, MediaId: filmId}))
 	} else {
-		kRow = append(kRow, telegram.NewInlineKeyboardButton("Stop refreshing ⏹", types.CallbackCancelFollowDownloadingStatusMovie.String()))
+		kRow = append(kRow, newCallbackButton(codec, "Stop refreshing ⏹", types.CallbackData{Action: types.CallbackCancelFollowDownloadingStatusMovie, Instance: instance, MediaId: filmId}))
 	}
 
 	return telegram.NewInlineKeyboardMarkup(kRow)
 }
 
-func getAdminKeyboard() telegram.InlineKeyboardMarkup {
+// getRootFolderKeyboard returns the keyboard to select the root folder of the media to add, with the free space of each folder.
+func getRootFolderKeyboard(codec *types.CallbackCodec, mediaType mediaType, instance int, rootFolders []types.RootFolder) telegram.InlineKeyboardMarkup {
+	action := types.CallbackRootFolderAddMovie
+	if mediaType == mediaTypeSerie {
+		action = types.CallbackRootFolderAddSerie
+	}
+
+	var rows [][]*telegram.InlineKeyboardButton
+	for _, folder := range rootFolders {
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, folder.PrintRootFolder(), types.CallbackData{Action: action, Instance: instance, Arg: folder.ID})))
+	}
+	rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancel})))
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+// getFollowDownloadingStatusButtonKeyboard returns the keyboard to start following the downloading status of the film.
+func getFollowDownloadingStatusButtonKeyboard(codec *types.CallbackCodec, instance int, filmId int64) telegram.InlineKeyboardMarkup {
 	return telegram.NewInlineKeyboardMarkup(
-		// wol button
-		telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButton("Wake on LAN the PC 🌐", types.CallbackWakeOnLan.String())),
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Follow downloading status 📡", types.CallbackData{Action: types.CallbackFollowDownloadingStatusMovie, Instance: instance, MediaId: filmId})),
 	)
 }
 
+// getBackToListKeyboard returns the keyboard to go back to the list of movies or series, from the details.
+func getBackToListKeyboard(codec *types.CallbackCodec, mediaType mediaType, instance int) telegram.InlineKeyboardMarkup {
+	if mediaType == mediaTypeMovie {
+		return telegram.NewInlineKeyboardMarkup(
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<< Back to movies list", types.CallbackData{Action: types.CallbackBackToMoviesList, Instance: instance})),
+		)
+	} else if mediaType == mediaTypeSerie {
+		return telegram.NewInlineKeyboardMarkup(
+			telegram.NewInlineKeyboardRow(newCallbackButton(codec, "<< Back to series list", types.CallbackData{Action: types.CallbackBackToSeriesList, Instance: instance})),
+		)
+	}
+
+	return telegram.InlineKeyboardMarkup{}
+}
+
+// getMovieDetailsKeyboard returns the keyboard of the details of a movie of the library, to act on it or go back to the list.
+func getMovieDetailsKeyboard(codec *types.CallbackCodec, instance int, film radarr.Film) telegram.InlineKeyboardMarkup {
+	data := types.CallbackData{Instance: instance, MediaId: film.MovieId}
+	button := func(text string, action types.CallbackAction) *telegram.InlineKeyboardButton {
+		data.Action = action
+		return newCallbackButton(codec, text, data)
+	}
+	monitorText := "👁 Monitor"
+	if film.Monitored {
+		monitorText = "👁 Unmonitor"
+	}
+
+	keyboard := getBackToListKeyboard(codec, mediaTypeMovie, instance)
+	keyboard.InlineKeyboard = append([][]*telegram.InlineKeyboardButton{
+		telegram.NewInlineKeyboardRow(button("🔍 Search now", types.CallbackSearchFilm), button("🔄 Refresh & rescan", types.CallbackRefreshFilm)),
+		telegram.NewInlineKeyboardRow(button(monitorText, types.CallbackToggleMonitoredFilm), button("📺 Quality profile", types.CallbackQualityProfilesFilm)),
+		telegram.NewInlineKeyboardRow(button("🔎 Search releases", types.CallbackSearchReleases)),
+	}, keyboard.InlineKeyboard...)
+	return keyboard
+}
+
+// getInstancesKeyboard returns the keyboard to select an instance, the data of each button is completed with the index of its instance.
+func getInstancesKeyboard(codec *types.CallbackCodec, names []string, data types.CallbackData) telegram.InlineKeyboardMarkup {
+	var rows [][]*telegram.InlineKeyboardButton
+	for i, name := range names {
+		data.Instance = i
+		rows = append(rows, telegram.NewInlineKeyboardRow(newCallbackButton(codec, name, data)))
+	}
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+// rootFolderService is a radarr or sonarr instance, adding the medias to its root folders.
+type rootFolderService interface {
+	GetRootFolders() ([]types.RootFolder, error)
+	DefaultRootFolder() string
+}
+
+// getRootFolder returns the root folder to add a media to when there is no choice to make:
+// the default root folder of the instance, or its only root folder.
+// Otherwise it returns an empty path and the root folders the user must select from.
+func getRootFolder(service rootFolderService) (string, []types.RootFolder, error) {
+	if service.DefaultRootFolder() != "" {
+		return service.DefaultRootFolder(), nil, nil
+	}
+
+	rootFolders, err := service.GetRootFolders()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(rootFolders) == 0 {
+		return "", nil, errors.New("no root folder configured")
+	}
+	if len(rootFolders) == 1 {
+		return rootFolders[0].Path, nil, nil
+	}
+
+	return "", rootFolders, nil
+}
+
 func getDiskUsage(path string) (types.DiskStatus, error) {
 	log.Debug().Str("path", path).Msg("Getting disk usage")
 	var disk types.DiskStatus
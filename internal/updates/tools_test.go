@@ -0,0 +1,46 @@
+package updates
+
+import (
+	"reflect"
+	"strings"
+	"telarr/internal/tgclient"
+	"telarr/internal/types"
+	"testing"
+
+	"gitlab.com/toby3d/telegram"
+)
+
+func TestNewCallbackButton_TooLong(t *testing.T) {
+	codec := types.NewCallbackCodec("test-token")
+	fake := tgclient.NewFake()
+	chatID := int64(1)
+
+	tooLong := types.CallbackData{Action: types.CallbackAction(strings.Repeat("a", types.MaxCallbackDataLength))}
+	if button := newCallbackButton(codec, "Too long", tooLong); button != nil {
+		t.Fatalf("newCallbackButton() = %+v, want nil", button)
+	}
+
+	// the button is left out, and the rest of the keyboard is sent
+	cancel := newCallbackButton(codec, "Cancel ❌", types.CallbackData{Action: types.CallbackCancel})
+	keyboard := telegram.NewInlineKeyboardMarkup(
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Too long", tooLong)),
+		telegram.NewInlineKeyboardRow(newCallbackButton(codec, "Too long", tooLong), cancel),
+	)
+	messageID := sendMessageWithKeyboard(fake, chatID, "Select:", keyboard)
+	if messageID < 0 {
+		t.Fatalf("sendMessageWithKeyboard() = %d, want a message id", messageID)
+	}
+	want := [][]*telegram.InlineKeyboardButton{{cancel}}
+	sent := fake.Messages(chatID)[0].ReplyMarkup.(telegram.InlineKeyboardMarkup)
+	if !reflect.DeepEqual(sent.InlineKeyboard, want) {
+		t.Errorf("sent keyboard = %+v, want %+v", sent.InlineKeyboard, want)
+	}
+
+	if !editMessageWithKeyboard(fake, chatID, messageID, "Select again:", &keyboard) {
+		t.Fatalf("editMessageWithKeyboard() = false, want true")
+	}
+	edited := fake.Messages(chatID)[0].ReplyMarkup.(*telegram.InlineKeyboardMarkup)
+	if !reflect.DeepEqual(edited.InlineKeyboard, want) {
+		t.Errorf("edited keyboard = %+v, want %+v", edited.InlineKeyboard, want)
+	}
+}
@@ -2,13 +2,23 @@ package updates
 
 import (
 	"context"
+	"errors"
+	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"telarr/configuration"
+	"telarr/internal/audit"
 	"telarr/internal/authentication"
+	"telarr/internal/invite"
+	"telarr/internal/quota"
 	"telarr/internal/radarr"
+	"telarr/internal/request"
+	"telarr/internal/session"
 	"telarr/internal/sonarr"
+	"telarr/internal/tgclient"
 	"telarr/internal/types"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fasthttp"
@@ -22,13 +32,20 @@ const (
 
 // Updates is the struct that will handle the messages.
 type Updates struct {
-	// config is the configuration.
-	config configuration.Configuration
+	// config is the configuration, replaced on reload.
+	config   configuration.Configuration
+	reloadMu sync.Mutex
+	// services are the instances and settings swapped on reload, shared by the messages and the callbacks.
+	services *atomic.Pointer[services]
 
 	// Bot is the telegram bot.
-	bot *telegram.Bot
+	bot tgclient.Client
+	// botUsername is the username of the bot, to recognize the messages addressed to it in the group chats.
+	botUsername string
 	// updateChan is the channel to receive the updates.
-	updateChan telegram.UpdatesChannel
+	updateChan tgclient.UpdatesChannel
+	// stopWebhook shuts the webhook server down, nil when using long polling.
+	stopWebhook func() error
 
 	// wg to wait for the goroutines to finish.
 	wg *sync.WaitGroup
@@ -38,13 +55,24 @@ type Updates struct {
 	// cb is the struct designed to handle the callbacks.
 	cb *callbacks
 
-	usersAction map[int]types.Action
+	// sessions is the store of the users conversations.
+	sessions session.Store
+
+	// auth is the struct designed to check the users authorization.
+	auth *authentication.Auth
+	// auditor records the authorizations of the new users.
+	auditor *auditor
+	// invites lets the new users redeem an invite code instead of entering the password.
+	invites *invites
+	// waitingForPassword is the list of users waiting for the password.
+	waitingForPassword   map[int]struct{}
+	waitingForPasswordMu sync.Mutex
 }
 
 func New(config configuration.Configuration) (*Updates, error) {
 	// creating the telegram bot
 	log.Debug().Msg("creating the telegram bot")
-	bot, err := telegram.New(config.Telegram.Token)
+	bot, err := tgclient.NewBot(config.Telegram.Token)
 	if err != nil {
 		log.Err(err).Msg("error when creating the telegram bot")
 		return nil, err
@@ -52,57 +80,215 @@ func New(config configuration.Configuration) (*Updates, error) {
 	log.Info().Str("botName", bot.FullName()).Msg("telegram bot created")
 
 	// getting the updates
-	updatesChan := bot.NewLongPollingChannel(
-		&telegram.GetUpdates{
-			Offset:  0,
-			Limit:   1,
-			Timeout: 60,
-		},
-	)
+	var updatesChan tgclient.UpdatesChannel
+	var stopWebhook func() error
+	if config.Telegram.Webhook.Enabled() {
+		log.Debug().Str("listen", config.Telegram.Webhook.Listen).Str("url", config.Telegram.Webhook.Url).Msg("starting the webhook server")
+		ln, err := net.Listen("tcp", config.Telegram.Webhook.Listen)
+		if err != nil {
+			log.Err(err).Msg("error when listening for the webhook")
+			return nil, err
+		}
+		updatesChan, stopWebhook, err = newWebhookChannel(config.Telegram.Webhook, ln)
+		if err != nil {
+			log.Err(err).Msg("error when creating the webhook channel")
+			ln.Close()
+			return nil, err
+		}
+
+		err = setWebhook(bot, config.Telegram.Webhook)
+		if err != nil {
+			log.Err(err).Msg("error when setting the webhook")
+			stopWebhook()
+			return nil, err
+		}
+		log.Info().Str("url", config.Telegram.Webhook.Url).Msg("webhook set")
+	} else {
+		// long polling doesn't work while a webhook is set
+		_, err = bot.DeleteWebhook()
+		if err != nil {
+			log.Err(err).Msg("error when deleting the webhook")
+			return nil, err
+		}
+
+		updatesChan = bot.NewLongPollingChannel(
+			&telegram.GetUpdates{
+				Offset:  0,
+				Limit:   1,
+				Timeout: 60,
+			},
+		)
+	}
+
+	// create the auth struct
+	auth, err := authentication.New(config)
+	if err != nil {
+		log.Err(err).Msg("error when creating the auth struct")
+		if stopWebhook != nil {
+			stopWebhook()
+		}
+		return nil, err
+	}
+
+	upd, err := newUpdates(config, bot, updatesChan, auth)
+	if err != nil {
+		if stopWebhook != nil {
+			stopWebhook()
+		}
+		return nil, err
+	}
+	upd.stopWebhook = stopWebhook
+	upd.botUsername = bot.Username
+	upd.invites.botUsername = bot.Username
+	return upd, nil
+}
+
+// newUpdates creates the updates handler, sending the messages with the client and receiving the updates from the channel.
+func newUpdates(config configuration.Configuration, bot tgclient.Client, updatesChan tgclient.UpdatesChannel, auth *authentication.Auth) (*Updates, error) {
+	// creating the sessions store
+	var sessions session.Store
+	if config.Session.Path != "" {
+		var err error
+		sessions, err = session.NewFileStore(config.Session.Path, config.Session.Ttl)
+		if err != nil {
+			log.Err(err).Msg("error when creating the sessions store")
+			return nil, err
+		}
+	} else {
+		sessions = session.NewMemoryStore(config.Session.Ttl)
+	}
+
+	// creating the store of the requests waiting for the approval of an admin
+	requestsPath := config.Requests.Path
+	if requestsPath == "" {
+		requestsPath = request.DefaultPath
+	}
+	requestsStore, err := request.NewStore(requestsPath)
+	if err != nil {
+		log.Err(err).Msg("error when creating the requests store")
+		return nil, err
+	}
+
+	// creating the ledger of the additions counted in the quotas
+	quotasPath := config.Quotas.Path
+	if quotasPath == "" {
+		quotasPath = quota.DefaultPath
+	}
+	ledger, err := quota.NewLedger(quotasPath)
+	if err != nil {
+		log.Err(err).Msg("error when creating the quotas ledger")
+		return nil, err
+	}
+
+	// creating the store of the invite codes
+	invitesStore, err := invite.NewStore(invite.ConfiguredPath(config))
+	if err != nil {
+		log.Err(err).Msg("error when creating the invites store")
+		return nil, err
+	}
+
+	// creating the audit log of the actions of the users
+	auditPath := config.Audit.Path
+	if auditPath == "" {
+		auditPath = audit.DefaultPath
+	}
+	auditLog, err := audit.NewLog(auditPath)
+	if err != nil {
+		log.Err(err).Msg("error when creating the audit log")
+		return nil, err
+	}
+	aud := &auditor{log: auditLog}
+
+	srv := &atomic.Pointer[services]{}
+	srv.Store(newServices(config))
 
-	usersAction := make(map[int]types.Action)
-	usersData := make(map[int]interface{})
-	usersCurrPage := make(map[int]int)
+	// the callback data are signed with a key derived from the bot token, so the buttons survive a restart
+	codec := types.NewCallbackCodec(config.Telegram.Token)
 
+	quo := &quotas{
+		ledger:   ledger,
+		requests: requestsStore,
+		services: srv,
+	}
+	req := &requests{
+		bot:      bot,
+		codec:    codec,
+		auth:     auth,
+		store:    requestsStore,
+		quotas:   quo,
+		auditor:  aud,
+		services: srv,
+	}
+	inv := &invites{
+		bot:      bot,
+		codec:    codec,
+		auth:     auth,
+		store:    invitesStore,
+		auditor:  aud,
+		services: srv,
+	}
+
+	wg := &sync.WaitGroup{}
 	return &Updates{
-		config:      config,
-		bot:         bot,
-		updateChan:  updatesChan,
-		wg:          &sync.WaitGroup{},
-		usersAction: usersAction,
+		config:     config,
+		bot:        bot,
+		updateChan: updatesChan,
+		wg:         wg,
+		sessions:   sessions,
+		auth:       auth,
+		auditor:    aud,
+		invites:    inv,
+		services:   srv,
+
+		waitingForPassword: make(map[int]struct{}),
 		mess: &messages{
-			bot:              bot,
-			radarrConfig:     config.Radarr,
-			sonarrConfig:     config.Sonarr,
-			pathForDiskUsage: config.PathForDiskUsage,
-			usersAction:      usersAction,
-			usersData:        usersData,
-			usersCurrPage:    usersCurrPage,
+			services: srv,
+			codec:    codec,
+			sessions: sessions,
+			auth:     auth,
+			requests: req,
+			quotas:   quo,
+			auditor:  aud,
 		},
 		cb: &callbacks{
-			bot:                    bot,
-			radarrConfig:           config.Radarr,
-			sonarrConfig:           config.Sonarr,
-			wolConfig:              config.WakeOnLan,
-			usersAction:            usersAction,
-			usersData:              usersData,
-			usersCurrPage:          usersCurrPage,
+			services:               srv,
+			auth:                   auth,
+			codec:                  codec,
+			sessions:               sessions,
+			requests:               req,
+			quotas:                 quo,
+			invites:                inv,
+			auditor:                aud,
 			usersDownloadingStatus: make(map[int]types.DownloadingStatusMessage),
+			wg:                     wg,
 		},
 	}, nil
 }
 
 func (upd *Updates) Start(ctx context.Context) error {
-	// create the auth struct
-	auth, err := authentication.New(upd.config)
-	if err != nil {
-		log.Err(err).Msg("error when creating the auth struct")
-		return err
-	}
+	// remove the expired sessions
+	upd.wg.Add(1)
+	go func() {
+		defer upd.wg.Done()
+		session.StartJanitor(ctx, upd.sessions)
+	}()
 
-	// list of users waiting for the password
-	waitingForPassword := make(map[int]chan string)
-	var waitingForPasswordMu sync.Mutex
+	// save the sizes of the medias added once downloaded, for the quotas
+	upd.wg.Add(1)
+	go func() {
+		defer upd.wg.Done()
+		upd.mess.quotas.watchSizes(ctx)
+	}()
+
+	// reload the configuration and the users lists when their files change
+	upd.wg.Add(1)
+	go func() {
+		defer upd.wg.Done()
+		upd.watchFiles(ctx)
+	}()
+
+	// the updates of a user are handled in order, the updates of different users concurrently
+	disp := newDispatcher(upd.wg, upd.handleUpdate)
 
 	upd.wg.Add(1)
 	go func() {
@@ -118,91 +304,12 @@ func (upd *Updates) Start(ctx context.Context) error {
 				log.Trace().
 					Msg("new update")
 
-				// get the username
-				var user authentication.User
-				if rcvUpdate.IsMessage() {
-					user = authentication.User{
-						Id:       rcvUpdate.Message.From.ID,
-						Username: rcvUpdate.Message.From.Username,
-					}
-				} else if rcvUpdate.IsCallbackQuery() {
-					user = authentication.User{
-						Id:       rcvUpdate.CallbackQuery.From.ID,
-						Username: rcvUpdate.CallbackQuery.From.Username,
-					}
-				}
-
-				// get the chat ID
-				var chatID int64
-				if rcvUpdate.IsMessage() {
-					chatID = rcvUpdate.Message.Chat.ID
-				} else if rcvUpdate.IsCallbackQuery() {
-					chatID = rcvUpdate.CallbackQuery.Message.Chat.ID
-				}
-
-				// check if the user is waiting for the password
-				waitingForPasswordMu.Lock()
-				if c, exist := waitingForPassword[user.Id]; exist {
-					c <- rcvUpdate.Message.Text
-					waitingForPasswordMu.Unlock()
-					continue
-				}
-				waitingForPasswordMu.Unlock()
-
-				// check authorization
-				authorized, isAdmin := auth.CheckAutorized(user.Id)
-				switch authorized {
-				// if the user is not authorized
-				case authentication.AuthStatusBlackListed:
-					log.Warn().Int("userId", user.Id).Str("username", user.Username).Msg("user is blacklisted")
-					sendSimpleMessage(upd.bot, chatID, "You are blacklisted!\nPlease contact the administrator to remove you from the blacklist.")
-					continue
-				// if authorization failed
-				case authentication.AuthStatusError:
-					log.Err(err).Msg("error when checking authorization")
-					sendSimpleMessage(upd.bot, chatID, "An error occurred while checking your authorization.\nPlease contact the administrator.")
-					continue
-				// if the user is new
-				case authentication.AuthStatusNewUser:
-					log.Info().Int("userId", user.Id).Str("username", user.Username).Msg("new user")
-					sendSimpleMessage(upd.bot, chatID, "Welcome to the group "+rcvUpdate.Message.From.FirstName+"!\nPlease enter the password 🔑:")
-
-					// create the channel for the password
-					textChan := make(chan string)
-					// add the user to the waiting list
-					waitingForPassword[user.Id] = textChan
-					// wait for the user to be autorized
-					upd.wg.Add(1)
-					go func() {
-						defer upd.wg.Done()
-						log.Info().Int("userId", user.Id).Str("username", user.Username).Msg("waiting for authorization")
-						auth.WaitForAutorization(ctx, user, upd.bot, textChan, chatID)
-						// remove the user from the waiting list
-						waitingForPasswordMu.Lock()
-						delete(waitingForPassword, user.Id)
-						waitingForPasswordMu.Unlock()
-					}()
+				userId, ok := getUpdateUserId(rcvUpdate)
+				if !ok {
+					log.Debug().Str("type", rcvUpdate.Type()).Msg("unsupported update")
 					continue
-				// if the user is authorized
-				case authentication.AuthStatusAutorized:
-					if rcvUpdate.IsMessage() {
-						// if it's a message
-						log.Trace().
-							Int("fromID", user.Id).
-							Str("fromUsername", user.Username).
-							Str("text", rcvUpdate.Message.Text).
-							Msg("new message")
-						upd.mess.handle(rcvUpdate.Message, isAdmin)
-					} else if rcvUpdate.IsCallbackQuery() {
-						// if it's a callback query
-						log.Trace().
-							Int("fromID", user.Id).
-							Str("fromUsername", user.Username).
-							Str("data", rcvUpdate.CallbackQuery.Data).
-							Msg("new callback query")
-						upd.cb.handle(ctx, rcvUpdate.CallbackQuery)
-					}
 				}
+				disp.dispatch(ctx, userId, rcvUpdate)
 			}
 		}
 	}()
@@ -210,23 +317,312 @@ func (upd *Updates) Start(ctx context.Context) error {
 	return nil
 }
 
+// handleUpdate checks the authorization of the user and handles the update.
+func (upd *Updates) handleUpdate(ctx context.Context, rcvUpdate *tgclient.Update) {
+	// get the username
+	var user authentication.User
+	if rcvUpdate.IsMessage() {
+		user = authentication.User{
+			Id:       rcvUpdate.Message.From.ID,
+			Username: rcvUpdate.Message.From.Username,
+		}
+	} else if rcvUpdate.IsCallbackQuery() {
+		user = authentication.User{
+			Id:       rcvUpdate.CallbackQuery.From.ID,
+			Username: rcvUpdate.CallbackQuery.From.Username,
+		}
+	}
+
+	// get the chat
+	var chat *telegram.Chat
+	if rcvUpdate.IsMessage() {
+		chat = rcvUpdate.Message.Chat
+	} else if rcvUpdate.IsCallbackQuery() {
+		chat = rcvUpdate.CallbackQuery.Message.Chat
+	}
+	chatID := chat.ID
+
+	// the answers are sent to the forum topic of the update
+	bot := tgclient.InThread(upd.bot, chatID, rcvUpdate.ThreadID)
+
+	// in a group chat, the bot only answers the messages addressed to it
+	if !chat.IsPrivate() && rcvUpdate.IsMessage() && !addressedToBot(upd.sessions, upd.botUsername, rcvUpdate.Message) {
+		log.Trace().Int("userId", user.Id).Int64("chatId", chatID).Msg("group message not addressed to the bot")
+		return
+	}
+
+	// without admin, the first user sending the code printed in the log becomes admin
+	if chat.IsPrivate() && rcvUpdate.IsMessage() && rcvUpdate.Message.IsCommandEqual("claim") && upd.auth.ClaimPending() {
+		upd.claim(bot, user, chatID, rcvUpdate.Message.CommandArgument())
+		return
+	}
+
+	// check if the user is waiting for the password
+	upd.waitingForPasswordMu.Lock()
+	_, waiting := upd.waitingForPassword[user.Id]
+	upd.waitingForPasswordMu.Unlock()
+	// the password is only entered in the private chat
+	if waiting && chat.IsPrivate() {
+		if !rcvUpdate.IsMessage() || (rcvUpdate.Message.IsCommandEqual("start") && !rcvUpdate.Message.HasCommandArgument()) {
+			sendSimpleMessage(bot, chatID, "Please enter the password or an invite code 🔑:")
+			return
+		}
+
+		// the password must not stay in the history of the chat
+		_, err := upd.bot.DeleteMessage(chatID, rcvUpdate.Message.ID)
+		if err != nil {
+			log.Err(err).Int("userId", user.Id).Msg("error when deleting the password message")
+		}
+
+		// the message is an invite code, or the password if no code matches it
+		text := rcvUpdate.Message.Text
+		if rcvUpdate.Message.IsCommandEqual("start") {
+			text = rcvUpdate.Message.CommandArgument()
+		}
+		done := true
+		err = upd.invites.redeem(chatID, user, text)
+		switch {
+		case errors.Is(err, invite.ErrInviteNotFound):
+			done = upd.auth.CheckPassword(user, bot, text, chatID)
+			upd.recordPassword(user)
+		case err != nil:
+			sendSimpleMessage(bot, chatID, printInviteError(err))
+			done = false
+		}
+		if done {
+			// remove the user from the waiting list
+			upd.waitingForPasswordMu.Lock()
+			delete(upd.waitingForPassword, user.Id)
+			upd.waitingForPasswordMu.Unlock()
+		}
+		return
+	}
+
+	// check authorization, the members of an autorized group chat are autorized in it
+	authorized, role := upd.auth.CheckAutorizedInChat(user.Id, chatID)
+	switch authorized {
+	// if the user is not authorized
+	case authentication.AuthStatusBlackListed:
+		log.Warn().Int("userId", user.Id).Str("username", user.Username).Msg("user is blacklisted")
+		sendSimpleMessage(bot, chatID, "You are blacklisted!\nPlease contact the administrator to remove you from the blacklist.")
+	// if the user entered too many wrong passwords
+	case authentication.AuthStatusLockedOut:
+		until, _ := upd.auth.LockedUntil(user.Id)
+		log.Debug().Int("userId", user.Id).Str("username", user.Username).Time("until", until).Msg("user is locked out")
+		sendSimpleMessage(bot, chatID, "You are locked out 🔒\nYou can try again in "+authentication.PrintDuration(time.Until(until))+".")
+	// if authorization failed
+	case authentication.AuthStatusError:
+		log.Error().Int("userId", user.Id).Msg("error when checking authorization")
+		sendSimpleMessage(bot, chatID, "An error occurred while checking your authorization.\nPlease contact the administrator.")
+	// if the user is new
+	case authentication.AuthStatusNewUser:
+		log.Info().Int("userId", user.Id).Str("username", user.Username).Msg("new user")
+
+		// the password must not be sent to the whole group
+		if !chat.IsPrivate() {
+			sendSimpleMessage(bot, chatID, "This group is not authorized.\nPlease send me a private message to enter the password or an invite code 🔑")
+			return
+		}
+
+		// a deep link to the bot with an invite code sends /start with the code
+		if rcvUpdate.IsMessage() && rcvUpdate.Message.IsCommandEqual("start") && rcvUpdate.Message.HasCommandArgument() {
+			err := upd.invites.redeem(chatID, user, rcvUpdate.Message.CommandArgument())
+			if err == nil {
+				return
+			}
+			sendSimpleMessage(bot, chatID, printInviteError(err))
+		}
+
+		firstName := user.Username
+		if rcvUpdate.IsMessage() {
+			firstName = rcvUpdate.Message.From.FirstName
+		} else if rcvUpdate.IsCallbackQuery() {
+			firstName = rcvUpdate.CallbackQuery.From.FirstName
+		}
+		sendSimpleMessage(bot, chatID, "Welcome to the group "+firstName+"!\nPlease enter the password or an invite code 🔑:")
+
+		// add the user to the waiting list
+		log.Info().Int("userId", user.Id).Str("username", user.Username).Msg("waiting for authorization")
+		upd.waitingForPasswordMu.Lock()
+		upd.waitingForPassword[user.Id] = struct{}{}
+		upd.waitingForPasswordMu.Unlock()
+	// if the user is authorized
+	case authentication.AuthStatusAutorized:
+		if rcvUpdate.IsMessage() {
+			// if it's a message
+			log.Trace().
+				Int("fromID", user.Id).
+				Str("fromUsername", user.Username).
+				Str("text", rcvUpdate.Message.Text).
+				Msg("new message")
+			upd.mess.handle(bot, rcvUpdate.Message, role)
+		} else if rcvUpdate.IsCallbackQuery() {
+			// if it's a callback query
+			log.Trace().
+				Int("fromID", user.Id).
+				Str("fromUsername", user.Username).
+				Str("data", rcvUpdate.CallbackQuery.Data).
+				Msg("new callback query")
+			upd.cb.handle(ctx, bot, rcvUpdate.CallbackQuery, role)
+		}
+	}
+}
+
+// claim makes the user the first admin if the code is the claim code, and tells the user the result.
+func (upd *Updates) claim(bot tgclient.Client, user authentication.User, chatID int64, code string) {
+	err := upd.auth.Claim(user, code)
+	switch {
+	case errors.Is(err, authentication.ErrWrongClaimCode):
+		log.Warn().Int("userId", user.Id).Str("username", user.Username).Msg("wrong claim code")
+		upd.auditor.record(user, audit.Entry{Action: audit.ActionClaimAdmin, Result: audit.ResultDenied}, nil)
+		sendSimpleMessage(bot, chatID, "Wrong claim code ❌\nThe code is printed in the log of the bot at startup.")
+		return
+	case errors.Is(err, authentication.ErrNoClaimCode):
+		sendSimpleMessage(bot, chatID, "The bot already has an admin.")
+		return
+	}
+	upd.auditor.record(user, audit.Entry{Action: audit.ActionClaimAdmin}, err)
+	if err != nil {
+		log.Err(err).Int("userId", user.Id).Msg("error when claiming the bot")
+		sendSimpleMessage(bot, chatID, "An error occurred while saving the users.\nPlease check the log of the bot.")
+		return
+	}
+
+	// the user doesn't have to enter the password anymore
+	upd.waitingForPasswordMu.Lock()
+	delete(upd.waitingForPassword, user.Id)
+	upd.waitingForPasswordMu.Unlock()
+
+	sendSimpleMessage(bot, chatID, "You are now admin ⭐\nUse /admin to manage the users and /help to see the commands list.")
+}
+
+// recordPassword records the outcome of the password entered by the new user, from its authorization after the check.
+func (upd *Updates) recordPassword(user authentication.User) {
+	var e audit.Entry
+	var err error
+	switch status, _ := upd.auth.CheckAutorized(user.Id); status {
+	case authentication.AuthStatusAutorized:
+		e = audit.Entry{Action: audit.ActionAuthorize}
+	case authentication.AuthStatusLockedOut:
+		e = audit.Entry{Action: audit.ActionLockout, Result: audit.ResultDenied}
+	case authentication.AuthStatusBlackListed:
+		e = audit.Entry{Action: audit.ActionBlacklist, Result: audit.ResultDenied}
+	case authentication.AuthStatusNewUser:
+		e = audit.Entry{Action: audit.ActionWrongPassword, Result: audit.ResultDenied}
+	default:
+		e = audit.Entry{Action: audit.ActionAuthorize}
+		err = errors.New("error when checking the authorization")
+	}
+	upd.auditor.record(user, e, err)
+}
+
 func (upd *Updates) Stop() error {
+	if upd.stopWebhook != nil {
+		err := upd.stopWebhook()
+		if err != nil {
+			log.Err(err).Msg("error when stopping the webhook server")
+			return err
+		}
+	}
+
 	upd.wg.Wait()
+
+	err := upd.auth.Close()
+	if err != nil {
+		log.Err(err).Msg("error when closing the auth store")
+		return err
+	}
 	return nil
 }
 
 /* Tools */
 
+// Instances
+
+// namedInstance is a radarr or sonarr instance.
+type namedInstance interface {
+	Name() string
+}
+
+// getInstance returns the instance at the index, false if it doesn't exist (anymore).
+func getInstance[T namedInstance](instances []T, index int) (T, bool) {
+	if index < 0 || index >= len(instances) {
+		var none T
+		return none, false
+	}
+	return instances[index], true
+}
+
+// getInstancesNames returns the names of the instances.
+func getInstancesNames[T namedInstance](instances []T) []string {
+	names := make([]string, len(instances))
+	for i, instance := range instances {
+		names[i] = instance.Name()
+	}
+	return names
+}
+
+// getListInstanceName returns the name of the instance to show in a list, empty if there is only one instance.
+func getListInstanceName[T namedInstance](instances []T, index int) string {
+	if len(instances) <= 1 || index < 0 || index >= len(instances) {
+		return ""
+	}
+	return instances[index].Name()
+}
+
+// Sessions
+
+// setUserAction sets the action of the user and the instance it is about, keeping the data of its session.
+func setUserAction(sessions session.Store, userId int, action types.UserAction, instance int) {
+	s, _ := sessions.Get(userId)
+	s.Action = action
+	s.Instance = instance
+	err := sessions.Set(userId, s)
+	if err != nil {
+		log.Err(err).Int("userId", userId).Msg("error when saving the session")
+	}
+}
+
+// clearUserAction removes the action of the user, keeping the data of its session.
+func clearUserAction(sessions session.Store, userId int) {
+	s, exist := sessions.Get(userId)
+	if !exist || s.Action == "" {
+		return
+	}
+	s.Action = ""
+	err := sessions.Set(userId, s)
+	if err != nil {
+		log.Err(err).Int("userId", userId).Msg("error when saving the session")
+	}
+}
+
+// setUserSession replaces the session of the user.
+func setUserSession(sessions session.Store, userId int, s session.Session) {
+	err := sessions.Set(userId, s)
+	if err != nil {
+		log.Err(err).Int("userId", userId).Msg("error when saving the session")
+	}
+}
+
+// deleteUserSession removes the session of the user.
+func deleteUserSession(sessions session.Store, userId int) {
+	err := sessions.Delete(userId)
+	if err != nil {
+		log.Err(err).Int("userId", userId).Msg("error when removing the session")
+	}
+}
+
 // Sening messages
 
 // sendMessage sends a message to the chat and returns true if the message was sent successfully.
-func sendMessage(bot *telegram.Bot, p telegram.SendMessage) int {
+func sendMessage(bot tgclient.Client, p telegram.SendMessage) int {
 	if p.ParseMode == "" {
 		p.ParseMode = telegram.ParseModeMarkdown
 	}
 	p.DisableWebPagePreview = true
+	p.ReplyMarkup = withoutMissingButtons(p.ReplyMarkup)
 
-	m, err := bot.SendMessage(p)
+	m, err := bot.SendMessage(tgclient.SendMessage{SendMessage: p})
 	if err != nil {
 		log.Err(err).Msg("error when sending message")
 		return -1
@@ -234,14 +630,14 @@ func sendMessage(bot *telegram.Bot, p telegram.SendMessage) int {
 	return m.ID
 }
 
-func sendSimpleMessage(bot *telegram.Bot, chatID int64, text string) int {
+func sendSimpleMessage(bot tgclient.Client, chatID int64, text string) int {
 	return sendMessage(bot, telegram.SendMessage{
 		ChatID: chatID,
 		Text:   text,
 	})
 }
 
-func sendMessageWithKeyboard(bot *telegram.Bot, chatID int64, text string, keyboard telegram.ReplyMarkup) int {
+func sendMessageWithKeyboard(bot tgclient.Client, chatID int64, text string, keyboard telegram.ReplyMarkup) int {
 	return sendMessage(bot, telegram.SendMessage{
 		ChatID:      chatID,
 		Text:        text,
@@ -249,7 +645,7 @@ func sendMessageWithKeyboard(bot *telegram.Bot, chatID int64, text string, keybo
 	})
 }
 
-func sendImageMessage(bot *telegram.Bot, chatID int64, imageUrl string, caption string) bool {
+func sendImageMessage(bot tgclient.Client, chatID int64, imageUrl string, caption string) bool {
 	u := fasthttp.AcquireURI()
 	defer fasthttp.ReleaseURI(u)
 	u.Update(imageUrl)
@@ -258,13 +654,13 @@ func sendImageMessage(bot *telegram.Bot, chatID int64, imageUrl string, caption
 		caption = caption[:200-3] + "..."
 	}
 
-	_, err := bot.SendPhoto(telegram.SendPhoto{
+	_, err := bot.SendPhoto(tgclient.SendPhoto{SendPhoto: telegram.SendPhoto{
 		ChatID:      chatID,
 		Photo:       &telegram.InputFile{URI: u},
 		Caption:     caption,
 		ParseMode:   telegram.ParseModeMarkdown,
 		ReplyMarkup: telegram.NewReplyKeyboardRemove(false),
-	})
+	}})
 	if err != nil {
 		log.Err(err).Msg("error when sending image message")
 		return false
@@ -272,7 +668,7 @@ func sendImageMessage(bot *telegram.Bot, chatID int64, imageUrl string, caption
 	return true
 }
 
-func sendImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, imageUrl string, caption string, keyboard telegram.ReplyMarkup) bool {
+func sendImageMessageWithKeyboard(bot tgclient.Client, chatID int64, imageUrl string, caption string, keyboard telegram.ReplyMarkup) bool {
 	u := fasthttp.AcquireURI()
 	defer fasthttp.ReleaseURI(u)
 	u.Update(imageUrl)
@@ -281,13 +677,13 @@ func sendImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, imageUrl stri
 		caption = caption[:200-3] + "..."
 	}
 
-	_, err := bot.SendPhoto(telegram.SendPhoto{
+	_, err := bot.SendPhoto(tgclient.SendPhoto{SendPhoto: telegram.SendPhoto{
 		ChatID:      chatID,
 		Photo:       &telegram.InputFile{URI: u},
 		Caption:     caption,
 		ParseMode:   telegram.ParseModeMarkdown,
-		ReplyMarkup: keyboard,
-	})
+		ReplyMarkup: withoutMissingButtons(keyboard),
+	}})
 	if err != nil {
 		log.Err(err).Msg("error when sending image message")
 		return false
@@ -298,11 +694,12 @@ func sendImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, imageUrl stri
 // Editing messages
 
 // editMessage edits a message and returns true if the message was edited successfully.
-func editMessage(bot *telegram.Bot, p *telegram.EditMessageText) bool {
+func editMessage(bot tgclient.Client, p *telegram.EditMessageText) bool {
 	if p.ParseMode == "" {
 		p.ParseMode = telegram.ParseModeMarkdown
 	}
 	p.DisableWebPagePreview = true
+	p.ReplyMarkup = dropMissingButtons(p.ReplyMarkup)
 
 	_, err := bot.EditMessageText(p)
 	if err != nil {
@@ -312,7 +709,7 @@ func editMessage(bot *telegram.Bot, p *telegram.EditMessageText) bool {
 	return true
 }
 
-func editSimpleMessage(bot *telegram.Bot, chatID int64, messageID int, text string) bool {
+func editSimpleMessage(bot tgclient.Client, chatID int64, messageID int, text string) bool {
 	return editMessage(bot, &telegram.EditMessageText{
 		ChatID:    chatID,
 		MessageID: messageID,
@@ -320,7 +717,7 @@ func editSimpleMessage(bot *telegram.Bot, chatID int64, messageID int, text stri
 	})
 }
 
-func editMessageWithKeyboard(bot *telegram.Bot, chatID int64, messageID int, text string, keyboard *telegram.InlineKeyboardMarkup) bool {
+func editMessageWithKeyboard(bot tgclient.Client, chatID int64, messageID int, text string, keyboard *telegram.InlineKeyboardMarkup) bool {
 	return editMessage(bot, &telegram.EditMessageText{
 		ChatID:      chatID,
 		MessageID:   messageID,
@@ -329,7 +726,7 @@ func editMessageWithKeyboard(bot *telegram.Bot, chatID int64, messageID int, tex
 	})
 }
 
-func editImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, messageID int, imageUrl string, caption string, keyboard *telegram.InlineKeyboardMarkup) bool {
+func editImageMessageWithKeyboard(bot tgclient.Client, chatID int64, messageID int, imageUrl string, caption string, keyboard *telegram.InlineKeyboardMarkup) bool {
 	u := fasthttp.AcquireURI()
 	defer fasthttp.ReleaseURI(u)
 	u.Update(imageUrl)
@@ -347,7 +744,7 @@ func editImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, messageID int
 			ParseMode: telegram.ParseModeMarkdown,
 			Type:      telegram.TypePhoto,
 		},
-		ReplyMarkup: keyboard,
+		ReplyMarkup: dropMissingButtons(keyboard),
 	})
 	if err != nil {
 		log.Err(err).Msg("error when updating image message")
@@ -358,31 +755,51 @@ func editImageMessageWithKeyboard(bot *telegram.Bot, chatID int64, messageID int
 
 // Printing messages
 
-func printHelp() string {
+// printHelp returns the commands the role can use.
+func printHelp(role authentication.Role) string {
 	str := "/help - 📋 Show commands list\n"
 
 	// movies
 	str += "\n🎬 *Movies*\n"
 	str += "/movies - Show the movies list\n"
-	str += "/addmovie - Add a movie\n"
+	if commandAllowed(role, "addmovie") {
+		str += "/addmovie - Add a movie\n"
+	}
 
 	// series
 	str += "\n📺 *Series*\n"
 	str += "/series - Show the series list\n"
-	str += "/addserie - Add a serie\n"
+	if commandAllowed(role, "addserie") {
+		str += "/addserie - Add a serie\n"
+	}
 
 	// commands
 	str += "\n🔧 *Commands*\n"
+	str += "/me - 👤 Show your role and your quota\n"
 	str += "/stop - 🛑 Cancel the current action\n"
 	str += "/status - 📊 Show the status of the server\n"
+	if commandAllowed(role, "admin") {
+		str += "/admin - 🔐 Show the admin menu\n"
+	}
+	if commandAllowed(role, "audit") {
+		str += "/audit - 📜 Show the actions of the users\n"
+	}
+	if commandAllowed(role, "allowchat") {
+		str += "/allowchat - 💬 Authorize the members of the group\n"
+		str += "/revokechat - Revoke the access of the group\n"
+	}
 
 	return str
 }
 
-func printMoviesList(list []radarr.Film) []string {
+func printMoviesList(list []radarr.Film, instanceName string) []string {
 	var messages []string
 
-	str := "🎬 *" + strconv.Itoa(len(list)) + " Movies*\n"
+	str := "🎬 *" + strconv.Itoa(len(list)) + " Movies*"
+	if instanceName != "" {
+		str += " _(" + instanceName + ")_"
+	}
+	str += "\n"
 	for _, film := range list {
 		sStr := "- *" + film.Title + "* (_" + strconv.Itoa(film.Year) + "_)\n"
 
@@ -398,10 +815,14 @@ func printMoviesList(list []radarr.Film) []string {
 	return messages
 }
 
-func printSeriesList(list []sonarr.Serie) []string {
+func printSeriesList(list []sonarr.Serie, instanceName string) []string {
 	var messages []string
 
-	str := "📺 *" + strconv.Itoa(len(list)) + " Series*\n"
+	str := "📺 *" + strconv.Itoa(len(list)) + " Series*"
+	if instanceName != "" {
+		str += " _(" + instanceName + ")_"
+	}
+	str += "\n"
 	for _, serie := range list {
 		sStr := "- *" + serie.Title + "* (_" + strconv.Itoa(serie.Year) + "_)\n"
 		for _, season := range serie.Seasons {
@@ -0,0 +1,1113 @@
+package updates
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"telarr/configuration"
+	"telarr/internal/arrstub"
+	"telarr/internal/audit"
+	"telarr/internal/authentication"
+	"telarr/internal/tgclient"
+	"testing"
+	"time"
+
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// testTimeout is the maximum time to wait for an answer of the bot.
+	testTimeout = 2 * time.Second
+)
+
+var (
+	testUser        = &telegram.User{ID: 1, Username: "user", FirstName: "User"}
+	testAdmin       = &telegram.User{ID: 2, Username: "admin", FirstName: "Admin"}
+	testBlacklisted = &telegram.User{ID: 3, Username: "blacklisted", FirstName: "Blacklisted"}
+	testNewUser     = &telegram.User{ID: 4, Username: "new", FirstName: "New"}
+	testViewer      = &telegram.User{ID: 5, Username: "viewer", FirstName: "Viewer"}
+	testRequester   = &telegram.User{ID: 6, Username: "requester", FirstName: "Requester"}
+)
+
+// startTestBot starts the bot with a fake telegram client, stopped at the end of the test.
+func startTestBot(t *testing.T, config configuration.Configuration) *tgclient.Fake {
+	t.Helper()
+
+	_, fake := startTestUpdates(t, config)
+	return fake
+}
+
+// startTestUpdates starts the bot like startTestBot, and returns the updates handler too.
+func startTestUpdates(t *testing.T, config configuration.Configuration) (*Updates, *tgclient.Fake) {
+	t.Helper()
+
+	config.Telegram.Token = "test-token"
+	if config.Requests.Path == "" {
+		config.Requests.Path = path.Join(t.TempDir(), "requests.json")
+	}
+	if config.Quotas.Path == "" {
+		config.Quotas.Path = path.Join(t.TempDir(), "quotas.json")
+	}
+	if config.Invites.Path == "" {
+		config.Invites.Path = path.Join(t.TempDir(), "invites.json")
+	}
+	if config.Audit.Path == "" {
+		config.Audit.Path = path.Join(t.TempDir(), "audit.jsonl")
+	}
+	store, err := authentication.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("authentication.NewJSONStore() error = %v", err)
+	}
+	lists := map[authentication.List][]authentication.User{
+		authentication.ListBlacklist: {{Id: testBlacklisted.ID, Username: testBlacklisted.Username}},
+		authentication.ListAutorized: {
+			{Id: testUser.ID, Username: testUser.Username, Role: authentication.RoleManager},
+			{Id: testAdmin.ID, Username: testAdmin.Username},
+			{Id: testViewer.ID, Username: testViewer.Username, Role: authentication.RoleViewer},
+			{Id: testRequester.ID, Username: testRequester.Username, Role: authentication.RoleRequester},
+		},
+		authentication.ListAdmins: {{Id: testAdmin.ID, Username: testAdmin.Username}},
+	}
+	for list, users := range lists {
+		err = store.SaveUsers(list, users)
+		if err != nil {
+			t.Fatalf("JSONStore.SaveUsers() error = %v", err)
+		}
+	}
+	auth, err := authentication.NewWithStore(config, store)
+	if err != nil {
+		t.Fatalf("authentication.NewWithStore() error = %v", err)
+	}
+
+	fake := tgclient.NewFake()
+	upd, err := newUpdates(config, fake, fake.Updates(), auth)
+	if err != nil {
+		t.Fatalf("newUpdates() error = %v", err)
+	}
+	upd.botUsername = tgclient.FakeBotUsername
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = upd.Start(ctx)
+	if err != nil {
+		t.Fatalf("Updates.Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		upd.Stop()
+	})
+
+	return upd, fake
+}
+
+// startArrStubs starts the radarr and sonarr stubs and points the configuration to them.
+func startArrStubs(t *testing.T, config *configuration.Configuration) (*arrstub.Radarr, *arrstub.Sonarr) {
+	t.Helper()
+
+	radarrStub, radarrConfig := startRadarrStub(t, "")
+	sonarrStub, sonarrConfig := startSonarrStub(t, "")
+	config.Radarr = configuration.Instances[configuration.Radarr]{radarrConfig}
+	config.Sonarr = configuration.Instances[configuration.Sonarr]{sonarrConfig}
+
+	return radarrStub, sonarrStub
+}
+
+// startRadarrStub starts a radarr stub and returns the configuration of the instance using it.
+func startRadarrStub(t *testing.T, name string) (*arrstub.Radarr, configuration.Radarr) {
+	t.Helper()
+
+	stub, err := arrstub.NewRadarr("stub")
+	if err != nil {
+		t.Fatalf("arrstub.NewRadarr() error = %v", err)
+	}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	return stub, configuration.Radarr{Name: name, Endpoint: srv.URL, ApiKey: "stub"}
+}
+
+// startSonarrStub starts a sonarr stub and returns the configuration of the instance using it.
+func startSonarrStub(t *testing.T, name string) (*arrstub.Sonarr, configuration.Sonarr) {
+	t.Helper()
+
+	stub, err := arrstub.NewSonarr("stub")
+	if err != nil {
+		t.Fatalf("arrstub.NewSonarr() error = %v", err)
+	}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	return stub, configuration.Sonarr{Name: name, Endpoint: srv.URL, ApiKey: "stub"}
+}
+
+// pressButton presses the button of the message containing the text.
+func pressButton(t *testing.T, fake *tgclient.Fake, from *telegram.User, m tgclient.FakeMessage, text string) {
+	t.Helper()
+
+	button, ok := m.Button(text)
+	if !ok {
+		t.Fatalf("no button %q in message %+v", text, m)
+	}
+	fake.InjectCallback(from, m, button.CallbackData)
+}
+
+// waitForMessages waits until the number of messages of the chat containing the text is reached.
+func waitForMessages(t *testing.T, fake *tgclient.Fake, chatID int64, text string, count int) {
+	t.Helper()
+
+	_, ok := fake.WaitForMessage(chatID, testTimeout, func(tgclient.FakeMessage) bool {
+		n := 0
+		for _, m := range fake.Messages(chatID) {
+			if strings.Contains(m.Text, text) {
+				n++
+			}
+		}
+		return n >= count
+	})
+	if !ok {
+		t.Fatalf("less than %d messages containing %q in chat %d: %+v", count, text, chatID, fake.Messages(chatID))
+	}
+}
+
+// waitForText waits for a message containing the text and fails the test if none is sent.
+func waitForText(t *testing.T, fake *tgclient.Fake, chatID int64, text string) tgclient.FakeMessage {
+	t.Helper()
+
+	m, ok := fake.WaitForText(chatID, testTimeout, text)
+	if !ok {
+		t.Fatalf("no message containing %q, messages = %+v", text, fake.Messages(chatID))
+	}
+	return m
+}
+
+func TestUpdates_Messages(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     *telegram.User
+		text     string
+		wantText string
+	}{
+		{
+			name:     "help",
+			from:     testUser,
+			text:     "/help",
+			wantText: "/addmovie - Add a movie",
+		},
+		{
+			name:     "unknown command",
+			from:     testUser,
+			text:     "/unknown",
+			wantText: "I don't understand this command.",
+		},
+		{
+			name:     "unknown message",
+			from:     testUser,
+			text:     "hello",
+			wantText: "I don't understand what you mean.",
+		},
+		{
+			name:     "add movie",
+			from:     testUser,
+			text:     "/addmovie",
+			wantText: "Please enter the name of the movie you want to add:",
+		},
+		{
+			name:     "stop",
+			from:     testUser,
+			text:     "/stop",
+			wantText: "Action canceled",
+		},
+		{
+			name:     "admin not administrator",
+			from:     testUser,
+			text:     "/admin",
+			wantText: "You are not allowed to do this.",
+		},
+		{
+			name:     "me",
+			from:     testUser,
+			text:     "/me",
+			wantText: "Role: manager\nQuota: unlimited ♾",
+		},
+		{
+			name:     "add movie viewer",
+			from:     testViewer,
+			text:     "/addmovie",
+			wantText: "Your role is *viewer*",
+		},
+		{
+			name:     "movies viewer",
+			from:     testViewer,
+			text:     "/movies",
+			wantText: "Movies",
+		},
+		{
+			name:     "admin",
+			from:     testAdmin,
+			text:     "/admin",
+			wantText: "Select an action:",
+		},
+		{
+			name:     "blacklisted",
+			from:     testBlacklisted,
+			text:     "/help",
+			wantText: "You are blacklisted!",
+		},
+		{
+			name:     "new user",
+			from:     testNewUser,
+			text:     "/help",
+			wantText: "Please enter the password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configuration.Configuration{}
+			startArrStubs(t, &config)
+			fake := startTestBot(t, config)
+
+			chatID := int64(tt.from.ID)
+			fake.InjectMessage(tt.from, chatID, tt.text)
+			if _, ok := fake.WaitForText(chatID, testTimeout, tt.wantText); !ok {
+				t.Errorf("no message containing %q, messages = %+v", tt.wantText, fake.Messages(chatID))
+			}
+		})
+	}
+}
+
+func TestUpdates_PasswordMessageDeleted(t *testing.T) {
+	fake := startTestBot(t, configuration.Configuration{})
+	chatID := int64(testNewUser.ID)
+
+	fake.InjectMessage(testNewUser, chatID, "/help")
+	waitForText(t, fake, chatID, "Please enter the password")
+
+	messageID := fake.InjectMessage(testNewUser, chatID, "wrong password")
+	waitForText(t, fake, chatID, "Wrong password ❌")
+	if !fake.UserMessageDeleted(chatID, messageID) {
+		t.Errorf("password message not deleted")
+	}
+}
+
+func TestUpdates_InvalidCallback(t *testing.T) {
+	fake := startTestBot(t, configuration.Configuration{})
+	chatID := int64(testAdmin.ID)
+
+	fake.InjectMessage(testAdmin, chatID, "/admin")
+	m, ok := fake.WaitForText(chatID, testTimeout, "Select an action:")
+	if !ok {
+		t.Fatalf("no admin keyboard, messages = %+v", fake.Messages(chatID))
+	}
+	if _, ok := m.Button(""); !ok {
+		t.Fatalf("admin message has no button")
+	}
+
+	// the content of the button can't be forged
+	fake.InjectCallback(testAdmin, m, "wakeOnLan|0|0|0|0|AAAAAAAA")
+	if _, ok := fake.WaitForText(chatID, testTimeout, "This button is not valid anymore."); !ok {
+		t.Errorf("forged callback not rejected, messages = %+v", fake.Messages(chatID))
+	}
+}
+
+func TestUpdates_AdminUsers(t *testing.T) {
+	fake := startTestBot(t, configuration.Configuration{})
+	chatID := int64(testAdmin.ID)
+
+	fake.InjectMessage(testAdmin, chatID, "/admin")
+	m := waitForText(t, fake, chatID, "Select an action:")
+	pressButton(t, fake, testAdmin, m, "Authorized users")
+
+	// the admins are marked with a star
+	m = waitForText(t, fake, chatID, "4 authorized users")
+	if _, ok := m.Button("⭐ @admin"); !ok {
+		t.Fatalf("admin not marked in message %+v", m)
+	}
+	pressButton(t, fake, testAdmin, m, "@viewer")
+	m = waitForText(t, fake, chatID, "Role: viewer")
+	for _, role := range []string{"requester", "manager", "admin ⭐"} {
+		if _, ok := m.Button(role); !ok {
+			t.Errorf("no %s role button in message %+v", role, m)
+		}
+	}
+
+	// an admin can't lock himself out
+	pressButton(t, fake, testAdmin, m, "Back")
+	m = waitForText(t, fake, chatID, "4 authorized users")
+	pressButton(t, fake, testAdmin, m, "⭐ @admin")
+	m = waitForText(t, fake, chatID, "Role: admin ⭐")
+	pressButton(t, fake, testAdmin, m, "viewer")
+	waitForText(t, fake, chatID, "You can't change your own access.")
+
+	// the buttons of the admins are rejected for the other users
+	pressButton(t, fake, testUser, m, "Revoke access")
+	waitForText(t, fake, chatID, "You are not allowed to do this.")
+}
+
+func TestUpdates_Invites(t *testing.T) {
+	fake := startTestBot(t, configuration.Configuration{})
+	chatID := int64(testAdmin.ID)
+
+	fake.InjectMessage(testAdmin, chatID, "/admin")
+	m := waitForText(t, fake, chatID, "Select an action:")
+	pressButton(t, fake, testAdmin, m, "Invite codes")
+	m = waitForText(t, fake, chatID, "0 invite codes")
+	pressButton(t, fake, testAdmin, m, "➕ viewer")
+
+	// without the username of the bot, the code is sent with /start
+	m = waitForText(t, fake, chatID, "Invite code created ✅")
+	code := regexp.MustCompile("/start ([A-Z0-9]+)").FindStringSubmatch(m.Text)
+	if code == nil {
+		t.Fatalf("no code in message %+v", m)
+	}
+	pressButton(t, fake, testAdmin, m, "Back")
+	m = waitForText(t, fake, chatID, "1 invite codes")
+	if !strings.Contains(m.Text, code[1]+"` viewer, 0/1 uses, expires in 168h") {
+		t.Errorf("code not listed in message %+v", m)
+	}
+	pressButton(t, fake, testAdmin, m, "Revoke "+code[1])
+	waitForText(t, fake, chatID, "0 invite codes")
+
+	// a revoked code doesn't give access, the user can still enter the password
+	newUserChatID := int64(testNewUser.ID)
+	fake.InjectMessage(testNewUser, newUserChatID, "/start "+code[1])
+	waitForText(t, fake, newUserChatID, "This invite code was revoked ❌")
+	waitForText(t, fake, newUserChatID, "Please enter the password or an invite code")
+
+	fake.InjectMessage(testNewUser, newUserChatID, "UNKNOWNCODE")
+	waitForText(t, fake, newUserChatID, "Wrong password ❌")
+}
+
+func TestUpdates_Claim(t *testing.T) {
+	upd, fake := startTestUpdates(t, configuration.Configuration{})
+	chatID := int64(testNewUser.ID)
+
+	// without claim code, /claim is handled like any message of a new user
+	fake.InjectMessage(testNewUser, chatID, "/claim")
+	waitForText(t, fake, chatID, "Please enter the password")
+
+	// a fresh install has no admin
+	err := upd.auth.SetRole(testAdmin.ID, authentication.RoleManager)
+	if err != nil {
+		t.Fatalf("Auth.SetRole() error = %v", err)
+	}
+	code, err := upd.auth.NewClaimCode()
+	if err != nil || code == "" {
+		t.Fatalf("Auth.NewClaimCode() = %q, error = %v", code, err)
+	}
+
+	fake.InjectMessage(testNewUser, chatID, "/claim WRONGCODE")
+	waitForText(t, fake, chatID, "Wrong claim code ❌")
+
+	fake.InjectMessage(testNewUser, chatID, "/claim "+code)
+	waitForText(t, fake, chatID, "You are now admin ⭐")
+	fake.InjectMessage(testNewUser, chatID, "/admin")
+	waitForText(t, fake, chatID, "Select an action:")
+
+	// the code is used once
+	userChatID := int64(testUser.ID)
+	fake.InjectMessage(testUser, userChatID, "/claim "+code)
+	waitForText(t, fake, userChatID, "I don't understand this command.")
+	if upd.auth.ClaimPending() {
+		t.Errorf("claim still pending after the claim")
+	}
+}
+
+func TestUpdates_GroupChat(t *testing.T) {
+	fake := startTestBot(t, configuration.Configuration{})
+	group := &telegram.Chat{ID: -100, Type: telegram.ChatSuperGroup, Title: "Family"}
+	adminChatID := int64(testAdmin.ID)
+	const threadID = 7
+
+	// the new users are sent to the private chat, without waiting for their password in the group
+	fake.InjectChatMessage(testNewUser, group, threadID, "/me", 0)
+	m := waitForText(t, fake, group.ID, "This group is not authorized.")
+	if m.ThreadID != threadID {
+		t.Errorf("answer sent to the topic %d, want %d", m.ThreadID, threadID)
+	}
+
+	// the messages for the other bots or for no one are ignored
+	fake.InjectChatMessage(testUser, group, threadID, "hello", 0)
+	fake.InjectChatMessage(testUser, group, threadID, "/me@other_bot", 0)
+	fake.InjectChatMessage(testUser, group, threadID, "/me@"+tgclient.FakeBotUsername, 0)
+	waitForText(t, fake, group.ID, "👤 *@user*")
+	if got := len(fake.Messages(group.ID)); got != 2 {
+		t.Errorf("%d messages in the group, want 2", got)
+	}
+
+	// only the admins authorize a group, and not as admins
+	fake.InjectChatMessage(testUser, group, threadID, "/allowchat", 0)
+	waitForText(t, fake, group.ID, "You are not allowed to do this.")
+	fake.InjectChatMessage(testAdmin, group, threadID, "/allowchat admin", 0)
+	waitForText(t, fake, group.ID, "The admin role can't be given to a whole group.")
+	fake.InjectChatMessage(testAdmin, group, threadID, "/allowchat requester", 0)
+	m = waitForText(t, fake, group.ID, "This group is now authorized ✅")
+
+	// the new users are members of the group, a mention or a reply is enough
+	fake.InjectChatMessage(testNewUser, group, threadID, "/me", 0)
+	waitForText(t, fake, group.ID, "👤 *@new*\nRole: requester")
+	fake.InjectChatMessage(testNewUser, group, threadID, "@"+tgclient.FakeBotUsername+" hello", 0)
+	waitForText(t, fake, group.ID, "I don't understand")
+	fake.InjectChatMessage(testNewUser, group, threadID, "hello", m.MessageID)
+	waitForMessages(t, fake, group.ID, "I don't understand", 2)
+
+	// the users keep their own role, and stay new users in the private chat
+	fake.InjectChatMessage(testViewer, group, threadID, "/me", 0)
+	waitForText(t, fake, group.ID, "👤 *@viewer*\nRole: viewer")
+	fake.InjectMessage(testNewUser, int64(testNewUser.ID), "/me")
+	waitForText(t, fake, int64(testNewUser.ID), "Please enter the password")
+
+	// the admins revoke the group from the admin menu
+	fake.InjectMessage(testAdmin, adminChatID, "/admin")
+	m = waitForText(t, fake, adminChatID, "Select an action:")
+	pressButton(t, fake, testAdmin, m, "Authorized groups")
+	m = waitForText(t, fake, adminChatID, "1 authorized groups")
+	pressButton(t, fake, testAdmin, m, "Revoke Family")
+	waitForText(t, fake, adminChatID, "0 authorized groups")
+	fake.InjectChatMessage(testRequester, group, 0, "/revokechat", 0)
+	waitForText(t, fake, group.ID, "You are not allowed to do this.")
+	fake.InjectChatMessage(testNewUser, group, 0, "/me", 0)
+	waitForMessages(t, fake, group.ID, "This group is not authorized.", 2)
+}
+
+func TestUpdates_RequestMovieInTopic(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	fake := startTestBot(t, config)
+	group := &telegram.Chat{ID: -100, Type: telegram.ChatSuperGroup, Title: "Family"}
+	adminChatID := int64(testAdmin.ID)
+	const threadID = 7
+
+	// the answers of a conversation in a topic don't need a mention
+	fake.InjectChatMessage(testRequester, group, threadID, "/addmovie", 0)
+	waitForText(t, fake, group.ID, "Please enter the name of the movie you want to add:")
+	fake.InjectChatMessage(testRequester, group, threadID, "Dune", 0)
+	m := waitForText(t, fake, group.ID, "Dune")
+	pressButton(t, fake, testRequester, m, "Add to Radarr")
+	waitForText(t, fake, group.ID, "Select the quality profile for the movie")
+	fake.InjectChatMessage(testRequester, group, threadID, "HD-1080p", 0)
+	m = waitForText(t, fake, group.ID, "Select the root folder for the movie")
+	pressButton(t, fake, testRequester, m, "/movies (")
+	waitForText(t, fake, group.ID, "was sent to the administrators")
+
+	// the outcome is sent to the topic of the request
+	m = waitForText(t, fake, adminChatID, "New request* from @requester")
+	pressButton(t, fake, testAdmin, m, "Approve")
+	m = waitForText(t, fake, group.ID, "Your request was approved ✅")
+	if m.ThreadID != threadID {
+		t.Errorf("outcome sent to the topic %d, want %d", m.ThreadID, threadID)
+	}
+	for _, m := range fake.Messages(group.ID) {
+		if m.ThreadID != threadID {
+			t.Errorf("message %q sent to the topic %d, want %d", m.Text, m.ThreadID, threadID)
+		}
+	}
+	for _, m := range fake.Messages(adminChatID) {
+		if m.ThreadID != 0 {
+			t.Errorf("message %q sent to the topic %d of the admin", m.Text, m.ThreadID)
+		}
+	}
+}
+
+func TestUpdates_AddMovie(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	config.Radarr[0].PublicUrl = "https://radarr.example.com"
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+
+	fake.InjectMessage(testUser, chatID, "Dune")
+	m := waitForText(t, fake, chatID, "Dune")
+	pressButton(t, fake, testUser, m, "Add to Radarr")
+
+	waitForText(t, fake, chatID, "Select the quality profile for the movie")
+	fake.InjectMessage(testUser, chatID, "HD-1080p")
+
+	// the stub has two root folders
+	m = waitForText(t, fake, chatID, "Select the root folder for the movie")
+	if _, ok := m.Button("/movies-4k (5120.00 GB free)"); !ok {
+		t.Fatalf("no root folder with its free space in message %+v", m)
+	}
+	pressButton(t, fake, testUser, m, "/movies (")
+	m = waitForText(t, fake, chatID, "added ✅")
+	if !strings.Contains(m.Text, "[View in Radarr](https://radarr.example.com/movie/438631)") {
+		t.Errorf("no link to radarr in the confirmation %q", m.Text)
+	}
+
+	// follow the download of the added movie
+	pressButton(t, fake, testUser, m, "Follow downloading status")
+	m = waitForText(t, fake, chatID, "*Status*")
+	if _, ok := m.Button("Stop refreshing"); !ok {
+		t.Fatalf("no stop refreshing button in message %+v", m)
+	}
+
+	pressButton(t, fake, testUser, m, "Stop refreshing")
+	_, ok := fake.WaitForMessage(chatID, testTimeout, func(edited tgclient.FakeMessage) bool {
+		_, follow := edited.Button("Follow downloading status")
+		return edited.MessageID == m.MessageID && edited.Edited > 0 && follow
+	})
+	if !ok {
+		t.Errorf("downloading status not stopped, messages = %+v", fake.Messages(chatID))
+	}
+}
+
+func TestUpdates_RequestMovie(t *testing.T) {
+	tests := []struct {
+		name         string
+		button       string
+		wantAdmin    string
+		wantReceived string
+	}{
+		{
+			name:         "approve",
+			button:       "Approve",
+			wantAdmin:    "✅ Approved by @admin",
+			wantReceived: "Your request was approved ✅",
+		},
+		{
+			name:         "reject",
+			button:       "Reject",
+			wantAdmin:    "❌ Rejected by @admin",
+			wantReceived: "was rejected ❌",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configuration.Configuration{}
+			startArrStubs(t, &config)
+			fake := startTestBot(t, config)
+			chatID := int64(testRequester.ID)
+			adminChatID := int64(testAdmin.ID)
+
+			fake.InjectMessage(testRequester, chatID, "/addmovie")
+			waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+			fake.InjectMessage(testRequester, chatID, "Dune")
+			m := waitForText(t, fake, chatID, "Dune")
+			pressButton(t, fake, testRequester, m, "Add to Radarr")
+			waitForText(t, fake, chatID, "Select the quality profile for the movie")
+			fake.InjectMessage(testRequester, chatID, "HD-1080p")
+			m = waitForText(t, fake, chatID, "Select the root folder for the movie")
+			pressButton(t, fake, testRequester, m, "/movies (")
+
+			// the movie is not added, the admins are asked
+			waitForText(t, fake, chatID, "was sent to the administrators")
+			m = waitForText(t, fake, adminChatID, "New request* from @requester")
+
+			// only the admins can handle the request
+			pressButton(t, fake, testRequester, m, tt.button)
+			waitForText(t, fake, adminChatID, "You are not allowed to do this.")
+
+			pressButton(t, fake, testAdmin, m, tt.button)
+			waitForText(t, fake, chatID, tt.wantReceived)
+			waitForText(t, fake, adminChatID, tt.wantAdmin)
+
+			// a request is handled once
+			pressButton(t, fake, testAdmin, m, tt.button)
+			waitForText(t, fake, adminChatID, "This request was already handled.")
+		})
+	}
+}
+
+func TestUpdates_Quota(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	config.Quotas.Roles = map[string]configuration.Quota{
+		"manager": {Movies: configuration.Limit{Max: 1, Period: 7 * 24 * time.Hour}},
+	}
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+	fake.InjectMessage(testUser, chatID, "Dune")
+	m := waitForText(t, fake, chatID, "Dune")
+	pressButton(t, fake, testUser, m, "Add to Radarr")
+	waitForText(t, fake, chatID, "Select the quality profile for the movie")
+	fake.InjectMessage(testUser, chatID, "HD-1080p")
+	m = waitForText(t, fake, chatID, "Select the root folder for the movie")
+	pressButton(t, fake, testUser, m, "/movies (")
+	waitForText(t, fake, chatID, "added ✅")
+
+	// the quota is used
+	fake.InjectMessage(testUser, chatID, "/me")
+	waitForText(t, fake, chatID, "🎬 1/1 movies per 7 days")
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "You have reached your quota of 1 movies per 7 days.")
+
+	// an admin gives the whole quota back
+	adminChatID := int64(testAdmin.ID)
+	fake.InjectMessage(testAdmin, adminChatID, "/admin")
+	m = waitForText(t, fake, adminChatID, "Select an action:")
+	pressButton(t, fake, testAdmin, m, "Authorized users")
+	m = waitForText(t, fake, adminChatID, "authorized users")
+	pressButton(t, fake, testAdmin, m, "@user")
+	m = waitForText(t, fake, adminChatID, "🎬 1/1 movies")
+	pressButton(t, fake, testAdmin, m, "Reset quota")
+	waitForText(t, fake, adminChatID, "Quota reset ✅")
+
+	fake.InjectMessage(testUser, chatID, "/me")
+	waitForText(t, fake, chatID, "🎬 0/1 movies per 7 days")
+}
+
+func TestUpdates_QuotaEstimatedSize(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	config.Quotas.Roles = map[string]configuration.Quota{
+		"manager": {Size: configuration.Limit{Max: 15, Period: 30 * 24 * time.Hour}},
+	}
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+	fake.InjectMessage(testUser, chatID, "Dune")
+	m := waitForText(t, fake, chatID, "Dune")
+	pressButton(t, fake, testUser, m, "Add to Radarr")
+	waitForText(t, fake, chatID, "Select the quality profile for the movie")
+	fake.InjectMessage(testUser, chatID, "HD-1080p")
+	m = waitForText(t, fake, chatID, "Select the root folder for the movie")
+	pressButton(t, fake, testUser, m, "/movies (")
+	waitForText(t, fake, chatID, "added ✅")
+
+	// the movie is not downloaded yet, it counts for its estimated size
+	fake.InjectMessage(testUser, chatID, "/me")
+	waitForText(t, fake, chatID, "💾 10.00/15 GB per 30 days\n\t📐 1 medias not downloaded yet")
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "A movie counts for 10 GB until it is downloaded, it is over your quota of 15 GB per 30 days.")
+}
+
+func TestUpdates_QuotaPendingRequest(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	config.Quotas.Roles = map[string]configuration.Quota{
+		"requester": {Movies: configuration.Limit{Max: 1, Period: 7 * 24 * time.Hour}},
+	}
+	fake := startTestBot(t, config)
+	chatID := int64(testRequester.ID)
+	adminChatID := int64(testAdmin.ID)
+
+	fake.InjectMessage(testRequester, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+	fake.InjectMessage(testRequester, chatID, "Dune")
+	m := waitForText(t, fake, chatID, "Dune")
+	pressButton(t, fake, testRequester, m, "Add to Radarr")
+	waitForText(t, fake, chatID, "Select the quality profile for the movie")
+	fake.InjectMessage(testRequester, chatID, "HD-1080p")
+	m = waitForText(t, fake, chatID, "Select the root folder for the movie")
+	pressButton(t, fake, testRequester, m, "/movies (")
+	waitForText(t, fake, chatID, "was sent to the administrators")
+	m = waitForText(t, fake, adminChatID, "New request* from @requester")
+
+	// the pending request is counted
+	fake.InjectMessage(testRequester, chatID, "/me")
+	waitForText(t, fake, chatID, "⏳ 1 pending requests counted")
+	fake.InjectMessage(testRequester, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "You have reached your quota of 1 movies per 7 days.")
+
+	// the request is counted once on approval
+	pressButton(t, fake, testAdmin, m, "Approve")
+	waitForText(t, fake, chatID, "Your request was approved ✅")
+	fake.InjectMessage(testRequester, chatID, "/me")
+	_, ok := fake.WaitForMessage(chatID, testTimeout, func(m tgclient.FakeMessage) bool {
+		return strings.Contains(m.Text, "🎬 1/1 movies per 7 days") && !strings.Contains(m.Text, "pending")
+	})
+	if !ok {
+		t.Errorf("approved request not counted once, messages = %+v", fake.Messages(chatID))
+	}
+}
+
+func TestUpdates_AddMovieAlreadyInLibrary(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+
+	fake.InjectMessage(testUser, chatID, "Inception")
+	m := waitForText(t, fake, chatID, "Already in your library ✅")
+	if _, ok := m.Button("Add to Radarr"); ok {
+		t.Errorf("movie of the library can be added again, message = %+v", m)
+	}
+}
+
+func TestUpdates_RemoveSerie(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/series")
+	m := waitForText(t, fake, chatID, "Breaking Bad")
+	pressButton(t, fake, testUser, m, "Remove serie")
+
+	waitForText(t, fake, chatID, "Select the serie")
+	fake.InjectMessage(testUser, chatID, "Breaking Bad")
+	m = waitForText(t, fake, chatID, "Are you sure you want to remove this serie from your library?")
+
+	pressButton(t, fake, testUser, m, "Confirm")
+	waitForText(t, fake, chatID, "removed successfully")
+
+	// the serie is not in the library anymore
+	fake.InjectMessage(testUser, chatID, "/series")
+	_, ok := fake.WaitForMessage(chatID, testTimeout, func(list tgclient.FakeMessage) bool {
+		return list.MessageID > m.MessageID && strings.Contains(list.Text, "The Office")
+	})
+	if !ok {
+		t.Fatalf("no series list, messages = %+v", fake.Messages(chatID))
+	}
+	for _, list := range fake.Messages(chatID) {
+		if list.MessageID > m.MessageID && strings.Contains(list.Text, "Breaking Bad") && strings.Contains(list.Text, "The Office") {
+			t.Errorf("removed serie still listed: %q", list.Text)
+		}
+	}
+}
+
+func TestUpdates_Audit(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	upd, fake := startTestUpdates(t, config)
+	chatID := int64(testUser.ID)
+	adminChatID := int64(testAdmin.ID)
+
+	// the removal is recorded
+	fake.InjectMessage(testUser, chatID, "/series")
+	m := waitForText(t, fake, chatID, "Breaking Bad")
+	pressButton(t, fake, testUser, m, "Remove serie")
+	waitForText(t, fake, chatID, "Select the serie")
+	fake.InjectMessage(testUser, chatID, "Breaking Bad")
+	m = waitForText(t, fake, chatID, "Are you sure you want to remove this serie from your library?")
+	pressButton(t, fake, testUser, m, "Confirm")
+	waitForText(t, fake, chatID, "removed successfully")
+
+	fake.InjectMessage(testAdmin, adminChatID, "/audit @user removeSerie")
+	m = waitForText(t, fake, adminChatID, "Audit log* (1 entries)")
+	if !strings.Contains(m.Text, "@user *removeSerie* Breaking Bad") {
+		t.Errorf("removal not listed in message %+v", m)
+	}
+
+	// the entries are paged from the newest
+	for i := 0; i < 12; i++ {
+		err := upd.auditor.log.Record(audit.Entry{UserId: testAdmin.ID, Username: testAdmin.Username, Action: audit.ActionWakeOnLan, Result: audit.ResultOk})
+		if err != nil {
+			t.Fatalf("Log.Record() error = %v", err)
+		}
+	}
+	fake.InjectMessage(testAdmin, adminChatID, "/audit 24h")
+	m = waitForText(t, fake, adminChatID, "Audit log* (13 entries)")
+	if !strings.Contains(m.Text, "page 1/2") || strings.Contains(m.Text, "removeSerie") {
+		t.Errorf("first page not shown in message %+v", m)
+	}
+	pressButton(t, fake, testAdmin, m, "Next ->")
+	waitForText(t, fake, adminChatID, "removeSerie")
+
+	fake.InjectMessage(testAdmin, adminChatID, "/audit yesterday")
+	waitForText(t, fake, adminChatID, "Usage: `/audit")
+
+	// the audit log is for the admins only
+	fake.InjectMessage(testUser, chatID, "/audit")
+	waitForText(t, fake, chatID, "You are not allowed to do this.")
+}
+
+func TestUpdates_RemoveSerieViewer(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	fake := startTestBot(t, config)
+	chatID := int64(testViewer.ID)
+
+	// the viewer can browse the series, not remove them
+	fake.InjectMessage(testViewer, chatID, "/series")
+	m := waitForText(t, fake, chatID, "Breaking Bad")
+	pressButton(t, fake, testViewer, m, "Remove serie")
+	waitForText(t, fake, chatID, "You are not allowed to do this.")
+}
+
+func TestUpdates_SeveralInstances(t *testing.T) {
+	_, radarrHD := startRadarrStub(t, "1080p")
+	_, radarr4K := startRadarrStub(t, "4K")
+	radarr4K.RootFolder = "/movies-4k"
+	config := configuration.Configuration{
+		Radarr: configuration.Instances[configuration.Radarr]{radarrHD, radarr4K},
+	}
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	// add the movie to the 4K instance
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	m := waitForText(t, fake, chatID, "Select the radarr instance to add the movie to:")
+	pressButton(t, fake, testUser, m, "4K")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+
+	fake.InjectMessage(testUser, chatID, "Dune")
+	m = waitForText(t, fake, chatID, "Dune")
+	pressButton(t, fake, testUser, m, "Add to Radarr")
+	waitForText(t, fake, chatID, "Select the quality profile for the movie")
+	fake.InjectMessage(testUser, chatID, "Ultra-HD")
+	waitForText(t, fake, chatID, "added ✅")
+
+	// the movie is only in the 4K library
+	tests := []struct {
+		name     string
+		instance string
+		wantDune bool
+	}{
+		{
+			name:     "1080p",
+			instance: "1080p",
+			wantDune: false,
+		},
+		{
+			name:     "4K",
+			instance: "4K",
+			wantDune: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.InjectMessage(testUser, chatID, "/movies")
+			m := waitForText(t, fake, chatID, "Select the radarr instance:")
+			pressButton(t, fake, testUser, m, tt.instance)
+
+			list, ok := fake.WaitForMessage(chatID, testTimeout, func(list tgclient.FakeMessage) bool {
+				return list.MessageID == m.MessageID && strings.Contains(list.Text, "("+tt.instance+")")
+			})
+			if !ok {
+				t.Fatalf("no movies list of %s, messages = %+v", tt.instance, fake.Messages(chatID))
+			}
+			if got := strings.Contains(list.Text, "Dune"); got != tt.wantDune {
+				t.Errorf("Dune in the list of %s = %v, want %v, list = %q", tt.instance, got, tt.wantDune, list.Text)
+			}
+		})
+	}
+}
+
+func TestUpdates_MediaDetailsLinks(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		button    string
+		media     string
+		wantLinks []string
+	}{
+		{
+			name:    "movie",
+			command: "/movies",
+			button:  "Show movie details",
+			media:   "The Matrix",
+			wantLinks: []string{
+				"[TMDb](https://www.themoviedb.org/movie/603)",
+				"[IMDb](https://www.imdb.com/title/tt0133093)",
+				"[View in Radarr](https://radarr.example.com/movie/603)",
+			},
+		},
+		{
+			name:    "serie",
+			command: "/series",
+			button:  "Show serie details",
+			media:   "Breaking Bad",
+			wantLinks: []string{
+				"[TVDb](https://www.thetvdb.com/dereferrer/series/81189)",
+				"[IMDb](https://www.imdb.com/title/tt0903747)",
+				"[View in Sonarr](https://sonarr.example.com/series/breaking-bad)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configuration.Configuration{}
+			startArrStubs(t, &config)
+			config.Radarr[0].PublicUrl = "https://radarr.example.com"
+			config.Sonarr[0].PublicUrl = "https://sonarr.example.com"
+			fake := startTestBot(t, config)
+			chatID := int64(testUser.ID)
+
+			fake.InjectMessage(testUser, chatID, tt.command)
+			m := waitForText(t, fake, chatID, tt.media)
+			pressButton(t, fake, testUser, m, tt.button)
+			waitForText(t, fake, chatID, "Select the")
+
+			fake.InjectMessage(testUser, chatID, tt.media)
+			m = waitForText(t, fake, chatID, "🔗")
+			for _, link := range tt.wantLinks {
+				if !strings.Contains(m.Text, link) {
+					t.Errorf("no link %q in the details %q", link, m.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdates_MovieDetailsActions(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	upd, fake := startTestUpdates(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/movies")
+	m := waitForText(t, fake, chatID, "The Matrix")
+	pressButton(t, fake, testUser, m, "Show movie details")
+	waitForText(t, fake, chatID, "Select the")
+	fake.InjectMessage(testUser, chatID, "The Matrix")
+	details := waitForText(t, fake, chatID, "*Monitored*: Yes")
+	detailsID := details.MessageID
+
+	// each action updates the details in place
+	steps := []struct {
+		button   string
+		wantText string
+	}{
+		{button: "Unmonitor", wantText: "The movie is not monitored anymore ✅"},
+		{button: "Monitor", wantText: "The movie is now monitored ✅"},
+		{button: "Quality profile", wantText: "Select the quality profile of the movie:"},
+		{button: "Ultra-HD", wantText: "Quality profile changed to *Ultra-HD* ✅"},
+		{button: "Search now", wantText: "Search started"},
+		{button: "Refresh & rescan", wantText: "Refresh and rescan started ✅"},
+	}
+	for _, step := range steps {
+		pressButton(t, fake, testUser, details, step.button)
+		details = waitForText(t, fake, chatID, step.wantText)
+		if details.MessageID != detailsID {
+			t.Fatalf("%s: details not updated in place, messages = %+v", step.button, fake.Messages(chatID))
+		}
+	}
+	if !strings.Contains(details.Text, "*Monitored*: Yes") {
+		t.Errorf("movie not monitored again in the details %q", details.Text)
+	}
+	for _, action := range []audit.Action{audit.ActionSearchMovie, audit.ActionRefreshMovie, audit.ActionEditMovie} {
+		_, total, err := upd.auditor.log.Query(audit.Filter{Action: action}, 0, 10)
+		if err != nil || total == 0 {
+			t.Errorf("Log.Query(%s) = %d entries, error = %v, want recorded", action, total, err)
+		}
+	}
+	pressButton(t, fake, testUser, details, "Quality profile")
+	details = waitForText(t, fake, chatID, "Select the quality profile of the movie:")
+	if _, ok := details.Button("Ultra-HD ✅"); !ok {
+		t.Errorf("quality profile of the movie not checked in message %+v", details)
+	}
+
+	// the viewers can only look at the details
+	pressButton(t, fake, testViewer, details, "Back")
+	_, ok := fake.WaitForMessage(chatID, testTimeout, func(edited tgclient.FakeMessage) bool {
+		_, search := edited.Button("Search now")
+		return edited.MessageID == detailsID && search
+	})
+	if !ok {
+		t.Fatalf("details not shown again, messages = %+v", fake.Messages(chatID))
+	}
+	pressButton(t, fake, testViewer, details, "Ultra-HD")
+	waitForText(t, fake, chatID, "You are not allowed to do this.")
+}
+
+func TestUpdates_SearchReleases(t *testing.T) {
+	config := configuration.Configuration{}
+	startArrStubs(t, &config)
+	fake := startTestBot(t, config)
+	chatID := int64(testUser.ID)
+
+	fake.InjectMessage(testUser, chatID, "/movies")
+	m := waitForText(t, fake, chatID, "The Matrix")
+	pressButton(t, fake, testUser, m, "Show movie details")
+	waitForText(t, fake, chatID, "Select the")
+	fake.InjectMessage(testUser, chatID, "The Matrix")
+	details := waitForText(t, fake, chatID, "🔗")
+
+	// the releases are listed 5 per page, with the reasons of the rejected ones
+	pressButton(t, fake, testUser, details, "Search releases")
+	m = waitForText(t, fake, chatID, "6 releases found")
+	for _, want := range []string{"The.Matrix.1999.1080p.BluRay.x264-STUB", "Bluray-1080p | 💾 8.00 GB | 🔍 Stub Torrents", "152 seeders", "usenet", "⚠️ Not enough seeders", "page 1/2"} {
+		if !strings.Contains(m.Text, want) {
+			t.Errorf("no %q in the releases %q", want, m.Text)
+		}
+	}
+	pressButton(t, fake, testUser, m, "Next ->")
+	m = waitForText(t, fake, chatID, "page 2/2")
+	if !strings.Contains(m.Text, "⚠️ Bluray-2160p is not wanted in profile") {
+		t.Errorf("no rejection in the releases %q", m.Text)
+	}
+
+	// the grabbed release is downloading
+	pressButton(t, fake, testUser, m, "⬇️ 6")
+	m = waitForText(t, fake, chatID, "Release grabbed ✅")
+	pressButton(t, fake, testUser, m, "Follow downloading status")
+	waitForText(t, fake, chatID, "*Status*")
+
+	// the viewers can't download the releases
+	pressButton(t, fake, testViewer, details, "Search releases")
+	waitForText(t, fake, chatID, "You are not allowed to do this.")
+}
+
+func TestUpdates_ReloadConfiguration(t *testing.T) {
+	configPath := t.TempDir()
+	t.Setenv("CONFIG_PATH", configPath)
+	writeConfig := func(content string) {
+		err := os.WriteFile(path.Join(configPath, "config.yaml"), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	_, radarrHD := startRadarrStub(t, "")
+	_, radarr4K := startRadarrStub(t, "4K")
+	upd, fake := startTestUpdates(t, configuration.Configuration{
+		Radarr: configuration.Instances[configuration.Radarr]{radarrHD},
+	})
+	chatID := int64(testUser.ID)
+
+	// a conversation started before the reload goes on after it
+	fake.InjectMessage(testUser, chatID, "/addmovie")
+	waitForText(t, fake, chatID, "Please enter the name of the movie you want to add:")
+
+	writeConfig(fmt.Sprintf(`
+telegram:
+    token: "test-token"
+radarr:
+    - name: "1080p"
+      apiKey: "stub"
+      endpoint: %q
+    - name: "4K"
+      apiKey: "stub"
+      endpoint: %q
+`, radarrHD.Endpoint, radarr4K.Endpoint))
+	err := upd.reloadConfiguration()
+	if err != nil {
+		t.Fatalf("Updates.reloadConfiguration() error = %v", err)
+	}
+
+	fake.InjectMessage(testUser, chatID, "Dune")
+	m := waitForText(t, fake, chatID, "Dune")
+	if _, ok := m.Button("Add to Radarr"); !ok {
+		t.Errorf("conversation lost after the reload, message = %+v", m)
+	}
+
+	fake.InjectMessage(testUser, chatID, "/movies")
+	waitForText(t, fake, chatID, "Select the radarr instance:")
+
+	// an invalid configuration is rejected
+	writeConfig(fmt.Sprintf(`
+telegram:
+    token: "test-token"
+radarr:
+    - name: "4K"
+      apiKey: "stub"
+      endpoint: %q
+    - name: "4K"
+      apiKey: "stub"
+      endpoint: %q
+    - name: "4K"
+      apiKey: "stub"
+      endpoint: %q
+`, radarrHD.Endpoint, radarr4K.Endpoint, radarr4K.Endpoint))
+	err = upd.reloadConfiguration()
+	if err == nil {
+		t.Fatalf("Updates.reloadConfiguration() error = nil, want the duplicated name")
+	}
+	if got := len(upd.services.Load().movies); got != 2 {
+		t.Errorf("radarr instances after the invalid reload = %d, want 2", got)
+	}
+}
@@ -0,0 +1,189 @@
+package updates
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"telarr/configuration"
+	"telarr/internal/tgclient"
+
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+	"gitlab.com/toby3d/telegram"
+)
+
+const (
+	// webhookSecretTokenHeader is the header in which telegram sends the secret token.
+	webhookSecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// webhookChannelSize is the size of the updates channel, same as the default limit of GetUpdates.
+	webhookChannelSize = 100
+)
+
+// newWebhookChannel starts a server on the listener and returns the channel where the received updates are sent.
+// The returned function shuts the server down, the requests waiting for room in the channel are answered with 503
+// so that telegram sends their updates again later.
+func newWebhookChannel(config configuration.Webhook, ln net.Listener) (tgclient.UpdatesChannel, func() error, error) {
+	u, err := url.Parse(config.Url)
+	if err != nil {
+		return nil, nil, err
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	updatesChan := make(tgclient.UpdatesChannel, webhookChannelSize)
+	// done is closed when the server is shut down, to release the handlers waiting for room in the channel
+	done := make(chan struct{})
+	var closeDone sync.Once
+
+	srv := &fasthttp.Server{
+		Name: "telarr",
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			if !ctx.IsPost() || string(ctx.Path()) != path {
+				log.Debug().Str("path", string(ctx.Path())).Str("method", string(ctx.Method())).Msg("unsupported webhook request")
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+				return
+			}
+
+			// check the secret token
+			if config.SecretToken != "" {
+				token := ctx.Request.Header.Peek(webhookSecretTokenHeader)
+				if subtle.ConstantTimeCompare(token, []byte(config.SecretToken)) != 1 {
+					log.Warn().Str("remoteAddr", ctx.RemoteAddr().String()).Msg("webhook request with wrong secret token")
+					ctx.SetStatusCode(fasthttp.StatusForbidden)
+					return
+				}
+			}
+
+			upd := new(tgclient.Update)
+			err := json.Unmarshal(ctx.PostBody(), upd)
+			if err != nil {
+				log.Err(err).Msg("error when parsing the webhook update")
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+				return
+			}
+
+			select {
+			case updatesChan <- upd:
+				ctx.SetStatusCode(fasthttp.StatusOK)
+			case <-done:
+				log.Debug().Int("updateId", upd.UpdateID).Msg("webhook update rejected, shutting down")
+				ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+			}
+		},
+	}
+
+	go func() {
+		var err error
+		if config.CertFile != "" && config.KeyFile != "" {
+			err = srv.ServeTLS(ln, config.CertFile, config.KeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil {
+			log.Err(err).Msg("error when serving the webhook")
+		}
+	}()
+
+	shutdown := func() error {
+		closeDone.Do(func() { close(done) })
+		return srv.Shutdown()
+	}
+
+	return updatesChan, shutdown, nil
+}
+
+// setWebhook registers the webhook url to telegram.
+// The certificate is uploaded when telarr serves the webhook itself with a (self-signed) certificate.
+func setWebhook(bot *tgclient.Bot, config configuration.Webhook) error {
+	var (
+		src []byte
+		err error
+	)
+	if config.CertFile != "" {
+		src, err = setWebhookWithCertificate(bot, config)
+	} else {
+		src, err = bot.Do(telegram.MethodSetWebhook, struct {
+			Url         string `json:"url"`
+			SecretToken string `json:"secret_token,omitempty"`
+		}{
+			Url:         config.Url,
+			SecretToken: config.SecretToken,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	err = json.Unmarshal(src, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return errors.New("error when setting the webhook: " + resp.Description)
+	}
+
+	return nil
+}
+
+// setWebhookWithCertificate calls setWebhook with the certificate as multipart form.
+// telegram.Bot.Upload can't be used as it names the form field after the file name instead of "certificate".
+func setWebhookWithCertificate(bot *tgclient.Bot, config configuration.Webhook) ([]byte, error) {
+	cert, err := os.ReadFile(config.CertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("certificate", filepath.Base(config.CertFile))
+	if err != nil {
+		return nil, err
+	}
+	_, err = part.Write(cert)
+	if err != nil {
+		return nil, err
+	}
+	err = w.WriteField("url", config.Url)
+	if err != nil {
+		return nil, err
+	}
+	if config.SecretToken != "" {
+		err = w.WriteField("secret_token", config.SecretToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI("https://api.telegram.org/bot" + bot.AccessToken + "/" + telegram.MethodSetWebhook)
+	req.Header.SetContentType(w.FormDataContentType())
+	req.SetBody(body.Bytes())
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	err = fasthttp.Do(req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), resp.Body()...), nil
+}
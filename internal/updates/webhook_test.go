@@ -0,0 +1,149 @@
+package updates
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"os"
+	"telarr/configuration"
+	"testing"
+	"time"
+)
+
+func TestNewWebhookChannel(t *testing.T) {
+	update, err := os.ReadFile("testdata/update_message.json")
+	if err != nil {
+		t.Fatalf("error reading recorded update: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	conf := configuration.Webhook{
+		Listen:      ln.Addr().String(),
+		Url:         "https://telarr.example.com/telegram",
+		SecretToken: "secret",
+	}
+	updatesChan, stop, err := newWebhookChannel(conf, ln)
+	if err != nil {
+		t.Fatalf("newWebhookChannel() error = %v", err)
+	}
+	defer stop()
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{
+			name:       "wrong path",
+			path:       "/other",
+			token:      "secret",
+			wantStatus: http.StatusNotFound,
+			wantUpdate: false,
+		},
+		{
+			name:       "wrong secret token",
+			path:       "/telegram",
+			token:      "wrong",
+			wantStatus: http.StatusForbidden,
+			wantUpdate: false,
+		},
+		{
+			name:       "ok",
+			path:       "/telegram",
+			token:      "secret",
+			wantStatus: http.StatusOK,
+			wantUpdate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://"+ln.Addr().String()+tt.path, bytes.NewReader(update))
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(webhookSecretTokenHeader, tt.token)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("error posting update: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+
+			select {
+			case upd := <-updatesChan:
+				if !tt.wantUpdate {
+					t.Fatalf("unexpected update %v", upd.UpdateID)
+				}
+				if !upd.IsMessage() || upd.Message.Text != "/movies" || upd.Message.From.ID != 123456789 {
+					t.Errorf("update not decoded correctly: %+v", upd.Message)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantUpdate {
+					t.Fatalf("no update received")
+				}
+			}
+		})
+	}
+}
+
+func TestNewWebhookChannel_Shutdown(t *testing.T) {
+	update, err := os.ReadFile("testdata/update_message.json")
+	if err != nil {
+		t.Fatalf("error reading recorded update: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	conf := configuration.Webhook{
+		Listen: ln.Addr().String(),
+		Url:    "https://telarr.example.com/telegram",
+	}
+	updatesChan, stop, err := newWebhookChannel(conf, ln)
+	if err != nil {
+		t.Fatalf("newWebhookChannel() error = %v", err)
+	}
+
+	// nobody reads the channel, the update after the full channel waits for room
+	for i := 0; i < cap(updatesChan); i++ {
+		updatesChan <- nil
+	}
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String()+"/telegram", "application/json", bytes.NewReader(update))
+		if err != nil {
+			t.Errorf("error posting update: %v", err)
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- stop()
+	}()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("stop() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("shutdown blocked by the waiting update")
+	}
+	if got := <-status; got != http.StatusServiceUnavailable {
+		t.Errorf("status = %v, want %v", got, http.StatusServiceUnavailable)
+	}
+}
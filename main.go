@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"syscall"
 	"telarr/configuration"
 	"telarr/internal/updates"
 
@@ -17,6 +18,12 @@ func main() {
 		os.Exit(ret)
 	}()
 
+	// run a command instead of the bot
+	if len(os.Args) > 1 {
+		ret = runCommand(os.Args[1:])
+		return
+	}
+
 	// get the log level
 	logLevel := os.Getenv("LOG_LEVEL")
 	if logLevel == "" {
@@ -42,9 +49,11 @@ func main() {
 	// creating the context
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// catching the signal interrupt
+	// catching the signal interrupt, and SIGHUP to reload the configuration
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
 	// handle updates
 	mess, err := updates.New(config)
@@ -61,7 +70,16 @@ func main() {
 	}
 
 	// wait for the signal interrupt
-	<-c
+wait:
+	for {
+		select {
+		case <-hup:
+			log.Info().Msg("SIGHUP received, reloading the configuration")
+			mess.Reload()
+		case <-c:
+			break wait
+		}
+	}
 	log.Info().Msg("signal interrupt received")
 	cancel()
 